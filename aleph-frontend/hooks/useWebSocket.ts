@@ -112,10 +112,15 @@ export function useWebSocket(url: string = 'ws://localhost:8081/ws'): UseWebSock
       setError('Debe iniciar sesión para usar el reproductor')
       return
     }
+    // streaming-ms toma el usuario y el plan del token de auth-ms, que es obligatorio
+    if (!session.user.backendToken) {
+      setError('La sesión no tiene token para usar el reproductor')
+      return
+    }
 
     try {
-      // Agregar el user_id como query parameter para autenticación
-      const wsUrl = `${url}?user_id=${encodeURIComponent(session.user.id)}`
+      // El navegador no permite headers en el WebSocket: el token va como query parameter
+      const wsUrl = `${url}?user_id=${encodeURIComponent(session.user.id)}&token=${encodeURIComponent(session.user.backendToken)}`
       wsRef.current = new WebSocket(wsUrl)
       
       wsRef.current.onopen = () => {
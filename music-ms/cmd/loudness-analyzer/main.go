@@ -0,0 +1,213 @@
+// loudness-analyzer mide la sonoridad (BS.1770) de los archivos de audio del catálogo y
+// la guarda en cada canción junto con las ganancias de pista y álbum.
+//
+//	loudness-analyzer -audio-dir /srv/audio
+//	loudness-analyzer -audio-base-url https://cdn.example.com/audio -force
+//
+// Se procesa por álbum: si falta alguna pista se vuelven a medir todas para que la
+// ganancia de álbum sea consistente. Se leen MP3 (el formato que sirve el catálogo) y WAV
+// (PCM o float); cualquier otro formato cuenta como error.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/angel/music-ms/internal/config"
+	"github.com/angel/music-ms/internal/db"
+	"github.com/angel/music-ms/internal/loudness"
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/service"
+)
+
+// audioSource resuelve la referencia de audio de una canción a un lector
+type audioSource struct {
+	dir     string
+	baseURL string
+	client  *http.Client
+}
+
+// open acepta URLs http(s) absolutas; las claves relativas (p. ej. de S3) se buscan en
+// el directorio local o se descargan desde la URL base
+func (a *audioSource) open(ref string) (io.ReadCloser, error) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return a.get(ref)
+	}
+	key := strings.TrimPrefix(ref, "/")
+	if a.dir != "" {
+		return os.Open(filepath.Join(a.dir, filepath.FromSlash(key)))
+	}
+	if a.baseURL != "" {
+		return a.get(strings.TrimSuffix(a.baseURL, "/") + "/" + key)
+	}
+	return nil, fmt.Errorf("clave %q sin -audio-dir ni -audio-base-url", ref)
+}
+
+func (a *audioSource) get(url string) (io.ReadCloser, error) {
+	resp, err := a.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// songAudioRef devuelve la referencia de audio de la canción (audio_url o, por compatibilidad, audio_path)
+func songAudioRef(song models.Song) string {
+	if song.AudioURL != "" {
+		return song.AudioURL
+	}
+	if song.S3Key != "" {
+		return song.S3Key
+	}
+	return song.AudioPath
+}
+
+// stats resume la ejecución
+type stats struct {
+	albums   int
+	analyzed int
+	skipped  int
+	failed   int
+}
+
+func main() {
+	audioDir := flag.String("audio-dir", os.Getenv("AUDIO_DIR"), "Directorio local con los archivos de audio (claves relativas)")
+	audioBaseURL := flag.String("audio-base-url", os.Getenv("AUDIO_BASE_URL"), "URL base para descargar las claves relativas")
+	reference := flag.Float64("reference", loudness.DefaultReferenceLUFS, "Nivel de referencia en LUFS para calcular las ganancias")
+	force := flag.Bool("force", false, "Volver a analizar canciones que ya tienen sonoridad")
+	albumID := flag.String("album", "", "Analizar solo este álbum")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found or error loading it. Using environment variables.")
+	}
+	cfg := config.LoadConfig()
+
+	client, err := db.ConnectMongoDB(cfg.MongoURI, cfg.MongoTimeout)
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	musicService := service.NewMusicService(client.Database(cfg.MongoDB), nil)
+	source := &audioSource{dir: *audioDir, baseURL: *audioBaseURL, client: &http.Client{Timeout: 5 * time.Minute}}
+	ctx := context.Background()
+
+	var albumIDs []primitive.ObjectID
+	if *albumID != "" {
+		id, err := primitive.ObjectIDFromHex(*albumID)
+		if err != nil {
+			log.Fatalf("ID de álbum inválido: %v", err)
+		}
+		albumIDs = []primitive.ObjectID{id}
+	} else {
+		albumIDs, err = musicService.GetAlbumIDsPendingLoudness(ctx, *force)
+		if err != nil {
+			log.Fatalf("Error buscando álbumes pendientes: %v", err)
+		}
+	}
+
+	var total stats
+	for _, id := range albumIDs {
+		total.albums++
+		if err := analyzeAlbum(ctx, musicService, source, id, *reference, &total); err != nil {
+			log.Printf("Álbum %s: %v", id.Hex(), err)
+		}
+	}
+	fmt.Printf("Álbumes: %d, canciones analizadas: %d, omitidas: %d, con error: %d\n",
+		total.albums, total.analyzed, total.skipped, total.failed)
+	if total.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// analyzeAlbum mide todas las pistas del álbum y guarda cada una con la ganancia de álbum
+func analyzeAlbum(ctx context.Context, musicService *service.MusicService, source *audioSource, albumID primitive.ObjectID, reference float64, total *stats) error {
+	songs, err := musicService.GetSongsByAlbumID(ctx, albumID)
+	if err != nil {
+		return err
+	}
+
+	var measured []models.Song
+	var results []*loudness.Result
+	for _, song := range songs {
+		result, err := analyzeSong(source, song)
+		switch {
+		case err == nil:
+			measured = append(measured, song)
+			results = append(results, result)
+		case errors.Is(err, loudness.ErrUnsupportedFormat):
+			// Ni MP3 ni WAV, o un MP3 sin tramas válidas: la pista queda sin normalizar
+			log.Printf("Sin analizar %s (%s): %v", song.ID.Hex(), song.Title, err)
+			total.failed++
+		case errors.Is(err, loudness.ErrTooQuiet), errors.Is(err, errNoAudio):
+			log.Printf("Omitida %s (%s): %v", song.ID.Hex(), song.Title, err)
+			total.skipped++
+		default:
+			log.Printf("Error analizando %s (%s): %v", song.ID.Hex(), song.Title, err)
+			total.failed++
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	albumLUFS, err := loudness.AlbumLoudness(results)
+	if err != nil {
+		return err
+	}
+	albumPeak := loudness.AlbumPeak(results)
+	now := time.Now()
+	for i, song := range measured {
+		result := results[i]
+		value := models.Loudness{
+			IntegratedLUFS: result.IntegratedLUFS,
+			PeakDBFS:       result.PeakDBFS,
+			TrackGainDB:    loudness.GainDB(result.IntegratedLUFS, reference),
+			AlbumGainDB:    loudness.GainDB(albumLUFS, reference),
+			AlbumPeakDBFS:  albumPeak,
+			ReferenceLUFS:  reference,
+			AnalyzedAt:     now,
+		}
+		if err := musicService.SetSongLoudness(ctx, song.ID, value); err != nil {
+			log.Printf("Error guardando sonoridad de %s: %v", song.ID.Hex(), err)
+			total.failed++
+			continue
+		}
+		log.Printf("%s (%s): %.2f LUFS, pico %.2f dBFS, ganancia pista %+.2f dB, álbum %+.2f dB",
+			song.ID.Hex(), song.Title, value.IntegratedLUFS, value.PeakDBFS, value.TrackGainDB, value.AlbumGainDB)
+		total.analyzed++
+	}
+	return nil
+}
+
+var errNoAudio = errors.New("sin archivo de audio")
+
+func analyzeSong(source *audioSource, song models.Song) (*loudness.Result, error) {
+	ref := songAudioRef(song)
+	if ref == "" {
+		return nil, errNoAudio
+	}
+	reader, err := source.open(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return loudness.Analyze(reader)
+}
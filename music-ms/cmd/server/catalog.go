@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	"github.com/angel/music-ms/internal/config"
+	"github.com/angel/music-ms/internal/db"
+	"github.com/angel/music-ms/internal/service"
+)
+
+// runExport vuelca el catálogo a un archivo JSON Lines por colección:
+//
+//	music-ms export -dir catalogo [-artist <id>,<id>] [-genre rock,indie]
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := flags.String("dir", "catalog", "Directorio donde escribir <colección>.jsonl")
+	artists := flags.String("artist", "", "Exportar solo estos artistas (IDs separados por comas)")
+	genres := flags.String("genre", "", "Exportar solo los artistas de estos géneros (nombres o slugs separados por comas)")
+	flags.Parse(args)
+
+	musicService, disconnect := connectCatalog()
+	defer disconnect()
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatalf("Error creando %s: %v", *dir, err)
+	}
+	writers := make(map[string]io.Writer)
+	var files []*os.File
+	var buffers []*bufio.Writer
+	for _, name := range service.CatalogCollections {
+		file, err := os.Create(filepath.Join(*dir, name+".jsonl"))
+		if err != nil {
+			log.Fatalf("Error creando el archivo de %s: %v", name, err)
+		}
+		buffer := bufio.NewWriter(file)
+		files, buffers = append(files, file), append(buffers, buffer)
+		writers[name] = buffer
+	}
+
+	filter := service.CatalogFilter{ArtistIDs: splitList(*artists), Genres: splitList(*genres)}
+	counts, err := musicService.ExportCatalog(context.Background(), writers, filter)
+	if err != nil {
+		log.Fatalf("Error exportando el catálogo: %v", err)
+	}
+	for i, file := range files {
+		if err := buffers[i].Flush(); err != nil {
+			log.Fatalf("Error escribiendo %s: %v", file.Name(), err)
+		}
+		if err := file.Close(); err != nil {
+			log.Fatalf("Error escribiendo %s: %v", file.Name(), err)
+		}
+	}
+
+	for _, name := range service.CatalogCollections {
+		fmt.Printf("%s: %d\n", name, counts[name])
+	}
+}
+
+// runImport carga un volcado de export; con -dry-run solo informa de lo que haría:
+//
+//	music-ms import -dir catalogo [-dry-run]
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := flags.String("dir", "catalog", "Directorio con los archivos <colección>.jsonl")
+	dryRun := flags.Bool("dry-run", false, "Validar e informar sin escribir nada")
+	flags.Parse(args)
+
+	musicService, disconnect := connectCatalog()
+	defer disconnect()
+
+	// Las colecciones sin archivo no se importan
+	readers := make(map[string]io.Reader)
+	for _, name := range service.CatalogCollections {
+		file, err := os.Open(filepath.Join(*dir, name+".jsonl"))
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Sin %s.jsonl, no se importan %s", name, name)
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Error abriendo el archivo de %s: %v", name, err)
+		}
+		defer file.Close()
+		readers[name] = bufio.NewReader(file)
+	}
+
+	report, err := musicService.ImportCatalog(context.Background(), readers, *dryRun)
+	if err != nil {
+		log.Fatalf("Error importando el catálogo: %v", err)
+	}
+
+	if report.DryRun {
+		fmt.Println("Simulación: no se ha escrito nada")
+	}
+	for _, name := range service.CatalogCollections {
+		if counts, ok := report.Counts[name]; ok {
+			fmt.Printf("%s: %d nuevos, %d actualizados, %d sin cambios, %d omitidos\n",
+				name, counts.Inserted, counts.Updated, counts.Unchanged, counts.Skipped)
+		}
+	}
+	for _, issue := range report.Issues {
+		fmt.Printf("%s.jsonl:%d %s [%s] %s\n", issue.Collection, issue.Line, issue.ID, issue.Kind, issue.Message)
+	}
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+// connectCatalog conecta con MongoDB como el servidor; devuelve el servicio y cómo desconectar
+func connectCatalog() (*service.MusicService, func()) {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found or error loading it. Using environment variables.")
+	}
+	cfg := config.LoadConfig()
+
+	client, err := db.ConnectMongoDB(cfg.MongoURI, cfg.MongoTimeout)
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	musicService := service.NewMusicService(client.Database(cfg.MongoDB), nil)
+	return musicService, func() { client.Disconnect(context.Background()) }
+}
+
+// splitList separa una lista de valores separados por comas, sin vacíos
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
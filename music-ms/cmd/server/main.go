@@ -18,6 +18,18 @@ import (
 )
 
 func main() {
+	// Subcomandos para mover el catálogo entre entornos; sin subcomando arranca el servidor
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		}
+	}
+
 	// Cargar variables de entorno
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found or error loading it. Using environment variables.")
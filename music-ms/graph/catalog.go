@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/angel/music-ms/internal/middleware"
+	"github.com/angel/music-ms/internal/service"
+)
+
+// CatalogWriteAuth exige "Authorization: Bearer <token>" en las mutaciones. Las consultas
+// no se ven afectadas. Con el token vacío las mutaciones quedan deshabilitadas.
+func CatalogWriteAuth(token string) graphql.OperationMiddleware {
+	return func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		operation := graphql.GetOperationContext(ctx)
+		if operation.Operation == nil || operation.Operation.Operation != ast.Mutation {
+			return next(ctx)
+		}
+
+		message := middleware.CatalogAuthError(operation.Headers.Get("Authorization"), token)
+		if message == "" {
+			return next(ctx)
+		}
+		return func(ctx context.Context) *graphql.Response {
+			return &graphql.Response{Errors: gqlerror.List{{
+				Message:    message,
+				Extensions: map[string]interface{}{"code": "UNAUTHORIZED"},
+			}}}
+		}
+	}
+}
+
+// catalogError traduce los errores del servicio a errores GraphQL con código
+func catalogError(err error) error {
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		return &gqlerror.Error{
+			Message:    validation.Error(),
+			Extensions: map[string]interface{}{"code": "BAD_USER_INPUT", "field": validation.Field},
+		}
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &gqlerror.Error{
+			Message:    "no encontrado",
+			Extensions: map[string]interface{}{"code": "NOT_FOUND"},
+		}
+	}
+	return err
+}
+
+// optionalList distingue una lista omitida (nil: no cambia) de una lista vacía
+func optionalList(values []string) *[]string {
+	if values == nil {
+		return nil
+	}
+	return &values
+}
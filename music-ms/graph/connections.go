@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/angel/music-ms/graph/model"
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/service"
+)
+
+// pageRequest convierte los argumentos first/after de una conexión. totalCount solo se
+// calcula si la consulta lo selecciona.
+func pageRequest(ctx context.Context, first *int, after *string) service.PageRequest {
+	req := service.PageRequest{}
+	for _, field := range graphql.CollectFieldsCtx(ctx, nil) {
+		if field.Name == "totalCount" {
+			req.Count = true
+		}
+	}
+	if first != nil {
+		req.First = *first
+	}
+	if after != nil {
+		req.After = *after
+	}
+	return req
+}
+
+func pageInfo[T any](page *service.Page[T]) *model.PageInfo {
+	info := &model.PageInfo{HasNextPage: page.HasNextPage, HasPreviousPage: page.HasPreviousPage}
+	if n := len(page.Cursors); n > 0 {
+		info.StartCursor = &page.Cursors[0]
+		info.EndCursor = &page.Cursors[n-1]
+	}
+	return info
+}
+
+func songConnection(page *service.Page[models.Song]) *model.SongConnection {
+	edges := make([]*model.SongEdge, len(page.Items))
+	for i := range page.Items {
+		edges[i] = &model.SongEdge{Cursor: page.Cursors[i], Node: songModel(&page.Items[i])}
+	}
+	return &model.SongConnection{Edges: edges, PageInfo: pageInfo(page), TotalCount: page.TotalCount}
+}
+
+func albumConnection(page *service.Page[models.Album]) *model.AlbumConnection {
+	edges := make([]*model.AlbumEdge, len(page.Items))
+	for i := range page.Items {
+		edges[i] = &model.AlbumEdge{Cursor: page.Cursors[i], Node: albumModel(&page.Items[i])}
+	}
+	return &model.AlbumConnection{Edges: edges, PageInfo: pageInfo(page), TotalCount: page.TotalCount}
+}
+
+func artistConnection(page *service.Page[models.Artist]) *model.ArtistConnection {
+	edges := make([]*model.ArtistEdge, len(page.Items))
+	for i := range page.Items {
+		edges[i] = &model.ArtistEdge{Cursor: page.Cursors[i], Node: artistModel(&page.Items[i])}
+	}
+	return &model.ArtistConnection{Edges: edges, PageInfo: pageInfo(page), TotalCount: page.TotalCount}
+}
+
+func genreConnection(page *service.Page[models.Genre]) *model.GenreConnection {
+	edges := make([]*model.GenreEdge, len(page.Items))
+	for i, g := range page.Items {
+		count := g.Count
+		edges[i] = &model.GenreEdge{Cursor: page.Cursors[i], Node: &model.Genre{
+			ID:    g.ID.Hex(),
+			Name:  g.Name,
+			Slug:  g.Slug,
+			Count: &count,
+		}}
+	}
+	return &model.GenreConnection{Edges: edges, PageInfo: pageInfo(page), TotalCount: page.TotalCount}
+}
+
+// songModel convierte una canción sin álbum ni artistas; los resolvers de Song los cargan si se piden
+func songModel(s *models.Song) *model.Song {
+	var albumID *string
+	if s.AlbumID != primitive.NilObjectID {
+		albumID = strPtr(s.AlbumID.Hex())
+	}
+	return &model.Song{
+		ID:               s.ID.Hex(),
+		Title:            s.Title,
+		Duration:         s.Duration,
+		SpotifyID:        strPtr(s.SpotifyID),
+		AlbumID:          albumID,
+		TrackNumber:      &s.TrackNumber,
+		AudioURL:         strPtr(s.AudioURL),
+		AvailableMarkets: s.AvailableMarkets,
+		AvailableFrom:    timePtr(s.AvailableFrom),
+		AvailableUntil:   timePtr(s.AvailableUntil),
+		Loudness:         loudnessModel(s.Loudness),
+		CreatedAt:        timePtr(&s.CreatedAt),
+		UpdatedAt:        timePtr(&s.UpdatedAt),
+	}
+}
+
+func albumModel(a *models.Album) *model.Album {
+	artistIDs := make([]string, len(a.ArtistIDs))
+	for i, id := range a.ArtistIDs {
+		artistIDs[i] = id.Hex()
+	}
+	return &model.Album{
+		ID:          a.ID.Hex(),
+		Title:       a.Title,
+		ReleaseDate: strPtr(a.ReleaseDate),
+		SpotifyID:   strPtr(a.SpotifyID),
+		ImageURL:    strPtr(a.ImageURL),
+		Year:        &a.Year,
+		ArtistIds:   artistIDs,
+		CreatedAt:   timePtr(&a.CreatedAt),
+		UpdatedAt:   timePtr(&a.UpdatedAt),
+	}
+}
+
+func artistModel(a *models.Artist) *model.Artist {
+	return &model.Artist{
+		ID:         a.ID.Hex(),
+		Name:       a.Name,
+		SpotifyID:  strPtr(a.SpotifyID),
+		ImageURL:   strPtr(a.ImageURL),
+		Genres:     a.Genres,
+		Popularity: &a.Popularity,
+		CreatedAt:  timePtr(&a.CreatedAt),
+		UpdatedAt:  timePtr(&a.UpdatedAt),
+	}
+}
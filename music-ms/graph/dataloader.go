@@ -0,0 +1,194 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/angel/music-ms/graph/model"
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/service"
+)
+
+// loaderWait es cuánto se esperan más claves antes de lanzar el lote. gqlgen resuelve
+// en paralelo los campos de una lista, así que casi todas llegan en este margen.
+// Es variable para que los tests no dependan de la velocidad de la máquina.
+var loaderWait = 2 * time.Millisecond
+
+// loaderMaxBatch evita $in desmesurados; un lote lleno se lanza sin esperar
+const loaderMaxBatch = 500
+
+// loaderTimeout limita cada consulta por lotes. El lote no usa el contexto de quien pidió
+// la primera clave: si esa petición se cancela, las demás que esperan el lote no deben fallar.
+var loaderTimeout = 10 * time.Second
+
+// batchLoader agrupa las claves pedidas durante loaderWait en una sola llamada a fetch y
+// recuerda los resultados durante la operación GraphQL
+type batchLoader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	results map[K]*loadResult[V]
+	batch   []K
+	timer   *time.Timer
+}
+
+type loadResult[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{fetch: fetch, results: make(map[K]*loadResult[V])}
+}
+
+// Load devuelve el valor de la clave o el valor cero si no existe. Si ctx se cancela deja
+// de esperar, pero el lote sigue para el resto.
+func (l *batchLoader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	result := l.enqueue(key)
+	select {
+	case <-result.done:
+		return result.value, result.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// LoadMany pide todas las claves en el mismo lote y devuelve los valores en el mismo orden
+func (l *batchLoader[K, V]) LoadMany(ctx context.Context, keys []K) ([]V, error) {
+	results := make([]*loadResult[V], len(keys))
+	for i, key := range keys {
+		results[i] = l.enqueue(key)
+	}
+	values := make([]V, len(keys))
+	for i, result := range results {
+		select {
+		case <-result.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		values[i] = result.value
+	}
+	return values, nil
+}
+
+func (l *batchLoader[K, V]) enqueue(key K) *loadResult[V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if result, ok := l.results[key]; ok {
+		return result
+	}
+
+	result := &loadResult[V]{done: make(chan struct{})}
+	l.results[key] = result
+	l.batch = append(l.batch, key)
+	if len(l.batch) >= loaderMaxBatch {
+		l.timer.Stop()
+		l.dispatchLocked()
+	} else if len(l.batch) == 1 {
+		l.timer = time.AfterFunc(loaderWait, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.dispatchLocked()
+		})
+	}
+	return result
+}
+
+// dispatchLocked lanza el lote pendiente; se llama con mu tomado
+func (l *batchLoader[K, V]) dispatchLocked() {
+	keys := l.batch
+	if len(keys) == 0 {
+		return
+	}
+	l.batch, l.timer = nil, nil
+
+	results := make([]*loadResult[V], len(keys))
+	for i, key := range keys {
+		results[i] = l.results[key]
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), loaderTimeout)
+		defer cancel()
+		values, err := l.fetch(ctx, keys)
+		for i, key := range keys {
+			results[i].value, results[i].err = values[key], err
+			close(results[i].done)
+		}
+	}()
+}
+
+// Loaders son los dataloaders de una operación GraphQL. Se crean por operación para que
+// ninguna respuesta vea datos cacheados de otra.
+type Loaders struct {
+	SongByID       *batchLoader[primitive.ObjectID, *models.Song]
+	AlbumByID      *batchLoader[primitive.ObjectID, *models.Album]
+	ArtistByID     *batchLoader[primitive.ObjectID, *models.Artist]
+	SongsByAlbum   *batchLoader[primitive.ObjectID, []models.Song]
+	AlbumsByArtist *batchLoader[primitive.ObjectID, []models.Album]
+	SongsByArtist  *batchLoader[primitive.ObjectID, []models.Song]
+}
+
+// NewLoaders crea los dataloaders sobre las consultas por lotes del servicio
+func NewLoaders(musicService *service.MusicService) *Loaders {
+	return &Loaders{
+		SongByID:       newBatchLoader(musicService.GetSongsByIDs),
+		AlbumByID:      newBatchLoader(musicService.GetAlbumsByIDs),
+		ArtistByID:     newBatchLoader(musicService.GetArtistsByIDs),
+		SongsByAlbum:   newBatchLoader(musicService.GetSongsByAlbumIDs),
+		AlbumsByArtist: newBatchLoader(musicService.GetAlbumsByArtistIDs),
+		SongsByArtist:  newBatchLoader(musicService.GetSongsByArtistIDs),
+	}
+}
+
+type loadersKey struct{}
+
+// DataLoaders añade unos Loaders nuevos al contexto de cada operación GraphQL
+func DataLoaders(musicService *service.MusicService) graphql.OperationMiddleware {
+	return func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return next(context.WithValue(ctx, loadersKey{}, NewLoaders(musicService)))
+	}
+}
+
+// loadersFor devuelve los Loaders de la operación; fuera de una operación (p. ej. si el
+// resolver se usa directamente) crea unos nuevos para no fallar
+func (r *Resolver) loadersFor(ctx context.Context) *Loaders {
+	if loaders, ok := ctx.Value(loadersKey{}).(*Loaders); ok {
+		return loaders
+	}
+	return NewLoaders(r.MusicService)
+}
+
+// loadArtists carga en un lote los artistas indicados, sin repetidos y omitiendo los que no existen
+func (r *Resolver) loadArtists(ctx context.Context, ids []string) ([]*model.Artist, error) {
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	var objectIDs []primitive.ObjectID
+	for _, id := range ids {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil || seen[objectID] {
+			continue
+		}
+		seen[objectID] = true
+		objectIDs = append(objectIDs, objectID)
+	}
+
+	artists, err := r.loadersFor(ctx).ArtistByID.LoadMany(ctx, objectIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Artist, 0, len(artists))
+	for _, artist := range artists {
+		if artist != nil {
+			result = append(result, artistModel(artist))
+		}
+	}
+	return result, nil
+}
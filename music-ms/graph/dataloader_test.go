@@ -0,0 +1,271 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/angel/music-ms/graph/model"
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/service"
+)
+
+// countingFetch simula una consulta $in sobre un mapa y cuenta cuántas veces se lanza
+type countingFetch[V any] struct {
+	mu    sync.Mutex
+	calls int
+	keys  int
+	data  map[primitive.ObjectID]V
+}
+
+func (f *countingFetch[V]) fetch(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]V, error) {
+	f.mu.Lock()
+	f.calls++
+	f.keys += len(keys)
+	f.mu.Unlock()
+	values := make(map[primitive.ObjectID]V, len(keys))
+	for _, key := range keys {
+		if value, ok := f.data[key]; ok {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func (f *countingFetch[V]) count() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls, f.keys
+}
+
+// serialized evita consultas simultáneas al servidor simulado de mtest, que no admite
+// concurrencia; no cambia cuántas consultas se lanzan
+func serialized[V any](mu *sync.Mutex, fetch func(context.Context, []primitive.ObjectID) (map[primitive.ObjectID]V, error)) func(context.Context, []primitive.ObjectID) (map[primitive.ObjectID]V, error) {
+	return func(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]V, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetch(ctx, keys)
+	}
+}
+
+func catalogDocument(t *testing.T, v interface{}) bson.D {
+	t.Helper()
+	data, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// Resolver album y artists de una página de 50 canciones debe costar una consulta por
+// relación, no una por canción. Se cuentan las órdenes que llegan al servidor simulado
+// (mtest las registra con un event.CommandMonitor), pasando por el servicio y el driver.
+func TestSongRelationsAreBatched(t *testing.T) {
+	// Con -race o una máquina cargada las 50 goroutines pueden tardar más de 2 ms en pedir
+	// sus claves; se amplía la espera para comprobar la agrupación y no la velocidad
+	previous := loaderWait
+	loaderWait = 50 * time.Millisecond
+	defer func() { loaderWait = previous }()
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("página de canciones", func(mt *mtest.T) {
+		const songCount = 50
+		// 5 álbumes con un artista cada uno; cada canción tiene además un artista invitado
+		var catalog []bson.D
+		var albumIDs []primitive.ObjectID
+		for i := 0; i < 5; i++ {
+			artist := models.Artist{ID: primitive.NewObjectID(), Name: "Artista"}
+			album := models.Album{ID: primitive.NewObjectID(), Title: "Álbum", ArtistIDs: []primitive.ObjectID{artist.ID}}
+			catalog = append(catalog, catalogDocument(mt.T, artist), catalogDocument(mt.T, album))
+			albumIDs = append(albumIDs, album.ID)
+		}
+		page := make([]*model.Song, songCount)
+		for i := range page {
+			guest := models.Artist{ID: primitive.NewObjectID(), Name: "Invitado"}
+			song := models.Song{ID: primitive.NewObjectID(), Title: "Canción", AlbumID: albumIDs[i%len(albumIDs)], ArtistIDs: []primitive.ObjectID{guest.ID}}
+			catalog = append(catalog, catalogDocument(mt.T, guest), catalogDocument(mt.T, song))
+			page[i] = songModel(&song)
+		}
+		// Cada find recibe el catálogo entero: el orden en que llegan las consultas no importa
+		// y cada loader se queda con los IDs que pidió. Una consulta de más se quedaría sin respuesta.
+		for i := 0; i < 3; i++ {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "music.catalog", mtest.FirstBatch, catalog...))
+		}
+
+		music := service.NewMusicService(mt.DB, nil)
+		var mu sync.Mutex
+		loaders := &Loaders{
+			SongByID:   newBatchLoader(serialized(&mu, music.GetSongsByIDs)),
+			AlbumByID:  newBatchLoader(serialized(&mu, music.GetAlbumsByIDs)),
+			ArtistByID: newBatchLoader(serialized(&mu, music.GetArtistsByIDs)),
+		}
+		ctx := context.WithValue(context.Background(), loadersKey{}, loaders)
+		resolver := &songResolver{&Resolver{MusicService: music}}
+
+		// gqlgen resuelve en paralelo los campos de cada elemento de la lista
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*songCount)
+		for _, song := range page {
+			song := song
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				album, err := resolver.Album(ctx, song)
+				if err == nil && album == nil {
+					err = errors.New("canción sin álbum")
+				}
+				errs <- err
+			}()
+			go func() {
+				defer wg.Done()
+				result, err := resolver.Artists(ctx, song)
+				if err == nil && len(result) != 2 {
+					err = errors.New("se esperaban el artista del álbum y el invitado")
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				mt.Fatal(err)
+			}
+		}
+
+		type roundTrips struct{ commands, keys int }
+		got := make(map[string]roundTrips)
+		for _, started := range mt.GetAllStartedEvents() {
+			collection := started.CommandName
+			keys := 0
+			if started.CommandName == "find" {
+				collection = started.Command.Lookup("find").StringValue()
+				values, _ := started.Command.Lookup("filter", "_id", "$in").Array().Values()
+				keys = len(values)
+			}
+			trips := got[collection]
+			trips.commands++
+			trips.keys += keys
+			got[collection] = trips
+		}
+		want := map[string]roundTrips{
+			"songs":   {1, songCount},
+			"albums":  {1, len(albumIDs)},
+			"artists": {1, len(albumIDs) + songCount},
+		}
+		if !reflect.DeepEqual(got, want) {
+			mt.Errorf("consultas a MongoDB (órdenes, claves en $in) = %v, se esperaba %v", got, want)
+		}
+	})
+}
+
+// El lote se lanza con su propio contexto: cancelar la petición que pidió la primera
+// clave no hace fallar a las demás que esperan el mismo lote
+func TestBatchLoaderOutlivesFirstCaller(t *testing.T) {
+	previous := loaderWait
+	loaderWait = 20 * time.Millisecond
+	defer func() { loaderWait = previous }()
+
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	deadlines := make(chan bool, 1)
+	loader := newBatchLoader(func(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return map[primitive.ObjectID]int{first: 1, second: 2}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := loader.Load(ctx, first)
+		firstErr <- err
+	}()
+	// Esperar a que la primera clave esté en el lote antes de cancelar su petición
+	for {
+		loader.mu.Lock()
+		queued := len(loader.batch)
+		loader.mu.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Load con la petición cancelada: error = %v, se esperaba %v", err, context.Canceled)
+	}
+
+	value, err := loader.Load(context.Background(), second)
+	if err != nil || value != 2 {
+		t.Errorf("Load = (%d, %v), se esperaba (2, nil)", value, err)
+	}
+	if !<-deadlines {
+		t.Error("el lote se lanzó sin plazo; se esperaba loaderTimeout")
+	}
+}
+
+func TestBatchLoader(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      int
+		repeat    bool // Pedir cada clave dos veces
+		wantCalls int
+	}{
+		{"un lote", 10, false, 1},
+		{"claves repetidas", 10, true, 1},
+		{"lotes llenos", 2*loaderMaxBatch + 1, false, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetch := &countingFetch[int]{data: make(map[primitive.ObjectID]int)}
+			var keys []primitive.ObjectID
+			for i := 0; i < tt.keys; i++ {
+				id := primitive.NewObjectID()
+				fetch.data[id] = i
+				keys = append(keys, id)
+				if tt.repeat {
+					keys = append(keys, id)
+				}
+			}
+			loader := newBatchLoader(fetch.fetch)
+			values, err := loader.LoadMany(context.Background(), keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, key := range keys {
+				if values[i] != fetch.data[key] {
+					t.Fatalf("valor %d = %d, se esperaba %d", i, values[i], fetch.data[key])
+				}
+			}
+			if calls, fetched := fetch.count(); calls != tt.wantCalls || fetched != tt.keys {
+				t.Errorf("%d llamadas con %d claves, se esperaban %d con %d", calls, fetched, tt.wantCalls, tt.keys)
+			}
+		})
+	}
+}
+
+func TestBatchLoaderError(t *testing.T) {
+	failure := errors.New("mongo caído")
+	loader := newBatchLoader(func(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+		return nil, failure
+	})
+	if _, err := loader.Load(context.Background(), primitive.NewObjectID()); !errors.Is(err, failure) {
+		t.Errorf("Load error = %v, se esperaba %v", err, failure)
+	}
+}
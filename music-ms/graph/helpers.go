@@ -1,5 +1,12 @@
 package graph
 
+import (
+	"time"
+
+	"github.com/angel/music-ms/graph/model"
+	"github.com/angel/music-ms/internal/models"
+)
+
 // strPtr es un helper para convertir un string a *string, devolviendo nil si está vacío.
 func strPtr(s string) *string {
 	if s == "" {
@@ -7,3 +14,29 @@ func strPtr(s string) *string {
 	}
 	return &s
 }
+
+// timePtr formatea una fecha opcional como RFC3339, devolviendo nil si no está definida.
+func timePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format("2006-01-02T15:04:05Z07:00")
+	return &formatted
+}
+
+// loudnessModel convierte la sonoridad guardada al tipo GraphQL, devolviendo nil si no hay medición.
+func loudnessModel(l *models.Loudness) *model.Loudness {
+	if l == nil {
+		return nil
+	}
+	analyzedAt := l.AnalyzedAt
+	return &model.Loudness{
+		IntegratedLufs: l.IntegratedLUFS,
+		PeakDbfs:       l.PeakDBFS,
+		TrackGainDb:    l.TrackGainDB,
+		AlbumGainDb:    l.AlbumGainDB,
+		AlbumPeakDbfs:  l.AlbumPeakDBFS,
+		ReferenceLufs:  l.ReferenceLUFS,
+		AnalyzedAt:     timePtr(&analyzedAt),
+	}
+}
@@ -2,31 +2,52 @@
 
 package model
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type Album struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	ReleaseDate *string   `json:"release_date,omitempty"`
-	SpotifyID   *string   `json:"spotify_id,omitempty"`
-	ImageURL    *string   `json:"image_url,omitempty"`
-	Year        *int      `json:"year,omitempty"`
-	CreatedAt   *string   `json:"created_at,omitempty"`
-	UpdatedAt   *string   `json:"updated_at,omitempty"`
-	ArtistIds   []string  `json:"artist_ids,omitempty"`
-	Songs       []*Song   `json:"songs,omitempty"`
-	Artists     []*Artist `json:"artists,omitempty"`
+	ID              string          `json:"id"`
+	Title           string          `json:"title"`
+	ReleaseDate     *string         `json:"release_date,omitempty"`
+	SpotifyID       *string         `json:"spotify_id,omitempty"`
+	ImageURL        *string         `json:"image_url,omitempty"`
+	Year            *int            `json:"year,omitempty"`
+	CreatedAt       *string         `json:"created_at,omitempty"`
+	UpdatedAt       *string         `json:"updated_at,omitempty"`
+	ArtistIds       []string        `json:"artist_ids,omitempty"`
+	Songs           []*Song         `json:"songs,omitempty"`
+	SongsConnection *SongConnection `json:"songsConnection"`
+	Artists         []*Artist       `json:"artists,omitempty"`
+}
+
+type AlbumConnection struct {
+	Edges      []*AlbumEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type AlbumEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Album `json:"node"`
 }
 
 type Artist struct {
-	ID         string   `json:"id"`
-	Name       string   `json:"name"`
-	SpotifyID  *string  `json:"spotify_id,omitempty"`
-	ImageURL   *string  `json:"image_url,omitempty"`
-	Genres     []string `json:"genres,omitempty"`
-	Popularity *int     `json:"popularity,omitempty"`
-	CreatedAt  *string  `json:"created_at,omitempty"`
-	UpdatedAt  *string  `json:"updated_at,omitempty"`
-	Albums     []*Album `json:"albums,omitempty"`
-	Songs      []*Song  `json:"songs,omitempty"`
+	ID               string           `json:"id"`
+	Name             string           `json:"name"`
+	SpotifyID        *string          `json:"spotify_id,omitempty"`
+	ImageURL         *string          `json:"image_url,omitempty"`
+	Genres           []string         `json:"genres,omitempty"`
+	Popularity       *int             `json:"popularity,omitempty"`
+	CreatedAt        *string          `json:"created_at,omitempty"`
+	UpdatedAt        *string          `json:"updated_at,omitempty"`
+	Albums           []*Album         `json:"albums,omitempty"`
+	Songs            []*Song          `json:"songs,omitempty"`
+	AlbumsConnection *AlbumConnection `json:"albumsConnection"`
+	SongsConnection  *SongConnection  `json:"songsConnection"`
 }
 
 type ArtistBasic struct {
@@ -42,6 +63,17 @@ type ArtistBasic struct {
 	SongCount  *int     `json:"song_count,omitempty"`
 }
 
+type ArtistConnection struct {
+	Edges      []*ArtistEdge `json:"edges"`
+	PageInfo   *PageInfo     `json:"pageInfo"`
+	TotalCount int           `json:"totalCount"`
+}
+
+type ArtistEdge struct {
+	Cursor string  `json:"cursor"`
+	Node   *Artist `json:"node"`
+}
+
 type Category struct {
 	ID       string   `json:"id"`
 	Name     string   `json:"name"`
@@ -50,6 +82,40 @@ type Category struct {
 	Genres   []*Genre `json:"genres"`
 }
 
+type CreateAlbumInput struct {
+	Title       string   `json:"title"`
+	ArtistIds   []string `json:"artist_ids"`
+	ReleaseDate *string  `json:"release_date,omitempty"`
+	Year        *int     `json:"year,omitempty"`
+	ImageURL    *string  `json:"image_url,omitempty"`
+	SpotifyID   *string  `json:"spotify_id,omitempty"`
+}
+
+type CreateArtistInput struct {
+	Name       string   `json:"name"`
+	Genres     []string `json:"genres,omitempty"`
+	ImageURL   *string  `json:"image_url,omitempty"`
+	Biography  *string  `json:"biography,omitempty"`
+	Popularity *int     `json:"popularity,omitempty"`
+	SpotifyID  *string  `json:"spotify_id,omitempty"`
+}
+
+type CreateGenreInput struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	ImageURL    *string `json:"image_url,omitempty"`
+}
+
+type CreateSongInput struct {
+	Title       string   `json:"title"`
+	Duration    int      `json:"duration"`
+	AlbumID     *string  `json:"album_id,omitempty"`
+	ArtistIds   []string `json:"artist_ids,omitempty"`
+	TrackNumber *int     `json:"track_number,omitempty"`
+	SpotifyID   *string  `json:"spotify_id,omitempty"`
+	AudioURL    *string  `json:"audio_url,omitempty"`
+}
+
 type Genre struct {
 	ID    string `json:"id"`
 	Name  string `json:"name"`
@@ -57,19 +123,180 @@ type Genre struct {
 	Count *int   `json:"count,omitempty"`
 }
 
+type GenreConnection struct {
+	Edges      []*GenreEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type GenreEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Genre `json:"node"`
+}
+
+type Loudness struct {
+	IntegratedLufs float64 `json:"integrated_lufs"`
+	PeakDbfs       float64 `json:"peak_dbfs"`
+	TrackGainDb    float64 `json:"track_gain_db"`
+	AlbumGainDb    float64 `json:"album_gain_db"`
+	AlbumPeakDbfs  float64 `json:"album_peak_dbfs"`
+	ReferenceLufs  float64 `json:"reference_lufs"`
+	AnalyzedAt     *string `json:"analyzed_at,omitempty"`
+}
+
+type LyricLine struct {
+	TimeMs int    `json:"time_ms"`
+	Text   string `json:"text"`
+}
+
+type Lyrics struct {
+	Language  string       `json:"language"`
+	Source    string       `json:"source"`
+	Plain     string       `json:"plain"`
+	Synced    bool         `json:"synced"`
+	Lines     []*LyricLine `json:"lines"`
+	UpdatedAt *string      `json:"updated_at,omitempty"`
+}
+
+type Mutation struct {
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
 type Query struct {
 }
 
+type SearchResult struct {
+	Type      SearchType `json:"type"`
+	Score     float64    `json:"score"`
+	Highlight string     `json:"highlight"`
+	Song      *Song      `json:"song,omitempty"`
+	Album     *Album     `json:"album,omitempty"`
+	Artist    *Artist    `json:"artist,omitempty"`
+}
+
 type Song struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Duration    int       `json:"duration"`
-	SpotifyID   *string   `json:"spotify_id,omitempty"`
-	AlbumID     *string   `json:"album_id,omitempty"`
-	TrackNumber *int      `json:"track_number,omitempty"`
-	AudioURL    *string   `json:"audio_url,omitempty"`
-	CreatedAt   *string   `json:"created_at,omitempty"`
-	UpdatedAt   *string   `json:"updated_at,omitempty"`
-	Album       *Album    `json:"album,omitempty"`
-	Artists     []*Artist `json:"artists,omitempty"`
+	ID               string    `json:"id"`
+	Title            string    `json:"title"`
+	Duration         int       `json:"duration"`
+	SpotifyID        *string   `json:"spotify_id,omitempty"`
+	AlbumID          *string   `json:"album_id,omitempty"`
+	TrackNumber      *int      `json:"track_number,omitempty"`
+	AudioURL         *string   `json:"audio_url,omitempty"`
+	AvailableMarkets []string  `json:"available_markets,omitempty"`
+	AvailableFrom    *string   `json:"available_from,omitempty"`
+	AvailableUntil   *string   `json:"available_until,omitempty"`
+	Loudness         *Loudness `json:"loudness,omitempty"`
+	Lyrics           *Lyrics   `json:"lyrics,omitempty"`
+	CreatedAt        *string   `json:"created_at,omitempty"`
+	UpdatedAt        *string   `json:"updated_at,omitempty"`
+	Album            *Album    `json:"album,omitempty"`
+	Artists          []*Artist `json:"artists,omitempty"`
+}
+
+type SongConnection struct {
+	Edges      []*SongEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount int         `json:"totalCount"`
+}
+
+type SongEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Song  `json:"node"`
+}
+
+type UpdateAlbumInput struct {
+	Title       *string  `json:"title,omitempty"`
+	ArtistIds   []string `json:"artist_ids,omitempty"`
+	ReleaseDate *string  `json:"release_date,omitempty"`
+	Year        *int     `json:"year,omitempty"`
+	ImageURL    *string  `json:"image_url,omitempty"`
+	SpotifyID   *string  `json:"spotify_id,omitempty"`
+}
+
+type UpdateArtistInput struct {
+	Name       *string  `json:"name,omitempty"`
+	Genres     []string `json:"genres,omitempty"`
+	ImageURL   *string  `json:"image_url,omitempty"`
+	Biography  *string  `json:"biography,omitempty"`
+	Popularity *int     `json:"popularity,omitempty"`
+	SpotifyID  *string  `json:"spotify_id,omitempty"`
+}
+
+type UpdateGenreInput struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	ImageURL    *string `json:"image_url,omitempty"`
+}
+
+type UpdateSongInput struct {
+	Title       *string  `json:"title,omitempty"`
+	Duration    *int     `json:"duration,omitempty"`
+	AlbumID     *string  `json:"album_id,omitempty"`
+	ArtistIds   []string `json:"artist_ids,omitempty"`
+	TrackNumber *int     `json:"track_number,omitempty"`
+	SpotifyID   *string  `json:"spotify_id,omitempty"`
+	AudioURL    *string  `json:"audio_url,omitempty"`
+}
+
+type SearchType string
+
+const (
+	SearchTypeSong   SearchType = "SONG"
+	SearchTypeAlbum  SearchType = "ALBUM"
+	SearchTypeArtist SearchType = "ARTIST"
+)
+
+var AllSearchType = []SearchType{
+	SearchTypeSong,
+	SearchTypeAlbum,
+	SearchTypeArtist,
+}
+
+func (e SearchType) IsValid() bool {
+	switch e {
+	case SearchTypeSong, SearchTypeAlbum, SearchTypeArtist:
+		return true
+	}
+	return false
+}
+
+func (e SearchType) String() string {
+	return string(e)
+}
+
+func (e *SearchType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchType", str)
+	}
+	return nil
+}
+
+func (e SearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *SearchType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e SearchType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
 }
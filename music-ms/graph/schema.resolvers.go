@@ -7,12 +7,266 @@ package graph
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/angel/music-ms/graph/generated"
 	"github.com/angel/music-ms/graph/model"
+	"github.com/angel/music-ms/internal/service"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Songs is the resolver for the songs field.
+func (r *albumResolver) Songs(ctx context.Context, obj *model.Album) ([]*model.Song, error) {
+	if len(obj.Songs) > 0 {
+		return obj.Songs, nil
+	}
+	albumID, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	songs, err := r.loadersFor(ctx).SongsByAlbum.Load(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Song, len(songs))
+	for i := range songs {
+		result[i] = songModel(&songs[i])
+	}
+	return result, nil
+}
+
+// SongsConnection is the resolver for the songsConnection field.
+func (r *albumResolver) SongsConnection(ctx context.Context, obj *model.Album, first *int, after *string) (*model.SongConnection, error) {
+	page, err := r.Resolver.MusicService.GetAlbumSongsPage(ctx, obj.ID, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return songConnection(page), nil
+}
+
+// Artists is the resolver for the artists field.
+func (r *albumResolver) Artists(ctx context.Context, obj *model.Album) ([]*model.Artist, error) {
+	if len(obj.Artists) > 0 {
+		return obj.Artists, nil
+	}
+	return r.loadArtists(ctx, obj.ArtistIds)
+}
+
+// Albums is the resolver for the albums field.
+func (r *artistResolver) Albums(ctx context.Context, obj *model.Artist) ([]*model.Album, error) {
+	if len(obj.Albums) > 0 {
+		return obj.Albums, nil
+	}
+	artistID, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	albums, err := r.loadersFor(ctx).AlbumsByArtist.Load(ctx, artistID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Album, len(albums))
+	for i := range albums {
+		result[i] = albumModel(&albums[i])
+	}
+	return result, nil
+}
+
+// Songs is the resolver for the songs field.
+func (r *artistResolver) Songs(ctx context.Context, obj *model.Artist) ([]*model.Song, error) {
+	if len(obj.Songs) > 0 {
+		return obj.Songs, nil
+	}
+	artistID, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	songs, err := r.loadersFor(ctx).SongsByArtist.Load(ctx, artistID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Song, len(songs))
+	for i := range songs {
+		result[i] = songModel(&songs[i])
+	}
+	return result, nil
+}
+
+// AlbumsConnection is the resolver for the albumsConnection field.
+func (r *artistResolver) AlbumsConnection(ctx context.Context, obj *model.Artist, first *int, after *string) (*model.AlbumConnection, error) {
+	page, err := r.Resolver.MusicService.GetArtistAlbumsPage(ctx, obj.ID, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return albumConnection(page), nil
+}
+
+// SongsConnection is the resolver for the songsConnection field.
+func (r *artistResolver) SongsConnection(ctx context.Context, obj *model.Artist, first *int, after *string) (*model.SongConnection, error) {
+	page, err := r.Resolver.MusicService.GetArtistSongsPage(ctx, obj.ID, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return songConnection(page), nil
+}
+
+// CreateSong is the resolver for the createSong field.
+func (r *mutationResolver) CreateSong(ctx context.Context, input model.CreateSongInput) (*model.Song, error) {
+	song, err := r.Resolver.MusicService.CreateSong(ctx, service.SongInput{
+		Title:       &input.Title,
+		Duration:    &input.Duration,
+		AlbumID:     input.AlbumID,
+		ArtistIDs:   optionalList(input.ArtistIds),
+		TrackNumber: input.TrackNumber,
+		SpotifyID:   input.SpotifyID,
+		AudioURL:    input.AudioURL,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Song(ctx, song.ID.Hex())
+}
+
+// UpdateSong is the resolver for the updateSong field.
+func (r *mutationResolver) UpdateSong(ctx context.Context, id string, input model.UpdateSongInput) (*model.Song, error) {
+	song, err := r.Resolver.MusicService.UpdateSong(ctx, id, service.SongInput{
+		Title:       input.Title,
+		Duration:    input.Duration,
+		AlbumID:     input.AlbumID,
+		ArtistIDs:   optionalList(input.ArtistIds),
+		TrackNumber: input.TrackNumber,
+		SpotifyID:   input.SpotifyID,
+		AudioURL:    input.AudioURL,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Song(ctx, song.ID.Hex())
+}
+
+// DeleteSong is the resolver for the deleteSong field.
+func (r *mutationResolver) DeleteSong(ctx context.Context, id string) (bool, error) {
+	if err := r.Resolver.MusicService.DeleteSong(ctx, id); err != nil {
+		return false, catalogError(err)
+	}
+	return true, nil
+}
+
+// CreateAlbum is the resolver for the createAlbum field.
+func (r *mutationResolver) CreateAlbum(ctx context.Context, input model.CreateAlbumInput) (*model.Album, error) {
+	album, err := r.Resolver.MusicService.CreateAlbum(ctx, service.AlbumInput{
+		Title:       &input.Title,
+		ArtistIDs:   &input.ArtistIds,
+		ReleaseDate: input.ReleaseDate,
+		Year:        input.Year,
+		ImageURL:    input.ImageURL,
+		SpotifyID:   input.SpotifyID,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Album(ctx, album.ID.Hex())
+}
+
+// UpdateAlbum is the resolver for the updateAlbum field.
+func (r *mutationResolver) UpdateAlbum(ctx context.Context, id string, input model.UpdateAlbumInput) (*model.Album, error) {
+	album, err := r.Resolver.MusicService.UpdateAlbum(ctx, id, service.AlbumInput{
+		Title:       input.Title,
+		ArtistIDs:   optionalList(input.ArtistIds),
+		ReleaseDate: input.ReleaseDate,
+		Year:        input.Year,
+		ImageURL:    input.ImageURL,
+		SpotifyID:   input.SpotifyID,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Album(ctx, album.ID.Hex())
+}
+
+// DeleteAlbum is the resolver for the deleteAlbum field.
+func (r *mutationResolver) DeleteAlbum(ctx context.Context, id string, deleteSongs *bool) (bool, error) {
+	if err := r.Resolver.MusicService.DeleteAlbum(ctx, id, deleteSongs != nil && *deleteSongs); err != nil {
+		return false, catalogError(err)
+	}
+	return true, nil
+}
+
+// CreateArtist is the resolver for the createArtist field.
+func (r *mutationResolver) CreateArtist(ctx context.Context, input model.CreateArtistInput) (*model.Artist, error) {
+	artist, err := r.Resolver.MusicService.CreateArtist(ctx, service.ArtistInput{
+		Name:       &input.Name,
+		Genres:     optionalList(input.Genres),
+		ImageURL:   input.ImageURL,
+		Biography:  input.Biography,
+		Popularity: input.Popularity,
+		SpotifyID:  input.SpotifyID,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Artist(ctx, artist.ID.Hex())
+}
+
+// UpdateArtist is the resolver for the updateArtist field.
+func (r *mutationResolver) UpdateArtist(ctx context.Context, id string, input model.UpdateArtistInput) (*model.Artist, error) {
+	artist, err := r.Resolver.MusicService.UpdateArtist(ctx, id, service.ArtistInput{
+		Name:       input.Name,
+		Genres:     optionalList(input.Genres),
+		ImageURL:   input.ImageURL,
+		Biography:  input.Biography,
+		Popularity: input.Popularity,
+		SpotifyID:  input.SpotifyID,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Artist(ctx, artist.ID.Hex())
+}
+
+// DeleteArtist is the resolver for the deleteArtist field.
+func (r *mutationResolver) DeleteArtist(ctx context.Context, id string) (bool, error) {
+	if err := r.Resolver.MusicService.DeleteArtist(ctx, id); err != nil {
+		return false, catalogError(err)
+	}
+	return true, nil
+}
+
+// CreateGenre is the resolver for the createGenre field.
+func (r *mutationResolver) CreateGenre(ctx context.Context, input model.CreateGenreInput) (*model.Genre, error) {
+	genre, err := r.Resolver.MusicService.CreateGenre(ctx, service.GenreInput{
+		Name:        &input.Name,
+		Description: input.Description,
+		ImageURL:    input.ImageURL,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Genre(ctx, genre.ID.Hex())
+}
+
+// UpdateGenre is the resolver for the updateGenre field.
+func (r *mutationResolver) UpdateGenre(ctx context.Context, id string, input model.UpdateGenreInput) (*model.Genre, error) {
+	genre, err := r.Resolver.MusicService.UpdateGenre(ctx, id, service.GenreInput{
+		Name:        input.Name,
+		Description: input.Description,
+		ImageURL:    input.ImageURL,
+	})
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return r.Query().Genre(ctx, genre.ID.Hex())
+}
+
+// DeleteGenre is the resolver for the deleteGenre field.
+func (r *mutationResolver) DeleteGenre(ctx context.Context, id string) (bool, error) {
+	if err := r.Resolver.MusicService.DeleteGenre(ctx, id); err != nil {
+		return false, catalogError(err)
+	}
+	return true, nil
+}
+
 // Songs is the resolver for the songs field.
 func (r *queryResolver) Songs(ctx context.Context) ([]*model.Song, error) {
 	songsData, err := r.Resolver.MusicService.GetSongs(ctx, 0, 0)
@@ -23,15 +277,19 @@ func (r *queryResolver) Songs(ctx context.Context) ([]*model.Song, error) {
 	var songs []*model.Song
 	for _, s := range songsData {
 		song := &model.Song{
-			ID:          s.Song.ID.Hex(),
-			Title:       s.Song.Title,
-			Duration:    s.Song.Duration,
-			SpotifyID:   strPtr(s.Song.SpotifyID),
-			AlbumID:     strPtr(s.Song.AlbumID.Hex()),
-			TrackNumber: &s.Song.TrackNumber,
-			AudioURL:    strPtr(s.Song.AudioURL),
-			CreatedAt:   strPtr(s.Song.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-			UpdatedAt:   strPtr(s.Song.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
+			ID:               s.Song.ID.Hex(),
+			Title:            s.Song.Title,
+			Duration:         s.Song.Duration,
+			SpotifyID:        strPtr(s.Song.SpotifyID),
+			AlbumID:          strPtr(s.Song.AlbumID.Hex()),
+			TrackNumber:      &s.Song.TrackNumber,
+			AudioURL:         strPtr(s.Song.AudioURL),
+			AvailableMarkets: s.Song.AvailableMarkets,
+			AvailableFrom:    timePtr(s.Song.AvailableFrom),
+			AvailableUntil:   timePtr(s.Song.AvailableUntil),
+			Loudness:         loudnessModel(s.Song.Loudness),
+			CreatedAt:        strPtr(s.Song.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
+			UpdatedAt:        strPtr(s.Song.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
 			Album: &model.Album{
 				ID:       s.Album.ID.Hex(),
 				Title:    s.Album.Title,
@@ -92,17 +350,21 @@ func (r *queryResolver) Song(ctx context.Context, id string) (*model.Song, error
 	}
 
 	return &model.Song{
-		ID:          song.Song.ID.Hex(),
-		Title:       song.Song.Title,
-		Duration:    song.Song.Duration,
-		SpotifyID:   strPtr(song.Song.SpotifyID),
-		AlbumID:     strPtr(albumID),
-		TrackNumber: &song.Song.TrackNumber,
-		AudioURL:    strPtr(song.Song.AudioURL),
-		CreatedAt:   strPtr(song.Song.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-		UpdatedAt:   strPtr(song.Song.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-		Album:       album,
-		Artists:     artists,
+		ID:               song.Song.ID.Hex(),
+		Title:            song.Song.Title,
+		Duration:         song.Song.Duration,
+		SpotifyID:        strPtr(song.Song.SpotifyID),
+		AlbumID:          strPtr(albumID),
+		TrackNumber:      &song.Song.TrackNumber,
+		AudioURL:         strPtr(song.Song.AudioURL),
+		AvailableMarkets: song.Song.AvailableMarkets,
+		AvailableFrom:    timePtr(song.Song.AvailableFrom),
+		AvailableUntil:   timePtr(song.Song.AvailableUntil),
+		Loudness:         loudnessModel(song.Song.Loudness),
+		CreatedAt:        strPtr(song.Song.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
+		UpdatedAt:        strPtr(song.Song.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
+		Album:            album,
+		Artists:          artists,
 	}, nil
 }
 
@@ -245,25 +507,7 @@ func (r *queryResolver) Artist(ctx context.Context, id string) (*model.Artist, e
 			})
 		}
 
-		// Obtener los artistas del álbum
-		var albumArtists []*model.Artist
-		for _, artistID := range a.ArtistIDs {
-			artistDetails, err := r.Resolver.MusicService.GetArtistByID(ctx, artistID)
-			if err != nil {
-				continue
-			}
-			albumArtists = append(albumArtists, &model.Artist{
-				ID:         artistDetails.ID.Hex(),
-				Name:       artistDetails.Name,
-				SpotifyID:  strPtr(artistDetails.SpotifyID),
-				ImageURL:   strPtr(artistDetails.ImageURL),
-				Genres:     artistDetails.Genres,
-				Popularity: &artistDetails.Popularity,
-				CreatedAt:  strPtr(artistDetails.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				UpdatedAt:  strPtr(artistDetails.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-			})
-		}
-
+		// Los artistas del álbum los carga el resolver de Album por lotes
 		albums = append(albums, &model.Album{
 			ID:          a.ID.Hex(),
 			Title:       a.Title,
@@ -275,7 +519,6 @@ func (r *queryResolver) Artist(ctx context.Context, id string) (*model.Artist, e
 			ArtistIds:   artistIDs,
 			ImageURL:    strPtr(a.ImageURL),
 			Songs:       albumSongs,
-			Artists:     albumArtists,
 		})
 	}
 
@@ -338,8 +581,7 @@ func (r *queryResolver) Genre(ctx context.Context, id string) (*model.Genre, err
 		return nil, err
 	}
 	var count *int
-	if v, ok := genreData["count"]; ok {
-		c := int(v.(int32))
+	if c, ok := genreData["count"].(int); ok {
 		count = &c
 	}
 	return &model.Genre{
@@ -409,116 +651,10 @@ func (r *queryResolver) ArtistsByGenre(ctx context.Context, genre string) ([]*mo
 	if err != nil {
 		return nil, err
 	}
-	var result []*model.Artist
-	for _, artist := range artists {
-		// Obtener detalles completos del artista (álbumes y canciones)
-		artistDetails, err := r.Resolver.MusicService.GetArtist(ctx, artist.ID.Hex())
-		if err != nil {
-			// Si falla, devolver solo los datos básicos
-			result = append(result, &model.Artist{
-				ID:         artist.ID.Hex(),
-				Name:       artist.Name,
-				SpotifyID:  strPtr(artist.SpotifyID),
-				ImageURL:   strPtr(artist.ImageURL),
-				Genres:     artist.Genres,
-				Popularity: &artist.Popularity,
-				CreatedAt:  strPtr(artist.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				UpdatedAt:  strPtr(artist.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-			})
-			continue
-		}
-
-		// Mapear álbumes
-		var albums []*model.Album
-		for _, a := range artistDetails.Albums {
-			artistIDs := make([]string, len(a.ArtistIDs))
-			for i, aid := range a.ArtistIDs {
-				artistIDs[i] = aid.Hex()
-			}
-
-			// Obtener detalles completos del álbum incluyendo canciones
-			albumDetails, err := r.Resolver.MusicService.GetAlbum(ctx, a.ID.Hex())
-			if err != nil {
-				continue
-			}
-
-			// Mapear las canciones del álbum
-			var albumSongs []*model.Song
-			for _, s := range albumDetails.Songs {
-				albumSongs = append(albumSongs, &model.Song{
-					ID:          s.ID.Hex(),
-					Title:       s.Title,
-					Duration:    s.Duration,
-					SpotifyID:   strPtr(s.SpotifyID),
-					AlbumID:     strPtr(s.AlbumID.Hex()),
-					TrackNumber: &s.TrackNumber,
-					AudioURL:    strPtr(s.AudioURL),
-					CreatedAt:   strPtr(s.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-					UpdatedAt:   strPtr(s.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				})
-			}
-
-			albums = append(albums, &model.Album{
-				ID:          a.ID.Hex(),
-				Title:       a.Title,
-				ReleaseDate: strPtr(a.ReleaseDate),
-				SpotifyID:   strPtr(a.SpotifyID),
-				Year:        &a.Year,
-				CreatedAt:   strPtr(a.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				UpdatedAt:   strPtr(a.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				ArtistIds:   artistIDs,
-				ImageURL:    strPtr(a.ImageURL),
-				Songs:       albumSongs,
-			})
-		}
-
-		// Mapear canciones
-		var songs []*model.Song
-		for _, s := range artistDetails.Songs {
-			// Obtener información del álbum para cada canción
-			var album *model.Album
-			if s.AlbumID != primitive.NilObjectID {
-				albumData, err := r.Resolver.MusicService.GetAlbum(ctx, s.AlbumID.Hex())
-				if err == nil {
-					album = &model.Album{
-						ID:          albumData.ID.Hex(),
-						Title:       albumData.Title,
-						ReleaseDate: strPtr(albumData.ReleaseDate),
-						SpotifyID:   strPtr(albumData.SpotifyID),
-						Year:        &albumData.Year,
-						CreatedAt:   strPtr(albumData.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-						UpdatedAt:   strPtr(albumData.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-						ImageURL:    strPtr(albumData.ImageURL),
-					}
-				}
-			}
-
-			songs = append(songs, &model.Song{
-				ID:          s.ID.Hex(),
-				Title:       s.Title,
-				Duration:    s.Duration,
-				SpotifyID:   strPtr(s.SpotifyID),
-				AlbumID:     strPtr(s.AlbumID.Hex()),
-				TrackNumber: &s.TrackNumber,
-				AudioURL:    strPtr(s.AudioURL),
-				CreatedAt:   strPtr(s.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				UpdatedAt:   strPtr(s.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-				Album:       album,
-			})
-		}
-
-		result = append(result, &model.Artist{
-			ID:         artistDetails.ID.Hex(),
-			Name:       artistDetails.Name,
-			SpotifyID:  strPtr(artistDetails.SpotifyID),
-			ImageURL:   strPtr(artistDetails.ImageURL),
-			Genres:     artistDetails.Genres,
-			Popularity: &artistDetails.Popularity,
-			CreatedAt:  strPtr(artistDetails.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
-			UpdatedAt:  strPtr(artistDetails.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")),
-			Albums:     albums,
-			Songs:      songs,
-		})
+	// Los álbumes y canciones se cargan por lotes en los resolvers de Artist solo si se piden
+	result := make([]*model.Artist, len(artists))
+	for i := range artists {
+		result[i] = artistModel(&artists[i])
 	}
 	return result, nil
 }
@@ -580,7 +716,191 @@ func (r *queryResolver) ArtistsByGenreCount(ctx context.Context, genre string) (
 	return count, nil
 }
 
+// SongsConnection is the resolver for the songsConnection field.
+func (r *queryResolver) SongsConnection(ctx context.Context, first *int, after *string) (*model.SongConnection, error) {
+	page, err := r.Resolver.MusicService.GetSongsPage(ctx, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return songConnection(page), nil
+}
+
+// AlbumsConnection is the resolver for the albumsConnection field.
+func (r *queryResolver) AlbumsConnection(ctx context.Context, first *int, after *string) (*model.AlbumConnection, error) {
+	page, err := r.Resolver.MusicService.GetAlbumsPage(ctx, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return albumConnection(page), nil
+}
+
+// ArtistsConnection is the resolver for the artistsConnection field.
+func (r *queryResolver) ArtistsConnection(ctx context.Context, first *int, after *string) (*model.ArtistConnection, error) {
+	page, err := r.Resolver.MusicService.GetArtistsPage(ctx, "", pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return artistConnection(page), nil
+}
+
+// GenresConnection is the resolver for the genresConnection field.
+func (r *queryResolver) GenresConnection(ctx context.Context, first *int, after *string) (*model.GenreConnection, error) {
+	page, err := r.Resolver.MusicService.GetGenresPage(ctx, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return genreConnection(page), nil
+}
+
+// ArtistsByGenreConnection is the resolver for the artistsByGenreConnection field.
+func (r *queryResolver) ArtistsByGenreConnection(ctx context.Context, genre string, first *int, after *string) (*model.ArtistConnection, error) {
+	page, err := r.Resolver.MusicService.GetArtistsPage(ctx, genre, pageRequest(ctx, first, after))
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return artistConnection(page), nil
+}
+
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, query string, types []model.SearchType, limit *int) ([]*model.SearchResult, error) {
+	serviceTypes := make([]string, len(types))
+	for i, t := range types {
+		serviceTypes[i] = strings.ToLower(t.String())
+	}
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	response, err := r.Resolver.MusicService.Search(ctx, query, serviceTypes, n)
+	if err != nil {
+		return nil, catalogError(err)
+	}
+
+	hits := make([]*model.SearchResult, len(response.Results))
+	for i, result := range response.Results {
+		hit := &model.SearchResult{
+			Type:      model.SearchType(strings.ToUpper(result.Type)),
+			Score:     result.Score,
+			Highlight: result.Highlight,
+		}
+		switch {
+		case result.Song != nil:
+			hit.Song = songModel(result.Song)
+		case result.Album != nil:
+			hit.Album = albumModel(result.Album)
+		case result.Artist != nil:
+			hit.Artist = artistModel(result.Artist)
+		}
+		hits[i] = hit
+	}
+	return hits, nil
+}
+
+// DidYouMean is the resolver for the didYouMean field.
+func (r *queryResolver) DidYouMean(ctx context.Context, query string) (*string, error) {
+	corrected := r.Resolver.MusicService.DidYouMean(query)
+	if corrected == "" {
+		return nil, nil
+	}
+	return &corrected, nil
+}
+
+// Lyrics is the resolver for the lyrics field.
+func (r *songResolver) Lyrics(ctx context.Context, obj *model.Song, language *string) (*model.Lyrics, error) {
+	lang := ""
+	if language != nil {
+		lang = strings.ToLower(*language)
+	}
+	lyrics, err := r.Resolver.MusicService.GetLyrics(ctx, obj.ID, lang)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]*model.LyricLine, len(lyrics.Lines))
+	for i, line := range lyrics.Lines {
+		lines[i] = &model.LyricLine{TimeMs: line.TimeMs, Text: line.Text}
+	}
+	return &model.Lyrics{
+		Language:  lyrics.Language,
+		Source:    lyrics.Source,
+		Plain:     lyrics.Plain,
+		Synced:    lyrics.Synced,
+		Lines:     lines,
+		UpdatedAt: timePtr(&lyrics.UpdatedAt),
+	}, nil
+}
+
+// Album is the resolver for the album field.
+func (r *songResolver) Album(ctx context.Context, obj *model.Song) (*model.Album, error) {
+	// Se carga por album_id aunque venga un álbum parcial, para tener todos sus campos
+	if obj.AlbumID == nil || *obj.AlbumID == "" {
+		return obj.Album, nil
+	}
+	albumID, err := primitive.ObjectIDFromHex(*obj.AlbumID)
+	if err != nil {
+		return nil, err
+	}
+	album, err := r.loadersFor(ctx).AlbumByID.Load(ctx, albumID)
+	if err != nil || album == nil {
+		return nil, err
+	}
+	return albumModel(album), nil
+}
+
+// Artists is the resolver for the artists field.
+func (r *songResolver) Artists(ctx context.Context, obj *model.Song) ([]*model.Artist, error) {
+	if len(obj.Artists) > 0 {
+		return obj.Artists, nil
+	}
+	songID, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return []*model.Artist{}, nil
+	}
+
+	// Artistas del álbum y, después, los propios de la canción
+	loaders := r.loadersFor(ctx)
+	song, err := loaders.SongByID.Load(ctx, songID)
+	if err != nil || song == nil {
+		return []*model.Artist{}, err
+	}
+	var artistIDs []string
+	if song.AlbumID != primitive.NilObjectID {
+		album, err := loaders.AlbumByID.Load(ctx, song.AlbumID)
+		if err != nil {
+			return nil, err
+		}
+		if album != nil {
+			for _, id := range album.ArtistIDs {
+				artistIDs = append(artistIDs, id.Hex())
+			}
+		}
+	}
+	for _, id := range song.ArtistIDs {
+		artistIDs = append(artistIDs, id.Hex())
+	}
+	return r.loadArtists(ctx, artistIDs)
+}
+
+// Album returns generated.AlbumResolver implementation.
+func (r *Resolver) Album() generated.AlbumResolver { return &albumResolver{r} }
+
+// Artist returns generated.ArtistResolver implementation.
+func (r *Resolver) Artist() generated.ArtistResolver { return &artistResolver{r} }
+
+// Mutation returns generated.MutationResolver implementation.
+func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
+
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Song returns generated.SongResolver implementation.
+func (r *Resolver) Song() generated.SongResolver { return &songResolver{r} }
+
+type albumResolver struct{ *Resolver }
+type artistResolver struct{ *Resolver }
+type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type songResolver struct{ *Resolver }
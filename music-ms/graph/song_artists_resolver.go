@@ -1,3 +0,0 @@
-package graph
-
-// Artists resolver for songs is implemented in song_custom_resolver.go
\ No newline at end of file
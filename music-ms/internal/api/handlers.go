@@ -1,8 +1,8 @@
 package api
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -18,7 +18,10 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
+	lyricsparser "github.com/angel/music-ms/internal/lyrics"
+	"github.com/angel/music-ms/internal/metadata"
 	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/search"
 	"github.com/angel/music-ms/internal/service"
 )
 
@@ -26,13 +29,17 @@ import (
 type Handler struct {
 	musicService   *service.MusicService
 	spotifyService *service.SpotifyService
+	importJobs     *service.ImportJobService
+	refresher      *service.RefreshService
 }
 
 // NewHandler crea un nuevo handler
-func NewHandler(musicService *service.MusicService, spotifyService *service.SpotifyService) *Handler {
+func NewHandler(musicService *service.MusicService, spotifyService *service.SpotifyService, importJobs *service.ImportJobService, refresher *service.RefreshService) *Handler {
 	return &Handler{
 		musicService:   musicService,
 		spotifyService: spotifyService,
+		importJobs:     importJobs,
+		refresher:      refresher,
 	}
 }
 
@@ -106,198 +113,249 @@ func ImportArtistHandler(spotifyClient *spotify.Client, db DatabaseInterface) gi
 	}
 }
 
-// ImportArtistFromSpotify maneja la petición POST /api/music/spotify/import_artist
+// ImportArtistFromSpotify maneja la petición POST /api/music/spotify/import_artist. Busca el
+// artista y encola la importación de su discografía; responde 202 con el trabajo, cuyo
+// progreso se consulta en /spotify/import_jobs/:id.
 func (h *Handler) ImportArtistFromSpotify(c *gin.Context) {
-	fmt.Println("========= INICIANDO ImportArtistFromSpotify =========")
-	fmt.Printf("Request: %+v\n", c.Request)
-
-	// Verificar que el servicio de Spotify esté disponible
-	if h.spotifyService == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Spotify service not available"})
-		return
-	}
-
-	// Parsear la solicitud
 	var req ImportArtistRequest
-
-	// Obtener el cuerpo de la petición para debugging
-	bodyBytes, _ := io.ReadAll(c.Request.Body)
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	fmt.Println("Request Body:", string(bodyBytes))
-
 	if err := c.ShouldBindJSON(&req); err != nil {
-		fmt.Println("Error de binding:", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	fmt.Println("Artist:", req.Artist)
-
-	// Crear contexto
-	ctx := context.Background()
-
-	// 1. Buscar artista en Spotify
-	artists, err := h.spotifyService.SearchArtists(ctx, req.Artist, 1)
+	job, err := h.importJobs.CreateArtistImport(c.Request.Context(), req.Artist)
+	if err == service.ErrArtistNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artist not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching for artist", "details": err.Error()})
+		spotifyFailure(c, "Error creating import job", err)
 		return
 	}
 
-	if len(artists) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Artist not found"})
-		return
+	c.Header("Location", "/api/v1/music/spotify/import_jobs/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, job)
+}
+
+// spotifyFailure responde 503 si faltan las credenciales de Spotify o las importaciones no
+// arrancaron, y 500 en otro caso
+func spotifyFailure(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, service.ErrSpotifyUnavailable) || errors.Is(err, service.ErrImportsUnavailable) {
+		status = http.StatusServiceUnavailable
 	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
 
-	// Obtener el primer artista de los resultados
-	artist := artists[0]
+// GetImportJobs lista los trabajos de importación más recientes. Parámetros: status y limit.
+func (h *Handler) GetImportJobs(c *gin.Context) {
+	limit := service.DefaultImportJobsLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe ser un entero positivo"})
+			return
+		}
+		limit = n
+	}
 
-	// 2. Obtener álbumes del artista
-	artistAlbums, err := h.spotifyService.GetArtistAlbums(ctx, string(artist.ID))
+	jobs, err := h.importJobs.GetImportJobs(c.Request.Context(), c.Query("status"), limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting artist albums", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las importaciones", "details": err.Error()})
 		return
 	}
+	if jobs == nil {
+		jobs = []models.ImportJob{}
+	}
+	c.JSON(http.StatusOK, jobs)
+}
 
-	if len(artistAlbums) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Artist found but has no albums",
-			"artist": map[string]interface{}{
-				"id":   string(artist.ID),
-				"name": artist.Name,
-			},
-		})
+// GetImportJob devuelve el estado y el progreso de un trabajo de importación
+func (h *Handler) GetImportJob(c *gin.Context) {
+	job, err := h.importJobs.GetImportJob(c.Request.Context(), c.Param("id"))
+	h.respondImportJob(c, job, err)
+}
+
+// CancelImportJob cancela un trabajo de importación pendiente o en curso
+func (h *Handler) CancelImportJob(c *gin.Context) {
+	job, err := h.importJobs.CancelImportJob(c.Request.Context(), c.Param("id"))
+	if err == service.ErrImportJobFinished {
+		c.JSON(http.StatusConflict, gin.H{"error": "La importación ya ha terminado"})
 		return
 	}
+	h.respondImportJob(c, job, err)
+}
 
-	// 3. Procesar el artista
-	artistModel := h.spotifyService.ConvertSpotifyArtistToModel(&artist)
+func (h *Handler) respondImportJob(c *gin.Context, job *models.ImportJob, err error) {
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Error(), "field": validation.Field})
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Importación no encontrada"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la importación", "details": err.Error()})
+	default:
+		c.JSON(http.StatusOK, job)
+	}
+}
 
-	// Guardar el artista en la base de datos
-	artistCollection := h.musicService.GetArtistCollection()
-	var existingArtist models.Artist
-	err = artistCollection.FindOne(ctx, map[string]string{"spotify_id": string(artist.ID)}).Decode(&existingArtist)
+// RefreshCatalog lanza ahora una pasada del refresco del catálogo desde Spotify y responde
+// 202 con ella; su registro de cambios se consulta en /spotify/refresh_runs/:id
+func (h *Handler) RefreshCatalog(c *gin.Context) {
+	run, err := h.refresher.RunNow(c.Request.Context())
+	if err == service.ErrRefreshRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya hay un refresco en curso"})
+		return
+	}
+	if err != nil {
+		spotifyFailure(c, "Error al iniciar el refresco", err)
+		return
+	}
+	c.Header("Location", "/api/v1/music/spotify/refresh_runs/"+run.ID.Hex())
+	c.JSON(http.StatusAccepted, run)
+}
 
-	var artistID primitive.ObjectID
-	if err == mongo.ErrNoDocuments {
-		// El artista no existe, insertarlo
-		result, err := artistCollection.InsertOne(ctx, artistModel)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving artist", "details": err.Error()})
+// GetRefreshRuns lista las pasadas de refresco más recientes. Parámetro: limit.
+func (h *Handler) GetRefreshRuns(c *gin.Context) {
+	limit := service.DefaultRefreshRunsLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe ser un entero positivo"})
 			return
 		}
-		artistID = result.InsertedID.(primitive.ObjectID)
+		limit = n
+	}
 
-		// Guardar los géneros del artista como documentos independientes
-		if len(artistModel.Genres) > 0 {
-			fmt.Printf("Guardando %d géneros del artista: %v\n", len(artistModel.Genres), artistModel.Genres)
-			if err := h.musicService.SaveGenres(ctx, artistModel.Genres); err != nil {
-				fmt.Printf("Error al guardar los géneros: %v\n", err)
-				// No detenemos el proceso por un error en los géneros
-			}
-		}
-	} else if err != nil {
-		// Error al buscar el artista
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking artist in database", "details": err.Error()})
+	runs, err := h.refresher.GetRefreshRuns(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los refrescos", "details": err.Error()})
 		return
-	} else {
-		// El artista ya existe
-		artistID = existingArtist.ID
+	}
+	if runs == nil {
+		runs = []models.RefreshRun{}
+	}
+	c.JSON(http.StatusOK, runs)
+}
 
-		// Asegurarnos de que los géneros estén actualizados en la base de datos
-		if len(artistModel.Genres) > 0 && !genresEqual(existingArtist.Genres, artistModel.Genres) {
-			fmt.Printf("Actualizando géneros del artista: %v\n", artistModel.Genres)
-			if err := h.musicService.SaveGenres(ctx, artistModel.Genres); err != nil {
-				fmt.Printf("Error al actualizar los géneros: %v\n", err)
-				// No detenemos el proceso por un error en los géneros
-			}
-		}
+// GetRefreshRun devuelve una pasada de refresco con su registro de cambios
+func (h *Handler) GetRefreshRun(c *gin.Context) {
+	run, err := h.refresher.GetRefreshRun(c.Request.Context(), c.Param("id"))
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Error(), "field": validation.Field})
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refresco no encontrado"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el refresco", "details": err.Error()})
+	default:
+		c.JSON(http.StatusOK, run)
 	}
+}
 
-	// 4. Importar los álbumes del artista
-	var importedAlbums []map[string]interface{}
-	for _, spotifyAlbum := range artistAlbums {
-		// Obtener detalles completos del álbum desde Spotify
-		fullAlbum, err := h.spotifyService.GetAlbum(ctx, string(spotifyAlbum.ID))
-		if err != nil {
-			fmt.Printf("Error obteniendo detalles del álbum %s: %v\n", spotifyAlbum.Name, err)
-			continue
-		}
+// GetProviders lista los proveedores de metadatos desde los que se puede importar
+func (h *Handler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.musicService.ProviderNames()})
+}
 
-		// Convertir el álbum de Spotify al modelo de la aplicación
-		albumModel := h.spotifyService.ConvertSpotifyAlbumToModel(fullAlbum)
-		albumModel.ArtistIDs = []primitive.ObjectID{artistID}
+// SearchProviderArtists busca artistas en un proveedor. Parámetros: q y limit.
+func (h *Handler) SearchProviderArtists(c *gin.Context) {
+	query, limit, ok := providerSearchParams(c)
+	if !ok {
+		return
+	}
+	artists, err := h.musicService.SearchProviderArtists(c.Request.Context(), c.Param("provider"), query, limit)
+	if err != nil {
+		providerFailure(c, "Error al buscar artistas", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"artists": artists})
+}
 
-		// Verificar si el álbum ya existe
-		albumCollection := h.musicService.GetAlbumCollection()
-		var existingAlbum models.Album
-		err = albumCollection.FindOne(ctx, map[string]string{"spotify_id": string(spotifyAlbum.ID)}).Decode(&existingAlbum)
+// SearchProviderAlbums busca álbumes en un proveedor. Parámetros: q y limit.
+func (h *Handler) SearchProviderAlbums(c *gin.Context) {
+	query, limit, ok := providerSearchParams(c)
+	if !ok {
+		return
+	}
+	albums, err := h.musicService.SearchProviderAlbums(c.Request.Context(), c.Param("provider"), query, limit)
+	if err != nil {
+		providerFailure(c, "Error al buscar álbumes", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"albums": albums})
+}
 
-		var albumID primitive.ObjectID
-		if err == mongo.ErrNoDocuments {
-			// El álbum no existe, insertarlo
-			result, err := albumCollection.InsertOne(ctx, albumModel)
-			if err != nil {
-				fmt.Printf("Error al guardar el álbum %s: %v\n", albumModel.Title, err)
-				continue
-			}
-			albumID = result.InsertedID.(primitive.ObjectID)
-		} else if err != nil {
-			// Error al buscar el álbum
-			fmt.Printf("Error al verificar el álbum %s en la base de datos: %v\n", albumModel.Title, err)
-			continue
-		} else {
-			// El álbum ya existe
-			albumID = existingAlbum.ID
+// providerSearchParams lee q y limit (10 por defecto); si no son válidos responde 400
+func providerSearchParams(c *gin.Context) (string, int, bool) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro q es obligatorio", "field": "q"})
+		return "", 0, false
+	}
+	limit := 10
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe ser un entero positivo", "field": "limit"})
+			return "", 0, false
 		}
+		limit = n
+	}
+	return query, limit, true
+}
 
-		// Guardar las pistas del álbum
-		songCollection := h.musicService.GetSongCollection()
-		for _, track := range fullAlbum.Tracks.Tracks {
-			song := h.spotifyService.ConvertSpotifyTrackToModel(track, albumID, []primitive.ObjectID{artistID})
-
-			// Verificar si la canción ya existe
-			var existingSong models.Song
-			err = songCollection.FindOne(ctx, map[string]string{"spotify_id": string(track.ID)}).Decode(&existingSong)
-			if err == mongo.ErrNoDocuments {
-				// La canción no existe, insertarla
-				_, err := songCollection.InsertOne(ctx, song)
-				if err != nil {
-					fmt.Printf("Error al guardar la canción %s: %v\n", song.Title, err)
-				} else {
-					fmt.Printf("Canción guardada correctamente: %s\n", song.Title)
-				}
-			} else if err != nil {
-				// Error al buscar la canción
-				fmt.Printf("Error al verificar la canción %s en la base de datos: %v\n", song.Title, err)
-			} else {
-				// La canción ya existe, pero actualizamos los artistas si es necesario
-				if len(existingSong.ArtistIDs) == 0 || !containsObjectID(existingSong.ArtistIDs, artistID) {
-					existingSong.ArtistIDs = append(existingSong.ArtistIDs, artistID)
-					_, err := songCollection.ReplaceOne(ctx, map[string]string{"spotify_id": string(track.ID)}, existingSong)
-					if err != nil {
-						fmt.Printf("Error al actualizar los artistas para la canción %s: %v\n", existingSong.Title, err)
-					}
-				}
-				fmt.Printf("La canción %s ya existe en la base de datos\n", song.Title)
-			}
-		}
+// providerImportRequest es el cuerpo de las importaciones: el ID en el proveedor
+type providerImportRequest struct {
+	ID string `json:"id" binding:"required"`
+}
 
-		importedAlbums = append(importedAlbums, map[string]interface{}{
-			"id":    albumID.Hex(),
-			"title": albumModel.Title,
-		})
+// ImportProviderArtist importa un artista de un proveedor con toda su discografía
+func (h *Handler) ImportProviderArtist(c *gin.Context) {
+	var req providerImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	result, err := h.musicService.ImportProviderArtist(c.Request.Context(), c.Param("provider"), req.ID)
+	if err != nil {
+		providerFailure(c, "Error al importar el artista", err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Artist imported successfully",
-		"artist": map[string]interface{}{
-			"id":   artistID.Hex(),
-			"name": artist.Name,
-		},
-		"albums_imported": len(importedAlbums),
-		"albums":          importedAlbums,
-	})
+// ImportProviderAlbum importa un álbum de un proveedor con sus canciones y artistas
+func (h *Handler) ImportProviderAlbum(c *gin.Context) {
+	var req providerImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	album, err := h.musicService.ImportProviderAlbum(c.Request.Context(), c.Param("provider"), req.ID)
+	if err != nil {
+		providerFailure(c, "Error al importar el álbum", err)
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// providerFailure responde 400 si el proveedor no existe, 404 si no tiene lo pedido, 503 si
+// es Spotify sin credenciales y 500 en otro caso
+func providerFailure(c *gin.Context, message string, err error) {
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Error(), "field": validation.Field})
+	case errors.Is(err, metadata.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, service.ErrSpotifyUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": message, "details": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
 }
 
 // SearchAlbumsInSpotify maneja la petición para buscar álbumes en Spotify
@@ -323,7 +381,7 @@ func (h *Handler) SearchAlbumsInSpotify(c *gin.Context) {
 	// Buscar álbumes en Spotify
 	albums, err := h.musicService.SearchAlbumsInSpotify(ctx, query, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching albums in Spotify", "details": err.Error()})
+		spotifyFailure(c, "Error searching albums in Spotify", err)
 		return
 	}
 
@@ -371,9 +429,9 @@ func (h *Handler) ImportAlbumFromSpotify(c *gin.Context) {
 	ctx := context.Background()
 
 	// 1. Obtener el álbum de Spotify con todas sus canciones incluidas
-	album, err := h.spotifyService.Client().GetAlbum(ctx, spotify.ID(req.AlbumID))
+	album, err := h.spotifyService.GetAlbum(ctx, req.AlbumID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting album from Spotify", "details": err.Error()})
+		spotifyFailure(c, "Error getting album from Spotify", err)
 		return
 	}
 
@@ -385,9 +443,9 @@ func (h *Handler) ImportAlbumFromSpotify(c *gin.Context) {
 	}
 
 	// Obtener información completa del artista
-	spotifyArtist, err := h.spotifyService.Client().GetArtist(ctx, album.Artists[0].ID)
+	spotifyArtist, err := h.spotifyService.GetArtist(ctx, string(album.Artists[0].ID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting artist from Spotify", "details": err.Error()})
+		spotifyFailure(c, "Error getting artist from Spotify", err)
 		return
 	}
 
@@ -513,6 +571,8 @@ func (h *Handler) ImportAlbumFromSpotify(c *gin.Context) {
 		}
 	}
 
+	h.musicService.RefreshAlbumSuggestions(ctx, albumID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Album imported successfully",
 		"album": map[string]interface{}{
@@ -811,6 +871,200 @@ func (h *Handler) UpdateSongAudioURL(c *gin.Context) {
 	})
 }
 
+// UpdateSongAvailability actualiza los países y la ventana de licencia de una canción.
+// Enviar una lista vacía o una fecha nula elimina esa restricción.
+func (h *Handler) UpdateSongAvailability(c *gin.Context) {
+	songID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(songID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de canción inválido"})
+		return
+	}
+
+	var request struct {
+		AvailableMarkets []string   `json:"available_markets"`
+		AvailableFrom    *time.Time `json:"available_from"`  // RFC3339
+		AvailableUntil   *time.Time `json:"available_until"` // RFC3339
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de disponibilidad inválidos", "details": err.Error()})
+		return
+	}
+
+	markets, err := normalizeMarkets(request.AvailableMarkets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.AvailableFrom != nil && request.AvailableUntil != nil && !request.AvailableFrom.Before(*request.AvailableUntil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "available_from debe ser anterior a available_until"})
+		return
+	}
+
+	err = h.musicService.UpdateSongAvailability(c.Request.Context(), songID, markets, request.AvailableFrom, request.AvailableUntil)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la disponibilidad", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Disponibilidad actualizada exitosamente",
+		"available_markets": markets,
+		"available_from":    request.AvailableFrom,
+		"available_until":   request.AvailableUntil,
+	})
+}
+
+// normalizeMarkets valida los códigos de país (ISO 3166-1 alfa-2), los pasa a mayúsculas y quita duplicados
+func normalizeMarkets(markets []string) ([]string, error) {
+	seen := make(map[string]bool, len(markets))
+	normalized := make([]string, 0, len(markets))
+	for _, market := range markets {
+		code := strings.ToUpper(strings.TrimSpace(market))
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("código de país inválido: %q", market)
+		}
+		if !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// GetSongLyrics devuelve la letra de una canción (?language=es para elegir idioma)
+func (h *Handler) GetSongLyrics(c *gin.Context) {
+	songID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(songID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de canción inválido"})
+		return
+	}
+
+	lyrics, err := h.musicService.GetLyrics(c.Request.Context(), songID, strings.ToLower(c.Query("language")))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La canción no tiene letra"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la letra", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, lyrics)
+}
+
+// PutSongLyrics crea o reemplaza la letra de una canción. Acepta JSON con "plain" o "lrc",
+// o el archivo LRC directamente (text/plain o multipart con el campo "file"), con
+// language y source como parámetros de la URL. Un LRC inválido devuelve los errores por línea.
+func (h *Handler) PutSongLyrics(c *gin.Context) {
+	songID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de canción inválido"})
+		return
+	}
+
+	var request struct {
+		Language string `json:"language"`
+		Source   string `json:"source"`
+		Plain    string `json:"plain"`
+		LRC      string `json:"lrc"`
+	}
+	switch c.ContentType() {
+	case "application/json":
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Datos de letra inválidos", "details": err.Error()})
+			return
+		}
+	case "multipart/form-data":
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Falta el archivo LRC en el campo 'file'"})
+			return
+		}
+		reader, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el archivo", "details": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, maxLyricsBytes+1))
+		reader.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el archivo", "details": err.Error()})
+			return
+		}
+		request.LRC = string(data)
+	default:
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLyricsBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el cuerpo", "details": err.Error()})
+			return
+		}
+		request.LRC = string(data)
+	}
+	if request.Language == "" {
+		request.Language = c.Query("language")
+	}
+	if request.Source == "" {
+		request.Source = c.Query("source")
+	}
+	if len(request.LRC) > maxLyricsBytes || len(request.Plain) > maxLyricsBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "La letra supera el tamaño máximo"})
+		return
+	}
+
+	lyrics := &models.Lyrics{SongID: songID, Source: request.Source, Plain: request.Plain}
+	if strings.TrimSpace(request.LRC) != "" {
+		parsed, err := lyricsparser.ParseLRC(request.LRC)
+		var parseErr *lyricsparser.ParseError
+		if errors.As(err, &parseErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "LRC inválido", "line_errors": parseErr.Errors})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		lyrics.Lines = parsed.Lines
+		lyrics.Synced = true
+		if lyrics.Plain == "" {
+			lyrics.Plain = parsed.Plain
+		}
+		if request.Language == "" {
+			request.Language = parsed.Language
+		}
+	}
+	if strings.TrimSpace(lyrics.Plain) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Se requiere 'plain' o 'lrc'"})
+		return
+	}
+
+	lyrics.Language = strings.ToLower(strings.TrimSpace(request.Language))
+	if len(lyrics.Language) != 2 || lyrics.Language[0] < 'a' || lyrics.Language[0] > 'z' || lyrics.Language[1] < 'a' || lyrics.Language[1] > 'z' {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "language debe ser un código ISO 639-1 (p. ej. \"es\")"})
+		return
+	}
+	if lyrics.Source == "" {
+		lyrics.Source = "manual"
+	}
+
+	err = h.musicService.SaveLyrics(c.Request.Context(), lyrics)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canción no encontrada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar la letra", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, lyrics)
+}
+
+// maxLyricsBytes limita el tamaño de una letra subida
+const maxLyricsBytes = 256 << 10
+
 // GetSongByName maneja la petición para obtener una canción por su nombre
 func (h *Handler) SearchSongsByName(c *gin.Context) {
 	name := c.Query("name")
@@ -820,11 +1074,15 @@ func (h *Handler) SearchSongsByName(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	songsDetails, err := h.musicService.SearchSongsByName(ctx, name)
+	songsDetails, didYouMean, err := h.musicService.SearchSongsByName(ctx, name)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error al buscar canciones: " + err.Error()})
 		return
 	}
+	// La respuesta es una lista, así que la corrección viaja en una cabecera
+	if didYouMean != "" {
+		c.Header("X-Did-You-Mean", didYouMean)
+	}
 
 	if len(songsDetails) == 0 {
 		c.JSON(http.StatusOK, []interface{}{})
@@ -877,6 +1135,72 @@ func (h *Handler) SearchSongsByName(c *gin.Context) {
 	c.JSON(200, formattedSongs)
 }
 
+// Search busca en canciones, álbumes y artistas ordenando por relevancia y popularidad.
+// Parámetros: q (obligatorio), types (song,album,artist; por defecto todos) y limit.
+func (h *Handler) Search(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El parámetro 'q' es requerido"})
+		return
+	}
+	var types []string
+	if raw := c.Query("types"); raw != "" {
+		types = strings.Split(raw, ",")
+	}
+	limit := service.DefaultSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe ser un entero positivo"})
+			return
+		}
+		limit = n
+	}
+
+	response, err := h.musicService.Search(c.Request.Context(), query, types, limit)
+	var validation *service.ValidationError
+	if errors.As(err, &validation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Error(), "field": validation.Field})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error en la búsqueda", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Autocomplete sugiere canciones, álbumes y artistas mientras se escribe. Responde desde
+// el índice en memoria, así que se puede llamar en cada pulsación.
+// Parámetros: q, types (song,album,artist) y limit.
+func (h *Handler) Autocomplete(c *gin.Context) {
+	query := c.Query("q")
+	var types []string
+	if raw := c.Query("types"); raw != "" {
+		types = strings.Split(raw, ",")
+	}
+	limit := service.DefaultSuggestLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe ser un entero positivo"})
+			return
+		}
+		limit = n
+	}
+
+	suggestions, err := h.musicService.Suggest(query, types, limit)
+	var validation *service.ValidationError
+	if errors.As(err, &validation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Error(), "field": validation.Field})
+		return
+	}
+	if suggestions == nil {
+		suggestions = []search.SuggestResult{}
+	}
+	c.JSON(http.StatusOK, gin.H{"query": query, "suggestions": suggestions})
+}
+
 // GetAlbums maneja la petición para obtener todos los álbumes
 func (h *Handler) GetAlbums(c *gin.Context) {
 	// Obtener el contexto de la petición
@@ -1064,6 +1388,31 @@ func (h *Handler) GetArtist(c *gin.Context) {
 	c.JSON(http.StatusOK, formattedArtist)
 }
 
+// FollowArtist marca o desmarca un artista como seguido; el refresco programado importa
+// los álbumes nuevos de los artistas seguidos. Cuerpo: {"followed": true}
+func (h *Handler) FollowArtist(c *gin.Context) {
+	var req struct {
+		Followed *bool `json:"followed" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	artist, err := h.musicService.FollowArtist(c.Request.Context(), c.Param("id"), *req.Followed)
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Error(), "field": validation.Field})
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artista no encontrado"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el artista", "details": err.Error()})
+	default:
+		c.JSON(http.StatusOK, artist)
+	}
+}
+
 // GetCategories maneja la petición para obtener todas las categorías
 func (h *Handler) GetCategories(c *gin.Context) {
 	// Obtener el contexto de la petición
@@ -1200,36 +1549,6 @@ type DatabaseInterface interface {
 	SaveArtistData(artist ArtistData) error
 }
 
-// genresEqual compara dos arrays de géneros para determinar si son iguales
-func genresEqual(a, b []string) bool {
-	if len(a) != len(b) {
-		return false
-	}
-
-	// Crear un mapa para contar las ocurrencias de cada género en el primer array
-	counts := make(map[string]int)
-	for _, genre := range a {
-		counts[genre]++
-	}
-
-	// Restar las ocurrencias encontradas en el segundo array
-	for _, genre := range b {
-		if counts[genre] <= 0 {
-			return false
-		}
-		counts[genre]--
-	}
-
-	// Verificar que no queden ocurrencias
-	for _, count := range counts {
-		if count != 0 {
-			return false
-		}
-	}
-
-	return true
-}
-
 // containsObjectID verifica si un ObjectID está presente en una lista de ObjectIDs
 func containsObjectID(list []primitive.ObjectID, id primitive.ObjectID) bool {
 	for _, item := range list {
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"context"
+	"log"
+	"time"
+
 	gqlhandler "github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gin-contrib/cors"
@@ -10,6 +14,8 @@ import (
 	"github.com/angel/music-ms/graph"
 	"github.com/angel/music-ms/graph/generated"
 	"github.com/angel/music-ms/internal/config"
+	"github.com/angel/music-ms/internal/metadata"
+	"github.com/angel/music-ms/internal/middleware"
 	"github.com/angel/music-ms/internal/service"
 )
 
@@ -29,15 +35,56 @@ func SetupRouter(db *mongo.Database) *gin.Engine {
 	// Cargar la configuración
 	cfg := config.LoadConfig()
 
-	// Crear servicios
-	spotifyService, err := service.NewSpotifyService(cfg.SpotifyID, cfg.SpotifyKey)
-	if err != nil {
-		// Fallback sin servicio de Spotify
-		spotifyService = nil
-	}
+	// Crear servicios. El cliente de Spotify se crea en la primera petición con
+	// credenciales, así que las rutas de Spotify existen aunque aún no estén configuradas.
+	spotifyService := service.NewSpotifyService(config.SpotifyCredentials, service.SpotifyOptions{
+		APIURL:   cfg.SpotifyAPIURL,
+		TokenURL: cfg.SpotifyTokenURL,
+	})
 
 	musicService := service.NewMusicService(db, spotifyService)
-	handler := NewHandler(musicService, spotifyService)
+	musicService.SetSearchFuzziness(cfg.SearchFuzziness)
+
+	// Proveedores de metadatos para artistas que no están en Spotify
+	musicService.RegisterProvider(metadata.NewMusicBrainzProvider(cfg.MusicBrainzURL, cfg.MusicBrainzUserAgent))
+	if cfg.LocalCatalogFile != "" {
+		musicService.RegisterProvider(metadata.NewLocalProvider(cfg.LocalCatalogFile))
+	}
+
+	// Sin los índices de texto la búsqueda falla; se avisa pero el servicio arranca
+	indexCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := musicService.EnsureSearchIndexes(indexCtx); err != nil {
+		log.Printf("Error creando los índices de búsqueda: %v", err)
+	}
+	// Sin los índices de la paginación los listados siguen funcionando, pero ordenan en memoria
+	if err := musicService.EnsurePageIndexes(indexCtx); err != nil {
+		log.Printf("Error preparando los índices de la paginación: %v", err)
+	}
+	cancel()
+
+	// El índice de sugerencias se carga en segundo plano; hasta entonces devuelve menos
+	// resultados. Se reconstruye cada SUGGESTION_REFRESH_INTERVAL para recoger los cambios
+	// hechos por otras réplicas o por el importador.
+	musicService.StartSuggestionIndex(context.Background(), cfg.SuggestionRefreshInterval)
+
+	// Las importaciones de artistas se ejecutan en segundo plano; las que deja a medias una
+	// réplica caída las retoma otra cuando caduca su reserva
+	importJobs := service.NewImportJobService(musicService, cfg.ImportWorkers)
+	// Si no arrancan, POST /spotify/import_artist responde 503 en lugar de encolar trabajos
+	// que nadie procesaría
+	if err := importJobs.Start(context.Background()); err != nil {
+		log.Printf("Error arrancando las importaciones en segundo plano, quedan deshabilitadas: %v", err)
+	}
+
+	// Refresco periódico de artistas y álbumes importados
+	refresher := service.NewRefreshService(musicService, cfg.RefreshInterval, cfg.RefreshBatchSize, cfg.SpotifyRequestInterval)
+	if err := refresher.Start(context.Background()); err != nil {
+		log.Printf("Error programando el refresco del catálogo: %v", err)
+	}
+	handler := NewHandler(musicService, spotifyService, importJobs, refresher)
+
+	// Las rutas REST que escriben en el catálogo requieren el mismo token que las mutaciones
+	write := middleware.CatalogWriteAuth(cfg.CatalogAdminToken)
 
 	// Rutas de la API
 	api := r.Group("/api/v1")
@@ -54,9 +101,16 @@ func SetupRouter(db *mongo.Database) *gin.Engine {
 			music.GET("/songs", handler.GetSongs)
 			music.GET("/songs/:id", handler.GetSong)
 			music.GET("/songs/:id/audio", handler.GetSongAudio)
-			music.PUT("/songs/:id/audio-url", handler.UpdateSongAudioURL)
+			music.PUT("/songs/:id/audio-url", write, handler.UpdateSongAudioURL)
+			music.PUT("/songs/:id/availability", write, handler.UpdateSongAvailability)
+			music.GET("/songs/:id/lyrics", handler.GetSongLyrics)
+			music.PUT("/songs/:id/lyrics", write, handler.PutSongLyrics)
 			music.GET("/songs/search", handler.SearchSongsByName)
 
+			// Búsqueda unificada (canciones, álbumes y artistas)
+			music.GET("/search", handler.Search)
+			music.GET("/autocomplete", handler.Autocomplete)
+
 			// Rutas de álbumes
 			music.GET("/albums", handler.GetAlbums)
 			music.GET("/albums/:id", handler.GetAlbum)
@@ -65,6 +119,7 @@ func SetupRouter(db *mongo.Database) *gin.Engine {
 			music.GET("/artists", handler.GetArtists)
 			music.GET("/artists/:id", handler.GetArtist)
 			music.GET("/artists/:id/details", handler.GetArtist) // Alias para compatibilidad
+			music.PUT("/artists/:id/follow", write, handler.FollowArtist)
 
 			// Rutas de géneros
 			music.GET("/genres", handler.GetGenres)
@@ -72,15 +127,36 @@ func SetupRouter(db *mongo.Database) *gin.Engine {
 			music.GET("/genres/slug/:slug", handler.GetGenreBySlug)
 
 			// Rutas de Spotify
+			// Sin credenciales responden 503 hasta que se configuren
 			spotify := music.Group("/spotify")
-			if spotifyService != nil {
+			{
 				spotify.GET("/search_albums", handler.SearchAlbumsInSpotify)
-				spotify.POST("/import_album", handler.ImportAlbumFromSpotify)
-				spotify.POST("/import_artist", handler.ImportArtistFromSpotify)
+				spotify.POST("/import_album", write, handler.ImportAlbumFromSpotify)
+				spotify.POST("/import_artist", write, handler.ImportArtistFromSpotify)
+				spotify.GET("/import_jobs", handler.GetImportJobs)
+				spotify.GET("/import_jobs/:id", handler.GetImportJob)
+				spotify.POST("/import_jobs/:id/cancel", write, handler.CancelImportJob)
+				spotify.POST("/refresh", write, handler.RefreshCatalog)
+				spotify.GET("/refresh_runs", handler.GetRefreshRuns)
+				spotify.GET("/refresh_runs/:id", handler.GetRefreshRun)
+			}
+
+			// Importación desde cualquier proveedor de metadatos (spotify, musicbrainz, local)
+			providers := music.Group("/providers")
+			{
+				providers.GET("", handler.GetProviders)
+				providers.GET("/:provider/artists", handler.SearchProviderArtists)
+				providers.GET("/:provider/albums", handler.SearchProviderAlbums)
+				providers.POST("/:provider/import_artist", write, handler.ImportProviderArtist)
+				providers.POST("/:provider/import_album", write, handler.ImportProviderAlbum)
 			}
 
 			// GraphQL endpoint
-			music.POST("/graphql", gin.WrapH(gqlhandler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{MusicService: musicService}}))))
+			// Las mutaciones requieren CATALOG_ADMIN_TOKEN; las consultas son públicas
+			graphqlServer := gqlhandler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{MusicService: musicService}}))
+			graphqlServer.AroundOperations(graph.CatalogWriteAuth(cfg.CatalogAdminToken))
+			graphqlServer.AroundOperations(graph.DataLoaders(musicService))
+			music.POST("/graphql", gin.WrapH(graphqlServer))
 
 			// Playground (opcional, solo en desarrollo)
 			music.GET("/playground", gin.WrapH(playground.Handler("GraphQL", "/api/v1/music/graphql")))
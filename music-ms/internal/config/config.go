@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"strconv"
+	"sync"
 	"time"
+
+	"github.com/joho/godotenv"
 )
 
 // Config estructura que contiene la configuración de la aplicación
@@ -14,6 +17,25 @@ type Config struct {
 	MongoTimeout time.Duration
 	SpotifyID    string
 	SpotifyKey   string
+	// URLs de la API y de los tokens de Spotify; vacías usan las reales
+	SpotifyAPIURL   string
+	SpotifyTokenURL string
+	// Token para las mutaciones GraphQL del catálogo; vacío deshabilita las escrituras
+	CatalogAdminToken string
+	// Ediciones toleradas por palabra en la búsqueda aproximada; 0 la desactiva
+	SearchFuzziness int
+	// Cada cuánto se reconstruye el índice de sugerencias; 0 solo lo construye al arrancar
+	SuggestionRefreshInterval time.Duration
+	// Importaciones de Spotify que se ejecutan a la vez en segundo plano
+	ImportWorkers int
+	// Refresco programado del catálogo desde Spotify; intervalo 0 lo desactiva
+	RefreshInterval        time.Duration
+	RefreshBatchSize       int
+	SpotifyRequestInterval time.Duration // Separación mínima entre peticiones del refresco
+	// Proveedores de metadatos además de Spotify: MusicBrainz y un catálogo JSON local
+	MusicBrainzURL       string
+	MusicBrainzUserAgent string
+	LocalCatalogFile     string // Vacío desactiva el catálogo local
 }
 
 // LoadConfig carga la configuración desde las variables de entorno
@@ -30,7 +52,7 @@ func LoadConfig() Config {
 	// Configuración MongoDB
 	cfg.MongoURI = getEnv("MONGODB_URI", "mongodb://localhost:27017")
 	cfg.MongoDB = getEnv("MONGODB_NAME", "music_ms")
-	
+
 	// Timeout para MongoDB (en segundos)
 	timeout, err := strconv.Atoi(getEnv("MONGODB_TIMEOUT", "10"))
 	if err != nil {
@@ -41,10 +63,93 @@ func LoadConfig() Config {
 	// Credenciales de Spotify
 	cfg.SpotifyID = getEnv("SPOTIFY_CLIENT_ID", "")
 	cfg.SpotifyKey = getEnv("SPOTIFY_CLIENT_SECRET", "")
+	cfg.SpotifyAPIURL = getEnv("SPOTIFY_API_URL", "")
+	cfg.SpotifyTokenURL = getEnv("SPOTIFY_TOKEN_URL", "")
+
+	// Autorización de escrituras del catálogo
+	cfg.CatalogAdminToken = getEnv("CATALOG_ADMIN_TOKEN", "")
+
+	// Tolerancia a errores de escritura en la búsqueda
+	fuzziness, err := strconv.Atoi(getEnv("SEARCH_FUZZINESS", "2"))
+	if err != nil || fuzziness < 0 {
+		fuzziness = 2
+	}
+	cfg.SearchFuzziness = fuzziness
+	cfg.SuggestionRefreshInterval = getDuration("SUGGESTION_REFRESH_INTERVAL", 10*time.Minute)
+
+	// Concurrencia de las importaciones en segundo plano
+	workers, err := strconv.Atoi(getEnv("IMPORT_WORKERS", "2"))
+	if err != nil || workers <= 0 {
+		workers = 2
+	}
+	cfg.ImportWorkers = workers
+
+	// Refresco del catálogo: cada cuánto, cuántos artistas por pasada y a qué ritmo
+	cfg.RefreshInterval = getDuration("REFRESH_INTERVAL", 24*time.Hour)
+	batchSize, err := strconv.Atoi(getEnv("REFRESH_BATCH_SIZE", "50"))
+	if err != nil || batchSize <= 0 {
+		batchSize = 50
+	}
+	cfg.RefreshBatchSize = batchSize
+	cfg.SpotifyRequestInterval = getDuration("SPOTIFY_REQUEST_INTERVAL", 200*time.Millisecond)
+
+	// Otros proveedores de metadatos
+	cfg.MusicBrainzURL = getEnv("MUSICBRAINZ_API_URL", "")
+	cfg.MusicBrainzUserAgent = getEnv("MUSICBRAINZ_USER_AGENT", "")
+	cfg.LocalCatalogFile = getEnv("LOCAL_CATALOG_FILE", "")
 
 	return cfg
 }
 
+// envFileTTL es cuánto se reutiliza lo leído del archivo .env antes de volver a leerlo
+const envFileTTL = 30 * time.Second
+
+// envFileCache guarda lo leído de un archivo de entorno durante ttl, para no leerlo del
+// disco en cada petición. Si la lectura falla (p. ej. no existe) también se guarda vacío.
+type envFileCache struct {
+	ttl  time.Duration
+	read func() (map[string]string, error)
+
+	mu     sync.Mutex
+	values map[string]string
+	readAt time.Time
+}
+
+// spotifyEnvFile es el archivo .env del que se leen las credenciales de Spotify
+var spotifyEnvFile = &envFileCache{
+	ttl:  envFileTTL,
+	read: func() (map[string]string, error) { return godotenv.Read() },
+}
+
+// Values devuelve las variables del archivo, leyéndolo de nuevo si ha pasado ttl
+func (c *envFileCache) Values() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readAt.IsZero() || time.Since(c.readAt) >= c.ttl {
+		values, err := c.read()
+		if err != nil {
+			values = nil
+		}
+		c.values, c.readAt = values, time.Now()
+	}
+	return c.values
+}
+
+// SpotifyCredentials lee las credenciales de Spotify del entorno o, si no están, del
+// archivo .env. Este se vuelve a leer cada envFileTTL como mucho, para poder añadirlas sin
+// reiniciar.
+func SpotifyCredentials() (clientID, clientSecret string) {
+	clientID = getEnv("SPOTIFY_CLIENT_ID", "")
+	clientSecret = getEnv("SPOTIFY_CLIENT_SECRET", "")
+	if clientID != "" && clientSecret != "" {
+		return clientID, clientSecret
+	}
+	if values := spotifyEnvFile.Values(); values != nil {
+		return values["SPOTIFY_CLIENT_ID"], values["SPOTIFY_CLIENT_SECRET"]
+	}
+	return clientID, clientSecret
+}
+
 // getEnv obtiene el valor de una variable de entorno, o un valor por defecto si no existe
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -52,3 +157,16 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDuration lee una duración como "24h" o "500ms"; si no es válida usa el valor por defecto
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return defaultValue
+	}
+	return duration
+}
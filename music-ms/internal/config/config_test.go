@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingRead simula la lectura del .env y cuenta cuántas veces se lee
+type countingRead struct {
+	reads  int
+	values map[string]string
+	err    error
+}
+
+func (r *countingRead) read() (map[string]string, error) {
+	r.reads++
+	return r.values, r.err
+}
+
+func TestEnvFileCache(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	values := map[string]string{"SPOTIFY_CLIENT_ID": "id"}
+	tests := []struct {
+		name       string
+		err        error
+		sleep      time.Duration // Espera entre la segunda y la tercera consulta
+		wantReads  int
+		wantValues bool
+	}{
+		{"dentro del ttl se reutiliza", nil, 0, 1, true},
+		{"pasado el ttl se vuelve a leer", nil, ttl + 10*time.Millisecond, 2, true},
+		{"un archivo que no existe también se guarda", errors.New("open .env: no such file or directory"), 0, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &countingRead{values: values, err: tt.err}
+			cache := &envFileCache{ttl: ttl, read: file.read}
+			cache.Values()
+			cache.Values()
+			time.Sleep(tt.sleep)
+			got := cache.Values()
+			if file.reads != tt.wantReads {
+				t.Errorf("%d lecturas, se esperaban %d", file.reads, tt.wantReads)
+			}
+			if (got != nil) != tt.wantValues {
+				t.Errorf("Values = %v, se esperaban valores: %v", got, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestSpotifyCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		file       map[string]string
+		wantID     string
+		wantSecret string
+		wantReads  int
+	}{
+		{
+			name:       "del entorno sin leer el archivo",
+			env:        map[string]string{"SPOTIFY_CLIENT_ID": "env-id", "SPOTIFY_CLIENT_SECRET": "env-secret"},
+			file:       map[string]string{"SPOTIFY_CLIENT_ID": "file-id", "SPOTIFY_CLIENT_SECRET": "file-secret"},
+			wantID:     "env-id",
+			wantSecret: "env-secret",
+		},
+		{
+			name:       "del archivo si faltan en el entorno",
+			file:       map[string]string{"SPOTIFY_CLIENT_ID": "file-id", "SPOTIFY_CLIENT_SECRET": "file-secret"},
+			wantID:     "file-id",
+			wantSecret: "file-secret",
+			wantReads:  1,
+		},
+		{
+			name:      "sin credenciales",
+			wantReads: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SPOTIFY_CLIENT_ID", tt.env["SPOTIFY_CLIENT_ID"])
+			t.Setenv("SPOTIFY_CLIENT_SECRET", tt.env["SPOTIFY_CLIENT_SECRET"])
+			file := &countingRead{values: tt.file}
+			previous := spotifyEnvFile
+			spotifyEnvFile = &envFileCache{ttl: time.Minute, read: file.read}
+			defer func() { spotifyEnvFile = previous }()
+
+			// Varias consultas seguidas leen el archivo una vez como mucho
+			for i := 0; i < 3; i++ {
+				id, secret := SpotifyCredentials()
+				if id != tt.wantID || secret != tt.wantSecret {
+					t.Fatalf("SpotifyCredentials = (%q, %q), se esperaba (%q, %q)", id, secret, tt.wantID, tt.wantSecret)
+				}
+			}
+			if file.reads != tt.wantReads {
+				t.Errorf("%d lecturas del .env, se esperaban %d", file.reads, tt.wantReads)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package loudness
+
+import "math"
+
+// biquad es un filtro IIR de segundo orden (forma directa I)
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	x1, x2     float64
+	y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting es el filtro K de BS.1770: un shelving de agudos (efecto de la cabeza)
+// seguido de un pasa-altos (curva RLB)
+type kWeighting struct {
+	shelf    biquad
+	highpass biquad
+}
+
+// newKWeighting calcula los coeficientes para la frecuencia de muestreo dada; a 48 kHz
+// coinciden con los publicados en la norma
+func newKWeighting(sampleRate float64) kWeighting {
+	var k kWeighting
+
+	f0 := 1681.974450955533
+	gain := 3.999843853973347
+	q := 0.7071752369554196
+	K := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + K/q + K*K
+	k.shelf = biquad{
+		b0: (vh + vb*K/q + K*K) / a0,
+		b1: 2 * (K*K - vh) / a0,
+		b2: (vh - vb*K/q + K*K) / a0,
+		a1: 2 * (K*K - 1) / a0,
+		a2: (1 - K/q + K*K) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	K = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + K/q + K*K
+	k.highpass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (K*K - 1) / a0,
+		a2: (1 - K/q + K*K) / a0,
+	}
+	return k
+}
+
+func (k *kWeighting) process(x float64) float64 {
+	return k.highpass.process(k.shelf.process(x))
+}
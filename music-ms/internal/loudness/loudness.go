@@ -0,0 +1,208 @@
+// Package loudness mide la sonoridad de archivos de audio según ITU-R BS.1770-4 / EBU R128:
+// filtro K, bloques de 400 ms con solapamiento del 75 % y compuertas absoluta (-70 LUFS)
+// y relativa (-10 LU). Está escrito en Go puro, sin dependencias de sistema.
+package loudness
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+)
+
+// DefaultReferenceLUFS es el nivel objetivo con el que se calculan las ganancias
+const DefaultReferenceLUFS = -18.0
+
+// ErrTooQuiet indica que ningún bloque supera la compuerta absoluta (silencio o audio < 400 ms)
+var ErrTooQuiet = errors.New("audio silencioso o demasiado corto para medir sonoridad")
+
+const (
+	absoluteGate = -70.0
+	relativeGate = -10.0
+	blockSeconds = 0.4
+	stepSeconds  = 0.1 // 75 % de solapamiento
+)
+
+// Result es la medición de una pista
+type Result struct {
+	IntegratedLUFS float64
+	PeakDBFS       float64 // Pico de muestra
+	Duration       float64 // Segundos
+
+	// blocks guarda la potencia ponderada de cada bloque de 400 ms para poder
+	// calcular la sonoridad de un álbum completo
+	blocks []float64
+}
+
+// GainDB devuelve la ganancia a aplicar para llevar la medición al nivel de referencia
+func GainDB(integratedLUFS, referenceLUFS float64) float64 {
+	return round2(referenceLUFS - integratedLUFS)
+}
+
+// pcmReader entrega las muestras decodificadas intercaladas en [-1, 1]
+type pcmReader interface {
+	format() (channels, sampleRate int)
+	read(out []float64) (int, error)
+}
+
+// newPCMReader reconoce el formato (MP3 o WAV) por los primeros bytes
+func newPCMReader(r io.Reader) (pcmReader, error) {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(12); err == nil && isMP3(header) {
+		return newMP3Reader(br)
+	}
+	return newWAVReader(br)
+}
+
+// Analyze decodifica un WAV o un MP3 y mide su sonoridad integrada y su pico
+func Analyze(r io.Reader) (*Result, error) {
+	pcm, err := newPCMReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, sampleRate := pcm.format()
+	filters := make([]kWeighting, channels)
+	for c := range filters {
+		filters[c] = newKWeighting(float64(sampleRate))
+	}
+	weights := channelWeights(channels)
+
+	// Se acumula la energía filtrada en sub-bloques de 100 ms; cada bloque son 4 sub-bloques
+	stepFrames := int(math.Round(float64(sampleRate) * stepSeconds))
+	subBlocks := make([]float64, 0, 1024)
+	var current float64
+	var currentFrames int
+	var totalFrames int
+	peak := 0.0
+
+	buf := make([]float64, 4096*channels)
+	for {
+		n, err := pcm.read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i+channels <= n; i += channels {
+			for c := 0; c < channels; c++ {
+				x := buf[i+c]
+				if a := math.Abs(x); a > peak {
+					peak = a
+				}
+				if weights[c] == 0 {
+					continue
+				}
+				y := filters[c].process(x)
+				current += weights[c] * y * y
+			}
+			currentFrames++
+			totalFrames++
+			if currentFrames == stepFrames {
+				subBlocks = append(subBlocks, current)
+				current, currentFrames = 0, 0
+			}
+		}
+	}
+
+	result := &Result{
+		Duration: float64(totalFrames) / float64(sampleRate),
+		PeakDBFS: round2(toDB(peak)),
+	}
+	blockFrames := float64(4 * stepFrames)
+	for i := 0; i+4 <= len(subBlocks); i++ {
+		power := (subBlocks[i] + subBlocks[i+1] + subBlocks[i+2] + subBlocks[i+3]) / blockFrames
+		result.blocks = append(result.blocks, power)
+	}
+
+	integrated, ok := gatedLoudness(result.blocks)
+	if !ok {
+		return nil, ErrTooQuiet
+	}
+	result.IntegratedLUFS = round2(integrated)
+	return result, nil
+}
+
+// AlbumLoudness mide la sonoridad integrada del conjunto de pistas, como si fueran
+// un único programa continuo (se combinan los bloques de todas antes de aplicar las compuertas)
+func AlbumLoudness(tracks []*Result) (float64, error) {
+	var blocks []float64
+	for _, track := range tracks {
+		blocks = append(blocks, track.blocks...)
+	}
+	integrated, ok := gatedLoudness(blocks)
+	if !ok {
+		return 0, ErrTooQuiet
+	}
+	return round2(integrated), nil
+}
+
+// AlbumPeak es el mayor pico entre las pistas
+func AlbumPeak(tracks []*Result) float64 {
+	peak := math.Inf(-1)
+	for _, track := range tracks {
+		peak = math.Max(peak, track.PeakDBFS)
+	}
+	return peak
+}
+
+// gatedLoudness aplica la compuerta absoluta y luego la relativa
+func gatedLoudness(blocks []float64) (float64, bool) {
+	absolute := meanAbove(blocks, absoluteGate)
+	if absolute == 0 {
+		return 0, false
+	}
+	threshold := blockLoudness(absolute) + relativeGate
+	gated := meanAbove(blocks, math.Max(threshold, absoluteGate))
+	if gated == 0 {
+		return 0, false
+	}
+	return blockLoudness(gated), true
+}
+
+// meanAbove promedia la potencia de los bloques cuya sonoridad supera el umbral
+func meanAbove(blocks []float64, threshold float64) float64 {
+	var sum float64
+	var count int
+	for _, power := range blocks {
+		if blockLoudness(power) > threshold {
+			sum += power
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+func blockLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+// channelWeights sigue el orden de canales de WAV (L, R, C, LFE, Ls, Rs): el LFE no
+// cuenta y los envolventes pesan 1.41
+func channelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for c := range weights {
+		weights[c] = 1
+	}
+	if channels >= 6 {
+		weights[3] = 0
+		weights[4] = 1.41
+		weights[5] = 1.41
+	}
+	return weights
+}
+
+func toDB(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return -120 // Piso para silencio digital, evita -Inf al serializar
+	}
+	return 20 * math.Log10(amplitude)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,191 @@
+package loudness
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// segment es un tramo de seno de 1 kHz con la amplitud dada (0 = silencio)
+type segment struct {
+	amplitude float64
+	seconds   float64
+}
+
+// wavFile arma un WAV en memoria con los mismos segmentos en todos los canales activos;
+// los canales fuera de active quedan en silencio
+type wavFile struct {
+	sampleRate int
+	channels   int
+	active     int // Canales con señal; 0 = todos
+	format     uint16
+	bits       int
+	segments   []segment
+}
+
+func (f wavFile) bytes() []byte {
+	active := f.active
+	if active == 0 {
+		active = f.channels
+	}
+	var data bytes.Buffer
+	frame := 0
+	for _, s := range f.segments {
+		frames := int(s.seconds * float64(f.sampleRate))
+		for i := 0; i < frames; i++ {
+			x := s.amplitude * math.Sin(2*math.Pi*1000*float64(frame)/float64(f.sampleRate))
+			for c := 0; c < f.channels; c++ {
+				v := x
+				if c >= active {
+					v = 0
+				}
+				writeSample(&data, v, f.format, f.bits)
+			}
+			frame++
+		}
+	}
+
+	var out bytes.Buffer
+	blockAlign := f.channels * f.bits / 8
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(36+data.Len()))
+	out.WriteString("WAVEfmt ")
+	binary.Write(&out, binary.LittleEndian, uint32(16))
+	binary.Write(&out, binary.LittleEndian, f.format)
+	binary.Write(&out, binary.LittleEndian, uint16(f.channels))
+	binary.Write(&out, binary.LittleEndian, uint32(f.sampleRate))
+	binary.Write(&out, binary.LittleEndian, uint32(f.sampleRate*blockAlign))
+	binary.Write(&out, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&out, binary.LittleEndian, uint16(f.bits))
+	out.WriteString("data")
+	binary.Write(&out, binary.LittleEndian, uint32(data.Len()))
+	out.Write(data.Bytes())
+	return out.Bytes()
+}
+
+func writeSample(w *bytes.Buffer, v float64, format uint16, bits int) {
+	switch {
+	case format == wavFormatFloat && bits == 32:
+		binary.Write(w, binary.LittleEndian, float32(v))
+	case format == wavFormatFloat:
+		binary.Write(w, binary.LittleEndian, v)
+	case bits == 16:
+		binary.Write(w, binary.LittleEndian, int16(math.Round(v*32767)))
+	case bits == 24:
+		s := int32(math.Round(v * 8388607))
+		w.Write([]byte{byte(s), byte(s >> 8), byte(s >> 16)})
+	}
+}
+
+// Los valores esperados son los de referencia de BS.1770-4: un seno de 1 kHz a 0 dBFS en
+// un canal mide -3.01 LKFS, así que a -20 dBFS mide -23.01 y en dos canales 3 dB más
+func TestAnalyzeSine(t *testing.T) {
+	tone := []segment{{amplitude: 0.1, seconds: 5}}
+	tests := []struct {
+		name     string
+		file     wavFile
+		wantLUFS float64
+		wantPeak float64
+	}{
+		{"mono 48 kHz PCM 16", wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 16, segments: tone}, -23.01, -20},
+		{"mono 44.1 kHz PCM 24", wavFile{sampleRate: 44100, channels: 1, format: wavFormatPCM, bits: 24, segments: tone}, -23.01, -20},
+		{"estéreo 48 kHz float 32", wavFile{sampleRate: 48000, channels: 2, format: wavFormatFloat, bits: 32, segments: tone}, -20.0, -20},
+		{"estéreo con un solo canal", wavFile{sampleRate: 48000, channels: 2, active: 1, format: wavFormatFloat, bits: 64, segments: tone}, -23.01, -20},
+		{"5.1 sin contar el LFE", wavFile{sampleRate: 48000, channels: 6, format: wavFormatPCM, bits: 16, segments: tone}, -23.01 + 10*math.Log10(3+2*1.41), -20},
+		{
+			// El tramo a -60 dBFS queda por debajo de la compuerta relativa y no baja la medición
+			"compuerta relativa",
+			wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 16, segments: []segment{{0.1, 20}, {0.001, 10}}},
+			-23.01, -20,
+		},
+		{
+			// El silencio digital no pasa la compuerta absoluta
+			"compuerta absoluta",
+			wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 16, segments: []segment{{0, 10}, {0.1, 20}}},
+			-23.01, -20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Analyze(bytes.NewReader(tt.file.bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(result.IntegratedLUFS-tt.wantLUFS) > 0.1 {
+				t.Errorf("sonoridad = %.2f LUFS, se esperaba %.2f", result.IntegratedLUFS, tt.wantLUFS)
+			}
+			if math.Abs(result.PeakDBFS-tt.wantPeak) > 0.1 {
+				t.Errorf("pico = %.2f dBFS, se esperaba %.2f", result.PeakDBFS, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"silencio", wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 16, segments: []segment{{0, 2}}}.bytes(), ErrTooQuiet},
+		{"más corto que un bloque", wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 16, segments: []segment{{0.1, 0.3}}}.bytes(), ErrTooQuiet},
+		{"MP3 con ID3", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), make([]byte, 64)...), ErrUnsupportedFormat},
+		{"MP3 sin etiqueta", append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 64)...), ErrUnsupportedFormat},
+		{"PCM de 12 bits", wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 12}.bytes(), ErrUnsupportedFormat},
+		{"vacío", nil, ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Analyze(bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Analyze() error = %v, se esperaba %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// La sonoridad del álbum combina los bloques de todas las pistas antes de las compuertas
+func TestAlbumLoudness(t *testing.T) {
+	track := func(amplitude float64) *Result {
+		file := wavFile{sampleRate: 48000, channels: 1, format: wavFormatPCM, bits: 16, segments: []segment{{amplitude, 5}}}
+		result, err := Analyze(bytes.NewReader(file.bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	loud, quiet := track(0.1), track(0.05)
+	// Una pista a -80 LUFS: Analyze la rechazaría, pero sus bloques no deben contar en el álbum
+	silent := &Result{blocks: []float64{math.Pow(10, (-80+0.691)/10), math.Pow(10, (-80+0.691)/10)}}
+
+	tests := []struct {
+		name   string
+		tracks []*Result
+		want   float64
+	}{
+		{"una pista", []*Result{loud}, -23.01},
+		// -23 y -29 LUFS a partes iguales: media de potencias
+		{"dos pistas de igual duración", []*Result{loud, quiet}, -23.01 + 10*math.Log10((1+0.25)/2)},
+		// La pista a -80 LUFS no pasa la compuerta absoluta
+		{"pista casi en silencio", []*Result{loud, silent}, -23.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AlbumLoudness(tt.tracks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("AlbumLoudness = %.2f, se esperaba %.2f", got, tt.want)
+			}
+		})
+	}
+	if _, err := AlbumLoudness(nil); !errors.Is(err, ErrTooQuiet) {
+		t.Errorf("AlbumLoudness(nil) error = %v, se esperaba ErrTooQuiet", err)
+	}
+	if got := GainDB(-23.01, DefaultReferenceLUFS); got != 5.01 {
+		t.Errorf("GainDB = %v, se esperaba 5.01", got)
+	}
+}
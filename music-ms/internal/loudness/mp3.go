@@ -0,0 +1,91 @@
+package loudness
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3Reader decodifica un MP3 con go-mp3 (Go puro). El decodificador siempre entrega PCM
+// de 16 bits estéreo, también para pistas mono: esas se miden con un único canal, como un
+// WAV mono, para no sumar dos veces la misma señal (+3 dB)
+type mp3Reader struct {
+	decoder    *mp3.Decoder
+	channels   int
+	sampleRate int
+	buf        []byte
+}
+
+// newMP3Reader salta la etiqueta ID3v2, lee el modo de canal de la primera trama y deja
+// el decodificador listo
+func newMP3Reader(r *bufio.Reader) (*mp3Reader, error) {
+	if err := skipID3v2(r); err != nil {
+		return nil, fmt.Errorf("%w: MP3 sin tramas válidas: %v", ErrUnsupportedFormat, err)
+	}
+	channels := 2
+	if frame, err := r.Peek(4); err == nil && frame[0] == 0xFF && frame[1]&0xE0 == 0xE0 && frame[3]>>6 == 3 {
+		channels = 1
+	}
+
+	decoder, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: MP3 sin tramas válidas: %v", ErrUnsupportedFormat, err)
+	}
+	return &mp3Reader{decoder: decoder, channels: channels, sampleRate: decoder.SampleRate()}, nil
+}
+
+// skipID3v2 descarta la etiqueta ID3v2 del inicio, si la hay
+func skipID3v2(r *bufio.Reader) error {
+	header, err := r.Peek(10)
+	if err != nil || string(header[0:3]) != "ID3" {
+		return nil
+	}
+	// Tamaño "syncsafe": 7 bits por byte, sin contar la cabecera ni el pie
+	size := int(header[6]&0x7F)<<21 | int(header[7]&0x7F)<<14 | int(header[8]&0x7F)<<7 | int(header[9]&0x7F)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	_, err = r.Discard(size)
+	return err
+}
+
+// isMP3 reconoce una etiqueta ID3 o la palabra de sincronía de una trama MPEG al inicio
+func isMP3(header []byte) bool {
+	if string(header[0:3]) == "ID3" {
+		return true
+	}
+	return header[0] == 0xFF && header[1]&0xE0 == 0xE0
+}
+
+// read decodifica hasta len(out)/channels frames intercalados en [-1, 1] y devuelve
+// la cantidad de muestras escritas (0 al terminar)
+func (m *mp3Reader) read(out []float64) (int, error) {
+	frames := len(out) / m.channels
+	want := frames * 4 // L y R de 16 bits
+	if cap(m.buf) < want {
+		m.buf = make([]byte, want)
+	}
+	buf := m.buf[:want]
+	n, err := io.ReadFull(m.decoder, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("MP3 corrupto: %v", err)
+	}
+
+	frames = n / 4
+	for i := 0; i < frames; i++ {
+		b := buf[i*4:]
+		out[i*m.channels] = float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+		if m.channels == 2 {
+			out[i*2+1] = float64(int16(binary.LittleEndian.Uint16(b[2:]))) / 32768
+		}
+	}
+	return frames * m.channels, nil
+}
+
+func (m *mp3Reader) format() (int, int) {
+	return m.channels, m.sampleRate
+}
@@ -0,0 +1,205 @@
+package loudness
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// bitWriter escribe campos MSB primero, como los lee el decodificador
+type bitWriter struct {
+	buf  []byte
+	bits int
+}
+
+func (w *bitWriter) write(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>i&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.bits % 8)
+		}
+		w.bits++
+	}
+}
+
+// mp3File arma tramas MPEG-1 Layer III (44.1 kHz, 128 kbps) sin codificador: cada granulo
+// lleva una única línea espectral (la 26, ~1 kHz) con la tabla Huffman 1, así que el tono
+// es el mismo en todos los canales
+type mp3File struct {
+	channels int
+	frames   int
+	silent   bool
+	id3      bool // Anteponer una etiqueta ID3v2
+}
+
+const mp3FrameSize = 417 // 144 * 128000 / 44100, sin relleno
+
+func (f mp3File) bytes() []byte {
+	var out bytes.Buffer
+	if f.id3 {
+		// Cabecera ID3v2.4 con 200 bytes de etiqueta (tamaño syncsafe: 1<<7 + 72)
+		out.Write([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 1, 72})
+		out.Write(make([]byte, 200))
+	}
+	mode := byte(0x00) // Estéreo
+	if f.channels == 1 {
+		mode = 0xC0
+	}
+
+	// 13 pares (0,0) codificados "1" y el par (1,0) codificado "01" más el bit de signo
+	part23 := 16
+	if f.silent {
+		part23 = 0
+	}
+	for i := 0; i < f.frames; i++ {
+		side := &bitWriter{}
+		side.write(0, 9) // main_data_begin: sin reserva de bits
+		if f.channels == 1 {
+			side.write(0, 5)
+			side.write(0, 4)
+		} else {
+			side.write(0, 3)
+			side.write(0, 8)
+		}
+		for gr := 0; gr < 2; gr++ {
+			for ch := 0; ch < f.channels; ch++ {
+				side.write(part23, 12)
+				side.write(14, 9)  // big_values
+				side.write(200, 8) // global_gain: tono en torno a -18 LUFS
+				side.write(0, 4)   // scalefac_compress: sin factores de escala
+				side.write(0, 1)   // Bloques largos
+				side.write(1, 5)   // Tabla Huffman 1 en las tres regiones
+				side.write(1, 5)
+				side.write(1, 5)
+				side.write(0, 4) // region0_count
+				side.write(0, 3) // region1_count
+				side.write(0, 3) // preflag, scalefac_scale, count1table_select
+			}
+		}
+
+		main := &bitWriter{}
+		if !f.silent {
+			for gr := 0; gr < 2; gr++ {
+				for ch := 0; ch < f.channels; ch++ {
+					for pair := 0; pair < 13; pair++ {
+						main.write(1, 1)
+					}
+					main.write(0b010, 3)
+				}
+			}
+		}
+
+		frame := make([]byte, mp3FrameSize)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, mode})
+		copy(frame[4:], side.buf)
+		copy(frame[4+len(side.buf):], main.buf)
+		out.Write(frame)
+	}
+	return out.Bytes()
+}
+
+// pcmWAV envuelve en un WAV el PCM de 16 bits que entrega go-mp3, quedándose con el
+// canal izquierdo si channels es 1
+func pcmWAV(t *testing.T, file []byte, channels int) []byte {
+	t.Helper()
+	decoder, err := mp3.NewDecoder(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stereo, err := io.ReadAll(decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := stereo
+	if channels == 1 {
+		data = nil
+		for i := 0; i+4 <= len(stereo); i += 4 {
+			data = append(data, stereo[i], stereo[i+1])
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(36+len(data)))
+	out.WriteString("WAVEfmt ")
+	binary.Write(&out, binary.LittleEndian, uint32(16))
+	binary.Write(&out, binary.LittleEndian, uint16(wavFormatPCM))
+	binary.Write(&out, binary.LittleEndian, uint16(channels))
+	binary.Write(&out, binary.LittleEndian, uint32(decoder.SampleRate()))
+	binary.Write(&out, binary.LittleEndian, uint32(decoder.SampleRate()*channels*2))
+	binary.Write(&out, binary.LittleEndian, uint16(channels*2))
+	binary.Write(&out, binary.LittleEndian, uint16(16))
+	out.WriteString("data")
+	binary.Write(&out, binary.LittleEndian, uint32(len(data)))
+	out.Write(data)
+	return out.Bytes()
+}
+
+// Un MP3 mide lo mismo que su PCM decodificado en WAV; el mono no se cuenta dos veces
+// aunque el decodificador lo entregue duplicado en estéreo
+func TestAnalyzeMP3(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     mp3File
+		channels int // Canales del WAV de referencia
+	}{
+		{"mono", mp3File{channels: 1, frames: 80}, 1},
+		{"estéreo", mp3File{channels: 2, frames: 80}, 2},
+		{"mono con ID3", mp3File{channels: 1, frames: 80, id3: true}, 1},
+	}
+	results := make(map[string]*Result)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.file.bytes()
+			got, err := Analyze(bytes.NewReader(file))
+			if err != nil {
+				t.Fatalf("Analyze() error = %v", err)
+			}
+			want, err := Analyze(bytes.NewReader(pcmWAV(t, file, tt.channels)))
+			if err != nil {
+				t.Fatalf("Analyze(WAV) error = %v", err)
+			}
+			if got.IntegratedLUFS != want.IntegratedLUFS || got.PeakDBFS != want.PeakDBFS || got.Duration != want.Duration {
+				t.Errorf("MP3 = %+v, WAV decodificado = %+v", *got, *want)
+			}
+			results[tt.name] = got
+		})
+	}
+
+	mono, stereo := results["mono"], results["estéreo"]
+	if mono == nil || stereo == nil {
+		return
+	}
+	if diff := stereo.IntegratedLUFS - mono.IntegratedLUFS; math.Abs(diff-3.01) > 0.02 {
+		t.Errorf("estéreo - mono = %.2f LU, se esperaba 3.01 (la misma señal en dos canales)", diff)
+	}
+	if results["mono con ID3"] != nil && results["mono con ID3"].IntegratedLUFS != mono.IntegratedLUFS {
+		t.Errorf("la etiqueta ID3 cambia la medición: %.2f frente a %.2f", results["mono con ID3"].IntegratedLUFS, mono.IntegratedLUFS)
+	}
+}
+
+func TestAnalyzeMP3Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"tramas en silencio", mp3File{channels: 2, frames: 80, silent: true}.bytes(), ErrTooQuiet},
+		{"etiqueta ID3 sin tramas", mp3File{channels: 1, id3: true}.bytes(), ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Analyze(bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Analyze() error = %v, se esperaba %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package loudness
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrUnsupportedFormat indica que el archivo no es un WAV PCM/float ni un MP3 que el analizador sepa leer
+var ErrUnsupportedFormat = errors.New("formato de audio no soportado (solo WAV PCM/float o MP3)")
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavReader decodifica un WAV por bloques, sin cargar el archivo completo en memoria
+type wavReader struct {
+	r             io.Reader
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+	float         bool
+	remaining     int64 // Bytes de audio pendientes en el chunk "data"
+	buf           []byte
+}
+
+// newWAVReader lee la cabecera y deja el lector al inicio de las muestras
+func newWAVReader(r io.Reader) (*wavReader, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, ErrUnsupportedFormat
+	}
+
+	w := &wavReader{r: r}
+	gotFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("WAV sin chunk de datos: %v", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("chunk fmt inválido")
+			}
+			data := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			format := binary.LittleEndian.Uint16(data[0:2])
+			w.channels = int(binary.LittleEndian.Uint16(data[2:4]))
+			w.sampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+			w.bitsPerSample = int(binary.LittleEndian.Uint16(data[14:16]))
+			if format == wavFormatExtensible && size >= 26 {
+				// Los dos primeros bytes del GUID del subformato son el código de formato
+				format = binary.LittleEndian.Uint16(data[24:26])
+			}
+			switch {
+			case format == wavFormatPCM && (w.bitsPerSample == 8 || w.bitsPerSample == 16 || w.bitsPerSample == 24 || w.bitsPerSample == 32):
+			case format == wavFormatFloat && (w.bitsPerSample == 32 || w.bitsPerSample == 64):
+				w.float = true
+			default:
+				return nil, ErrUnsupportedFormat
+			}
+			if w.channels <= 0 || w.sampleRate <= 0 {
+				return nil, fmt.Errorf("cabecera WAV inválida")
+			}
+			gotFormat = true
+
+		case "data":
+			if !gotFormat {
+				return nil, fmt.Errorf("chunk data antes de fmt")
+			}
+			w.remaining = size
+			return w, nil
+
+		default:
+			// Otros chunks (LIST, fact, ...) se saltan; el tamaño se alinea a 2 bytes
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// read decodifica hasta len(out)/channels frames intercalados en [-1, 1] y devuelve
+// la cantidad de muestras escritas (0 al terminar)
+func (w *wavReader) read(out []float64) (int, error) {
+	bytesPerSample := w.bitsPerSample / 8
+	frameSize := bytesPerSample * w.channels
+	frames := len(out) / w.channels
+	want := int64(frames * frameSize)
+	if want > w.remaining {
+		want = w.remaining - w.remaining%int64(frameSize)
+	}
+	if want <= 0 {
+		return 0, nil
+	}
+	if cap(w.buf) < int(want) {
+		w.buf = make([]byte, want)
+	}
+	buf := w.buf[:want]
+	n, err := io.ReadFull(w.r, buf)
+	n -= n % frameSize
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	w.remaining -= int64(n)
+	if err == io.ErrUnexpectedEOF {
+		w.remaining = 0 // Archivo truncado: se analiza lo que haya
+	}
+
+	samples := n / bytesPerSample
+	for i := 0; i < samples; i++ {
+		b := buf[i*bytesPerSample:]
+		switch {
+		case w.float && bytesPerSample == 4:
+			out[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case w.float:
+			out[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		case bytesPerSample == 1:
+			out[i] = (float64(b[0]) - 128) / 128 // PCM de 8 bits es sin signo
+		case bytesPerSample == 2:
+			out[i] = float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+		case bytesPerSample == 3:
+			v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+			out[i] = float64(v) / 8388608
+		default:
+			out[i] = float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+		}
+	}
+	return samples, nil
+}
+
+func (w *wavReader) format() (int, int) {
+	return w.channels, w.sampleRate
+}
@@ -0,0 +1,194 @@
+// Package lyrics interpreta letras sincronizadas en formato LRC.
+package lyrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+// LineError es un error en una línea concreta del LRC (numerada desde 1)
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ParseError agrupa todos los errores encontrados, para corregirlos de una vez
+type ParseError struct {
+	Errors []LineError
+}
+
+func (e *ParseError) Error() string {
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("LRC inválido en la línea %d: %s", e.Errors[0].Line, e.Errors[0].Message)
+	}
+	return fmt.Sprintf("LRC inválido: %d errores (primero en la línea %d: %s)",
+		len(e.Errors), e.Errors[0].Line, e.Errors[0].Message)
+}
+
+// Parsed es el resultado de interpretar un LRC
+type Parsed struct {
+	Lines    []models.LyricLine // Ordenadas por tiempo
+	Plain    string             // Texto sin marcas de tiempo
+	Language string             // Etiqueta [la:], si existe
+}
+
+// ParseLRC interpreta un LRC: líneas "[mm:ss.xx]texto" (una o varias marcas por línea),
+// etiquetas de metadatos como [ar:], [ti:] o [la:] y el ajuste [offset:±ms].
+// Las líneas vacías se ignoran; cualquier otra línea sin marca de tiempo es un error.
+func ParseLRC(text string) (*Parsed, error) {
+	parsed := &Parsed{}
+	var errs []LineError
+	offset := 0
+
+	type pending struct {
+		timeMs int
+		text   string
+	}
+	var entries []pending
+
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		lineNo := i + 1
+		line := strings.TrimSpace(raw)
+		if i == 0 {
+			line = strings.TrimPrefix(line, "\ufeff") // BOM UTF-8
+		}
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "[") {
+			errs = append(errs, LineError{Line: lineNo, Message: "falta la marca de tiempo [mm:ss.xx]"})
+			continue
+		}
+
+		var times []int
+		rest := line
+		lineFailed := false
+		for strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				errs = append(errs, LineError{Line: lineNo, Message: "corchete sin cerrar"})
+				lineFailed = true
+				break
+			}
+			tag := rest[1:end]
+			rest = rest[end+1:]
+
+			if key, value, ok := metadataTag(tag); ok {
+				switch key {
+				case "offset":
+					n, err := strconv.Atoi(strings.TrimPrefix(value, "+"))
+					if err != nil {
+						errs = append(errs, LineError{Line: lineNo, Message: fmt.Sprintf("offset inválido: %q", value)})
+						lineFailed = true
+					}
+					offset = n
+				case "la":
+					parsed.Language = strings.ToLower(value)
+				}
+				continue
+			}
+
+			ms, err := parseTimestamp(tag)
+			if err != nil {
+				errs = append(errs, LineError{Line: lineNo, Message: err.Error()})
+				lineFailed = true
+				break
+			}
+			times = append(times, ms)
+		}
+		if lineFailed || len(times) == 0 {
+			if !lineFailed && strings.TrimSpace(rest) != "" {
+				errs = append(errs, LineError{Line: lineNo, Message: "texto sin marca de tiempo"})
+			}
+			continue
+		}
+
+		lyric := strings.TrimSpace(rest)
+		for _, ms := range times {
+			entries = append(entries, pending{timeMs: ms, text: lyric})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &ParseError{Errors: errs}
+	}
+	if len(entries) == 0 {
+		return nil, &ParseError{Errors: []LineError{{Line: 1, Message: "el LRC no tiene líneas con marca de tiempo"}}}
+	}
+
+	// Un offset positivo adelanta la letra (se resta al tiempo), como en los reproductores LRC
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].timeMs < entries[b].timeMs })
+	var plain []string
+	for _, entry := range entries {
+		ms := entry.timeMs - offset
+		if ms < 0 {
+			ms = 0
+		}
+		parsed.Lines = append(parsed.Lines, models.LyricLine{TimeMs: ms, Text: entry.text})
+		if entry.text != "" {
+			plain = append(plain, entry.text)
+		}
+	}
+	parsed.Plain = strings.Join(plain, "\n")
+	return parsed, nil
+}
+
+// metadataTag reconoce etiquetas "clave:valor" cuya clave no es numérica (p. ej. "ar:Artista")
+func metadataTag(tag string) (string, string, bool) {
+	colon := strings.Index(tag, ":")
+	if colon <= 0 {
+		return "", "", false
+	}
+	key := strings.ToLower(strings.TrimSpace(tag[:colon]))
+	for _, r := range key {
+		if r < 'a' || r > 'z' {
+			return "", "", false
+		}
+	}
+	return key, strings.TrimSpace(tag[colon+1:]), true
+}
+
+// parseTimestamp convierte "mm:ss", "mm:ss.xx" o "mm:ss.xxx" a milisegundos
+func parseTimestamp(tag string) (int, error) {
+	invalid := fmt.Errorf("marca de tiempo inválida: [%s]", tag)
+	colon := strings.Index(tag, ":")
+	if colon <= 0 {
+		return 0, invalid
+	}
+	minutes, err := strconv.Atoi(tag[:colon])
+	if err != nil || minutes < 0 {
+		return 0, invalid
+	}
+
+	secPart, fracPart := tag[colon+1:], ""
+	if dot := strings.IndexAny(secPart, ".:"); dot >= 0 {
+		secPart, fracPart = secPart[:dot], secPart[dot+1:]
+	}
+	if len(secPart) != 2 {
+		return 0, invalid
+	}
+	seconds, err := strconv.Atoi(secPart)
+	if err != nil || seconds < 0 || seconds > 59 {
+		return 0, invalid
+	}
+
+	ms := 0
+	if fracPart != "" {
+		if len(fracPart) > 3 {
+			return 0, invalid
+		}
+		frac, err := strconv.Atoi(fracPart)
+		if err != nil || frac < 0 {
+			return 0, invalid
+		}
+		for i := len(fracPart); i < 3; i++ {
+			frac *= 10
+		}
+		ms = frac
+	}
+	return (minutes*60+seconds)*1000 + ms, nil
+}
@@ -0,0 +1,125 @@
+package lyrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+func TestParseLRC(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     []models.LyricLine
+		plain    string
+		language string
+	}{
+		{
+			name:  "líneas simples",
+			input: "[00:01.00]Hola\n[00:02.50]Mundo",
+			want:  []models.LyricLine{{TimeMs: 1000, Text: "Hola"}, {TimeMs: 2500, Text: "Mundo"}},
+			plain: "Hola\nMundo",
+		},
+		{
+			name:  "precisión de minutos, centésimas y milésimas",
+			input: "[01:02]a\n[01:02.3]b\n[01:02.34]c\n[01:02.345]d\n[100:00.00]e",
+			want: []models.LyricLine{
+				{TimeMs: 62000, Text: "a"}, {TimeMs: 62300, Text: "b"}, {TimeMs: 62340, Text: "c"},
+				{TimeMs: 62345, Text: "d"}, {TimeMs: 6000000, Text: "e"},
+			},
+			plain: "a\nb\nc\nd\ne",
+		},
+		{
+			name:  "varias marcas en una línea y orden por tiempo",
+			input: "[00:10.00][00:30.00]Estribillo\n[00:20.00]Estrofa",
+			want: []models.LyricLine{
+				{TimeMs: 10000, Text: "Estribillo"}, {TimeMs: 20000, Text: "Estrofa"}, {TimeMs: 30000, Text: "Estribillo"},
+			},
+			plain: "Estribillo\nEstrofa\nEstribillo",
+		},
+		{
+			name:     "metadatos, BOM, CRLF y líneas vacías",
+			input:    "\ufeff[ti:Canción]\r\n[ar:Artista]\r\n[la:ES]\r\n\r\n[00:01.00]Uno\r\n",
+			want:     []models.LyricLine{{TimeMs: 1000, Text: "Uno"}},
+			plain:    "Uno",
+			language: "es",
+		},
+		{
+			name:  "línea instrumental sin texto",
+			input: "[00:01.00]Uno\n[00:05.00]\n[00:09.00]Dos",
+			want:  []models.LyricLine{{TimeMs: 1000, Text: "Uno"}, {TimeMs: 5000}, {TimeMs: 9000, Text: "Dos"}},
+			plain: "Uno\nDos",
+		},
+		{
+			name:  "offset positivo adelanta y no baja de cero",
+			input: "[offset:+500]\n[00:00.20]Uno\n[00:02.00]Dos",
+			want:  []models.LyricLine{{TimeMs: 0, Text: "Uno"}, {TimeMs: 1500, Text: "Dos"}},
+			plain: "Uno\nDos",
+		},
+		{
+			name:  "offset negativo atrasa",
+			input: "[offset:-250]\n[00:01.00]Uno",
+			want:  []models.LyricLine{{TimeMs: 1250, Text: "Uno"}},
+			plain: "Uno",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseLRC(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed.Lines, tt.want) {
+				t.Errorf("Lines = %+v, se esperaba %+v", parsed.Lines, tt.want)
+			}
+			if parsed.Plain != tt.plain {
+				t.Errorf("Plain = %q, se esperaba %q", parsed.Plain, tt.plain)
+			}
+			if parsed.Language != tt.language {
+				t.Errorf("Language = %q, se esperaba %q", parsed.Language, tt.language)
+			}
+		})
+	}
+}
+
+func TestParseLRCErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []LineError
+	}{
+		{"vacío", "", []LineError{{1, "el LRC no tiene líneas con marca de tiempo"}}},
+		{"solo metadatos", "[ar:Artista]\n[ti:Título]", []LineError{{1, "el LRC no tiene líneas con marca de tiempo"}}},
+		{"texto sin marca", "[00:01.00]Uno\nDos", []LineError{{2, "falta la marca de tiempo [mm:ss.xx]"}}},
+		{"texto tras metadatos", "[ar:Artista]Dos", []LineError{{1, "texto sin marca de tiempo"}}},
+		{"corchete sin cerrar", "[00:01.00Uno", []LineError{{1, "corchete sin cerrar"}}},
+		{"segundos fuera de rango", "[00:60.00]Uno", []LineError{{1, "marca de tiempo inválida: [00:60.00]"}}},
+		{"segundos de un dígito", "[00:1.00]Uno", []LineError{{1, "marca de tiempo inválida: [00:1.00]"}}},
+		{"fracción demasiado larga", "[00:01.0000]Uno", []LineError{{1, "marca de tiempo inválida: [00:01.0000]"}}},
+		{"minutos negativos", "[-1:00.00]Uno", []LineError{{1, "marca de tiempo inválida: [-1:00.00]"}}},
+		{"offset inválido", "[offset:abc]\n[00:01.00]Uno", []LineError{{1, `offset inválido: "abc"`}}},
+		{
+			"se informan todos los errores",
+			"[00:01.00]Uno\nDos\n[00:99.00]Tres\n\n[xx]Cuatro",
+			[]LineError{
+				{2, "falta la marca de tiempo [mm:ss.xx]"},
+				{3, "marca de tiempo inválida: [00:99.00]"},
+				{5, "marca de tiempo inválida: [xx]"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLRC(tt.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("error = %v, se esperaba *ParseError", err)
+			}
+			if !reflect.DeepEqual(parseErr.Errors, tt.want) {
+				t.Errorf("Errors = %+v, se esperaba %+v", parseErr.Errors, tt.want)
+			}
+		})
+	}
+}
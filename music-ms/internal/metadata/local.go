@@ -0,0 +1,226 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angel/music-ms/internal/search"
+)
+
+// LocalCatalog es el contenido del archivo JSON que lee LocalProvider. En los álbumes basta
+// con el ID de cada artista; el nombre se toma de la lista de artistas.
+type LocalCatalog struct {
+	Artists []Artist `json:"artists"`
+	Albums  []Album  `json:"albums"`
+}
+
+// LocalProvider sirve los metadatos de un catálogo en un archivo JSON, para artistas que no
+// están en ningún proveedor externo. El archivo se vuelve a leer cuando cambia, así que se
+// pueden añadir artistas sin reiniciar.
+type LocalProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	catalog LocalCatalog
+	artists map[string]*Artist // Índices por ID sobre catalog
+	albums  map[string]*Album
+}
+
+// NewLocalProvider crea el proveedor para el catálogo de path; el archivo se lee al usarlo
+func NewLocalProvider(path string) *LocalProvider {
+	return &LocalProvider{path: path}
+}
+
+// Name retorna el nombre del proveedor
+func (p *LocalProvider) Name() string {
+	return ProviderLocal
+}
+
+// SearchArtists busca artistas cuyo nombre contenga todas las palabras de la consulta
+func (p *LocalProvider) SearchArtists(ctx context.Context, query string, limit int) ([]Artist, error) {
+	catalog, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	terms := search.Terms(query)
+	var artists []Artist
+	for _, artist := range catalog.Artists {
+		if limit > 0 && len(artists) == limit {
+			break
+		}
+		if matches(artist.Name, terms) {
+			artists = append(artists, artist)
+		}
+	}
+	return artists, nil
+}
+
+// SearchAlbums busca álbumes cuyo título contenga todas las palabras de la consulta
+func (p *LocalProvider) SearchAlbums(ctx context.Context, query string, limit int) ([]Album, error) {
+	catalog, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	terms := search.Terms(query)
+	var albums []Album
+	for _, album := range catalog.Albums {
+		if limit > 0 && len(albums) == limit {
+			break
+		}
+		if matches(album.Title, terms) {
+			album.Tracks = nil
+			albums = append(albums, album)
+		}
+	}
+	return albums, nil
+}
+
+// GetArtist obtiene un artista por su ID en el catálogo
+func (p *LocalProvider) GetArtist(ctx context.Context, id string) (*Artist, error) {
+	if _, err := p.load(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	artist, ok := p.artists[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *artist
+	return &result, nil
+}
+
+// GetAlbum obtiene un álbum con sus pistas
+func (p *LocalProvider) GetAlbum(ctx context.Context, id string) (*Album, error) {
+	if _, err := p.load(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	album, ok := p.albums[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *album
+	return &result, nil
+}
+
+// GetArtistAlbums obtiene los álbumes en los que participa el artista
+func (p *LocalProvider) GetArtistAlbums(ctx context.Context, artistID string) ([]Album, error) {
+	catalog, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	_, ok := p.artists[artistID]
+	p.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var albums []Album
+	for _, album := range catalog.Albums {
+		for _, artist := range album.Artists {
+			if artist.ID == artistID {
+				album.Tracks = nil
+				albums = append(albums, album)
+				break
+			}
+		}
+	}
+	return albums, nil
+}
+
+// load devuelve el catálogo, leyéndolo de nuevo si el archivo ha cambiado
+func (p *LocalProvider) load() (LocalCatalog, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return LocalCatalog{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.artists == nil || !info.ModTime().Equal(p.modTime) {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return LocalCatalog{}, err
+		}
+		var catalog LocalCatalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return LocalCatalog{}, fmt.Errorf("catálogo %s: %w", p.path, err)
+		}
+		if err := p.index(catalog); err != nil {
+			return LocalCatalog{}, fmt.Errorf("catálogo %s: %w", p.path, err)
+		}
+		p.modTime = info.ModTime()
+	}
+	// Al recargar se sustituyen los slices, no se modifican, así que se pueden devolver
+	return p.catalog, nil
+}
+
+// index valida el catálogo y lo guarda por ID; completa los nombres de los artistas de
+// cada álbum y numera las pistas que no traen número
+func (p *LocalProvider) index(catalog LocalCatalog) error {
+	artists := make(map[string]*Artist, len(catalog.Artists))
+	for i := range catalog.Artists {
+		artist := &catalog.Artists[i]
+		if artist.ID == "" || artist.Name == "" {
+			return fmt.Errorf("artista %d sin id o nombre", i+1)
+		}
+		if _, ok := artists[artist.ID]; ok {
+			return fmt.Errorf("artista %q repetido", artist.ID)
+		}
+		artists[artist.ID] = artist
+	}
+
+	albums := make(map[string]*Album, len(catalog.Albums))
+	for i := range catalog.Albums {
+		album := &catalog.Albums[i]
+		if album.ID == "" || album.Title == "" {
+			return fmt.Errorf("álbum %d sin id o título", i+1)
+		}
+		if _, ok := albums[album.ID]; ok {
+			return fmt.Errorf("álbum %q repetido", album.ID)
+		}
+		if len(album.Artists) == 0 {
+			return fmt.Errorf("álbum %q sin artistas", album.ID)
+		}
+		for j, ref := range album.Artists {
+			artist, ok := artists[ref.ID]
+			if !ok {
+				return fmt.Errorf("álbum %q: artista %q desconocido", album.ID, ref.ID)
+			}
+			album.Artists[j].Name = artist.Name
+		}
+		for j := range album.Tracks {
+			track := &album.Tracks[j]
+			if track.ID == "" {
+				return fmt.Errorf("álbum %q: pista %d sin id", album.ID, j+1)
+			}
+			if track.TrackNumber == 0 {
+				track.TrackNumber = j + 1
+			}
+		}
+		albums[album.ID] = album
+	}
+
+	p.catalog, p.artists, p.albums = catalog, artists, albums
+	return nil
+}
+
+// matches indica si el texto contiene todas las palabras buscadas
+func matches(text string, terms []string) bool {
+	folded := search.Fold(text)
+	for _, term := range terms {
+		if !strings.Contains(folded, term) {
+			return false
+		}
+	}
+	return len(terms) > 0
+}
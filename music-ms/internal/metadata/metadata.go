@@ -0,0 +1,51 @@
+// Package metadata define los datos de catálogo que devuelven los proveedores de
+// metadatos (Spotify, MusicBrainz, un catálogo local...) con independencia de su API
+package metadata
+
+import "errors"
+
+// Nombres de los proveedores; se guardan en el campo provider de los documentos importados
+const (
+	ProviderSpotify     = "spotify"
+	ProviderMusicBrainz = "musicbrainz"
+	ProviderLocal       = "local"
+)
+
+// ErrNotFound indica que el proveedor no tiene el artista o álbum pedido
+var ErrNotFound = errors.New("not found in metadata provider")
+
+// Artist es un artista tal como lo describe un proveedor
+type Artist struct {
+	ID         string   `json:"id"` // ID en el proveedor
+	Name       string   `json:"name"`
+	Genres     []string `json:"genres,omitempty"`
+	ImageURL   string   `json:"image_url,omitempty"`
+	Biography  string   `json:"biography,omitempty"`
+	Popularity int      `json:"popularity,omitempty"`
+}
+
+// ArtistRef es la referencia a un artista dentro de un álbum
+type ArtistRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Album es un álbum de un proveedor. Tracks solo viene relleno al pedir el álbum por su
+// ID; en búsquedas y discografías queda vacío.
+type Album struct {
+	ID          string      `json:"id"`
+	Title       string      `json:"title"`
+	ReleaseDate string      `json:"release_date,omitempty"` // AAAA, AAAA-MM o AAAA-MM-DD
+	ImageURL    string      `json:"image_url,omitempty"`
+	Artists     []ArtistRef `json:"artists"`
+	Tracks      []Track     `json:"tracks,omitempty"`
+}
+
+// Track es una pista de un álbum
+type Track struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	DurationMs  int      `json:"duration_ms"`
+	TrackNumber int      `json:"track_number"`
+	Markets     []string `json:"markets,omitempty"` // Países donde se puede escuchar, si el proveedor lo sabe
+}
@@ -0,0 +1,312 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMusicBrainzURL es la API pública de MusicBrainz
+	DefaultMusicBrainzURL = "https://musicbrainz.org/ws/2"
+	// DefaultMusicBrainzUserAgent identifica al servicio; MusicBrainz bloquea las peticiones sin él
+	DefaultMusicBrainzUserAgent = "music-ms/1.0"
+	// musicBrainzInterval es la separación entre peticiones que exige la API pública
+	musicBrainzInterval = time.Second
+	// musicBrainzPageSize es el máximo de resultados por página que admite la API
+	musicBrainzPageSize = 100
+	// coverArtURL da la portada de un release group desde Cover Art Archive
+	coverArtURL = "https://coverartarchive.org/release-group/%s/front"
+)
+
+// MusicBrainzProvider obtiene los metadatos de la API de MusicBrainz (o de un servidor con
+// la misma API). Los álbumes son release groups; sus pistas se toman de la edición oficial
+// más antigua. Las peticiones se espacian para respetar el límite de una por segundo.
+type MusicBrainzProvider struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+	interval  time.Duration // Separación entre peticiones
+
+	mu   sync.Mutex
+	next time.Time // Momento a partir del cual se puede hacer la siguiente petición
+}
+
+// NewMusicBrainzProvider crea el proveedor; baseURL y userAgent vacíos usan los valores por defecto
+func NewMusicBrainzProvider(baseURL, userAgent string) *MusicBrainzProvider {
+	if baseURL == "" {
+		baseURL = DefaultMusicBrainzURL
+	}
+	if userAgent == "" {
+		userAgent = DefaultMusicBrainzUserAgent
+	}
+	return &MusicBrainzProvider{
+		baseURL:   baseURL,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		interval:  musicBrainzInterval,
+	}
+}
+
+// Name retorna el nombre del proveedor
+func (p *MusicBrainzProvider) Name() string {
+	return ProviderMusicBrainz
+}
+
+// Respuestas de la API, solo con los campos que se usan
+
+type mbArtist struct {
+	ID     string    `json:"id"`
+	Name   string    `json:"name"`
+	Genres []mbLabel `json:"genres"`
+	Tags   []mbLabel `json:"tags"`
+}
+
+type mbLabel struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type mbArtistCredit struct {
+	Name   string   `json:"name"`
+	Artist mbArtist `json:"artist"`
+}
+
+type mbReleaseGroup struct {
+	ID               string           `json:"id"`
+	Title            string           `json:"title"`
+	FirstReleaseDate string           `json:"first-release-date"`
+	ArtistCredit     []mbArtistCredit `json:"artist-credit"`
+	Releases         []mbRelease      `json:"releases"`
+}
+
+type mbRelease struct {
+	ID     string    `json:"id"`
+	Status string    `json:"status"`
+	Date   string    `json:"date"`
+	Media  []mbMedia `json:"media"`
+}
+
+type mbMedia struct {
+	Tracks []mbTrack `json:"tracks"`
+}
+
+type mbTrack struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Length int    `json:"length"` // Milisegundos; puede faltar
+}
+
+// SearchArtists busca artistas por nombre
+func (p *MusicBrainzProvider) SearchArtists(ctx context.Context, query string, limit int) ([]Artist, error) {
+	var result struct {
+		Artists []mbArtist `json:"artists"`
+	}
+	params := url.Values{"query": {query}, "limit": {strconv.Itoa(pageLimit(limit))}}
+	if err := p.get(ctx, "/artist", params, &result); err != nil {
+		return nil, err
+	}
+	artists := make([]Artist, len(result.Artists))
+	for i, artist := range result.Artists {
+		artists[i] = artist.toArtist()
+	}
+	return artists, nil
+}
+
+// SearchAlbums busca álbumes por título
+func (p *MusicBrainzProvider) SearchAlbums(ctx context.Context, query string, limit int) ([]Album, error) {
+	var result struct {
+		ReleaseGroups []mbReleaseGroup `json:"release-groups"`
+	}
+	params := url.Values{"query": {query}, "limit": {strconv.Itoa(pageLimit(limit))}}
+	if err := p.get(ctx, "/release-group", params, &result); err != nil {
+		return nil, err
+	}
+	albums := make([]Album, len(result.ReleaseGroups))
+	for i, group := range result.ReleaseGroups {
+		albums[i] = group.toAlbum()
+	}
+	return albums, nil
+}
+
+// GetArtist obtiene un artista por su MBID
+func (p *MusicBrainzProvider) GetArtist(ctx context.Context, id string) (*Artist, error) {
+	var artist mbArtist
+	if err := p.get(ctx, "/artist/"+url.PathEscape(id), url.Values{"inc": {"genres tags"}}, &artist); err != nil {
+		return nil, err
+	}
+	result := artist.toArtist()
+	return &result, nil
+}
+
+// GetAlbum obtiene un release group con las pistas de su edición oficial más antigua
+func (p *MusicBrainzProvider) GetAlbum(ctx context.Context, id string) (*Album, error) {
+	var group mbReleaseGroup
+	if err := p.get(ctx, "/release-group/"+url.PathEscape(id), url.Values{"inc": {"artist-credits releases"}}, &group); err != nil {
+		return nil, err
+	}
+	album := group.toAlbum()
+
+	release, ok := group.preferredRelease()
+	if !ok {
+		return &album, nil
+	}
+	var full mbRelease
+	if err := p.get(ctx, "/release/"+url.PathEscape(release.ID), url.Values{"inc": {"recordings"}}, &full); err != nil {
+		return nil, err
+	}
+	// Las pistas de varios discos se numeran seguidas. El ID es el de la pista en la
+	// edición: el de la grabación se repite en cada álbum que la incluye (recopilatorios,
+	// reediciones), y las canciones se identifican por él al importar.
+	for _, media := range full.Media {
+		for _, track := range media.Tracks {
+			album.Tracks = append(album.Tracks, Track{
+				ID:          track.ID,
+				Title:       track.Title,
+				DurationMs:  track.Length,
+				TrackNumber: len(album.Tracks) + 1,
+			})
+		}
+	}
+	return &album, nil
+}
+
+// GetArtistAlbums obtiene los álbumes y EPs de un artista
+func (p *MusicBrainzProvider) GetArtistAlbums(ctx context.Context, artistID string) ([]Album, error) {
+	var albums []Album
+	for offset := 0; ; offset += musicBrainzPageSize {
+		var page struct {
+			Count         int              `json:"release-group-count"`
+			ReleaseGroups []mbReleaseGroup `json:"release-groups"`
+		}
+		params := url.Values{
+			"artist": {artistID},
+			"type":   {"album|ep"},
+			"inc":    {"artist-credits"},
+			"limit":  {strconv.Itoa(musicBrainzPageSize)},
+			"offset": {strconv.Itoa(offset)},
+		}
+		if err := p.get(ctx, "/release-group", params, &page); err != nil {
+			return nil, err
+		}
+		for _, group := range page.ReleaseGroups {
+			albums = append(albums, group.toAlbum())
+		}
+		if len(page.ReleaseGroups) == 0 || offset+len(page.ReleaseGroups) >= page.Count {
+			return albums, nil
+		}
+	}
+}
+
+// get hace una petición a la API y decodifica la respuesta JSON
+func (p *MusicBrainzProvider) get(ctx context.Context, path string, params url.Values, out any) error {
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+	params.Set("fmt", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("musicbrainz: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// wait espera hasta que se pueda hacer la siguiente petición
+func (p *MusicBrainzProvider) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// pageLimit ajusta el límite de una búsqueda al rango que admite la API
+func pageLimit(limit int) int {
+	if limit <= 0 || limit > musicBrainzPageSize {
+		return musicBrainzPageSize
+	}
+	return limit
+}
+
+func (a mbArtist) toArtist() Artist {
+	// Los géneros son las etiquetas curadas; si no tiene, se usan las etiquetas de usuarios
+	labels := a.Genres
+	if len(labels) == 0 {
+		labels = a.Tags
+	}
+	labels = append([]mbLabel(nil), labels...)
+	sort.SliceStable(labels, func(i, j int) bool { return labels[i].Count > labels[j].Count })
+
+	genres := make([]string, 0, len(labels))
+	for _, label := range labels {
+		genres = append(genres, label.Name)
+	}
+	return Artist{ID: a.ID, Name: a.Name, Genres: genres}
+}
+
+func (g mbReleaseGroup) toAlbum() Album {
+	album := Album{
+		ID:          g.ID,
+		Title:       g.Title,
+		ReleaseDate: g.FirstReleaseDate,
+		ImageURL:    fmt.Sprintf(coverArtURL, g.ID),
+		Artists:     make([]ArtistRef, len(g.ArtistCredit)),
+	}
+	for i, credit := range g.ArtistCredit {
+		album.Artists[i] = ArtistRef{ID: credit.Artist.ID, Name: credit.Artist.Name}
+	}
+	return album
+}
+
+// preferredRelease elige la edición oficial más antigua; si no hay oficiales, la más antigua
+func (g mbReleaseGroup) preferredRelease() (mbRelease, bool) {
+	if len(g.Releases) == 0 {
+		return mbRelease{}, false
+	}
+	releases := append([]mbRelease(nil), g.Releases...)
+	sort.SliceStable(releases, func(i, j int) bool {
+		a, b := releases[i], releases[j]
+		if (a.Status == "Official") != (b.Status == "Official") {
+			return a.Status == "Official"
+		}
+		// Las ediciones sin fecha van al final
+		if (a.Date == "") != (b.Date == "") {
+			return b.Date == ""
+		}
+		return a.Date < b.Date
+	})
+	return releases[0], true
+}
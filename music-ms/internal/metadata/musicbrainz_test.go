@@ -0,0 +1,218 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMusicBrainz responde con el JSON fijado para cada ruta y guarda las peticiones
+type fakeMusicBrainz struct {
+	*httptest.Server
+	responses map[string]func(r *http.Request) string // Cuerpo por ruta; sin ruta, 404
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func newFakeMusicBrainz(t *testing.T, responses map[string]func(r *http.Request) string) *fakeMusicBrainz {
+	t.Helper()
+	fake := &fakeMusicBrainz{responses: responses}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, r)
+		fake.mu.Unlock()
+		respond, ok := fake.responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, respond(r))
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// provider crea el proveedor contra el servidor falso, sin espera entre peticiones
+func (f *fakeMusicBrainz) provider() *MusicBrainzProvider {
+	p := NewMusicBrainzProvider(f.URL, "music-ms-test/1.0 (test@example.com)")
+	p.interval = 0
+	return p
+}
+
+// seen devuelve las peticiones recibidas hasta ahora
+func (f *fakeMusicBrainz) seen() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...)
+}
+
+func fixed(body string) func(r *http.Request) string {
+	return func(r *http.Request) string { return body }
+}
+
+// Las pistas se toman de la edición oficial más antigua, se numeran seguidas entre discos
+// y llevan el ID de la pista, no el de la grabación (que comparten otros álbumes)
+func TestMusicBrainzGetAlbum(t *testing.T) {
+	fake := newFakeMusicBrainz(t, map[string]func(r *http.Request) string{
+		"/release-group/rg1": fixed(`{
+			"id": "rg1", "title": "Motomami", "first-release-date": "2022-03-18",
+			"artist-credit": [{"name": "ROSALÍA", "artist": {"id": "ar1", "name": "ROSALÍA"}}],
+			"releases": [
+				{"id": "bootleg", "status": "Bootleg", "date": "2022-03-01"},
+				{"id": "reedicion", "status": "Official", "date": "2022-11-04"},
+				{"id": "original", "status": "Official", "date": "2022-03-18"},
+				{"id": "sin-fecha", "status": "Official"}
+			]}`),
+		"/release/original": fixed(`{"id": "original", "media": [
+			{"tracks": [
+				{"id": "t1", "title": "Saoko", "length": 137000, "recording": {"id": "rec1"}},
+				{"id": "t2", "title": "Candy", "recording": {"id": "rec2"}}
+			]},
+			{"tracks": [{"id": "t3", "title": "Hentai", "length": 161000, "recording": {"id": "rec3"}}]}
+		]}`),
+	})
+
+	album, err := fake.provider().GetAlbum(context.Background(), "rg1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Album{
+		ID: "rg1", Title: "Motomami", ReleaseDate: "2022-03-18",
+		ImageURL: "https://coverartarchive.org/release-group/rg1/front",
+		Artists:  []ArtistRef{{ID: "ar1", Name: "ROSALÍA"}},
+		Tracks: []Track{
+			{ID: "t1", Title: "Saoko", DurationMs: 137000, TrackNumber: 1},
+			{ID: "t2", Title: "Candy", TrackNumber: 2},
+			{ID: "t3", Title: "Hentai", DurationMs: 161000, TrackNumber: 3},
+		},
+	}
+	if !reflect.DeepEqual(album, want) {
+		t.Errorf("GetAlbum = %+v, se esperaba %+v", album, want)
+	}
+	var paths []string
+	for _, r := range fake.seen() {
+		paths = append(paths, r.URL.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"/release-group/rg1", "/release/original"}) {
+		t.Errorf("peticiones = %v, se esperaba el release group y su edición original", paths)
+	}
+}
+
+func TestMusicBrainzGetArtist(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"géneros curados", `{"id": "ar1", "name": "ROSALÍA",
+			"genres": [{"name": "pop", "count": 2}, {"name": "flamenco", "count": 5}],
+			"tags": [{"name": "spanish", "count": 9}]}`, []string{"flamenco", "pop"}},
+		{"solo etiquetas", `{"id": "ar1", "name": "ROSALÍA",
+			"tags": [{"name": "spanish", "count": 1}, {"name": "nuevo flamenco", "count": 3}]}`, []string{"nuevo flamenco", "spanish"}},
+		{"sin géneros", `{"id": "ar1", "name": "ROSALÍA"}`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeMusicBrainz(t, map[string]func(r *http.Request) string{"/artist/ar1": fixed(tt.body)})
+			artist, err := fake.provider().GetArtist(context.Background(), "ar1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if artist.ID != "ar1" || artist.Name != "ROSALÍA" || !reflect.DeepEqual(artist.Genres, tt.want) {
+				t.Errorf("GetArtist = %+v, se esperaban los géneros %v", artist, tt.want)
+			}
+
+			// MusicBrainz exige identificarse y la respuesta se pide en JSON
+			r := fake.seen()[0]
+			if r.UserAgent() != "music-ms-test/1.0 (test@example.com)" || r.URL.Query().Get("fmt") != "json" || r.URL.Query().Get("inc") != "genres tags" {
+				t.Errorf("petición %s con User-Agent %q, se esperaba el configurado y fmt=json", r.URL, r.UserAgent())
+			}
+		})
+	}
+}
+
+// La discografía se pide por páginas hasta completar release-group-count
+func TestMusicBrainzGetArtistAlbumsPages(t *testing.T) {
+	const total = 150
+	fake := newFakeMusicBrainz(t, map[string]func(r *http.Request) string{
+		"/release-group": func(r *http.Request) string {
+			var offset int
+			fmt.Sscan(r.URL.Query().Get("offset"), &offset)
+			body := fmt.Sprintf(`{"release-group-count": %d, "release-groups": [`, total)
+			for i := offset; i < min(offset+musicBrainzPageSize, total); i++ {
+				if i > offset {
+					body += ","
+				}
+				body += fmt.Sprintf(`{"id": "rg%d", "title": "Álbum %d"}`, i, i)
+			}
+			return body + "]}"
+		},
+	})
+
+	albums, err := fake.provider().GetArtistAlbums(context.Background(), "ar1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != total || albums[0].ID != "rg0" || albums[total-1].ID != fmt.Sprintf("rg%d", total-1) {
+		t.Fatalf("GetArtistAlbums = %d álbumes, se esperaban %d", len(albums), total)
+	}
+	var offsets []string
+	for _, r := range fake.seen() {
+		if r.URL.Query().Get("artist") != "ar1" {
+			t.Errorf("petición %s sin el artista", r.URL)
+		}
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+	}
+	if !reflect.DeepEqual(offsets, []string{"0", "100"}) {
+		t.Errorf("offsets = %v, se esperaban dos páginas", offsets)
+	}
+}
+
+func TestMusicBrainzErrors(t *testing.T) {
+	fake := newFakeMusicBrainz(t, map[string]func(r *http.Request) string{})
+	if _, err := fake.provider().GetAlbum(context.Background(), "no-existe"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAlbum error = %v, se esperaba %v", err, ErrNotFound)
+	}
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "mantenimiento", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	p := NewMusicBrainzProvider(unavailable.URL, "")
+	p.interval = 0
+	if _, err := p.GetArtist(context.Background(), "ar1"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetArtist error = %v, se esperaba el estado del servidor", err)
+	}
+}
+
+// Las peticiones se espacian interval aunque lleguen a la vez
+func TestMusicBrainzSpacesRequests(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	fake := newFakeMusicBrainz(t, map[string]func(r *http.Request) string{"/artist/ar1": fixed(`{"id": "ar1", "name": "ROSALÍA"}`)})
+	p := fake.provider()
+	p.interval = interval
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.GetArtist(context.Background(), "ar1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("3 peticiones en %v, se esperaban al menos %v", elapsed, 2*interval)
+	}
+}
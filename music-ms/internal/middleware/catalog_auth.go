@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CatalogAuthError comprueba la cabecera Authorization contra CATALOG_ADMIN_TOKEN y
+// devuelve el motivo del rechazo, o "" si la escritura está autorizada. El prefijo
+// "Bearer " es obligatorio.
+func CatalogAuthError(authorization, token string) string {
+	if token == "" {
+		return "las escrituras del catálogo están deshabilitadas (CATALOG_ADMIN_TOKEN no configurado)"
+	}
+	provided, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return "no autorizado para modificar el catálogo"
+	}
+	return ""
+}
+
+// CatalogWriteAuth protege las rutas REST que modifican el catálogo con el mismo token que
+// las mutaciones GraphQL: 401 sin token válido y 503 si no hay token configurado
+func CatalogWriteAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		message := CatalogAuthError(c.GetHeader("Authorization"), token)
+		switch {
+		case message == "":
+			c.Next()
+		case token == "":
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": message})
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+		}
+	}
+}
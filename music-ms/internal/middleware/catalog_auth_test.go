@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCatalogWriteAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		status        int
+	}{
+		{"token correcto", "secreto", "Bearer secreto", http.StatusOK},
+		{"sin cabecera", "secreto", "", http.StatusUnauthorized},
+		{"token sin prefijo Bearer", "secreto", "secreto", http.StatusUnauthorized},
+		{"otro esquema", "secreto", "Basic secreto", http.StatusUnauthorized},
+		{"token incorrecto", "secreto", "Bearer otro", http.StatusUnauthorized},
+		{"escrituras deshabilitadas", "", "Bearer ", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.PUT("/songs/:id/lyrics", CatalogWriteAuth(tt.token), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPut, "/songs/1/lyrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, se esperaba %d (%s)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -12,6 +12,8 @@ type Album struct {
 	Title       string               `bson:"title" json:"title"`
 	ReleaseDate string               `bson:"release_date" json:"release_date"`
 	SpotifyID   string               `bson:"spotify_id" json:"spotify_id"`
+	Provider    string               `bson:"provider,omitempty" json:"provider,omitempty"`       // Proveedor de metadatos de origen
+	ExternalID  string               `bson:"external_id,omitempty" json:"external_id,omitempty"` // ID en ese proveedor
 	ImageURL    string               `bson:"image_url" json:"image_url"`
 	ArtistIDs   []primitive.ObjectID `bson:"artist_ids" json:"artist_ids"`
 	Year        int                  `bson:"year" json:"year"`
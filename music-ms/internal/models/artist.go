@@ -17,6 +17,14 @@ type Artist struct {
 	Popularity int               `bson:"popularity" json:"popularity"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Los artistas seguidos reciben sus álbumes nuevos en el refresco programado
+	Followed    bool       `bson:"followed" json:"followed"`
+	RefreshedAt *time.Time `bson:"refreshed_at,omitempty" json:"refreshed_at,omitempty"`
+
+	// Proveedor de metadatos del que se importó (spotify, musicbrainz, local) y su ID allí
+	Provider   string `bson:"provider,omitempty" json:"provider,omitempty"`
+	ExternalID string `bson:"external_id,omitempty" json:"external_id,omitempty"`
 }
 
 // ArtistWithDetails representa un artista con sus álbumes y canciones
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Estados de un trabajo de importación
+const (
+	ImportJobPending   = "pending"   // En cola, o devuelto a la cola por un worker que se detuvo
+	ImportJobRunning   = "running"   // Un worker lo está procesando
+	ImportJobCompleted = "completed" // Terminado; algunos álbumes pueden haber fallado
+	ImportJobFailed    = "failed"    // No se pudo obtener el artista o su discografía
+	ImportJobCancelled = "cancelled"
+)
+
+// Estados de cada álbum de un trabajo
+const (
+	ImportAlbumPending = "pending"
+	ImportAlbumDone    = "done"
+	ImportAlbumFailed  = "failed"
+)
+
+// ImportJob es la importación en segundo plano de la discografía de un artista de Spotify.
+// Guarda el estado de cada álbum para poder reanudarla tras un reinicio.
+type ImportJob struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Status          string             `bson:"status" json:"status"`
+	Query           string             `bson:"query" json:"query"` // Nombre buscado en Spotify
+	SpotifyArtistID string             `bson:"spotify_artist_id" json:"spotify_artist_id"`
+	ArtistName      string             `bson:"artist_name" json:"artist_name"`
+	ArtistID        primitive.ObjectID `bson:"artist_id,omitempty" json:"artist_id,omitempty"`
+	AlbumsTotal     int                `bson:"albums_total" json:"albums_total"`
+	AlbumsDone      int                `bson:"albums_done" json:"albums_done"` // Procesados, con o sin error
+	AlbumsFailed    int                `bson:"albums_failed" json:"albums_failed"`
+	Albums          []ImportJobAlbum   `bson:"albums" json:"albums"` // Vacío hasta que se obtiene la discografía
+	Error           string             `bson:"error,omitempty" json:"error,omitempty"`
+	WorkerID        string             `bson:"worker_id,omitempty" json:"worker_id,omitempty"`     // Worker que lo está procesando
+	LeaseUntil      *time.Time         `bson:"lease_until,omitempty" json:"lease_until,omitempty"` // Reserva del worker; caducada, otro lo retoma
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	FinishedAt      *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// ImportJobAlbum es el progreso de un álbum dentro de un trabajo
+type ImportJobAlbum struct {
+	SpotifyID string             `bson:"spotify_id" json:"spotify_id"`
+	Title     string             `bson:"title" json:"title"`
+	Status    string             `bson:"status" json:"status"`
+	AlbumID   primitive.ObjectID `bson:"album_id,omitempty" json:"album_id,omitempty"`
+	Error     string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Finished indica si el trabajo ya no va a avanzar
+func (j *ImportJob) Finished() bool {
+	return j.Status == ImportJobCompleted || j.Status == ImportJobFailed || j.Status == ImportJobCancelled
+}
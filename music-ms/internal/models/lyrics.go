@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lyrics es la letra de una canción en un idioma. Puede ser solo texto plano o estar
+// sincronizada (líneas con tiempo, importadas desde LRC).
+type Lyrics struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SongID    primitive.ObjectID `bson:"song_id" json:"song_id"`
+	Language  string             `bson:"language" json:"language"` // Código ISO 639-1, p. ej. "es"
+	Source    string             `bson:"source" json:"source"`     // Origen de la letra (proveedor, usuario, etc.)
+	Plain     string             `bson:"plain" json:"plain"`
+	Lines     []LyricLine        `bson:"lines,omitempty" json:"lines,omitempty"`
+	Synced    bool               `bson:"synced" json:"synced"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LyricLine es una línea de letra y el momento (ms desde el inicio) en que empieza
+type LyricLine struct {
+	TimeMs int    `bson:"time_ms" json:"time_ms"`
+	Text   string `bson:"text" json:"text"`
+}
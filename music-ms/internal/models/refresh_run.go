@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Estados de una pasada de refresco
+const (
+	RefreshRunRunning   = "running"
+	RefreshRunCompleted = "completed" // Terminada; algunos artistas pueden haber fallado (ver Errors)
+	RefreshRunFailed    = "failed"    // Interrumpida, p. ej. por un reinicio
+)
+
+// Tipos de cambio del registro de un refresco
+const (
+	CatalogChangeArtist   = "artist"    // Campo de un artista actualizado
+	CatalogChangeAlbum    = "album"     // Campo de un álbum actualizado
+	CatalogChangeNewAlbum = "new_album" // Álbum nuevo importado de un artista seguido
+)
+
+// RefreshRun es una pasada del refresco del catálogo desde Spotify y el registro de lo
+// que cambió en ella
+type RefreshRun struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Status         string             `bson:"status" json:"status"`
+	Trigger        string             `bson:"trigger" json:"trigger"` // "schedule" o "manual"
+	ArtistsChecked int                `bson:"artists_checked" json:"artists_checked"`
+	AlbumsChecked  int                `bson:"albums_checked" json:"albums_checked"`
+	AlbumsImported int                `bson:"albums_imported" json:"albums_imported"`
+	Changes        []CatalogChange    `bson:"changes" json:"changes"`
+	Errors         []string           `bson:"errors" json:"errors"`
+	StartedAt      time.Time          `bson:"started_at" json:"started_at"`
+	FinishedAt     *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// CatalogChange es un cambio aplicado a un artista o álbum. En los álbumes nuevos no hay
+// Field ni valores.
+type CatalogChange struct {
+	Type  string             `bson:"type" json:"type"`
+	ID    primitive.ObjectID `bson:"id" json:"id"`
+	Name  string             `bson:"name" json:"name"` // Nombre o título, para leer el registro sin más consultas
+	Field string             `bson:"field,omitempty" json:"field,omitempty"`
+	Old   interface{}        `bson:"old,omitempty" json:"old,omitempty"`
+	New   interface{}        `bson:"new,omitempty" json:"new,omitempty"`
+}
@@ -12,6 +12,8 @@ type Song struct {
 	Title       string               `bson:"title" json:"title"`
 	Duration    int                  `bson:"duration" json:"duration"` // Duración en segundos
 	SpotifyID   string               `bson:"spotify_id" json:"spotify_id"`
+	Provider    string               `bson:"provider,omitempty" json:"provider,omitempty"`       // Proveedor de metadatos de origen
+	ExternalID  string               `bson:"external_id,omitempty" json:"external_id,omitempty"` // ID en ese proveedor
 	AlbumID     primitive.ObjectID   `bson:"album_id" json:"album_id"`
 	ArtistIDs   []primitive.ObjectID `bson:"artist_ids" json:"artist_ids"` // IDs de los artistas asociados a la canción
 	TrackNumber int                  `bson:"track_number" json:"track_number"`
@@ -19,8 +21,27 @@ type Song struct {
 	AudioPath   string               `bson:"audio_path" json:"audio_path"` // Para compatibilidad con código existente
 	S3Bucket    string               `bson:"s3_bucket" json:"s3_bucket,omitempty"`
 	S3Key       string               `bson:"s3_key" json:"s3_key,omitempty"`
-	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
+	// Disponibilidad por licencia: países permitidos (ISO 3166-1 alfa-2, vacío = todos)
+	// y ventana de fechas en la que se puede reproducir (nil = sin límite)
+	AvailableMarkets []string   `bson:"available_markets,omitempty" json:"available_markets,omitempty"`
+	AvailableFrom    *time.Time `bson:"available_from,omitempty" json:"available_from,omitempty"`
+	AvailableUntil   *time.Time `bson:"available_until,omitempty" json:"available_until,omitempty"`
+	// Sonoridad medida por cmd/loudness-analyzer (nil = aún no analizada)
+	Loudness  *Loudness `bson:"loudness,omitempty" json:"loudness,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Loudness es la sonoridad de una pista según BS.1770 y las ganancias para normalizarla
+// al nivel de referencia, a nivel de pista y de álbum
+type Loudness struct {
+	IntegratedLUFS float64   `bson:"integrated_lufs" json:"integrated_lufs"`
+	PeakDBFS       float64   `bson:"peak_dbfs" json:"peak_dbfs"`
+	TrackGainDB    float64   `bson:"track_gain_db" json:"track_gain_db"`
+	AlbumGainDB    float64   `bson:"album_gain_db" json:"album_gain_db"`
+	AlbumPeakDBFS  float64   `bson:"album_peak_dbfs" json:"album_peak_dbfs"`
+	ReferenceLUFS  float64   `bson:"reference_lufs" json:"reference_lufs"`
+	AnalyzedAt     time.Time `bson:"analyzed_at" json:"analyzed_at"`
 }
 
 // SongWithDetails representa una canción con detalles del álbum y artista
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/agnivade/levenshtein"
+)
+
+// DefaultMaxEdits es la tolerancia por defecto: hasta dos letras de más, de menos o cambiadas
+const DefaultMaxEdits = 2
+
+// AllowedEdits devuelve cuántas ediciones se toleran en un término según su longitud:
+// ninguna hasta 3 letras, una hasta 7 y dos a partir de 8, sin pasar de maxEdits
+func AllowedEdits(term string, maxEdits int) int {
+	edits := 0
+	switch n := utf8.RuneCountInString(term); {
+	case n >= 8:
+		edits = 2
+	case n >= 4:
+		edits = 1
+	}
+	return min(edits, maxEdits)
+}
+
+// Corrections devuelve hasta max palabras del índice a una distancia de edición de word
+// de como mucho maxEdits: primero las más cercanas y, a igual distancia, las que aparecen
+// en más elementos. Si word ya está en el índice devuelve solo word.
+func (x *SuggestionIndex) Corrections(word string, maxEdits, max int) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if _, ok := x.postings[word]; ok {
+		return []string{word}
+	}
+	if maxEdits <= 0 || max <= 0 {
+		return nil
+	}
+
+	type candidate struct {
+		word     string
+		distance int
+		count    int
+	}
+	var candidates []candidate
+	length := utf8.RuneCountInString(word)
+	for _, w := range x.words {
+		// La diferencia de longitud ya es una cota inferior de la distancia
+		if diff := utf8.RuneCountInString(w) - length; diff > maxEdits || -diff > maxEdits {
+			continue
+		}
+		if d := levenshtein.ComputeDistance(word, w); d <= maxEdits {
+			candidates = append(candidates, candidate{word: w, distance: d, count: len(x.postings[w])})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].count > candidates[j].count
+	})
+
+	if len(candidates) > max {
+		candidates = candidates[:max]
+	}
+	words := make([]string, len(candidates))
+	for i, c := range candidates {
+		words[i] = c.word
+	}
+	return words
+}
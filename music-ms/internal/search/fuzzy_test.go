@@ -0,0 +1,65 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllowedEdits(t *testing.T) {
+	tests := []struct {
+		term     string
+		maxEdits int
+		want     int
+	}{
+		{"sol", 2, 0},
+		{"amor", 2, 1},
+		{"corazon", 2, 1},
+		{"canciones", 2, 2},
+		{"corazón", 2, 1}, // Cuenta letras, no bytes
+		{"ñandú", 2, 1},
+		{"bohemian", 1, 1}, // Nunca más que maxEdits
+		{"bohemian", 0, 0},
+		{"", 2, 0},
+	}
+	for _, tt := range tests {
+		if got := AllowedEdits(tt.term, tt.maxEdits); got != tt.want {
+			t.Errorf("AllowedEdits(%q, %d) = %d, se esperaba %d", tt.term, tt.maxEdits, got, tt.want)
+		}
+	}
+}
+
+func TestCorrections(t *testing.T) {
+	index := NewSuggestionIndex()
+	for _, item := range []Suggestion{
+		{Type: "artist", ID: "a1", Text: "Metallica"},
+		{Type: "song", ID: "s1", Text: "Bohemian Rhapsody"},
+		{Type: "song", ID: "s2", Text: "Bohemian Like You"},
+		{Type: "song", ID: "s3", Text: "Bohemia"},
+	} {
+		index.Upsert(item)
+	}
+
+	tests := []struct {
+		name     string
+		word     string
+		maxEdits int
+		max      int
+		want     []string
+	}{
+		{"palabra existente", "metallica", 2, 5, []string{"metallica"}},
+		{"una letra cambiada", "metalica", 1, 5, []string{"metallica"}},
+		// A igual distancia, primero la que aparece en más elementos
+		{"más cercana y más frecuente primero", "bohemiam", 2, 5, []string{"bohemian", "bohemia"}},
+		{"máximo de correcciones", "bohemiam", 2, 1, []string{"bohemian"}},
+		{"fuera de la tolerancia", "metalika", 1, 5, []string{}},
+		{"sin tolerancia", "metalica", 0, 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := index.Corrections(tt.word, tt.maxEdits, tt.max)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Corrections(%q, %d, %d) = %#v, se esperaba %#v", tt.word, tt.maxEdits, tt.max, got, tt.want)
+			}
+		})
+	}
+}
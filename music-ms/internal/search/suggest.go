@@ -0,0 +1,271 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Suggestion es un elemento del catálogo que se puede sugerir mientras se escribe
+type Suggestion struct {
+	Type       string `json:"type"` // "song", "album" o "artist"
+	ID         string `json:"id"`
+	Text       string `json:"text"`               // Título o nombre
+	Subtitle   string `json:"subtitle,omitempty"` // Artista principal de canciones y álbumes
+	Popularity int    `json:"-"`
+}
+
+// SuggestResult es una sugerencia con la parte escrita marcada
+type SuggestResult struct {
+	Suggestion
+	Highlight string `json:"highlight"`
+}
+
+type indexEntry struct {
+	Suggestion
+	folded string
+	words  []string
+}
+
+// SuggestionIndex es un índice en memoria de prefijos de palabras. Se consulta en
+// microsegundos y admite altas, cambios y bajas mientras se usa.
+type SuggestionIndex struct {
+	mu       sync.RWMutex
+	entries  map[string]*indexEntry            // por tipo:id
+	postings map[string]map[string]*indexEntry // palabra normalizada -> entradas
+	words    []string                          // claves de postings ordenadas, para buscar por prefijo
+
+	rebuildMu sync.Mutex    // Una sola reconstrucción a la vez
+	journal   []indexChange // Cambios incrementales durante una reconstrucción; nil si no hay
+}
+
+// indexChange es un alta o una baja anotada mientras se reconstruye el índice
+type indexChange struct {
+	key   string
+	entry *indexEntry // nil = baja
+}
+
+// NewSuggestionIndex crea un índice vacío
+func NewSuggestionIndex() *SuggestionIndex {
+	return &SuggestionIndex{
+		entries:  make(map[string]*indexEntry),
+		postings: make(map[string]map[string]*indexEntry),
+	}
+}
+
+func entryKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+func newIndexEntry(s Suggestion) *indexEntry {
+	return &indexEntry{Suggestion: s, folded: Fold(s.Text), words: Terms(s.Text)}
+}
+
+// Len devuelve el número de elementos indexados
+func (x *SuggestionIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// Rebuild sustituye todo el contenido por lo que devuelve load, que suele leer el catálogo
+// completo. Las palabras se ordenan una sola vez en lugar de insertarlas de una en una, y
+// las consultas siguen usando el índice anterior hasta el cambio. Las altas y bajas que
+// llegan mientras load lee se vuelven a aplicar sobre el resultado, porque load puede no
+// haberlas visto. Si load falla el índice no cambia.
+func (x *SuggestionIndex) Rebuild(load func() ([]Suggestion, error)) error {
+	x.rebuildMu.Lock()
+	defer x.rebuildMu.Unlock()
+
+	x.mu.Lock()
+	x.journal = []indexChange{}
+	x.mu.Unlock()
+
+	items, err := load()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	journal := x.journal
+	x.journal = nil
+	if err != nil {
+		return err
+	}
+
+	fresh := &SuggestionIndex{
+		entries:  make(map[string]*indexEntry, len(items)),
+		postings: make(map[string]map[string]*indexEntry),
+	}
+	for _, item := range items {
+		key := entryKey(item.Type, item.ID)
+		entry := newIndexEntry(item)
+		fresh.entries[key] = entry
+		for _, word := range entry.words {
+			posting, ok := fresh.postings[word]
+			if !ok {
+				posting = make(map[string]*indexEntry)
+				fresh.postings[word] = posting
+			}
+			posting[key] = entry
+		}
+	}
+	fresh.words = make([]string, 0, len(fresh.postings))
+	for word := range fresh.postings {
+		fresh.words = append(fresh.words, word)
+	}
+	sort.Strings(fresh.words)
+
+	for _, change := range journal {
+		fresh.removeLocked(change.key)
+		if change.entry != nil {
+			fresh.insertLocked(change.key, change.entry)
+		}
+	}
+	x.entries, x.postings, x.words = fresh.entries, fresh.postings, fresh.words
+	return nil
+}
+
+// Upsert añade el elemento o lo reemplaza si ya estaba
+func (x *SuggestionIndex) Upsert(s Suggestion) {
+	key := entryKey(s.Type, s.ID)
+	entry := newIndexEntry(s)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.journal != nil {
+		x.journal = append(x.journal, indexChange{key: key, entry: entry})
+	}
+	x.removeLocked(key)
+	x.insertLocked(key, entry)
+}
+
+// insertLocked añade una entrada que no está en el índice. Las palabras nuevas se insertan
+// en su posición; solo se usa para cambios sueltos, la carga completa va por Rebuild.
+func (x *SuggestionIndex) insertLocked(key string, entry *indexEntry) {
+	x.entries[key] = entry
+	for _, word := range entry.words {
+		posting, ok := x.postings[word]
+		if !ok {
+			posting = make(map[string]*indexEntry)
+			x.postings[word] = posting
+			i := sort.SearchStrings(x.words, word)
+			x.words = append(x.words, "")
+			copy(x.words[i+1:], x.words[i:])
+			x.words[i] = word
+		}
+		posting[key] = entry
+	}
+}
+
+// Remove quita el elemento si estaba
+func (x *SuggestionIndex) Remove(kind, id string) {
+	key := entryKey(kind, id)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.journal != nil {
+		x.journal = append(x.journal, indexChange{key: key})
+	}
+	x.removeLocked(key)
+}
+
+func (x *SuggestionIndex) removeLocked(key string) {
+	entry, ok := x.entries[key]
+	if !ok {
+		return
+	}
+	delete(x.entries, key)
+	for _, word := range entry.words {
+		posting := x.postings[word]
+		delete(posting, key)
+		if len(posting) > 0 {
+			continue
+		}
+		delete(x.postings, word)
+		if i := sort.SearchStrings(x.words, word); i < len(x.words) && x.words[i] == word {
+			x.words = append(x.words[:i], x.words[i+1:]...)
+		}
+	}
+}
+
+// Suggest devuelve hasta limit elementos en los que la última palabra de la consulta es
+// prefijo de alguna palabra y las anteriores también aparecen (como palabra o prefijo).
+// Se ordenan primero los que empiezan por la consulta, luego por popularidad y por
+// longitud. types filtra por tipo; vacío incluye todos.
+func (x *SuggestionIndex) Suggest(query string, types []string, limit int) []SuggestResult {
+	terms := Terms(query)
+	if len(terms) == 0 || limit <= 0 {
+		return nil
+	}
+	last, previous := terms[len(terms)-1], terms[:len(terms)-1]
+	wanted := make(map[string]bool, len(types))
+	for _, t := range types {
+		wanted[t] = true
+	}
+	phrase := strings.Join(terms, " ")
+
+	// Se conservan solo los limit mejores para no ordenar miles de candidatos con prefijos cortos
+	var best []candidate
+	seen := make(map[*indexEntry]bool)
+
+	x.mu.RLock()
+	for i := sort.SearchStrings(x.words, last); i < len(x.words) && strings.HasPrefix(x.words[i], last); i++ {
+		for _, entry := range x.postings[x.words[i]] {
+			if seen[entry] || (len(wanted) > 0 && !wanted[entry.Type]) || !hasAllPrefixes(entry.words, previous) {
+				continue
+			}
+			seen[entry] = true
+			c := candidate{entry: entry, score: entry.Popularity}
+			if strings.HasPrefix(entry.folded, phrase) {
+				c.score += 1000
+			}
+			if len(best) == limit && !c.better(best[limit-1]) {
+				continue
+			}
+			pos := sort.Search(len(best), func(j int) bool { return c.better(best[j]) })
+			if len(best) < limit {
+				best = append(best, candidate{})
+			}
+			copy(best[pos+1:], best[pos:])
+			best[pos] = c
+		}
+	}
+	x.mu.RUnlock()
+
+	results := make([]SuggestResult, len(best))
+	for i, c := range best {
+		highlight, _ := Highlight(c.entry.Text, terms)
+		results[i] = SuggestResult{Suggestion: c.entry.Suggestion, Highlight: highlight}
+	}
+	return results
+}
+
+type candidate struct {
+	entry *indexEntry
+	score int
+}
+
+// better ordena por puntuación, luego los textos más cortos y después alfabéticamente
+func (c candidate) better(other candidate) bool {
+	if c.score != other.score {
+		return c.score > other.score
+	}
+	if len(c.entry.folded) != len(other.entry.folded) {
+		return len(c.entry.folded) < len(other.entry.folded)
+	}
+	return c.entry.folded < other.entry.folded
+}
+
+func hasAllPrefixes(words, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
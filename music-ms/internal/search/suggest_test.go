@@ -0,0 +1,188 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// catalog es un catálogo pequeño para las pruebas del índice
+var catalog = []Suggestion{
+	{Type: "artist", ID: "a1", Text: "Beyoncé", Popularity: 90},
+	{Type: "album", ID: "b1", Text: "Beyoncé", Subtitle: "Beyoncé", Popularity: 80},
+	{Type: "song", ID: "s1", Text: "Beyond the Sea", Subtitle: "Bobby Darin", Popularity: 40},
+	{Type: "song", ID: "s2", Text: "Canción del Mariachi", Subtitle: "Los Lobos", Popularity: 50},
+	{Type: "artist", ID: "a2", Text: "Los Lobos", Popularity: 50},
+	{Type: "song", ID: "s3", Text: "La Bamba", Subtitle: "Los Lobos", Popularity: 50},
+}
+
+func newCatalogIndex(t *testing.T) *SuggestionIndex {
+	t.Helper()
+	index := NewSuggestionIndex()
+	if err := index.Rebuild(func() ([]Suggestion, error) { return catalog, nil }); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func suggestionIDs(results []SuggestResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Type + ":" + result.ID
+	}
+	return ids
+}
+
+func TestSuggest(t *testing.T) {
+	index := newCatalogIndex(t)
+	tests := []struct {
+		name  string
+		query string
+		types []string
+		limit int
+		want  []string
+	}{
+		// Los que empiezan por la consulta primero, luego popularidad y textos más cortos
+		{"prefijo", "bey", nil, 8, []string{"artist:a1", "album:b1", "song:s1"}},
+		{"sin acentos ni mayúsculas", "CANCIÓN", nil, 8, []string{"song:s2"}},
+		{"palabra intermedia", "mariachi", nil, 8, []string{"song:s2"}},
+		{"varias palabras", "los lob", nil, 8, []string{"artist:a2"}},
+		{"palabras anteriores como prefijo", "b sea", nil, 8, []string{"song:s1"}},
+		{"filtro por tipo", "bey", []string{"song"}, 8, []string{"song:s1"}},
+		{"límite", "bey", nil, 2, []string{"artist:a1", "album:b1"}},
+		{"sin coincidencias", "zzz", nil, 8, []string{}},
+		{"consulta vacía", "  ", nil, 8, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := suggestionIDs(index.Suggest(tt.query, tt.types, tt.limit))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest(%q) = %v, se esperaba %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestHighlight(t *testing.T) {
+	index := newCatalogIndex(t)
+	results := index.Suggest("bey", []string{"artist"}, 1)
+	if len(results) != 1 || results[0].Highlight != "<em>Bey</em>oncé" {
+		t.Errorf("Suggest = %+v, se esperaba el resaltado <em>Bey</em>oncé", results)
+	}
+}
+
+func TestSuggestionIndexChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(index *SuggestionIndex)
+		query  string
+		want   []string
+	}{
+		{
+			name:   "alta",
+			change: func(index *SuggestionIndex) { index.Upsert(Suggestion{Type: "artist", ID: "a3", Text: "Bebe"}) },
+			query:  "beb",
+			want:   []string{"artist:a3"},
+		},
+		{
+			name:   "cambio de texto",
+			change: func(index *SuggestionIndex) { index.Upsert(Suggestion{Type: "song", ID: "s3", Text: "Kiko"}) },
+			query:  "bamba",
+			want:   []string{},
+		},
+		{
+			name:   "baja",
+			change: func(index *SuggestionIndex) { index.Remove("artist", "a2") },
+			query:  "lobos",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newCatalogIndex(t)
+			tt.change(index)
+			got := suggestionIDs(index.Suggest(tt.query, []string{"artist", "song"}, 8))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest(%q) = %v, se esperaba %v", tt.query, got, tt.want)
+			}
+			if !sort.StringsAreSorted(index.words) {
+				t.Errorf("las palabras del índice no están ordenadas: %v", index.words)
+			}
+		})
+	}
+}
+
+// Reconstruir de una vez debe dejar el mismo índice que insertar elemento a elemento
+func TestRebuildMatchesUpserts(t *testing.T) {
+	rebuilt := newCatalogIndex(t)
+	incremental := NewSuggestionIndex()
+	for _, item := range catalog {
+		incremental.Upsert(item)
+	}
+	if !reflect.DeepEqual(rebuilt.words, incremental.words) {
+		t.Errorf("palabras = %v, se esperaba %v", rebuilt.words, incremental.words)
+	}
+	if rebuilt.Len() != incremental.Len() {
+		t.Errorf("Len = %d, se esperaba %d", rebuilt.Len(), incremental.Len())
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	failure := errors.New("mongo caído")
+	tests := []struct {
+		name string
+		// during se ejecuta mientras load lee el catálogo
+		during  func(index *SuggestionIndex)
+		load    []Suggestion
+		loadErr error
+		wantErr error
+		want    []string // Resultado de buscar "l"
+	}{
+		{
+			name: "sustituye el contenido",
+			load: []Suggestion{{Type: "artist", ID: "a9", Text: "Luis Miguel"}},
+			want: []string{"artist:a9"},
+		},
+		{
+			name:   "conserva las altas hechas durante la carga",
+			during: func(index *SuggestionIndex) { index.Upsert(Suggestion{Type: "artist", ID: "a8", Text: "Lila Downs"}) },
+			load:   []Suggestion{{Type: "artist", ID: "a9", Text: "Luis Miguel"}},
+			want:   []string{"artist:a8", "artist:a9"},
+		},
+		{
+			name:   "conserva las bajas hechas durante la carga",
+			during: func(index *SuggestionIndex) { index.Remove("artist", "a9") },
+			load:   []Suggestion{{Type: "artist", ID: "a9", Text: "Luis Miguel"}},
+			want:   []string{},
+		},
+		{
+			name:    "si la carga falla no cambia",
+			loadErr: failure,
+			wantErr: failure,
+			want:    []string{"artist:a2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newCatalogIndex(t)
+			err := index.Rebuild(func() ([]Suggestion, error) {
+				if tt.during != nil {
+					tt.during(index)
+				}
+				return tt.load, tt.loadErr
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Rebuild error = %v, se esperaba %v", err, tt.wantErr)
+			}
+			got := suggestionIDs(index.Suggest("l", []string{"artist"}, 8))
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest = %v, se esperaba %v", got, tt.want)
+			}
+			if index.journal != nil {
+				t.Error("el diario de cambios debe vaciarse al terminar")
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package search normaliza textos del catálogo para buscar sin distinguir mayúsculas ni
+// acentos y marca las coincidencias en los resultados.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Marcas con las que Highlight rodea cada coincidencia
+const (
+	HighlightStart = "<em>"
+	HighlightEnd   = "</em>"
+)
+
+// foldRune pasa una runa a minúsculas y sin diacríticos ("Á" -> "a", "ñ" -> "n").
+// Puede devolver más de una runa (p. ej. ligaduras descompuestas) o ninguna.
+func foldRune(r rune) string {
+	var b strings.Builder
+	for _, c := range norm.NFKD.String(string(r)) {
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// Fold normaliza un texto para compararlo sin mayúsculas ni acentos
+func Fold(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		b.WriteString(foldRune(r))
+	}
+	return b.String()
+}
+
+// Terms divide una consulta en palabras normalizadas, sin repetidos
+func Terms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.FieldsFunc(Fold(query), isSeparator) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// foldedText es un texto normalizado que recuerda de qué byte del original viene cada byte
+type foldedText struct {
+	folded  string
+	offsets []int // offsets[i] = inicio en el original de la runa que produjo folded[i]; uno más al final
+}
+
+func foldWithOffsets(text string) foldedText {
+	var b strings.Builder
+	var offsets []int
+	for i, r := range text {
+		f := foldRune(r)
+		for j := 0; j < len(f); j++ {
+			offsets = append(offsets, i)
+		}
+		b.WriteString(f)
+	}
+	offsets = append(offsets, len(text))
+	return foldedText{folded: b.String(), offsets: offsets}
+}
+
+// originalEnd devuelve el fin en el original de un rango que termina en folded[end-1]
+func (f foldedText) originalEnd(text string, end int) int {
+	for next := end; next < len(f.offsets); next++ {
+		if f.offsets[next] != f.offsets[end-1] {
+			return f.offsets[next]
+		}
+	}
+	return len(text)
+}
+
+// Highlight escapa el texto como HTML y rodea con <em> las palabras que empiezan por algún
+// término. Devuelve también si hubo alguna coincidencia.
+func Highlight(text string, terms []string) (string, bool) {
+	f := foldWithOffsets(text)
+	type span struct{ start, end int }
+	var spans []span
+
+	// Se marca desde el inicio de cada palabra que empieza por un término
+	for i := 0; i < len(f.folded); {
+		r, size := utf8.DecodeRuneInString(f.folded[i:])
+		if isSeparator(r) {
+			i += size
+			continue
+		}
+		wordEnd := i
+		for wordEnd < len(f.folded) {
+			r, size := utf8.DecodeRuneInString(f.folded[wordEnd:])
+			if isSeparator(r) {
+				break
+			}
+			wordEnd += size
+		}
+		word := f.folded[i:wordEnd]
+		best := 0
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) && len(term) > best {
+				best = len(term)
+			}
+		}
+		if best > 0 {
+			spans = append(spans, span{f.offsets[i], f.originalEnd(text, i+best)})
+		}
+		i = wordEnd
+	}
+
+	if len(spans) == 0 {
+		return html.EscapeString(text), false
+	}
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		b.WriteString(html.EscapeString(text[last:s.start]))
+		b.WriteString(HighlightStart)
+		b.WriteString(html.EscapeString(text[s.start:s.end]))
+		b.WriteString(HighlightEnd)
+		last = s.end
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String(), true
+}
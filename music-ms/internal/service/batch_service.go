@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+// Consultas por lotes para los dataloaders de GraphQL: cada una resuelve muchos IDs con un
+// solo $in. Los IDs que no existen simplemente no aparecen en el resultado.
+
+func findAll[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []T
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetSongsByIDs obtiene las canciones indicadas, indexadas por ID
+func (s *MusicService) GetSongsByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Song, error) {
+	if len(ids) == 0 {
+		return map[primitive.ObjectID]*models.Song{}, nil
+	}
+	songs, err := findAll[models.Song](ctx, s.GetSongCollection(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[primitive.ObjectID]*models.Song, len(songs))
+	for i := range songs {
+		result[songs[i].ID] = &songs[i]
+	}
+	return result, nil
+}
+
+// GetAlbumsByIDs obtiene los álbumes indicados, indexados por ID
+func (s *MusicService) GetAlbumsByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Album, error) {
+	if len(ids) == 0 {
+		return map[primitive.ObjectID]*models.Album{}, nil
+	}
+	albums, err := findAll[models.Album](ctx, s.GetAlbumCollection(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[primitive.ObjectID]*models.Album, len(albums))
+	for i := range albums {
+		result[albums[i].ID] = &albums[i]
+	}
+	return result, nil
+}
+
+// GetArtistsByIDs obtiene los artistas indicados, indexados por ID
+func (s *MusicService) GetArtistsByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Artist, error) {
+	if len(ids) == 0 {
+		return map[primitive.ObjectID]*models.Artist{}, nil
+	}
+	artists, err := findAll[models.Artist](ctx, s.GetArtistCollection(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[primitive.ObjectID]*models.Artist, len(artists))
+	for i := range artists {
+		result[artists[i].ID] = &artists[i]
+	}
+	return result, nil
+}
+
+// GetSongsByAlbumIDs agrupa por álbum las canciones de varios álbumes, en orden de pista
+func (s *MusicService) GetSongsByAlbumIDs(ctx context.Context, albumIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Song, error) {
+	songs, err := findAll[models.Song](ctx, s.GetSongCollection(), bson.M{"album_id": bson.M{"$in": albumIDs}},
+		options.Find().SetSort(bson.D{{Key: "track_number", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[primitive.ObjectID][]models.Song)
+	for _, song := range songs {
+		result[song.AlbumID] = append(result[song.AlbumID], song)
+	}
+	return result, nil
+}
+
+// GetAlbumsByArtistIDs agrupa por artista los álbumes de varios artistas
+func (s *MusicService) GetAlbumsByArtistIDs(ctx context.Context, artistIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Album, error) {
+	albums, err := findAll[models.Album](ctx, s.GetAlbumCollection(), bson.M{"artist_ids": bson.M{"$in": artistIDs}},
+		options.Find().SetSort(bson.D{{Key: "year", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[primitive.ObjectID]bool, len(artistIDs))
+	for _, id := range artistIDs {
+		wanted[id] = true
+	}
+	result := make(map[primitive.ObjectID][]models.Album)
+	for _, album := range albums {
+		for _, artistID := range album.ArtistIDs {
+			if wanted[artistID] {
+				result[artistID] = append(result[artistID], album)
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetSongsByArtistIDs agrupa por artista sus canciones: las que lo tienen en artist_ids y
+// las de sus álbumes. Son dos consultas sea cual sea el número de artistas.
+func (s *MusicService) GetSongsByArtistIDs(ctx context.Context, artistIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Song, error) {
+	albums, err := findAll[models.Album](ctx, s.GetAlbumCollection(), bson.M{"artist_ids": bson.M{"$in": artistIDs}},
+		options.Find().SetProjection(bson.M{"_id": 1, "artist_ids": 1}))
+	if err != nil {
+		return nil, err
+	}
+	albumArtists := make(map[primitive.ObjectID][]primitive.ObjectID, len(albums))
+	albumIDs := make([]primitive.ObjectID, 0, len(albums))
+	for _, album := range albums {
+		albumArtists[album.ID] = album.ArtistIDs
+		albumIDs = append(albumIDs, album.ID)
+	}
+
+	songs, err := findAll[models.Song](ctx, s.GetSongCollection(), bson.M{"$or": bson.A{
+		bson.M{"artist_ids": bson.M{"$in": artistIDs}},
+		bson.M{"album_id": bson.M{"$in": albumIDs}},
+	}}, options.Find().SetSort(bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[primitive.ObjectID]bool, len(artistIDs))
+	for _, id := range artistIDs {
+		wanted[id] = true
+	}
+	result := make(map[primitive.ObjectID][]models.Song)
+	for _, song := range songs {
+		// Un artista puede figurar en la canción y en su álbum; se cuenta una vez
+		seen := make(map[primitive.ObjectID]bool)
+		for _, artistID := range append(append([]primitive.ObjectID{}, song.ArtistIDs...), albumArtists[song.AlbumID]...) {
+			if wanted[artistID] && !seen[artistID] {
+				seen[artistID] = true
+				result[artistID] = append(result[artistID], song)
+			}
+		}
+	}
+	return result, nil
+}
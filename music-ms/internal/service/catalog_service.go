@@ -0,0 +1,706 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+// ValidationError es un dato inválido en una escritura del catálogo
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// SongInput son los campos de una canción para crearla o modificarla.
+// En una modificación, los campos nil no cambian.
+type SongInput struct {
+	Title       *string
+	Duration    *int
+	AlbumID     *string
+	ArtistIDs   *[]string
+	TrackNumber *int
+	SpotifyID   *string
+	AudioURL    *string
+}
+
+// AlbumInput son los campos de un álbum para crearlo o modificarlo
+type AlbumInput struct {
+	Title       *string
+	ReleaseDate *string
+	Year        *int
+	ImageURL    *string
+	SpotifyID   *string
+	ArtistIDs   *[]string
+}
+
+// ArtistInput son los campos de un artista para crearlo o modificarlo
+type ArtistInput struct {
+	Name       *string
+	ImageURL   *string
+	Biography  *string
+	Genres     *[]string
+	Popularity *int
+	SpotifyID  *string
+}
+
+// GenreInput son los campos de un género para crearlo o modificarlo
+type GenreInput struct {
+	Name        *string
+	Description *string
+	ImageURL    *string
+}
+
+// releaseDatePattern acepta las precisiones que usa Spotify: año, año-mes o fecha completa
+var releaseDatePattern = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+// CreateSong valida y crea una canción. Si no se indican artistas se usan los del álbum.
+func (s *MusicService) CreateSong(ctx context.Context, input SongInput) (*models.Song, error) {
+	if input.Title == nil || input.Duration == nil {
+		return nil, invalid("input", "title y duration son obligatorios")
+	}
+	now := time.Now()
+	song := models.Song{ID: primitive.NewObjectID(), ArtistIDs: []primitive.ObjectID{}, CreatedAt: now, UpdatedAt: now}
+	if _, err := s.applySongInput(ctx, &song, input); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetSongCollection().InsertOne(ctx, song); err != nil {
+		return nil, err
+	}
+	s.refreshSongSuggestion(ctx, &song)
+	return &song, nil
+}
+
+// UpdateSong modifica los campos indicados de una canción. El $set lleva solo esos campos,
+// para no pisar los que el modelo no conoce ni los que otro proceso escribe a la vez
+// (loudness, disponibilidad, ...).
+func (s *MusicService) UpdateSong(ctx context.Context, id string, input SongInput) (*models.Song, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	var song models.Song
+	if err := s.GetSongCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&song); err != nil {
+		return nil, err
+	}
+	set, err := s.applySongInput(ctx, &song, input)
+	if err != nil {
+		return nil, err
+	}
+	song.UpdatedAt = time.Now()
+	set["updated_at"] = song.UpdatedAt
+	if _, err := s.GetSongCollection().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+	s.refreshSongSuggestion(ctx, &song)
+	return &song, nil
+}
+
+// applySongInput aplica la entrada sobre la canción y devuelve el $set con los campos que cambia
+func (s *MusicService) applySongInput(ctx context.Context, song *models.Song, input SongInput) (bson.M, error) {
+	set := bson.M{}
+	if input.Title != nil {
+		title := strings.TrimSpace(*input.Title)
+		if title == "" {
+			return nil, invalid("title", "no puede estar vacío")
+		}
+		song.Title = title
+		set["title"] = title
+	}
+	if input.Duration != nil {
+		if *input.Duration <= 0 {
+			return nil, invalid("duration", "debe ser mayor que 0 segundos")
+		}
+		song.Duration = *input.Duration
+		set["duration"] = song.Duration
+	}
+	if input.TrackNumber != nil {
+		if *input.TrackNumber < 0 {
+			return nil, invalid("track_number", "no puede ser negativo")
+		}
+		song.TrackNumber = *input.TrackNumber
+		set["track_number"] = song.TrackNumber
+	}
+	if input.SpotifyID != nil {
+		song.SpotifyID = strings.TrimSpace(*input.SpotifyID)
+		set["spotify_id"] = song.SpotifyID
+	}
+	if input.AudioURL != nil {
+		song.AudioURL = strings.TrimSpace(*input.AudioURL)
+		set["audio_url"] = song.AudioURL
+	}
+
+	var album *models.Album
+	if input.AlbumID != nil {
+		albumID, err := parseID("album_id", *input.AlbumID)
+		if err != nil {
+			return nil, err
+		}
+		album, err = s.GetAlbumByID(ctx, albumID)
+		if err == mongo.ErrNoDocuments {
+			return nil, invalid("album_id", "el álbum %s no existe", *input.AlbumID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		song.AlbumID = albumID
+		set["album_id"] = albumID
+	}
+	if input.ArtistIDs != nil {
+		ids, err := s.existingArtistIDs(ctx, "artist_ids", *input.ArtistIDs)
+		if err != nil {
+			return nil, err
+		}
+		song.ArtistIDs = ids
+		set["artist_ids"] = ids
+	} else if len(song.ArtistIDs) == 0 && album != nil {
+		song.ArtistIDs = album.ArtistIDs
+		set["artist_ids"] = song.ArtistIDs
+	}
+	return set, nil
+}
+
+// DeleteSong elimina una canción y sus letras
+func (s *MusicService) DeleteSong(ctx context.Context, id string) error {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+	result, err := s.GetSongCollection().DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	s.suggestions.Remove(SearchTypeSong, id)
+	_, err = s.GetLyricsCollection().DeleteMany(ctx, bson.M{"song_id": objectID})
+	return err
+}
+
+// CreateAlbum valida y crea un álbum
+func (s *MusicService) CreateAlbum(ctx context.Context, input AlbumInput) (*models.Album, error) {
+	if input.Title == nil || input.ArtistIDs == nil {
+		return nil, invalid("input", "title y artist_ids son obligatorios")
+	}
+	now := time.Now()
+	album := models.Album{ID: primitive.NewObjectID(), CreatedAt: now, UpdatedAt: now}
+	if _, err := s.applyAlbumInput(ctx, &album, input); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetAlbumCollection().InsertOne(ctx, album); err != nil {
+		return nil, err
+	}
+	s.RefreshAlbumSuggestions(ctx, album.ID)
+	return &album, nil
+}
+
+// UpdateAlbum modifica los campos indicados de un álbum. Si cambian sus artistas, las
+// canciones que heredaban los del álbum (artist_ids igual al anterior del álbum) pasan a
+// los nuevos; las que tienen artistas propios, como las colaboraciones, no se tocan.
+func (s *MusicService) UpdateAlbum(ctx context.Context, id string, input AlbumInput) (*models.Album, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	album, err := s.GetAlbumByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	previousArtists := album.ArtistIDs
+	set, err := s.applyAlbumInput(ctx, album, input)
+	if err != nil {
+		return nil, err
+	}
+	album.UpdatedAt = time.Now()
+	set["updated_at"] = album.UpdatedAt
+	if _, err := s.GetAlbumCollection().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+	if input.ArtistIDs != nil && !sameIDs(previousArtists, album.ArtistIDs) {
+		// Un array en el filtro solo coincide con uno idéntico, en el mismo orden
+		inherited := bson.M{"album_id": objectID, "artist_ids": previousArtists}
+		update := bson.M{"$set": bson.M{"artist_ids": album.ArtistIDs, "updated_at": album.UpdatedAt}}
+		if _, err := s.GetSongCollection().UpdateMany(ctx, inherited, update); err != nil {
+			return nil, err
+		}
+	}
+	s.RefreshAlbumSuggestions(ctx, objectID)
+	return album, nil
+}
+
+// applyAlbumInput aplica la entrada sobre el álbum y devuelve el $set con los campos que cambia
+func (s *MusicService) applyAlbumInput(ctx context.Context, album *models.Album, input AlbumInput) (bson.M, error) {
+	set := bson.M{}
+	if input.Title != nil {
+		title := strings.TrimSpace(*input.Title)
+		if title == "" {
+			return nil, invalid("title", "no puede estar vacío")
+		}
+		album.Title = title
+		set["title"] = title
+	}
+	if input.ReleaseDate != nil {
+		date := strings.TrimSpace(*input.ReleaseDate)
+		if date != "" && !releaseDatePattern.MatchString(date) {
+			return nil, invalid("release_date", "formato esperado AAAA, AAAA-MM o AAAA-MM-DD")
+		}
+		album.ReleaseDate = date
+		set["release_date"] = date
+		// El año se deriva de la fecha salvo que se indique explícitamente
+		if input.Year == nil && date != "" {
+			album.Year, _ = strconv.Atoi(date[:4])
+			set["year"] = album.Year
+		}
+	}
+	if input.Year != nil {
+		if *input.Year != 0 && (*input.Year < 1000 || *input.Year > 9999) {
+			return nil, invalid("year", "año inválido: %d", *input.Year)
+		}
+		album.Year = *input.Year
+		set["year"] = album.Year
+	}
+	if input.ImageURL != nil {
+		album.ImageURL = strings.TrimSpace(*input.ImageURL)
+		set["image_url"] = album.ImageURL
+	}
+	if input.SpotifyID != nil {
+		album.SpotifyID = strings.TrimSpace(*input.SpotifyID)
+		set["spotify_id"] = album.SpotifyID
+	}
+	if input.ArtistIDs != nil {
+		ids, err := s.existingArtistIDs(ctx, "artist_ids", *input.ArtistIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, invalid("artist_ids", "el álbum necesita al menos un artista")
+		}
+		album.ArtistIDs = ids
+		set["artist_ids"] = ids
+	}
+	return set, nil
+}
+
+// sameIDs indica si dos listas de IDs son iguales, en el mismo orden
+func sameIDs(a, b []primitive.ObjectID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteAlbum elimina un álbum. Si tiene canciones solo se elimina con deleteSongs,
+// que borra también las canciones y sus letras.
+func (s *MusicService) DeleteAlbum(ctx context.Context, id string, deleteSongs bool) error {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.GetAlbumByID(ctx, objectID); err != nil {
+		return err
+	}
+
+	songIDs, err := s.songIDs(ctx, bson.M{"album_id": objectID})
+	if err != nil {
+		return err
+	}
+	if len(songIDs) > 0 {
+		if !deleteSongs {
+			return invalid("id", "el álbum tiene %d canciones; use deleteSongs para eliminarlas", len(songIDs))
+		}
+		if _, err := s.GetLyricsCollection().DeleteMany(ctx, bson.M{"song_id": bson.M{"$in": songIDs}}); err != nil {
+			return err
+		}
+		if _, err := s.GetSongCollection().DeleteMany(ctx, bson.M{"album_id": objectID}); err != nil {
+			return err
+		}
+		for _, songID := range songIDs {
+			s.suggestions.Remove(SearchTypeSong, songID.Hex())
+		}
+	}
+	if _, err := s.GetAlbumCollection().DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+		return err
+	}
+	s.suggestions.Remove(SearchTypeAlbum, id)
+	return nil
+}
+
+// CreateArtist valida y crea un artista, sumándolo al contador de sus géneros
+func (s *MusicService) CreateArtist(ctx context.Context, input ArtistInput) (*models.Artist, error) {
+	if input.Name == nil {
+		return nil, invalid("input", "name es obligatorio")
+	}
+	now := time.Now()
+	artist := models.Artist{ID: primitive.NewObjectID(), Genres: []string{}, CreatedAt: now, UpdatedAt: now}
+	if _, err := applyArtistInput(&artist, input); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetArtistCollection().InsertOne(ctx, artist); err != nil {
+		return nil, err
+	}
+	s.refreshArtistSuggestions(ctx, &artist)
+	if err := s.adjustGenreCounts(ctx, artist.Genres, nil); err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
+
+// UpdateArtist modifica los campos indicados de un artista y ajusta los contadores de géneros
+func (s *MusicService) UpdateArtist(ctx context.Context, id string, input ArtistInput) (*models.Artist, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	artist, err := s.GetArtistByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	previousGenres := artist.Genres
+	set, err := applyArtistInput(artist, input)
+	if err != nil {
+		return nil, err
+	}
+	artist.UpdatedAt = time.Now()
+	set["updated_at"] = artist.UpdatedAt
+	if _, err := s.GetArtistCollection().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+	s.refreshArtistSuggestions(ctx, artist)
+	added, removed := diffGenres(previousGenres, artist.Genres)
+	if err := s.adjustGenreCounts(ctx, added, removed); err != nil {
+		return nil, err
+	}
+	return artist, nil
+}
+
+// applyArtistInput aplica la entrada sobre el artista y devuelve el $set con los campos que cambia
+func applyArtistInput(artist *models.Artist, input ArtistInput) (bson.M, error) {
+	set := bson.M{}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return nil, invalid("name", "no puede estar vacío")
+		}
+		artist.Name = name
+		set["name"] = name
+	}
+	if input.Popularity != nil {
+		if *input.Popularity < 0 || *input.Popularity > 100 {
+			return nil, invalid("popularity", "debe estar entre 0 y 100")
+		}
+		artist.Popularity = *input.Popularity
+		set["popularity"] = artist.Popularity
+	}
+	if input.ImageURL != nil {
+		artist.ImageURL = strings.TrimSpace(*input.ImageURL)
+		set["image_url"] = artist.ImageURL
+	}
+	if input.Biography != nil {
+		artist.Biography = strings.TrimSpace(*input.Biography)
+		set["biography"] = artist.Biography
+	}
+	if input.SpotifyID != nil {
+		artist.SpotifyID = strings.TrimSpace(*input.SpotifyID)
+		set["spotify_id"] = artist.SpotifyID
+	}
+	if input.Genres != nil {
+		genres := []string{}
+		seen := make(map[string]bool)
+		for _, genre := range *input.Genres {
+			genre = strings.TrimSpace(genre)
+			if genre == "" {
+				return nil, invalid("genres", "los géneros no pueden estar vacíos")
+			}
+			if !seen[genre] {
+				seen[genre] = true
+				genres = append(genres, genre)
+			}
+		}
+		artist.Genres = genres
+		set["genres"] = genres
+	}
+	return set, nil
+}
+
+// DeleteArtist elimina un artista, lo quita de artist_ids de álbumes y canciones y
+// descuenta sus géneros. Se rechaza si es el único artista de algún álbum o canción,
+// que quedarían sin artistas.
+func (s *MusicService) DeleteArtist(ctx context.Context, id string) error {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+	artist, err := s.GetArtistByID(ctx, objectID)
+	if err != nil {
+		return err
+	}
+
+	// Un array de un solo elemento solo coincide con artist_ids exactamente igual a [id]
+	onlyArtist := bson.M{"artist_ids": bson.A{objectID}}
+	albums, err := s.GetAlbumCollection().CountDocuments(ctx, onlyArtist)
+	if err != nil {
+		return err
+	}
+	if albums > 0 {
+		return invalid("id", "el artista es el único de %d álbumes; elimínelos o asígneles otro artista antes", albums)
+	}
+	songs, err := s.GetSongCollection().CountDocuments(ctx, onlyArtist)
+	if err != nil {
+		return err
+	}
+	if songs > 0 {
+		return invalid("id", "el artista es el único de %d canciones; elimínelas o asígneles otro artista antes", songs)
+	}
+
+	pull := bson.M{"$pull": bson.M{"artist_ids": objectID}}
+	if _, err := s.GetAlbumCollection().UpdateMany(ctx, bson.M{"artist_ids": objectID}, pull); err != nil {
+		return err
+	}
+	if _, err := s.GetSongCollection().UpdateMany(ctx, bson.M{"artist_ids": objectID}, pull); err != nil {
+		return err
+	}
+	if _, err := s.GetArtistCollection().DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+		return err
+	}
+	s.suggestions.Remove(SearchTypeArtist, id)
+	return s.adjustGenreCounts(ctx, nil, artist.Genres)
+}
+
+// CreateGenre crea un género; su contador parte de los artistas que ya lo tienen
+func (s *MusicService) CreateGenre(ctx context.Context, input GenreInput) (*models.Genre, error) {
+	if input.Name == nil {
+		return nil, invalid("input", "name es obligatorio")
+	}
+	now := time.Now()
+	genre := models.Genre{ID: primitive.NewObjectID(), CreatedAt: now, UpdatedAt: now}
+	if err := s.applyGenreInput(ctx, &genre, input); err != nil {
+		return nil, err
+	}
+	if genre.Description == "" {
+		genre.Description = fmt.Sprintf("Género musical: %s", genre.Name)
+	}
+	count, err := s.GetArtistCollection().CountDocuments(ctx, bson.M{"genres": genre.Name})
+	if err != nil {
+		return nil, err
+	}
+	genre.Count = int(count)
+	if _, err := s.db.Collection("genres").InsertOne(ctx, genre); err != nil {
+		return nil, err
+	}
+	return &genre, nil
+}
+
+// UpdateGenre modifica un género; al renombrarlo se renombra también en los artistas
+func (s *MusicService) UpdateGenre(ctx context.Context, id string, input GenreInput) (*models.Genre, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	var genre models.Genre
+	if err := s.db.Collection("genres").FindOne(ctx, bson.M{"_id": objectID}).Decode(&genre); err != nil {
+		return nil, err
+	}
+	previousName := genre.Name
+	if err := s.applyGenreInput(ctx, &genre, input); err != nil {
+		return nil, err
+	}
+
+	if genre.Name != previousName {
+		// Los artistas que ya tenían ambos nombres quedan con uno solo
+		if _, err := s.GetArtistCollection().UpdateMany(ctx,
+			bson.M{"genres": bson.M{"$all": bson.A{previousName, genre.Name}}},
+			bson.M{"$pull": bson.M{"genres": previousName}}); err != nil {
+			return nil, err
+		}
+		if _, err := s.GetArtistCollection().UpdateMany(ctx,
+			bson.M{"genres": previousName},
+			bson.M{"$set": bson.M{"genres.$": genre.Name}}); err != nil {
+			return nil, err
+		}
+		count, err := s.GetArtistCollection().CountDocuments(ctx, bson.M{"genres": genre.Name})
+		if err != nil {
+			return nil, err
+		}
+		genre.Count = int(count)
+	}
+	genre.UpdatedAt = time.Now()
+	if _, err := s.db.Collection("genres").UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": genre}); err != nil {
+		return nil, err
+	}
+	return &genre, nil
+}
+
+func (s *MusicService) applyGenreInput(ctx context.Context, genre *models.Genre, input GenreInput) error {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return invalid("name", "no puede estar vacío")
+		}
+		slug := slugify(name)
+		duplicate := bson.M{"_id": bson.M{"$ne": genre.ID}, "$or": bson.A{bson.M{"name": name}, bson.M{"slug": slug}}}
+		count, err := s.db.Collection("genres").CountDocuments(ctx, duplicate)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return invalid("name", "ya existe un género %q", name)
+		}
+		genre.Name, genre.Slug = name, slug
+	}
+	if input.Description != nil {
+		genre.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.ImageURL != nil {
+		genre.ImageURL = strings.TrimSpace(*input.ImageURL)
+	}
+	return nil
+}
+
+// DeleteGenre elimina un género y lo quita de los artistas que lo tenían
+func (s *MusicService) DeleteGenre(ctx context.Context, id string) error {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+	var genre models.Genre
+	if err := s.db.Collection("genres").FindOne(ctx, bson.M{"_id": objectID}).Decode(&genre); err != nil {
+		return err
+	}
+	if _, err := s.GetArtistCollection().UpdateMany(ctx,
+		bson.M{"genres": genre.Name},
+		bson.M{"$pull": bson.M{"genres": genre.Name}}); err != nil {
+		return err
+	}
+	_, err = s.db.Collection("genres").DeleteOne(ctx, bson.M{"_id": objectID})
+	return err
+}
+
+// adjustGenreCounts suma un artista a los géneros agregados (creándolos si no existen)
+// y lo resta de los quitados, sin bajar de cero
+func (s *MusicService) adjustGenreCounts(ctx context.Context, added, removed []string) error {
+	collection := s.db.Collection("genres")
+	now := time.Now()
+	for _, name := range added {
+		update := bson.M{
+			"$inc": bson.M{"count": 1},
+			"$set": bson.M{"updated_at": now},
+			"$setOnInsert": bson.M{
+				"slug":        slugify(name),
+				"description": fmt.Sprintf("Género musical: %s", name),
+				"created_at":  now,
+			},
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"name": name}, update, options.Update().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+	for _, name := range removed {
+		update := bson.M{"$inc": bson.M{"count": -1}, "$set": bson.M{"updated_at": now}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"name": name, "count": bson.M{"$gt": 0}}, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffGenres devuelve los géneros agregados y quitados entre dos listas
+func diffGenres(before, after []string) (added, removed []string) {
+	previous := make(map[string]bool, len(before))
+	for _, genre := range before {
+		previous[genre] = true
+	}
+	current := make(map[string]bool, len(after))
+	for _, genre := range after {
+		current[genre] = true
+		if !previous[genre] {
+			added = append(added, genre)
+		}
+	}
+	for _, genre := range before {
+		if !current[genre] {
+			removed = append(removed, genre)
+		}
+	}
+	return added, removed
+}
+
+// existingArtistIDs valida los IDs, quita duplicados y comprueba que todos los artistas existan
+func (s *MusicService) existingArtistIDs(ctx context.Context, field string, ids []string) ([]primitive.ObjectID, error) {
+	objectIDs := []primitive.ObjectID{}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, id := range ids {
+		objectID, err := parseID(field, id)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[objectID] {
+			seen[objectID] = true
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	if len(objectIDs) == 0 {
+		return objectIDs, nil
+	}
+
+	count, err := s.GetArtistCollection().CountDocuments(ctx, bson.M{"_id": bson.M{"$in": objectIDs}})
+	if err != nil {
+		return nil, err
+	}
+	if int(count) != len(objectIDs) {
+		return nil, invalid(field, "%d de los artistas indicados no existen", len(objectIDs)-int(count))
+	}
+	return objectIDs, nil
+}
+
+// songIDs devuelve los IDs de las canciones que cumplen el filtro
+func (s *MusicService) songIDs(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := s.GetSongCollection().Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
+
+func parseID(field, id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalid(field, "ID inválido: %q", id)
+	}
+	return objectID, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/search"
+)
+
+// document convierte un modelo en la respuesta que daría el servidor
+func document(t *testing.T, v interface{}) bson.D {
+	t.Helper()
+	data, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// sentUpdate es una orden update enviada al servidor simulado
+type sentUpdate struct {
+	collection string
+	filter     bson.Raw
+	set        bson.Raw
+}
+
+func (u sentUpdate) setKeys() []string {
+	var keys []string
+	elements, _ := u.set.Elements()
+	for _, element := range elements {
+		keys = append(keys, element.Key())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sentUpdates(mt *mtest.T) []sentUpdate {
+	var updates []sentUpdate
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName != "update" {
+			continue
+		}
+		statement := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+		updates = append(updates, sentUpdate{
+			collection: started.Command.Lookup("update").StringValue(),
+			filter:     statement.Lookup("q").Document(),
+			set:        statement.Lookup("u", "$set").Document(),
+		})
+	}
+	return updates
+}
+
+// Las modificaciones solo escriben los campos indicados (más updated_at): el resto del
+// documento, incluidos los campos que el modelo no conoce, queda como está en la base
+func TestUpdatesSetOnlyGivenFields(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	artistID := primitive.NewObjectID()
+	albumID := primitive.NewObjectID()
+	songID := primitive.NewObjectID()
+	title := "Nuevo título"
+	name := "Rosalía"
+	date := "2022-03-18"
+	found := func(collection string, v interface{}) bson.D {
+		return mtest.CreateCursorResponse(0, "music."+collection, mtest.FirstBatch, document(mt.T, v))
+	}
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		update    func(ctx context.Context, music *MusicService) error
+		want      map[string][]string
+	}{
+		{
+			name: "canción",
+			responses: []bson.D{
+				found("songs", models.Song{ID: songID, Title: "Antes", Duration: 200, AlbumID: albumID, ArtistIDs: []primitive.ObjectID{artistID}}),
+				mtest.CreateSuccessResponse(),
+			},
+			update: func(ctx context.Context, music *MusicService) error {
+				_, err := music.UpdateSong(ctx, songID.Hex(), SongInput{Title: &title})
+				return err
+			},
+			want: map[string][]string{"songs": {"title", "updated_at"}},
+		},
+		{
+			name: "álbum con fecha",
+			responses: []bson.D{
+				found("albums", models.Album{ID: albumID, Title: "Motomami", ArtistIDs: []primitive.ObjectID{artistID}}),
+				mtest.CreateSuccessResponse(),
+			},
+			update: func(ctx context.Context, music *MusicService) error {
+				_, err := music.UpdateAlbum(ctx, albumID.Hex(), AlbumInput{ReleaseDate: &date})
+				return err
+			},
+			want: map[string][]string{"albums": {"release_date", "updated_at", "year"}},
+		},
+		{
+			name: "artista",
+			responses: []bson.D{
+				found("artists", models.Artist{ID: artistID, Name: "rosalia", Genres: []string{"flamenco"}}),
+				mtest.CreateSuccessResponse(),
+			},
+			update: func(ctx context.Context, music *MusicService) error {
+				_, err := music.UpdateArtist(ctx, artistID.Hex(), ArtistInput{Name: &name})
+				return err
+			},
+			want: map[string][]string{"artists": {"name", "updated_at"}},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			music := &MusicService{db: mt.DB, suggestions: search.NewSuggestionIndex()}
+			if err := tt.update(context.Background(), music); err != nil {
+				mt.Fatal(err)
+			}
+			got := make(map[string][]string)
+			for _, update := range sentUpdates(mt) {
+				got[update.collection] = update.setKeys()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				mt.Errorf("$set = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Al cambiar los artistas de un álbum se actualizan las canciones que tenían exactamente
+// los artistas anteriores del álbum; las de artistas propios las excluye el filtro
+func TestUpdateAlbumArtistsUpdatesInheritedSongs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	albumID := primitive.NewObjectID()
+	before := primitive.NewObjectID()
+	after := primitive.NewObjectID()
+	album := models.Album{ID: albumID, Title: "Motomami", ArtistIDs: []primitive.ObjectID{before}}
+	count := func(n int) bson.D {
+		return mtest.CreateCursorResponse(0, "music.artists", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+	}
+
+	tests := []struct {
+		name      string
+		artistIDs []string
+		responses []bson.D
+		wantSongs bool
+	}{
+		{
+			name:      "artistas nuevos",
+			artistIDs: []string{after.Hex()},
+			responses: []bson.D{count(1), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse()},
+			wantSongs: true,
+		},
+		{
+			name:      "mismos artistas",
+			artistIDs: []string{before.Hex()},
+			responses: []bson.D{count(1), mtest.CreateSuccessResponse()},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "music.albums", mtest.FirstBatch, document(mt.T, album)))
+			mt.AddMockResponses(tt.responses...)
+			music := &MusicService{db: mt.DB, suggestions: search.NewSuggestionIndex()}
+			ids := tt.artistIDs
+			if _, err := music.UpdateAlbum(context.Background(), albumID.Hex(), AlbumInput{ArtistIDs: &ids}); err != nil {
+				mt.Fatal(err)
+			}
+
+			var songs []sentUpdate
+			for _, update := range sentUpdates(mt) {
+				if update.collection == "songs" {
+					songs = append(songs, update)
+				}
+			}
+			if !tt.wantSongs {
+				if len(songs) != 0 {
+					mt.Errorf("se actualizaron canciones sin cambiar los artistas: %v", songs)
+				}
+				return
+			}
+			if len(songs) != 1 {
+				mt.Fatalf("%d actualizaciones de canciones, se esperaba 1", len(songs))
+			}
+			var filter struct {
+				AlbumID   primitive.ObjectID   `bson:"album_id"`
+				ArtistIDs []primitive.ObjectID `bson:"artist_ids"`
+			}
+			var set struct {
+				ArtistIDs []primitive.ObjectID `bson:"artist_ids"`
+			}
+			if err := bson.Unmarshal(songs[0].filter, &filter); err != nil {
+				mt.Fatal(err)
+			}
+			if err := bson.Unmarshal(songs[0].set, &set); err != nil {
+				mt.Fatal(err)
+			}
+			if filter.AlbumID != albumID || !sameIDs(filter.ArtistIDs, []primitive.ObjectID{before}) {
+				mt.Errorf("filtro = %+v, se esperaban las canciones del álbum con artist_ids [%s]", filter, before.Hex())
+			}
+			if !sameIDs(set.ArtistIDs, []primitive.ObjectID{after}) {
+				mt.Errorf("artist_ids = %v, se esperaba [%s]", set.ArtistIDs, after.Hex())
+			}
+		})
+	}
+}
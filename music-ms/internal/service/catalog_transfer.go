@@ -0,0 +1,519 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/metadata"
+	"github.com/angel/music-ms/internal/models"
+)
+
+// CatalogCollections son las colecciones del volcado del catálogo, en el orden en que se
+// importan: cada una solo referencia a las anteriores
+var CatalogCollections = []string{"genres", "artists", "albums", "songs"}
+
+// maxCatalogLine es el tamaño máximo de una línea del volcado
+const maxCatalogLine = 16 << 20
+
+// Tipos de problema de una importación; el documento afectado no se importa
+const (
+	CatalogIssueInvalid   = "invalid"   // Línea que no es JSON válido o a la que le faltan campos
+	CatalogIssueReference = "reference" // Referencia a un documento que no está ni en el volcado ni en la base
+	CatalogIssueConflict  = "conflict"  // Repetido en el volcado, ambiguo o con el ID ocupado por otro documento
+)
+
+// CatalogFilter limita la exportación a unos artistas (por ID) y a los de unos géneros
+// (por nombre o slug). Vacío exporta todo el catálogo.
+type CatalogFilter struct {
+	ArtistIDs []string
+	Genres    []string
+}
+
+// CatalogImportReport resume una importación del catálogo
+type CatalogImportReport struct {
+	DryRun bool                            `json:"dry_run"`
+	Counts map[string]*CatalogImportCounts `json:"counts"` // Por colección
+	Issues []CatalogIssue                  `json:"issues"`
+}
+
+// CatalogImportCounts cuenta lo que se hizo (o se haría, en simulación) con cada documento
+type CatalogImportCounts struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"` // Documentos con algún problema
+}
+
+// CatalogIssue es un documento del volcado que no se pudo importar
+type CatalogIssue struct {
+	Collection string `json:"collection"`
+	Line       int    `json:"line"`
+	ID         string `json:"id,omitempty"`
+	Kind       string `json:"kind"`
+	Message    string `json:"message"`
+}
+
+// ExportCatalog escribe cada colección del catálogo en JSON Lines, un documento por línea
+// ordenados por ID, en el writer de su nombre; las colecciones sin writer no se exportan.
+// Con filtro se exportan los álbumes de los artistas elegidos con sus canciones, y también
+// los demás artistas y géneros a los que hacen referencia, para que el volcado se pueda
+// importar solo. Devuelve cuántos documentos se escribieron de cada colección.
+func (s *MusicService) ExportCatalog(ctx context.Context, writers map[string]io.Writer, filter CatalogFilter) (map[string]int, error) {
+	selection, err := s.catalogSelection(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, name := range CatalogCollections {
+		w, ok := writers[name]
+		if !ok {
+			continue
+		}
+		collection := s.db.Collection(name)
+		var n int
+		switch name {
+		case "genres":
+			n, err = exportDocuments[models.Genre](ctx, collection, selection[name], w)
+		case "artists":
+			n, err = exportDocuments[models.Artist](ctx, collection, selection[name], w)
+		case "albums":
+			n, err = exportDocuments[models.Album](ctx, collection, selection[name], w)
+		case "songs":
+			n, err = exportDocuments[models.Song](ctx, collection, selection[name], w)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		counts[name] = n
+	}
+	return counts, nil
+}
+
+// catalogSelection calcula el filtro de cada colección para exportar
+func (s *MusicService) catalogSelection(ctx context.Context, filter CatalogFilter) (map[string]bson.M, error) {
+	if len(filter.ArtistIDs) == 0 && len(filter.Genres) == 0 {
+		return map[string]bson.M{"genres": {}, "artists": {}, "albums": {}, "songs": {}}, nil
+	}
+
+	var seed []interface{}
+	for _, id := range filter.ArtistIDs {
+		objectID, err := parseID("artist", id)
+		if err != nil {
+			return nil, err
+		}
+		seed = append(seed, objectID)
+	}
+	if len(filter.Genres) > 0 {
+		var or bson.A
+		for _, genre := range filter.Genres {
+			or = append(or, bson.M{"name": genre}, bson.M{"slug": slugify(genre)})
+		}
+		names, err := s.db.Collection("genres").Distinct(ctx, "name", bson.M{"$or": or})
+		if err != nil {
+			return nil, err
+		}
+		// También valen los géneros de los artistas que aún no están en la colección
+		for _, genre := range filter.Genres {
+			names = append(names, genre)
+		}
+		ids, err := s.GetArtistCollection().Distinct(ctx, "_id", bson.M{"genres": bson.M{"$in": names}})
+		if err != nil {
+			return nil, err
+		}
+		seed = append(seed, ids...)
+	}
+	if len(seed) == 0 {
+		return nil, invalid("genre", "ningún artista tiene esos géneros")
+	}
+
+	albumIDs, err := s.GetAlbumCollection().Distinct(ctx, "_id", bson.M{"artist_ids": bson.M{"$in": seed}})
+	if err != nil {
+		return nil, err
+	}
+	albumIDs = append(bson.A{}, albumIDs...) // $in no admite null
+	songs := bson.M{"album_id": bson.M{"$in": albumIDs}}
+
+	// Colaboradores de los álbumes y las canciones exportados
+	albumArtists, err := s.GetAlbumCollection().Distinct(ctx, "artist_ids", bson.M{"_id": bson.M{"$in": albumIDs}})
+	if err != nil {
+		return nil, err
+	}
+	songArtists, err := s.GetSongCollection().Distinct(ctx, "artist_ids", songs)
+	if err != nil {
+		return nil, err
+	}
+	artistIDs := append(append(seed, albumArtists...), songArtists...)
+
+	genres, err := s.GetArtistCollection().Distinct(ctx, "genres", bson.M{"_id": bson.M{"$in": artistIDs}})
+	if err != nil {
+		return nil, err
+	}
+	genres = append(bson.A{}, genres...)
+	return map[string]bson.M{
+		"genres":  {"name": bson.M{"$in": genres}},
+		"artists": {"_id": bson.M{"$in": artistIDs}},
+		"albums":  {"_id": bson.M{"$in": albumIDs}},
+		"songs":   songs,
+	}, nil
+}
+
+// exportDocuments escribe los documentos de la colección según se leen del cursor
+func exportDocuments[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, w io.Writer) (int, error) {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	encoder := json.NewEncoder(w)
+	n := 0
+	for cursor.Next(ctx) {
+		var document T
+		if err := cursor.Decode(&document); err != nil {
+			return n, err
+		}
+		if err := encoder.Encode(document); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cursor.Err()
+}
+
+// ImportCatalog importa un volcado de ExportCatalog leyendo cada colección del reader de su
+// nombre; las colecciones sin reader no se importan. Los documentos se buscan por su ID
+// externo (proveedor e ID en él, o spotify_id), los géneros por su slug y lo demás por su
+// ID; si existen se actualizan y si no se insertan con el ID del volcado. Las referencias a
+// otros documentos se traducen a los IDs locales; los contadores de los géneros no se
+// copian, los ajustan los artistas importados. Los documentos con problemas se saltan y se
+// informan en el resultado. En simulación (dryRun) no se escribe nada.
+func (s *MusicService) ImportCatalog(ctx context.Context, readers map[string]io.Reader, dryRun bool) (*CatalogImportReport, error) {
+	im := &catalogImporter{
+		music:  s,
+		dryRun: dryRun,
+		report: &CatalogImportReport{DryRun: dryRun, Counts: make(map[string]*CatalogImportCounts), Issues: []CatalogIssue{}},
+		ids:    make(map[string]map[primitive.ObjectID]primitive.ObjectID),
+		keys:   make(map[string]map[string]bool),
+	}
+	for _, name := range CatalogCollections {
+		r, ok := readers[name]
+		if !ok {
+			continue
+		}
+		im.report.Counts[name] = &CatalogImportCounts{}
+		im.ids[name] = make(map[primitive.ObjectID]primitive.ObjectID)
+		im.keys[name] = make(map[string]bool)
+
+		var err error
+		switch name {
+		case "genres":
+			err = importLines(ctx, im, name, r, im.importGenre)
+		case "artists":
+			err = importLines(ctx, im, name, r, im.importArtist)
+		case "albums":
+			err = importLines(ctx, im, name, r, im.importAlbum)
+		case "songs":
+			err = importLines(ctx, im, name, r, im.importSong)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return im.report, nil
+}
+
+// catalogImporter guarda el estado de una importación
+type catalogImporter struct {
+	music  *MusicService
+	dryRun bool
+	report *CatalogImportReport
+	// Por colección, el ID local de cada ID del volcado ya importado
+	ids map[string]map[primitive.ObjectID]primitive.ObjectID
+	// Por colección, las claves de búsqueda ya vistas, para detectar repetidos
+	keys map[string]map[string]bool
+}
+
+// importLines decodifica el reader línea a línea y pasa cada documento a each. Los errores
+// de each detienen la importación; los problemas de un documento se anotan con issue.
+func importLines[T any](ctx context.Context, im *catalogImporter, collection string, r io.Reader, each func(ctx context.Context, line int, document *T) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxCatalogLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var document T
+		if err := json.Unmarshal(text, &document); err != nil {
+			im.issue(collection, line, primitive.NilObjectID, CatalogIssueInvalid, err.Error())
+			continue
+		}
+		if err := each(ctx, line, &document); err != nil {
+			return fmt.Errorf("línea %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// issue anota un documento que no se importa
+func (im *catalogImporter) issue(collection string, line int, id primitive.ObjectID, kind, message string) {
+	issue := CatalogIssue{Collection: collection, Line: line, Kind: kind, Message: message}
+	if !id.IsZero() {
+		issue.ID = id.Hex()
+	}
+	im.report.Issues = append(im.report.Issues, issue)
+	im.report.Counts[collection].Skipped++
+}
+
+func (im *catalogImporter) importGenre(ctx context.Context, line int, genre *models.Genre) error {
+	if genre.Name == "" {
+		im.issue("genres", line, genre.ID, CatalogIssueInvalid, "falta name")
+		return nil
+	}
+	if genre.Slug == "" {
+		genre.Slug = slugify(genre.Name)
+	}
+	_, _, err := im.upsert(ctx, "genres", line, genre.ID, bson.M{"slug": genre.Slug}, genre.Slug, genre)
+	return err
+}
+
+func (im *catalogImporter) importArtist(ctx context.Context, line int, artist *models.Artist) error {
+	if artist.Name == "" {
+		im.issue("artists", line, artist.ID, CatalogIssueInvalid, "falta name")
+		return nil
+	}
+	match, key := externalMatch(artist.Provider, artist.ExternalID, artist.SpotifyID)
+	previous, written, err := im.upsert(ctx, "artists", line, artist.ID, match, key, artist)
+	if err != nil || im.dryRun {
+		return err
+	}
+	// Los contadores de los géneros se ajustan como al importar de un proveedor: solo con
+	// los que gana o pierde el artista
+	if _, ok := written["genres"]; !ok {
+		return nil
+	}
+	var before []string
+	if genres, ok := previous["genres"].(bson.A); ok {
+		for _, genre := range genres {
+			if name, ok := genre.(string); ok {
+				before = append(before, name)
+			}
+		}
+	}
+	added, removed := diffGenres(before, artist.Genres)
+	if err := im.music.adjustGenreCounts(ctx, added, removed); err != nil {
+		log.Printf("Error actualizando los géneros de %s: %v", artist.Name, err)
+	}
+	return nil
+}
+
+func (im *catalogImporter) importAlbum(ctx context.Context, line int, album *models.Album) error {
+	if album.Title == "" {
+		im.issue("albums", line, album.ID, CatalogIssueInvalid, "falta title")
+		return nil
+	}
+	artistIDs, ok, err := im.resolveAll(ctx, "albums", line, album.ID, "artists", album.ArtistIDs)
+	if err != nil || !ok {
+		return err
+	}
+	album.ArtistIDs = artistIDs
+	match, key := externalMatch(album.Provider, album.ExternalID, album.SpotifyID)
+	_, _, err = im.upsert(ctx, "albums", line, album.ID, match, key, album)
+	return err
+}
+
+func (im *catalogImporter) importSong(ctx context.Context, line int, song *models.Song) error {
+	if song.Title == "" {
+		im.issue("songs", line, song.ID, CatalogIssueInvalid, "falta title")
+		return nil
+	}
+	if !song.AlbumID.IsZero() {
+		albumIDs, ok, err := im.resolveAll(ctx, "songs", line, song.ID, "albums", []primitive.ObjectID{song.AlbumID})
+		if err != nil || !ok {
+			return err
+		}
+		song.AlbumID = albumIDs[0]
+	}
+	artistIDs, ok, err := im.resolveAll(ctx, "songs", line, song.ID, "artists", song.ArtistIDs)
+	if err != nil || !ok {
+		return err
+	}
+	song.ArtistIDs = artistIDs
+	match, key := externalMatch(song.Provider, song.ExternalID, song.SpotifyID)
+	_, _, err = im.upsert(ctx, "songs", line, song.ID, match, key, song)
+	return err
+}
+
+// externalMatch devuelve el filtro por ID externo y la clave para detectar repetidos; nil
+// si el documento no viene de ningún proveedor
+func externalMatch(provider, externalID, spotifyID string) (bson.M, string) {
+	if provider != "" && externalID != "" {
+		return externalFilter(provider, externalID), provider + ":" + externalID
+	}
+	if spotifyID != "" {
+		return externalFilter(metadata.ProviderSpotify, spotifyID), metadata.ProviderSpotify + ":" + spotifyID
+	}
+	return nil, ""
+}
+
+// resolveAll traduce referencias a documentos de target: primero los importados del volcado
+// y si no, los que ya existan en la base con ese ID. Si falta alguno anota el problema en
+// collection y devuelve ok = false.
+func (im *catalogImporter) resolveAll(ctx context.Context, collection string, line int, id primitive.ObjectID, target string, refs []primitive.ObjectID) ([]primitive.ObjectID, bool, error) {
+	resolved := make([]primitive.ObjectID, 0, len(refs))
+	for _, ref := range refs {
+		if local, ok := im.ids[target][ref]; ok {
+			resolved = append(resolved, local)
+			continue
+		}
+		count, err := im.music.db.Collection(target).CountDocuments(ctx, bson.M{"_id": ref}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, false, err
+		}
+		if count == 0 {
+			im.issue(collection, line, id, CatalogIssueReference, fmt.Sprintf("%s %s no existe", target, ref.Hex()))
+			return nil, false, nil
+		}
+		resolved = append(resolved, ref)
+	}
+	return resolved, true, nil
+}
+
+// upsert inserta o actualiza un documento con las referencias ya traducidas. match busca el
+// documento local por su clave natural (nil si no tiene) y si no se encuentra se busca por ID.
+// Devuelve el documento local anterior (nil si se inserta) y los campos escritos (nil si no
+// se escribe nada).
+func (im *catalogImporter) upsert(ctx context.Context, collection string, line int, id primitive.ObjectID, match bson.M, key string, document interface{}) (previous, written bson.M, err error) {
+	counts := im.report.Counts[collection]
+	if id.IsZero() {
+		im.issue(collection, line, id, CatalogIssueInvalid, "falta id")
+		return nil, nil, nil
+	}
+	if _, ok := im.ids[collection][id]; ok {
+		im.issue(collection, line, id, CatalogIssueConflict, "ID repetido en el volcado")
+		return nil, nil, nil
+	}
+	if key != "" {
+		if im.keys[collection][key] {
+			im.issue(collection, line, id, CatalogIssueConflict, fmt.Sprintf("%s repetido en el volcado", key))
+			return nil, nil, nil
+		}
+		im.keys[collection][key] = true
+	}
+
+	coll := im.music.db.Collection(collection)
+	var existing bson.M
+	if match != nil {
+		found, err := findAll[bson.M](ctx, coll, match, options.Find().SetLimit(2))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(found) > 1 {
+			im.issue(collection, line, id, CatalogIssueConflict, fmt.Sprintf("%s coincide con varios documentos", key))
+			return nil, nil, nil
+		}
+		if len(found) == 1 {
+			existing = found[0]
+		}
+	}
+	if existing == nil {
+		err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, nil, err
+		}
+		// Con el mismo ID pero otro origen es otro documento
+		if existing != nil && key != "" && naturalKey(collection, existing) != "" {
+			im.issue(collection, line, id, CatalogIssueConflict, fmt.Sprintf("el ID ya lo usa %s", naturalKey(collection, existing)))
+			return nil, nil, nil
+		}
+	}
+
+	incoming, err := toBSON(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	if collection == "genres" {
+		// El contador de un género es el de los artistas de esta base, no el del volcado:
+		// lo ajustan los artistas al importarse
+		delete(incoming, "count")
+	}
+	if existing == nil {
+		if collection == "genres" {
+			incoming["count"] = 0
+		}
+		if !im.dryRun {
+			if _, err := coll.InsertOne(ctx, incoming); err != nil {
+				return nil, nil, err
+			}
+		}
+		im.ids[collection][id] = id
+		counts.Inserted++
+		return nil, incoming, nil
+	}
+
+	localID := existing["_id"].(primitive.ObjectID)
+	im.ids[collection][id] = localID
+	set := bson.M{}
+	for field, value := range incoming {
+		if field == "_id" || field == "created_at" || field == "updated_at" {
+			continue
+		}
+		if !reflect.DeepEqual(existing[field], value) {
+			set[field] = value
+		}
+	}
+	if len(set) == 0 {
+		counts.Unchanged++
+		return existing, nil, nil
+	}
+	if !im.dryRun {
+		set["updated_at"] = time.Now()
+		if _, err := coll.UpdateOne(ctx, bson.M{"_id": localID}, bson.M{"$set": set}); err != nil {
+			return nil, nil, err
+		}
+	}
+	counts.Updated++
+	return existing, set, nil
+}
+
+// naturalKey devuelve la clave natural de un documento local, como la de externalMatch
+func naturalKey(collection string, document bson.M) string {
+	if collection == "genres" {
+		slug, _ := document["slug"].(string)
+		return slug
+	}
+	provider, _ := document["provider"].(string)
+	externalID, _ := document["external_id"].(string)
+	spotifyID, _ := document["spotify_id"].(string)
+	_, key := externalMatch(provider, externalID, spotifyID)
+	return key
+}
+
+// toBSON convierte un modelo en el documento que se guardaría, para compararlo campo a
+// campo con el de la base
+func toBSON(document interface{}) (bson.M, error) {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var result bson.M
+	if err := bson.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+// jsonLines escribe los documentos como un volcado de ExportCatalog
+func jsonLines(t *testing.T, documents ...interface{}) string {
+	t.Helper()
+	var lines []string
+	for _, document := range documents {
+		data, err := json.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(data))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// La importación consulta la base con un servidor simulado: cada caso encola, en orden, las
+// respuestas a las consultas que hará (find por clave natural, find por ID y count de las
+// referencias). En simulación no hay escrituras a las que responder.
+func TestImportCatalogConflicts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	artistID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+	rosalia := models.Artist{ID: artistID, Name: "Rosalía", Provider: "spotify", ExternalID: "sp1"}
+	// found responde a un find con los documentos indicados
+	found := func(collection string, documents ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, "music."+collection, mtest.FirstBatch, documents...)
+	}
+	notFound := func(collection string) bson.D { return found(collection) }
+
+	tests := []struct {
+		name       string
+		collection string
+		lines      string
+		responses  []bson.D
+		wantIssues []CatalogIssue
+		wantCounts CatalogImportCounts
+	}{
+		{
+			name:       "ID repetido en el volcado",
+			collection: "artists",
+			lines: jsonLines(t, rosalia,
+				models.Artist{ID: artistID, Name: "Otra", Provider: "spotify", ExternalID: "sp2"}),
+			responses: []bson.D{notFound("artists"), notFound("artists")},
+			wantIssues: []CatalogIssue{
+				{Collection: "artists", Line: 2, ID: artistID.Hex(), Kind: CatalogIssueConflict, Message: "ID repetido en el volcado"},
+			},
+			wantCounts: CatalogImportCounts{Inserted: 1, Skipped: 1},
+		},
+		{
+			name:       "ID externo repetido en el volcado",
+			collection: "artists",
+			lines: jsonLines(t, rosalia,
+				models.Artist{ID: otherID, Name: "Rosalía (copia)", Provider: "spotify", ExternalID: "sp1"}),
+			responses: []bson.D{notFound("artists"), notFound("artists")},
+			wantIssues: []CatalogIssue{
+				{Collection: "artists", Line: 2, ID: otherID.Hex(), Kind: CatalogIssueConflict, Message: "spotify:sp1 repetido en el volcado"},
+			},
+			wantCounts: CatalogImportCounts{Inserted: 1, Skipped: 1},
+		},
+		{
+			name:       "spotify_id de documentos antiguos repetido",
+			collection: "artists",
+			lines: jsonLines(t, rosalia,
+				models.Artist{ID: otherID, Name: "Rosalía (antigua)", SpotifyID: "sp1"}),
+			responses: []bson.D{notFound("artists"), notFound("artists")},
+			wantIssues: []CatalogIssue{
+				{Collection: "artists", Line: 2, ID: otherID.Hex(), Kind: CatalogIssueConflict, Message: "spotify:sp1 repetido en el volcado"},
+			},
+			wantCounts: CatalogImportCounts{Inserted: 1, Skipped: 1},
+		},
+		{
+			name:       "el ID externo coincide con varios documentos",
+			collection: "artists",
+			lines:      jsonLines(t, rosalia),
+			responses: []bson.D{found("artists",
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "provider", Value: "spotify"}, {Key: "external_id", Value: "sp1"}},
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "spotify_id", Value: "sp1"}},
+			)},
+			wantIssues: []CatalogIssue{
+				{Collection: "artists", Line: 1, ID: artistID.Hex(), Kind: CatalogIssueConflict, Message: "spotify:sp1 coincide con varios documentos"},
+			},
+			wantCounts: CatalogImportCounts{Skipped: 1},
+		},
+		{
+			name:       "el ID lo usa un documento de otro origen",
+			collection: "artists",
+			lines:      jsonLines(t, rosalia),
+			responses: []bson.D{
+				notFound("artists"),
+				found("artists", bson.D{{Key: "_id", Value: artistID}, {Key: "provider", Value: "musicbrainz"}, {Key: "external_id", Value: "mb1"}}),
+			},
+			wantIssues: []CatalogIssue{
+				{Collection: "artists", Line: 1, ID: artistID.Hex(), Kind: CatalogIssueConflict, Message: "el ID ya lo usa musicbrainz:mb1"},
+			},
+			wantCounts: CatalogImportCounts{Skipped: 1},
+		},
+		{
+			// Sin origen no hay conflicto: es el mismo documento y se actualiza
+			name:       "el ID lo usa un documento sin origen",
+			collection: "artists",
+			lines:      jsonLines(t, rosalia),
+			responses: []bson.D{
+				notFound("artists"),
+				found("artists", bson.D{{Key: "_id", Value: artistID}, {Key: "name", Value: "Rosalia"}}),
+			},
+			wantIssues: []CatalogIssue{},
+			wantCounts: CatalogImportCounts{Updated: 1},
+		},
+		{
+			name:       "encontrado por su ID externo con otro ID local",
+			collection: "artists",
+			lines:      jsonLines(t, rosalia),
+			responses: []bson.D{found("artists",
+				bson.D{{Key: "_id", Value: otherID}, {Key: "name", Value: "Rosalia"}, {Key: "provider", Value: "spotify"}, {Key: "external_id", Value: "sp1"}},
+			)},
+			wantIssues: []CatalogIssue{},
+			wantCounts: CatalogImportCounts{Updated: 1},
+		},
+		{
+			name:       "referencia a un artista que no existe",
+			collection: "albums",
+			lines:      jsonLines(t, models.Album{ID: otherID, Title: "Motomami", ArtistIDs: []primitive.ObjectID{artistID}}),
+			// CountDocuments es un aggregate: sin resultados cuenta 0
+			responses: []bson.D{notFound("artists")},
+			wantIssues: []CatalogIssue{
+				{Collection: "albums", Line: 1, ID: otherID.Hex(), Kind: CatalogIssueReference, Message: "artists " + artistID.Hex() + " no existe"},
+			},
+			wantCounts: CatalogImportCounts{Skipped: 1},
+		},
+		{
+			name:       "línea que no es JSON",
+			collection: "genres",
+			lines:      "{\"name\": \n",
+			wantIssues: []CatalogIssue{
+				{Collection: "genres", Line: 1, Kind: CatalogIssueInvalid, Message: "unexpected end of JSON input"},
+			},
+			wantCounts: CatalogImportCounts{Skipped: 1},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			music := &MusicService{db: mt.DB}
+			report, err := music.ImportCatalog(context.Background(), map[string]io.Reader{tt.collection: strings.NewReader(tt.lines)}, true)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if !reflect.DeepEqual(report.Issues, tt.wantIssues) {
+				mt.Errorf("problemas = %+v, se esperaba %+v", report.Issues, tt.wantIssues)
+			}
+			if got := *report.Counts[tt.collection]; got != tt.wantCounts {
+				mt.Errorf("recuento = %+v, se esperaba %+v", got, tt.wantCounts)
+			}
+		})
+	}
+}
+
+// Los contadores de los géneros no se copian del volcado: los ajustan los artistas que se
+// insertan o cambian de géneros
+func TestImportCatalogGenreCounts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	genreID := primitive.NewObjectID()
+	artistID := primitive.NewObjectID()
+	found := func(collection string, documents ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, "music."+collection, mtest.FirstBatch, documents...)
+	}
+	success := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+	stored := func(genres ...string) bson.D {
+		return document(t, models.Artist{ID: artistID, Name: "Rosalia", Provider: "spotify", ExternalID: "sp1", Genres: genres})
+	}
+	artist := func(genres ...string) models.Artist {
+		return models.Artist{ID: artistID, Name: "Rosalía", Provider: "spotify", ExternalID: "sp1", Genres: genres}
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		lines      string
+		responses  []bson.D
+		wantSet    []string         // Campos del $set del género, si se actualiza
+		wantCounts map[string]int32 // $inc de count por género
+	}{
+		{
+			name:       "género nuevo",
+			collection: "genres",
+			lines:      jsonLines(t, models.Genre{ID: genreID, Name: "Pop", Slug: "pop", Count: 42}),
+			responses:  []bson.D{found("genres"), found("genres"), success},
+			wantCounts: map[string]int32{},
+		},
+		{
+			name:       "género existente",
+			collection: "genres",
+			lines:      jsonLines(t, models.Genre{ID: genreID, Name: "Pop", Slug: "pop", Description: "Nueva", Count: 42}),
+			responses: []bson.D{
+				found("genres", document(t, models.Genre{ID: primitive.NewObjectID(), Name: "Pop", Slug: "pop", Description: "Antigua", Count: 7})),
+				success,
+			},
+			wantSet:    []string{"description", "updated_at"},
+			wantCounts: map[string]int32{},
+		},
+		{
+			name:       "artista nuevo",
+			collection: "artists",
+			lines:      jsonLines(t, artist("pop", "latin")),
+			responses:  []bson.D{found("artists"), found("artists"), success, success, success},
+			wantCounts: map[string]int32{"pop": 1, "latin": 1},
+		},
+		{
+			name:       "artista con otros géneros",
+			collection: "artists",
+			lines:      jsonLines(t, artist("pop", "latin")),
+			responses:  []bson.D{found("artists", stored("pop", "flamenco")), success, success, success},
+			wantCounts: map[string]int32{"latin": 1, "flamenco": -1},
+		},
+		{
+			name:       "artista con los mismos géneros",
+			collection: "artists",
+			lines:      jsonLines(t, artist("pop")),
+			responses:  []bson.D{found("artists", stored("pop")), success},
+			wantCounts: map[string]int32{},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			music := &MusicService{db: mt.DB}
+			if _, err := music.ImportCatalog(context.Background(), map[string]io.Reader{tt.collection: strings.NewReader(tt.lines)}, false); err != nil {
+				mt.Fatal(err)
+			}
+
+			counts := make(map[string]int32)
+			var genreSet []string
+			for _, started := range mt.GetAllStartedEvents() {
+				switch {
+				case started.CommandName == "insert" && tt.collection == "genres":
+					inserted := started.Command.Lookup("documents").Array().Index(0).Value().Document()
+					if count := inserted.Lookup("count").Int32(); count != 0 {
+						mt.Errorf("género insertado con count %d, se esperaba 0", count)
+					}
+				case started.CommandName == "update" && started.Command.Lookup("update").StringValue() == "genres":
+					statement := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+					if inc, ok := statement.Lookup("u", "$inc", "count").Int32OK(); ok {
+						counts[statement.Lookup("q", "name").StringValue()] += inc
+						continue
+					}
+					genreSet = sentUpdate{set: statement.Lookup("u", "$set").Document()}.setKeys()
+				}
+			}
+			if !reflect.DeepEqual(genreSet, tt.wantSet) {
+				mt.Errorf("$set del género = %v, se esperaba %v", genreSet, tt.wantSet)
+			}
+			if !reflect.DeepEqual(counts, tt.wantCounts) {
+				mt.Errorf("contadores = %v, se esperaba %v", counts, tt.wantCounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+const (
+	// DefaultImportWorkers es el número de importaciones simultáneas si no se configura
+	DefaultImportWorkers = 2
+	// DefaultImportJobsLimit es el número de trabajos que devuelve el listado
+	DefaultImportJobsLimit = 20
+	// importJobPollInterval es cada cuánto buscan trabajo los workers sin que se les avise
+	importJobPollInterval = 10 * time.Second
+	// importJobLease es cuánto dura la reserva de un trabajo; el worker la renueva cada
+	// tercio, así que un trabajo solo se retoma si su worker lleva ese tiempo sin dar señales
+	importJobLease = time.Minute
+)
+
+// ErrImportJobFinished indica que el trabajo ya terminó y no se puede cancelar
+var ErrImportJobFinished = errors.New("import job already finished")
+
+// ErrImportsUnavailable indica que Start falló: sin workers ni el índice de importaciones
+// activas los trabajos nuevos no se procesarían y podrían duplicarse
+var ErrImportsUnavailable = errors.New("import jobs not available")
+
+// ImportJobService importa en segundo plano la discografía de artistas de Spotify. Los
+// trabajos se guardan en la colección import_jobs y un número fijo de workers los va
+// tomando de ahí: la concurrencia está acotada y los trabajos sobreviven a un reinicio.
+type ImportJobService struct {
+	music    *MusicService
+	workers  int
+	workerID string // Identifica a esta instancia en worker_id
+	wake     chan struct{}
+	started  atomic.Bool
+}
+
+// NewImportJobService crea el servicio de importaciones; los workers arrancan con Start
+func NewImportJobService(music *MusicService, workers int) *ImportJobService {
+	if workers <= 0 {
+		workers = DefaultImportWorkers
+	}
+	return &ImportJobService{
+		music:    music,
+		workers:  workers,
+		workerID: newWorkerID(),
+		wake:     make(chan struct{}, workers),
+	}
+}
+
+// newWorkerID combina el host y el proceso con un sufijo aleatorio, para que un contenedor
+// reiniciado (mismo host y pid) no se confunda con el anterior
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "music-ms"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), primitive.NewObjectID().Hex()[16:])
+}
+
+// GetImportJobCollection retorna la colección de trabajos de importación
+func (j *ImportJobService) GetImportJobCollection() *mongo.Collection {
+	return j.music.db.Collection("import_jobs")
+}
+
+// activeImportIndex impide dos trabajos pendientes o en curso del mismo artista aunque
+// lleguen a la vez dos peticiones (el filtro $in de un índice parcial requiere MongoDB 6.0)
+var activeImportIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "spotify_artist_id", Value: 1}},
+	Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+		"status": bson.M{"$in": bson.A{models.ImportJobPending, models.ImportJobRunning}},
+	}),
+}
+
+// Start crea los índices y arranca los workers, que terminan al cancelar ctx. No hace falta
+// devolver nada a la cola: los trabajos de un worker que se paró sin liberarlos se retoman
+// cuando caduca su reserva, sin repetir los álbumes ya importados.
+func (j *ImportJobService) Start(ctx context.Context) error {
+	_, err := j.GetImportJobCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		activeImportIndex,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < j.workers; i++ {
+		go j.work(ctx)
+	}
+	j.started.Store(true)
+	return nil
+}
+
+// CreateArtistImport busca el artista en Spotify y encola la importación de su
+// discografía. Si ya hay una importación sin terminar del mismo artista, devuelve esa.
+func (j *ImportJobService) CreateArtistImport(ctx context.Context, query string) (*models.ImportJob, error) {
+	if !j.started.Load() {
+		return nil, ErrImportsUnavailable
+	}
+	if j.music.spotifyService == nil {
+		return nil, ErrSpotifyUnavailable
+	}
+	artists, err := j.music.spotifyService.SearchArtists(ctx, query, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(artists) == 0 {
+		return nil, ErrArtistNotFound
+	}
+	artist := artists[0]
+
+	if existing, err := j.activeImport(ctx, string(artist.ID)); existing != nil || err != nil {
+		return existing, err
+	}
+
+	now := time.Now()
+	job := &models.ImportJob{
+		Status:          models.ImportJobPending,
+		Query:           query,
+		SpotifyArtistID: string(artist.ID),
+		ArtistName:      artist.Name,
+		Albums:          []models.ImportJobAlbum{},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	result, err := j.GetImportJobCollection().InsertOne(ctx, job)
+	if mongo.IsDuplicateKeyError(err) {
+		// Otra petición creó el trabajo entre la búsqueda y la inserción
+		if existing, err := j.activeImport(ctx, job.SpotifyArtistID); existing != nil || err != nil {
+			return existing, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.ID = result.InsertedID.(primitive.ObjectID)
+
+	// Se avisa a un worker libre; si todos están ocupados lo verán al terminar
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// activeImport devuelve la importación pendiente o en curso del artista; nil si no hay
+func (j *ImportJobService) activeImport(ctx context.Context, spotifyArtistID string) (*models.ImportJob, error) {
+	var existing models.ImportJob
+	err := j.GetImportJobCollection().FindOne(ctx, bson.M{
+		"spotify_artist_id": spotifyArtistID,
+		"status":            bson.M{"$in": bson.A{models.ImportJobPending, models.ImportJobRunning}},
+	}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// GetImportJob obtiene un trabajo por su ID
+func (j *ImportJobService) GetImportJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	var job models.ImportJob
+	if err := j.GetImportJobCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetImportJobs obtiene los trabajos más recientes, opcionalmente solo los de un estado
+func (j *ImportJobService) GetImportJobs(ctx context.Context, status string, limit int) ([]models.ImportJob, error) {
+	if limit <= 0 {
+		limit = DefaultImportJobsLimit
+	}
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	return findAll[models.ImportJob](ctx, j.GetImportJobCollection(), filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+}
+
+// CancelImportJob cancela un trabajo pendiente o en curso. Si está en curso, el worker
+// termina el álbum que está importando y no empieza más.
+func (j *ImportJobService) CancelImportJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var job models.ImportJob
+	err = j.GetImportJobCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID, "status": bson.M{"$in": bson.A{models.ImportJobPending, models.ImportJobRunning}}},
+		bson.M{
+			"$set":   bson.M{"status": models.ImportJobCancelled, "updated_at": now, "finished_at": now},
+			"$unset": bson.M{"worker_id": "", "lease_until": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		// O no existe o ya había terminado
+		if _, err := j.GetImportJob(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrImportJobFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// work procesa trabajos mientras los haya y después espera a que lo avisen o a la siguiente revisión
+func (j *ImportJobService) work(ctx context.Context) {
+	ticker := time.NewTicker(importJobPollInterval)
+	defer ticker.Stop()
+	for {
+		// Sin credenciales de Spotify los trabajos esperan en la cola
+		for j.music.spotifyService.Available() {
+			job, err := j.claim(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Error buscando importaciones pendientes: %v", err)
+				}
+				break
+			}
+			if job == nil {
+				break
+			}
+			j.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimFilter selecciona los trabajos que un worker puede tomar: los pendientes y los que
+// siguen en curso con la reserva caducada (o sin reserva, de versiones anteriores)
+func claimFilter(now time.Time) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"status": models.ImportJobPending},
+		bson.M{"status": models.ImportJobRunning, "lease_until": bson.M{"$not": bson.M{"$gte": now}}},
+	}}
+}
+
+// claim reserva para este worker el trabajo disponible más antiguo; nil si no hay ninguno
+func (j *ImportJobService) claim(ctx context.Context) (*models.ImportJob, error) {
+	now := time.Now()
+	lease := now.Add(importJobLease)
+	var previous models.ImportJob
+	err := j.GetImportJobCollection().FindOneAndUpdate(ctx,
+		claimFilter(now),
+		bson.M{"$set": bson.M{"status": models.ImportJobRunning, "worker_id": j.workerID, "lease_until": lease, "updated_at": now}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if previous.Status == models.ImportJobRunning {
+		log.Printf("Retomando la importación de %s abandonada por %s", previous.ArtistName, previous.WorkerID)
+	}
+	job := previous
+	job.Status, job.WorkerID, job.LeaseUntil, job.UpdatedAt = models.ImportJobRunning, j.workerID, &lease, now
+	return &job, nil
+}
+
+// owned filtra el trabajo mientras siga en curso y reservado por este worker. Todas las
+// escrituras del worker lo usan, así que uno que perdió la reserva no pisa al que lo retomó.
+func (j *ImportJobService) owned(job *models.ImportJob) bson.M {
+	return bson.M{"_id": job.ID, "status": models.ImportJobRunning, "worker_id": j.workerID}
+}
+
+// heartbeat renueva la reserva del trabajo hasta que done se cierra o hasta que el trabajo
+// deja de ser de este worker (lo han cancelado o lo retomó otro); en ese caso run lo nota al
+// guardar el progreso del álbum en curso y no empieza más.
+func (j *ImportJobService) heartbeat(ctx context.Context, job *models.ImportJob, done <-chan struct{}) {
+	ticker := time.NewTicker(importJobLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		result, err := j.GetImportJobCollection().UpdateOne(ctx, j.owned(job),
+			bson.M{"$set": bson.M{"lease_until": time.Now().Add(importJobLease)}})
+		if err != nil {
+			// Un fallo puntual no suelta el trabajo; si se repite, la reserva caduca
+			log.Printf("Error renovando la reserva del trabajo %s: %v", job.ID.Hex(), err)
+			continue
+		}
+		if result.MatchedCount == 0 {
+			return
+		}
+	}
+}
+
+// release devuelve a la cola el trabajo que estaba procesando este worker, para que otro lo
+// retome sin esperar a que caduque la reserva. Se usa al parar el servicio.
+func (j *ImportJobService) release(job *models.ImportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := j.GetImportJobCollection().UpdateOne(ctx, j.owned(job), bson.M{
+		"$set":   bson.M{"status": models.ImportJobPending, "updated_at": time.Now()},
+		"$unset": bson.M{"worker_id": "", "lease_until": ""},
+	})
+	if err != nil {
+		log.Printf("Error devolviendo a la cola el trabajo %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// run importa los álbumes pendientes del trabajo mientras conserve la reserva. Cada avance
+// se guarda solo si el trabajo sigue reservado por este worker; si no (se ha cancelado o lo
+// retomó otro) se deja de procesar. Si se cancela ctx el trabajo vuelve a la cola.
+func (j *ImportJobService) run(ctx context.Context, job *models.ImportJob) {
+	done := make(chan struct{})
+	defer close(done)
+	go j.heartbeat(ctx, job, done)
+	defer func() {
+		if ctx.Err() != nil {
+			j.release(job)
+		}
+	}()
+
+	log.Printf("Importando la discografía de %s (trabajo %s)", job.ArtistName, job.ID.Hex())
+	if job.ArtistID.IsZero() {
+		if err := j.prepare(ctx, job); err != nil {
+			if ctx.Err() == nil {
+				j.finish(ctx, job, models.ImportJobFailed, err.Error())
+			}
+			return
+		}
+		if job.Status != models.ImportJobRunning {
+			return
+		}
+	}
+
+	for _, album := range job.Albums {
+		if album.Status != models.ImportAlbumPending {
+			continue
+		}
+		imported, err := j.music.importArtistAlbum(ctx, job.ArtistID, album.SpotifyID)
+		if ctx.Err() != nil {
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		inc := bson.M{"albums_done": 1}
+		if err != nil {
+			log.Printf("Error importando el álbum %s de %s: %v", album.Title, job.ArtistName, err)
+			set["albums.$.status"] = models.ImportAlbumFailed
+			set["albums.$.error"] = err.Error()
+			inc["albums_failed"] = 1
+		} else {
+			set["albums.$.status"] = models.ImportAlbumDone
+			set["albums.$.album_id"] = imported.ID
+		}
+		filter := j.owned(job)
+		filter["albums.spotify_id"] = album.SpotifyID
+		result, err := j.GetImportJobCollection().UpdateOne(ctx, filter, bson.M{"$set": set, "$inc": inc})
+		if err != nil {
+			log.Printf("Error guardando el progreso del trabajo %s: %v", job.ID.Hex(), err)
+			return
+		}
+		if result.MatchedCount == 0 {
+			log.Printf("Importación de %s cancelada o retomada por otro worker", job.ArtistName)
+			return
+		}
+	}
+	j.finish(ctx, job, models.ImportJobCompleted, "")
+}
+
+// prepare guarda el artista y la lista de álbumes a importar
+func (j *ImportJobService) prepare(ctx context.Context, job *models.ImportJob) error {
+	artist, err := j.music.spotifyService.GetArtist(ctx, job.SpotifyArtistID)
+	if err != nil {
+		return err
+	}
+	artistID, err := j.music.saveSpotifyArtist(ctx, artist)
+	if err != nil {
+		return err
+	}
+	// Quien importa la discografía quiere también los álbumes que vayan saliendo
+	if _, err := j.music.FollowArtist(ctx, artistID.Hex(), true); err != nil {
+		return err
+	}
+
+	spotifyAlbums, err := j.music.spotifyService.GetArtistAlbums(ctx, job.SpotifyArtistID)
+	if err != nil {
+		return err
+	}
+	albums := make([]models.ImportJobAlbum, len(spotifyAlbums))
+	for i, album := range spotifyAlbums {
+		albums[i] = models.ImportJobAlbum{SpotifyID: string(album.ID), Title: album.Name, Status: models.ImportAlbumPending}
+	}
+
+	result, err := j.GetImportJobCollection().UpdateOne(ctx, j.owned(job),
+		bson.M{"$set": bson.M{"artist_id": artistID, "albums": albums, "albums_total": len(albums), "updated_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		job.Status = models.ImportJobCancelled
+		return nil
+	}
+	job.ArtistID = artistID
+	job.Albums = albums
+	job.AlbumsTotal = len(albums)
+	return nil
+}
+
+// finish cierra el trabajo con el estado final si no lo habían cancelado ni retomado antes
+func (j *ImportJobService) finish(ctx context.Context, job *models.ImportJob, status, message string) {
+	now := time.Now()
+	set := bson.M{"status": status, "updated_at": now, "finished_at": now}
+	if message != "" {
+		set["error"] = message
+	}
+	_, err := j.GetImportJobCollection().UpdateOne(ctx, j.owned(job),
+		bson.M{"$set": set, "$unset": bson.M{"worker_id": "", "lease_until": ""}})
+	if err != nil {
+		log.Printf("Error cerrando el trabajo %s: %v", job.ID.Hex(), err)
+		return
+	}
+	log.Printf("Importación de %s terminada: %s", job.ArtistName, status)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+// findAndModifyResponse es la respuesta del servidor a FindOneAndUpdate: el documento
+// antes o después del cambio, o null si ninguno cumple el filtro
+func findAndModifyResponse(t *testing.T, job *models.ImportJob) bson.D {
+	t.Helper()
+	if job == nil {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil})
+	}
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: document(t, job)})
+}
+
+// startedCommand devuelve la primera orden enviada con ese nombre
+func startedCommand(mt *mtest.T, name string) bson.Raw {
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName == name {
+			return started.Command
+		}
+	}
+	mt.Fatalf("no se envió ninguna orden %s", name)
+	return nil
+}
+
+// claim toma el trabajo más antiguo que esté pendiente o cuya reserva haya caducado y lo
+// deja en curso con la reserva de este worker
+func TestImportJobClaim(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	expired := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name     string
+		previous *models.ImportJob
+	}{
+		{"pendiente", &models.ImportJob{ID: primitive.NewObjectID(), Status: models.ImportJobPending, ArtistName: "Rosalía"}},
+		{"reserva caducada de otro worker", &models.ImportJob{ID: primitive.NewObjectID(), Status: models.ImportJobRunning,
+			ArtistName: "Rosalía", WorkerID: "caido-1-abc", LeaseUntil: &expired}},
+		{"nada que hacer", nil},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(findAndModifyResponse(mt.T, tt.previous))
+			jobs := &ImportJobService{music: &MusicService{db: mt.DB}, workerID: "host-1-abc"}
+			before := time.Now()
+			job, err := jobs.claim(context.Background())
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if tt.previous == nil {
+				if job != nil {
+					mt.Errorf("claim = %+v, se esperaba nil", job)
+				}
+				return
+			}
+			if job == nil || job.ID != tt.previous.ID || job.Status != models.ImportJobRunning || job.WorkerID != "host-1-abc" ||
+				job.LeaseUntil == nil || job.LeaseUntil.Before(before.Add(importJobLease)) {
+				mt.Errorf("claim = %+v, se esperaba el trabajo %s en curso y reservado por host-1-abc durante %s", job, tt.previous.ID.Hex(), importJobLease)
+			}
+
+			// El filtro no coge trabajos en curso con la reserva vigente, y el orden es por antigüedad
+			command := startedCommand(mt, "findAndModify")
+			var sent struct {
+				Sort   bson.D `bson:"sort"`
+				Update struct {
+					Set struct {
+						WorkerID string `bson:"worker_id"`
+					} `bson:"$set"`
+				} `bson:"update"`
+			}
+			if err := bson.Unmarshal(command, &sent); err != nil {
+				mt.Fatal(err)
+			}
+			if sent.Update.Set.WorkerID != "host-1-abc" || len(sent.Sort) != 1 || sent.Sort[0].Key != "created_at" {
+				mt.Errorf("findAndModify = %v, se esperaba reservar para host-1-abc el más antiguo", command)
+			}
+			lease := command.Lookup("query", "$or").Array().Index(1).Value().Document().Lookup("lease_until", "$not", "$gte")
+			if leaseTime := lease.Time(); leaseTime.Before(before.Truncate(time.Millisecond)) {
+				mt.Errorf("la reserva vigente se compara con %s, se esperaba ahora", leaseTime)
+			}
+		})
+	}
+}
+
+// Un trabajo retomado tras caducar la reserva continúa por los álbumes pendientes: si ya
+// estaban todos hechos se cierra sin volver a importar nada, con escrituras que solo
+// aplican mientras siga reservado por este worker
+func TestImportJobResumesAfterExpiredLease(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("álbumes ya importados", func(mt *mtest.T) {
+		expired := time.Now().Add(-time.Minute)
+		previous := &models.ImportJob{
+			ID: primitive.NewObjectID(), Status: models.ImportJobRunning, ArtistName: "Rosalía",
+			ArtistID: primitive.NewObjectID(), WorkerID: "caido-1-abc", LeaseUntil: &expired,
+			Albums: []models.ImportJobAlbum{
+				{SpotifyID: "a1", Title: "Motomami", Status: models.ImportAlbumDone},
+				{SpotifyID: "a2", Title: "El Mal Querer", Status: models.ImportAlbumFailed},
+			},
+			AlbumsTotal: 2, AlbumsDone: 2, AlbumsFailed: 1,
+		}
+		mt.AddMockResponses(findAndModifyResponse(mt.T, previous), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		// Sin Spotify: importar un álbum fallaría, así que el test solo pasa si no se repite ninguno
+		jobs := &ImportJobService{music: &MusicService{db: mt.DB}, workerID: "host-1-abc"}
+
+		job, err := jobs.claim(context.Background())
+		if err != nil || job == nil {
+			mt.Fatalf("claim = (%v, %v), se esperaba el trabajo abandonado", job, err)
+		}
+		jobs.run(context.Background(), job)
+
+		var finish struct {
+			Updates []struct {
+				Q bson.M `bson:"q"`
+				U struct {
+					Set bson.M `bson:"$set"`
+				} `bson:"u"`
+			} `bson:"updates"`
+		}
+		if err := bson.Unmarshal(startedCommand(mt, "update"), &finish); err != nil {
+			mt.Fatal(err)
+		}
+		if len(finish.Updates) != 1 {
+			mt.Fatalf("%d actualizaciones, se esperaba 1", len(finish.Updates))
+		}
+		update := finish.Updates[0]
+		if update.Q["worker_id"] != "host-1-abc" || update.Q["status"] != models.ImportJobRunning || update.U.Set["status"] != models.ImportJobCompleted {
+			mt.Errorf("cierre = %v %v, se esperaba completar el trabajo solo si sigue reservado por host-1-abc", update.Q, update.U.Set)
+		}
+	})
+}
+
+func TestCancelImportJob(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	id := primitive.NewObjectID()
+	cancelled := &models.ImportJob{ID: id, Status: models.ImportJobCancelled, ArtistName: "Rosalía"}
+	completed := &models.ImportJob{ID: id, Status: models.ImportJobCompleted, ArtistName: "Rosalía"}
+	tests := []struct {
+		name      string
+		responses []bson.D
+		want      *models.ImportJob
+		wantErr   error
+	}{
+		{
+			name:      "en curso",
+			responses: []bson.D{findAndModifyResponse(t, cancelled)},
+			want:      cancelled,
+		},
+		{
+			name: "ya terminado",
+			responses: []bson.D{
+				findAndModifyResponse(t, nil),
+				mtest.CreateCursorResponse(0, "music.import_jobs", mtest.FirstBatch, document(t, completed)),
+			},
+			wantErr: ErrImportJobFinished,
+		},
+		{
+			name: "no existe",
+			responses: []bson.D{
+				findAndModifyResponse(t, nil),
+				mtest.CreateCursorResponse(0, "music.import_jobs", mtest.FirstBatch),
+			},
+			wantErr: mongo.ErrNoDocuments,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			jobs := &ImportJobService{music: &MusicService{db: mt.DB}, workerID: "host-1-abc"}
+			job, err := jobs.CancelImportJob(context.Background(), id.Hex())
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("CancelImportJob error = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if tt.want != nil && (job == nil || job.Status != tt.want.Status) {
+				mt.Errorf("CancelImportJob = %+v, se esperaba %+v", job, tt.want)
+			}
+
+			// Solo se cancelan trabajos sin terminar, y se suelta la reserva del worker
+			var sent struct {
+				Query  bson.M `bson:"query"`
+				Update struct {
+					Unset bson.M `bson:"$unset"`
+				} `bson:"update"`
+			}
+			if err := bson.Unmarshal(startedCommand(mt, "findAndModify"), &sent); err != nil {
+				mt.Fatal(err)
+			}
+			if _, ok := sent.Query["status"]; !ok || sent.Update.Unset["worker_id"] == nil || sent.Update.Unset["lease_until"] == nil {
+				mt.Errorf("findAndModify = %v %v, se esperaba filtrar por estado y soltar la reserva", sent.Query, sent.Update.Unset)
+			}
+		})
+	}
+}
+
+// Si Start no pudo crear los índices no hay workers: no se aceptan importaciones nuevas
+func TestCreateArtistImportRequiresStart(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("índices sin crear", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "sin permisos"}))
+		jobs := NewImportJobService(&MusicService{db: mt.DB}, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := jobs.Start(ctx); err == nil {
+			mt.Fatal("Start no devolvió el error de los índices")
+		}
+		if _, err := jobs.CreateArtistImport(ctx, "Rosalía"); !errors.Is(err, ErrImportsUnavailable) {
+			mt.Errorf("CreateArtistImport error = %v, se esperaba %v", err, ErrImportsUnavailable)
+		}
+	})
+}
+
+func TestNewWorkerIDIsUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newWorkerID()
+		if seen[id] {
+			t.Fatalf("worker_id repetido: %s", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/zmb3/spotify/v2"
+
+	"github.com/angel/music-ms/internal/metadata"
+)
+
+// MetadataProvider es una fuente de metadatos de la que se importan artistas, álbumes y
+// canciones. Los IDs que recibe y devuelve son los del propio proveedor; si no tiene lo
+// pedido devuelve metadata.ErrNotFound.
+type MetadataProvider interface {
+	// Name es el nombre con el que se registra y que se guarda en los documentos importados
+	Name() string
+	SearchArtists(ctx context.Context, query string, limit int) ([]metadata.Artist, error)
+	SearchAlbums(ctx context.Context, query string, limit int) ([]metadata.Album, error)
+	GetArtist(ctx context.Context, id string) (*metadata.Artist, error)
+	// GetAlbum devuelve el álbum con sus pistas
+	GetAlbum(ctx context.Context, id string) (*metadata.Album, error)
+	GetArtistAlbums(ctx context.Context, artistID string) ([]metadata.Album, error)
+}
+
+// RegisterProvider añade un proveedor de metadatos, o sustituye al que tenga el mismo nombre
+func (s *MusicService) RegisterProvider(provider MetadataProvider) {
+	s.providers[provider.Name()] = provider
+}
+
+// ProviderNames retorna los nombres de los proveedores registrados, ordenados
+func (s *MusicService) ProviderNames() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// provider busca un proveedor registrado por su nombre
+func (s *MusicService) provider(name string) (MetadataProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, invalid("provider", "proveedor desconocido %q", name)
+	}
+	return provider, nil
+}
+
+// SearchProviderArtists busca artistas en un proveedor
+func (s *MusicService) SearchProviderArtists(ctx context.Context, providerName, query string, limit int) ([]metadata.Artist, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	return provider.SearchArtists(ctx, query, limit)
+}
+
+// SearchProviderAlbums busca álbumes en un proveedor
+func (s *MusicService) SearchProviderAlbums(ctx context.Context, providerName, query string, limit int) ([]metadata.Album, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	return provider.SearchAlbums(ctx, query, limit)
+}
+
+// spotifyProvider adapta SpotifyService a MetadataProvider
+type spotifyProvider struct {
+	spotify *SpotifyService
+}
+
+func (p spotifyProvider) Name() string {
+	return metadata.ProviderSpotify
+}
+
+func (p spotifyProvider) SearchArtists(ctx context.Context, query string, limit int) ([]metadata.Artist, error) {
+	found, err := p.spotify.SearchArtists(ctx, query, limit)
+	if err != nil {
+		return nil, spotifyNotFound(err)
+	}
+	artists := make([]metadata.Artist, len(found))
+	for i := range found {
+		artists[i] = spotifyArtist(&found[i])
+	}
+	return artists, nil
+}
+
+func (p spotifyProvider) SearchAlbums(ctx context.Context, query string, limit int) ([]metadata.Album, error) {
+	found, err := p.spotify.SearchAlbums(ctx, query, limit)
+	if err != nil {
+		return nil, spotifyNotFound(err)
+	}
+	albums := make([]metadata.Album, len(found))
+	for i, album := range found {
+		albums[i] = spotifyAlbum(album)
+	}
+	return albums, nil
+}
+
+func (p spotifyProvider) GetArtist(ctx context.Context, id string) (*metadata.Artist, error) {
+	found, err := p.spotify.GetArtist(ctx, id)
+	if err != nil {
+		return nil, spotifyNotFound(err)
+	}
+	artist := spotifyArtist(found)
+	return &artist, nil
+}
+
+func (p spotifyProvider) GetAlbum(ctx context.Context, id string) (*metadata.Album, error) {
+	found, err := p.spotify.GetAlbum(ctx, id)
+	if err != nil {
+		return nil, spotifyNotFound(err)
+	}
+	album := spotifyAlbum(found.SimpleAlbum)
+	album.Tracks = make([]metadata.Track, len(found.Tracks.Tracks))
+	for i, track := range found.Tracks.Tracks {
+		album.Tracks[i] = metadata.Track{
+			ID:          string(track.ID),
+			Title:       track.Name,
+			DurationMs:  track.Duration,
+			TrackNumber: track.TrackNumber,
+			Markets:     track.AvailableMarkets,
+		}
+	}
+	return &album, nil
+}
+
+func (p spotifyProvider) GetArtistAlbums(ctx context.Context, artistID string) ([]metadata.Album, error) {
+	found, err := p.spotify.GetArtistAlbums(ctx, artistID)
+	if err != nil {
+		return nil, spotifyNotFound(err)
+	}
+	albums := make([]metadata.Album, len(found))
+	for i, album := range found {
+		albums[i] = spotifyAlbum(album)
+	}
+	return albums, nil
+}
+
+// spotifyNotFound traduce el 404 de Spotify a metadata.ErrNotFound
+func spotifyNotFound(err error) error {
+	var spotifyErr spotify.Error
+	if errors.As(err, &spotifyErr) && spotifyErr.Status == http.StatusNotFound {
+		return metadata.ErrNotFound
+	}
+	return err
+}
+
+func spotifyArtist(artist *spotify.FullArtist) metadata.Artist {
+	var imageURL string
+	if len(artist.Images) > 0 {
+		imageURL = artist.Images[0].URL
+	}
+	return metadata.Artist{
+		ID:         string(artist.ID),
+		Name:       artist.Name,
+		Genres:     artist.Genres,
+		ImageURL:   imageURL,
+		Popularity: artist.Popularity,
+	}
+}
+
+func spotifyAlbum(album spotify.SimpleAlbum) metadata.Album {
+	var imageURL string
+	if len(album.Images) > 0 {
+		imageURL = album.Images[0].URL
+	}
+	artists := make([]metadata.ArtistRef, len(album.Artists))
+	for i, artist := range album.Artists {
+		artists[i] = metadata.ArtistRef{ID: string(artist.ID), Name: artist.Name}
+	}
+	return metadata.Album{
+		ID:          string(album.ID),
+		Title:       album.Name,
+		ReleaseDate: album.ReleaseDate,
+		ImageURL:    imageURL,
+		Artists:     artists,
+	}
+}
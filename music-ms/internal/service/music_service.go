@@ -2,9 +2,9 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
 	"time"
 
@@ -14,21 +14,40 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/angel/music-ms/internal/metadata"
 	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/search"
 )
 
 // MusicService maneja las operaciones de la base de datos para la música
 type MusicService struct {
 	db             *mongo.Database
 	spotifyService *SpotifyService
+	suggestions    *search.SuggestionIndex
+	fuzziness      int // ediciones toleradas en la búsqueda; 0 la deja exacta
+	providers      map[string]MetadataProvider
 }
 
-// NewMusicService crea un nuevo servicio de música
+// NewMusicService crea un nuevo servicio de música. Spotify queda registrado como
+// proveedor de metadatos; los demás se añaden con RegisterProvider.
 func NewMusicService(db *mongo.Database, spotifyService *SpotifyService) *MusicService {
-	return &MusicService{
+	s := &MusicService{
 		db:             db,
 		spotifyService: spotifyService,
+		suggestions:    search.NewSuggestionIndex(),
+		fuzziness:      search.DefaultMaxEdits,
+		providers:      make(map[string]MetadataProvider),
 	}
+	if spotifyService != nil {
+		s.RegisterProvider(spotifyProvider{spotify: spotifyService})
+	}
+	return s
+}
+
+// SetSearchFuzziness fija cuántas ediciones (letras de más, de menos o cambiadas) se
+// toleran como mucho por palabra al buscar; 0 desactiva la búsqueda aproximada
+func (s *MusicService) SetSearchFuzziness(maxEdits int) {
+	s.fuzziness = maxEdits
 }
 
 // GetArtistCollection retorna la colección de artistas
@@ -206,19 +225,128 @@ func (s *MusicService) GetSong(ctx context.Context, id string) (*models.SongWith
 	}, nil
 }
 
-// SearchSongsByName busca canciones por nombre
-func (s *MusicService) SearchSongsByName(ctx context.Context, name string) ([]models.SongWithDetails, error) {
-	filter := bson.M{"title": bson.M{"$regex": name, "$options": "i"}}
-	cursor, err := s.GetSongCollection().Find(ctx, filter)
+// UpdateSongAvailability reemplaza los países y la ventana de disponibilidad de una canción.
+// Devuelve mongo.ErrNoDocuments si la canción no existe.
+func (s *MusicService) UpdateSongAvailability(ctx context.Context, id string, markets []string, from, until *time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	fields := map[string]interface{}{
+		"available_markets": markets,
+		"available_from":    from,
+		"available_until":   until,
+	}
+	for field, value := range fields {
+		switch v := value.(type) {
+		case []string:
+			if len(v) == 0 {
+				unset[field] = ""
+				continue
+			}
+		case *time.Time:
+			if v == nil {
+				unset[field] = ""
+				continue
+			}
+		}
+		set[field] = value
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	result, err := s.GetSongCollection().UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// GetLyricsCollection retorna la colección de letras
+func (s *MusicService) GetLyricsCollection() *mongo.Collection {
+	return s.db.Collection("lyrics")
+}
+
+// GetLyrics obtiene la letra de una canción en el idioma indicado; sin idioma devuelve la
+// última actualizada. Devuelve mongo.ErrNoDocuments si no hay letra.
+func (s *MusicService) GetLyrics(ctx context.Context, songID, language string) (*models.Lyrics, error) {
+	objectID, err := primitive.ObjectIDFromHex(songID)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var songs []models.Song
-	if err := cursor.All(ctx, &songs); err != nil {
+	filter := bson.M{"song_id": objectID}
+	if language != "" {
+		filter["language"] = language
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	var lyrics models.Lyrics
+	if err := s.GetLyricsCollection().FindOne(ctx, filter, opts).Decode(&lyrics); err != nil {
 		return nil, err
 	}
+	return &lyrics, nil
+}
+
+// SaveLyrics crea o reemplaza la letra de la canción en su idioma.
+// Devuelve mongo.ErrNoDocuments si la canción no existe.
+func (s *MusicService) SaveLyrics(ctx context.Context, lyrics *models.Lyrics) error {
+	count, err := s.GetSongCollection().CountDocuments(ctx, bson.M{"_id": lyrics.SongID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	now := time.Now()
+	lyrics.UpdatedAt = now
+	filter := bson.M{"song_id": lyrics.SongID, "language": lyrics.Language}
+	update := bson.M{
+		"$set": bson.M{
+			"source":     lyrics.Source,
+			"plain":      lyrics.Plain,
+			"lines":      lyrics.Lines,
+			"synced":     lyrics.Synced,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	return s.GetLyricsCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(lyrics)
+}
+
+// SearchSongsByName busca canciones cuyo título contiene el texto indicado (literal, no
+// como expresión regular). Si no hay ninguna, busca con las palabras del catálogo más
+// parecidas y devuelve también la consulta corregida. Para búsquedas por relevancia está Search.
+func (s *MusicService) SearchSongsByName(ctx context.Context, name string) ([]models.SongWithDetails, string, error) {
+	filter := bson.M{"title": bson.M{"$regex": regexp.QuoteMeta(name), "$options": "i"}}
+	songs, err := findAll[models.Song](ctx, s.GetSongCollection(), filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	didYouMean := ""
+	if len(songs) == 0 {
+		if expanded, corrected := s.correctTerms(search.Terms(name)); corrected != "" {
+			score := bson.M{"score": bson.M{"$meta": "textScore"}}
+			songs, err = findAll[models.Song](ctx, s.GetSongCollection(),
+				bson.M{"$text": bson.M{"$search": strings.Join(expanded, " ")}},
+				options.Find().SetProjection(score).SetSort(score).SetLimit(MaxSearchLimit))
+			if err != nil {
+				return nil, "", err
+			}
+			didYouMean = corrected
+		}
+	}
 
 	var result []models.SongWithDetails
 	for _, song := range songs {
@@ -243,7 +371,7 @@ func (s *MusicService) SearchSongsByName(ctx context.Context, name string) ([]mo
 			Artists: artists,
 		})
 	}
-	return result, nil
+	return result, didYouMean, nil
 }
 
 // GetAlbums returns all albums from the database
@@ -492,115 +620,77 @@ func (s *MusicService) GetCategories(ctx context.Context) ([]models.Category, er
 
 // ImportAlbumFromSpotify importa un álbum de Spotify
 func (s *MusicService) ImportAlbumFromSpotify(ctx context.Context, spotifyID string) (*models.Album, error) {
-	// Verificar si ya existe el álbum
-	albumCollection := s.db.Collection("albums")
-	var existingAlbum models.Album
-	err := albumCollection.FindOne(ctx, bson.M{"spotify_id": spotifyID}).Decode(&existingAlbum)
-	if err == nil {
-		return &existingAlbum, nil // El álbum ya existe
-	} else if err != mongo.ErrNoDocuments {
-		return nil, err
-	}
+	return s.ImportProviderAlbum(ctx, metadata.ProviderSpotify, spotifyID)
+}
 
-	// Obtener álbum de Spotify
-	albumData, err := s.spotifyService.GetAlbum(ctx, spotifyID)
-	if err != nil {
-		return nil, err
+// SearchAlbumsInSpotify busca álbumes en Spotify
+func (s *MusicService) SearchAlbumsInSpotify(ctx context.Context, query string, limit int) ([]spotify.SimpleAlbum, error) {
+	if s.spotifyService == nil {
+		return nil, ErrSpotifyUnavailable
 	}
+	return s.spotifyService.SearchAlbums(ctx, query, limit)
+}
 
-	// Procesar artistas
-	var artistIDs []primitive.ObjectID
-	artistCollection := s.db.Collection("artists")
-
-	for _, spotifyArtist := range albumData.Artists {
-		// Verificar si el artista ya existe
-		var existingArtist models.Artist
-		err := artistCollection.FindOne(ctx, bson.M{"spotify_id": string(spotifyArtist.ID)}).Decode(&existingArtist)
-
-		if err == nil {
-			// El artista ya existe
-			artistIDs = append(artistIDs, existingArtist.ID)
-		} else if err == mongo.ErrNoDocuments {
-			// Obtener detalles del artista
-			artistData, err := s.spotifyService.GetArtist(ctx, string(spotifyArtist.ID))
-			if err != nil {
-				continue
-			}
-
-			// Crear el artista
-			artist := s.spotifyService.ConvertSpotifyArtistToModel(artistData)
-			insertResult, err := artistCollection.InsertOne(ctx, artist)
-			if err != nil {
-				return nil, err
-			}
+// CountSongsByAlbumID cuenta el número de canciones de un álbum
+func (s *MusicService) CountSongsByAlbumID(ctx context.Context, albumID primitive.ObjectID) (int, error) {
+	collection := s.db.Collection("songs")
 
-			artistID, ok := insertResult.InsertedID.(primitive.ObjectID)
-			if !ok {
-				return nil, errors.New("failed to get inserted artist ID")
-			}
-			artistIDs = append(artistIDs, artistID)
-		} else {
-			return nil, err
-		}
+	count, err := collection.CountDocuments(ctx, bson.M{"album_id": albumID})
+	if err != nil {
+		return 0, err
 	}
 
-	// Crear el álbum
-	album := s.spotifyService.ConvertSpotifyAlbumToModel(albumData)
-	album.ArtistIDs = artistIDs
+	return int(count), nil
+}
 
-	insertResult, err := albumCollection.InsertOne(ctx, album)
+// GetSongsByAlbumID obtiene las canciones de un álbum ordenadas por número de pista
+func (s *MusicService) GetSongsByAlbumID(ctx context.Context, albumID primitive.ObjectID) ([]models.Song, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "track_number", Value: 1}})
+	cursor, err := s.GetSongCollection().Find(ctx, bson.M{"album_id": albumID}, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	albumID, ok := insertResult.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return nil, errors.New("failed to get inserted album ID")
-	}
-	album.ID = albumID
-
-	// Procesar canciones
-	songCollection := s.db.Collection("songs")
-	for _, track := range albumData.Tracks.Tracks {
-		song := s.spotifyService.ConvertSpotifyTrackToModel(track, albumID, artistIDs)
-		_, err := songCollection.InsertOne(ctx, song)
-		if err != nil {
-			log.Printf("Error inserting song %s: %v", track.Name, err)
-		}
+	var songs []models.Song
+	if err := cursor.All(ctx, &songs); err != nil {
+		return nil, err
 	}
-
-	return &album, nil
+	return songs, nil
 }
 
-// SearchAlbumsInSpotify busca álbumes en Spotify
-func (s *MusicService) SearchAlbumsInSpotify(ctx context.Context, query string, limit int) ([]spotify.SimpleAlbum, error) {
-	if s.spotifyService == nil {
-		return nil, fmt.Errorf("Spotify service not available")
+// GetAlbumIDsPendingLoudness devuelve los álbumes con alguna canción sin sonoridad medida,
+// o todos los álbumes con canciones si force es true
+func (s *MusicService) GetAlbumIDsPendingLoudness(ctx context.Context, force bool) ([]primitive.ObjectID, error) {
+	filter := bson.M{}
+	if !force {
+		filter["loudness"] = bson.M{"$exists": false}
 	}
-
-	// Crear cliente de Spotify
-	results, err := s.spotifyService.Client().Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
+	values, err := s.GetSongCollection().Distinct(ctx, "album_id", filter)
 	if err != nil {
 		return nil, err
 	}
 
-	if results.Albums == nil || len(results.Albums.Albums) == 0 {
-		return []spotify.SimpleAlbum{}, nil
+	var ids []primitive.ObjectID
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok && !id.IsZero() {
+			ids = append(ids, id)
+		}
 	}
-
-	return results.Albums.Albums, nil
+	return ids, nil
 }
 
-// CountSongsByAlbumID cuenta el número de canciones de un álbum
-func (s *MusicService) CountSongsByAlbumID(ctx context.Context, albumID primitive.ObjectID) (int, error) {
-	collection := s.db.Collection("songs")
-
-	count, err := collection.CountDocuments(ctx, bson.M{"album_id": albumID})
+// SetSongLoudness guarda la medición de sonoridad de una canción
+func (s *MusicService) SetSongLoudness(ctx context.Context, songID primitive.ObjectID, loudness models.Loudness) error {
+	update := bson.M{"$set": bson.M{"loudness": loudness, "updated_at": time.Now()}}
+	result, err := s.GetSongCollection().UpdateOne(ctx, bson.M{"_id": songID}, update)
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	return int(count), nil
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
 }
 
 // GetGenres obtiene todos los géneros musicales desde la base de datos
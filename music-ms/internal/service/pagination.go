@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+const (
+	// DefaultPageSize es el tamaño de página cuando no se indica first
+	DefaultPageSize = 20
+	// MaxPageSize limita first para que ninguna página descargue el catálogo entero
+	MaxPageSize = 100
+)
+
+// PageRequest pide los primeros First elementos posteriores al cursor After (vacío = desde el inicio)
+type PageRequest struct {
+	First int
+	After string
+	Count bool // Calcular TotalCount; cuesta una consulta más sobre todo el filtro
+}
+
+// Page es una página de resultados con un cursor por elemento
+type Page[T any] struct {
+	Items           []T
+	Cursors         []string
+	TotalCount      int
+	HasNextPage     bool
+	HasPreviousPage bool
+}
+
+// pageCursor es el contenido de un cursor: la clave de orden del elemento y su _id, que
+// desempata cuando varios elementos comparten la clave
+type pageCursor struct {
+	Key interface{} `json:"k"`
+	ID  string      `json:"id"`
+}
+
+func encodeCursor(key interface{}, id primitive.ObjectID) string {
+	data, _ := json.Marshal(pageCursor{Key: key, ID: id.Hex()})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (*pageCursor, primitive.ObjectID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, primitive.NilObjectID, invalid("after", "cursor inválido")
+	}
+	var decoded pageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, primitive.NilObjectID, invalid("after", "cursor inválido")
+	}
+	id, err := primitive.ObjectIDFromHex(decoded.ID)
+	if err != nil {
+		return nil, primitive.NilObjectID, invalid("after", "cursor inválido")
+	}
+	// JSON no distingue enteros; las claves numéricas (track_number, year) se guardan como int
+	if f, ok := decoded.Key.(float64); ok && f == math.Trunc(f) {
+		decoded.Key = int64(f)
+	}
+	return &decoded, id, nil
+}
+
+// pageIndexes son los índices compuestos (filtro, clave de orden, _id) de cada listado
+// paginado, para que la búsqueda por clave y el orden salgan del índice
+var pageIndexes = map[string][]bson.D{
+	"songs": {
+		{{Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+		{{Key: "album_id", Value: 1}, {Key: "track_number", Value: 1}, {Key: "_id", Value: 1}},
+		{{Key: "artist_ids", Value: 1}, {Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+	},
+	"albums": {
+		{{Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+		{{Key: "artist_ids", Value: 1}, {Key: "year", Value: 1}, {Key: "_id", Value: 1}},
+	},
+	"artists": {
+		{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+		{{Key: "genres", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+	},
+	"genres": {
+		{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+	},
+}
+
+// pageSortFields son las claves de orden de los listados con el valor que toman donde
+// faltan: el valor cero del campo en Go, que es lo que keyOf pone en el cursor
+var pageSortFields = []struct {
+	collection string
+	field      string
+	zero       interface{}
+}{
+	{"songs", "title", ""},
+	{"songs", "track_number", 0},
+	{"albums", "title", ""},
+	{"albums", "year", 0},
+	{"artists", "name", ""},
+	{"genres", "name", ""},
+}
+
+// EnsurePageIndexes rellena las claves de orden que faltan o son null en documentos
+// antiguos y crea los índices de la paginación. Los modelos escriben siempre esos campos
+// (no son omitempty), así que el relleno solo afecta a datos cargados por fuera del servicio.
+func (s *MusicService) EnsurePageIndexes(ctx context.Context) error {
+	for _, sortField := range pageSortFields {
+		// {campo: null} coincide con el campo ausente o null
+		_, err := s.db.Collection(sortField.collection).UpdateMany(ctx,
+			bson.M{sortField.field: nil},
+			bson.M{"$set": bson.M{sortField.field: sortField.zero}})
+		if err != nil {
+			return err
+		}
+	}
+	for collection, keys := range pageIndexes {
+		indexModels := make([]mongo.IndexModel, len(keys))
+		for i, key := range keys {
+			indexModels[i] = mongo.IndexModel{Keys: key}
+		}
+		if _, err := s.db.Collection(collection).Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findPage recorre la colección ordenada por (sortKey, _id) ascendente. Usa paginación por
+// clave en lugar de skip para que las páginas no se desplacen si se insertan elementos.
+// TotalCount solo se calcula si req.Count lo pide, porque cuenta todo el filtro.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, sortKey string, keyOf func(T) (interface{}, primitive.ObjectID), req PageRequest) (*Page[T], error) {
+	first := req.First
+	if first <= 0 {
+		first = DefaultPageSize
+	}
+	if first > MaxPageSize {
+		return nil, invalid("first", "el máximo es %d", MaxPageSize)
+	}
+
+	var after *pageCursor
+	var afterID primitive.ObjectID
+	if req.After != "" {
+		var err error
+		if after, afterID, err = decodeCursor(req.After); err != nil {
+			return nil, err
+		}
+	}
+
+	page := &Page[T]{HasPreviousPage: req.After != ""}
+	if req.Count {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		page.TotalCount = int(total)
+	}
+
+	// Se pide un elemento de más para saber si hay página siguiente
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortKey, Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(first + 1))
+	cursor, err := collection.Find(ctx, pageFilter(filter, sortKey, after, afterID), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []T
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	if len(items) > first {
+		items = items[:first]
+		page.HasNextPage = true
+	}
+	page.Items = items
+	page.Cursors = make([]string, len(items))
+	for i, item := range items {
+		page.Cursors[i] = encodeCursor(keyOf(item))
+	}
+	return page, nil
+}
+
+// pageFilter añade al filtro la condición de los elementos posteriores al cursor
+func pageFilter(filter bson.M, sortKey string, after *pageCursor, afterID primitive.ObjectID) bson.M {
+	if after == nil {
+		return filter
+	}
+	keyset := bson.M{"$or": bson.A{
+		bson.M{sortKey: bson.M{"$gt": after.Key}},
+		bson.M{sortKey: after.Key, "_id": bson.M{"$gt": afterID}},
+	}}
+	if len(filter) == 0 {
+		return keyset
+	}
+	// $and porque el filtro puede traer su propio $or
+	return bson.M{"$and": bson.A{filter, keyset}}
+}
+
+func songKey(song models.Song) (interface{}, primitive.ObjectID) {
+	return song.Title, song.ID
+}
+
+// GetSongsPage pagina todas las canciones por título
+func (s *MusicService) GetSongsPage(ctx context.Context, req PageRequest) (*Page[models.Song], error) {
+	return findPage(ctx, s.GetSongCollection(), bson.M{}, "title", songKey, req)
+}
+
+// GetAlbumsPage pagina todos los álbumes por título
+func (s *MusicService) GetAlbumsPage(ctx context.Context, req PageRequest) (*Page[models.Album], error) {
+	return findPage(ctx, s.GetAlbumCollection(), bson.M{}, "title", func(album models.Album) (interface{}, primitive.ObjectID) {
+		return album.Title, album.ID
+	}, req)
+}
+
+// GetArtistsPage pagina los artistas por nombre; con genre solo los de ese género
+func (s *MusicService) GetArtistsPage(ctx context.Context, genre string, req PageRequest) (*Page[models.Artist], error) {
+	filter := bson.M{}
+	if genre != "" {
+		filter["genres"] = genre
+	}
+	return findPage(ctx, s.GetArtistCollection(), filter, "name", func(artist models.Artist) (interface{}, primitive.ObjectID) {
+		return artist.Name, artist.ID
+	}, req)
+}
+
+// GetGenresPage pagina los géneros por nombre
+func (s *MusicService) GetGenresPage(ctx context.Context, req PageRequest) (*Page[models.Genre], error) {
+	return findPage(ctx, s.db.Collection("genres"), bson.M{}, "name", func(genre models.Genre) (interface{}, primitive.ObjectID) {
+		return genre.Name, genre.ID
+	}, req)
+}
+
+// GetAlbumSongsPage pagina las canciones de un álbum en orden de pista
+func (s *MusicService) GetAlbumSongsPage(ctx context.Context, albumID string, req PageRequest) (*Page[models.Song], error) {
+	id, err := primitive.ObjectIDFromHex(albumID)
+	if err != nil {
+		return nil, err
+	}
+	return findPage(ctx, s.GetSongCollection(), bson.M{"album_id": id}, "track_number", func(song models.Song) (interface{}, primitive.ObjectID) {
+		return song.TrackNumber, song.ID
+	}, req)
+}
+
+// GetArtistAlbumsPage pagina los álbumes de un artista del más antiguo al más reciente
+func (s *MusicService) GetArtistAlbumsPage(ctx context.Context, artistID string, req PageRequest) (*Page[models.Album], error) {
+	id, err := primitive.ObjectIDFromHex(artistID)
+	if err != nil {
+		return nil, err
+	}
+	return findPage(ctx, s.GetAlbumCollection(), bson.M{"artist_ids": id}, "year", func(album models.Album) (interface{}, primitive.ObjectID) {
+		return album.Year, album.ID
+	}, req)
+}
+
+// GetArtistSongsPage pagina por título las canciones del artista: las que lo tienen en
+// artist_ids y las de sus álbumes
+func (s *MusicService) GetArtistSongsPage(ctx context.Context, artistID string, req PageRequest) (*Page[models.Song], error) {
+	id, err := primitive.ObjectIDFromHex(artistID)
+	if err != nil {
+		return nil, err
+	}
+	albumIDs, err := s.GetAlbumCollection().Distinct(ctx, "_id", bson.M{"artist_ids": id})
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"artist_ids": id},
+		bson.M{"album_id": bson.M{"$in": albumIDs}},
+	}}
+	return findPage(ctx, s.GetSongCollection(), filter, "title", songKey, req)
+}
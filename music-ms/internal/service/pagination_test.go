@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/angel/music-ms/internal/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		name string
+		key  interface{}
+		want interface{}
+	}{
+		{"título", "Bohemian Rhapsody", "Bohemian Rhapsody"},
+		{"título vacío", "", ""},
+		// JSON no distingue enteros: las claves numéricas vuelven como int64
+		{"número de pista", 7, int64(7)},
+		{"sin número de pista", 0, int64(0)},
+		{"año", 1975, int64(1975)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, gotID, err := decodeCursor(encodeCursor(tt.key, id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cursor.Key, tt.want) || gotID != id {
+				t.Errorf("decodeCursor = (%#v, %s), se esperaba (%#v, %s)", cursor.Key, gotID.Hex(), tt.want, id.Hex())
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"no es base64", "%%%"},
+		{"no es JSON", "bm8tanNvbg"},
+		{"id inválido", "eyJrIjoiYSIsImlkIjoieCJ9"}, // {"k":"a","id":"x"}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeCursor(tt.cursor)
+			var validation *ValidationError
+			if !errors.As(err, &validation) || validation.Field != "after" {
+				t.Errorf("decodeCursor(%q) error = %v, se esperaba un error de validación en after", tt.cursor, err)
+			}
+		})
+	}
+}
+
+func TestPageFilter(t *testing.T) {
+	albumID := primitive.NewObjectID()
+	artistID := primitive.NewObjectID()
+	afterID := primitive.NewObjectID()
+	// Un documento con track_number 0 (el relleno de los que no lo tenían) tiene cursor con
+	// clave 0; la página siguiente debe incluir a los demás con 0 y _id mayor
+	keyset := bson.M{"$or": bson.A{
+		bson.M{"track_number": bson.M{"$gt": int64(0)}},
+		bson.M{"track_number": int64(0), "_id": bson.M{"$gt": afterID}},
+	}}
+	artistSongs := bson.M{"$or": bson.A{bson.M{"artist_ids": artistID}, bson.M{"album_id": bson.M{"$in": bson.A{albumID}}}}}
+
+	tests := []struct {
+		name   string
+		filter bson.M
+		after  *pageCursor
+		want   bson.M
+	}{
+		{"primera página", bson.M{"album_id": albumID}, nil, bson.M{"album_id": albumID}},
+		{"sin filtro", bson.M{}, &pageCursor{Key: int64(0)}, keyset},
+		{"con filtro", bson.M{"album_id": albumID}, &pageCursor{Key: int64(0)}, bson.M{"$and": bson.A{bson.M{"album_id": albumID}, keyset}}},
+		{"filtro con su propio $or", artistSongs, &pageCursor{Key: int64(0)}, bson.M{"$and": bson.A{artistSongs, keyset}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pageFilter(tt.filter, "track_number", tt.after, afterID)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pageFilter =\n%v\nse esperaba\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+// El relleno de EnsurePageIndexes debe ser la clave que keyOf pone en el cursor de un
+// documento sin el campo
+func TestPageSortFieldsMatchKeyOfMissingField(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"_id": primitive.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var song models.Song
+	var album models.Album
+	var artist models.Artist
+	var genre models.Genre
+	for _, v := range []interface{}{&song, &album, &artist, &genre} {
+		if err := bson.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := map[string]interface{}{
+		"songs.title":        song.Title,
+		"songs.track_number": song.TrackNumber,
+		"albums.title":       album.Title,
+		"albums.year":        album.Year,
+		"artists.name":       artist.Name,
+		"genres.name":        genre.Name,
+	}
+	for _, sortField := range pageSortFields {
+		name := sortField.collection + "." + sortField.field
+		key, ok := keys[name]
+		if !ok {
+			t.Errorf("%s: clave de orden sin comprobar", name)
+			continue
+		}
+		if key != sortField.zero {
+			t.Errorf("%s: clave %#v, el relleno usa %#v", name, key, sortField.zero)
+		}
+	}
+}
+
+// TotalCount cuenta todo el filtro, así que solo se consulta cuando se pide; la página es
+// un find por el campo de orden sin calcular y _id
+func TestFindPageCount(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	songs := []bson.D{
+		{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "A"}},
+		{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "B"}},
+		{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "C"}},
+	}
+	tests := []struct {
+		name      string
+		count     bool
+		responses []bson.D
+		wantTotal int
+		wantCmds  []string
+	}{
+		{
+			name:      "sin totalCount",
+			responses: []bson.D{mtest.CreateCursorResponse(0, "music.songs", mtest.FirstBatch, songs...)},
+			wantCmds:  []string{"find"},
+		},
+		{
+			name:  "con totalCount",
+			count: true,
+			responses: []bson.D{
+				mtest.CreateCursorResponse(0, "music.songs", mtest.FirstBatch, bson.D{{Key: "n", Value: 3}}),
+				mtest.CreateCursorResponse(0, "music.songs", mtest.FirstBatch, songs...),
+			},
+			wantTotal: 3,
+			wantCmds:  []string{"aggregate", "find"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			music := &MusicService{db: mt.DB}
+			page, err := music.GetSongsPage(context.Background(), PageRequest{First: 2, Count: tt.count})
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if page.TotalCount != tt.wantTotal || len(page.Items) != 2 || !page.HasNextPage {
+				mt.Errorf("página = %d elementos, total %d, siguiente %v; se esperaban 2, %d, true", len(page.Items), page.TotalCount, page.HasNextPage, tt.wantTotal)
+			}
+
+			var cmds []string
+			for _, started := range mt.GetAllStartedEvents() {
+				cmds = append(cmds, started.CommandName)
+				if started.CommandName != "find" {
+					continue
+				}
+				sort := started.Command.Lookup("sort").Document()
+				keys, _ := sort.Elements()
+				if len(keys) != 2 || keys[0].Key() != "title" || keys[1].Key() != "_id" {
+					mt.Errorf("sort = %v, se esperaba {title: 1, _id: 1}", sort)
+				}
+				if limit := started.Command.Lookup("limit").AsInt64(); limit != 3 {
+					mt.Errorf("limit = %d, se esperaba 3 (uno de más)", limit)
+				}
+			}
+			if !reflect.DeepEqual(cmds, tt.wantCmds) {
+				mt.Errorf("órdenes = %v, se esperaba %v", cmds, tt.wantCmds)
+			}
+		})
+	}
+}
+
+func TestFindPageRejectsLargePages(t *testing.T) {
+	_, err := findPage(context.Background(), nil, bson.M{}, "title", songKey, PageRequest{First: MaxPageSize + 1})
+	var validation *ValidationError
+	if !errors.As(err, &validation) || validation.Field != "first" {
+		t.Errorf("findPage error = %v, se esperaba un error de validación en first", err)
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/angel/music-ms/internal/metadata"
+	"github.com/angel/music-ms/internal/models"
+)
+
+// ProviderArtistImport es el resultado de importar un artista con su discografía
+type ProviderArtistImport struct {
+	Artist models.Artist          `json:"artist"`
+	Albums []models.Album         `json:"albums"`
+	Failed []ProviderAlbumFailure `json:"failed,omitempty"`
+}
+
+// ProviderAlbumFailure es un álbum de la discografía que no se pudo importar
+type ProviderAlbumFailure struct {
+	ID    string `json:"id"` // ID en el proveedor
+	Title string `json:"title"`
+	Error string `json:"error"`
+}
+
+// ImportProviderAlbum importa un álbum de un proveedor con sus pistas y los artistas que
+// falten. Si ya se había importado no se duplica.
+func (s *MusicService) ImportProviderAlbum(ctx context.Context, providerName, id string) (*models.Album, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	return s.importProviderAlbum(ctx, provider, id, primitive.NilObjectID)
+}
+
+// ImportProviderArtist importa un artista y todos sus álbumes. Los álbumes que fallan no
+// detienen la importación: se devuelven en Failed.
+func (s *MusicService) ImportProviderArtist(ctx context.Context, providerName, id string) (*ProviderArtistImport, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	found, err := provider.GetArtist(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	artist, err := s.saveProviderArtist(ctx, provider.Name(), found)
+	if err != nil {
+		return nil, err
+	}
+	albums, err := provider.GetArtistAlbums(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProviderArtistImport{Artist: *artist, Albums: []models.Album{}}
+	for _, album := range albums {
+		imported, err := s.importProviderAlbum(ctx, provider, album.ID, artist.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Error importando el álbum %s de %s (%s): %v", album.Title, artist.Name, provider.Name(), err)
+			result.Failed = append(result.Failed, ProviderAlbumFailure{ID: album.ID, Title: album.Title, Error: err.Error()})
+			continue
+		}
+		result.Albums = append(result.Albums, *imported)
+	}
+	return result, nil
+}
+
+// saveProviderArtist guarda el artista si no existía, o actualiza sus géneros si el
+// proveedor devuelve otros, y ajusta los contadores de los géneros que cambian
+func (s *MusicService) saveProviderArtist(ctx context.Context, provider string, artist *metadata.Artist) (*models.Artist, error) {
+	var existing models.Artist
+	err := s.GetArtistCollection().FindOne(ctx, externalFilter(provider, artist.ID)).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	exists := err == nil
+	added, removed := importedGenres(existing.Genres, exists, artist.Genres)
+
+	if !exists {
+		now := time.Now()
+		existing = models.Artist{
+			Name:       artist.Name,
+			ImageURL:   artist.ImageURL,
+			Biography:  artist.Biography,
+			Genres:     artist.Genres,
+			Popularity: artist.Popularity,
+			Provider:   provider,
+			ExternalID: artist.ID,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if provider == metadata.ProviderSpotify {
+			existing.SpotifyID = artist.ID
+		}
+		result, err := s.GetArtistCollection().InsertOne(ctx, existing)
+		if err != nil {
+			return nil, err
+		}
+		existing.ID = result.InsertedID.(primitive.ObjectID)
+	} else if len(added) > 0 || len(removed) > 0 {
+		existing.Genres, existing.UpdatedAt = artist.Genres, time.Now()
+		_, err := s.GetArtistCollection().UpdateOne(ctx, bson.M{"_id": existing.ID},
+			bson.M{"$set": bson.M{"genres": existing.Genres, "updated_at": existing.UpdatedAt}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Un error en los contadores de géneros no detiene la importación
+	if err := s.adjustGenreCounts(ctx, added, removed); err != nil {
+		log.Printf("Error guardando los géneros de %s: %v", artist.Name, err)
+	}
+	return &existing, nil
+}
+
+// importedGenres devuelve los géneros que gana y pierde un artista al importarlo de nuevo.
+// Si el proveedor no devuelve géneros se conservan los que tenía.
+func importedGenres(before []string, exists bool, after []string) (added, removed []string) {
+	if !exists {
+		return diffGenres(nil, after)
+	}
+	if len(after) == 0 {
+		return nil, nil
+	}
+	return diffGenres(before, after)
+}
+
+// importProviderAlbum importa un álbum y sus pistas. Los artistas del álbum que no estén
+// en el catálogo se piden al proveedor; artistID, si no es nulo, se añade siempre (es el
+// artista cuya discografía se importa). Los álbumes y canciones que ya existen no se
+// duplican: solo se les añaden los artistas que les falten.
+func (s *MusicService) importProviderAlbum(ctx context.Context, provider MetadataProvider, id string, artistID primitive.ObjectID) (*models.Album, error) {
+	found, err := provider.GetAlbum(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	artistIDs := []primitive.ObjectID{}
+	if !artistID.IsZero() {
+		artistIDs = append(artistIDs, artistID)
+	}
+	for _, ref := range found.Artists {
+		var artist models.Artist
+		err := s.GetArtistCollection().FindOne(ctx, externalFilter(provider.Name(), ref.ID)).Decode(&artist)
+		if err == mongo.ErrNoDocuments {
+			details, err := provider.GetArtist(ctx, ref.ID)
+			if err != nil {
+				return nil, err
+			}
+			saved, err := s.saveProviderArtist(ctx, provider.Name(), details)
+			if err != nil {
+				return nil, err
+			}
+			artist = *saved
+		} else if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(artistIDs, artist.ID) {
+			artistIDs = append(artistIDs, artist.ID)
+		}
+	}
+
+	var album models.Album
+	err = s.GetAlbumCollection().FindOne(ctx, externalFilter(provider.Name(), found.ID)).Decode(&album)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		now := time.Now()
+		album = models.Album{
+			Title:       found.Title,
+			ReleaseDate: found.ReleaseDate,
+			ImageURL:    found.ImageURL,
+			ArtistIDs:   artistIDs,
+			Year:        releaseYear(found.ReleaseDate),
+			Provider:    provider.Name(),
+			ExternalID:  found.ID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if provider.Name() == metadata.ProviderSpotify {
+			album.SpotifyID = found.ID
+		}
+		result, err := s.GetAlbumCollection().InsertOne(ctx, album)
+		if err != nil {
+			return nil, err
+		}
+		album.ID = result.InsertedID.(primitive.ObjectID)
+	case err != nil:
+		return nil, err
+	default:
+		_, err := s.GetAlbumCollection().UpdateOne(ctx, bson.M{"_id": album.ID},
+			bson.M{"$addToSet": bson.M{"artist_ids": bson.M{"$each": artistIDs}}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	songCollection := s.GetSongCollection()
+	for _, track := range found.Tracks {
+		var existing models.Song
+		err := songCollection.FindOne(ctx, externalFilter(provider.Name(), track.ID)).Decode(&existing)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			now := time.Now()
+			song := models.Song{
+				Title:       track.Title,
+				Duration:    track.DurationMs / 1000,
+				AlbumID:     album.ID,
+				ArtistIDs:   artistIDs,
+				TrackNumber: track.TrackNumber,
+				Provider:    provider.Name(),
+				ExternalID:  track.ID,
+				// Los mercados del proveedor sirven como lista inicial de países con licencia
+				AvailableMarkets: track.Markets,
+				CreatedAt:        now,
+				UpdatedAt:        now,
+			}
+			if provider.Name() == metadata.ProviderSpotify {
+				song.SpotifyID = track.ID
+			}
+			if _, err := songCollection.InsertOne(ctx, song); err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		default:
+			_, err := songCollection.UpdateOne(ctx, bson.M{"_id": existing.ID},
+				bson.M{"$addToSet": bson.M{"artist_ids": bson.M{"$each": artistIDs}}})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s.RefreshAlbumSuggestions(ctx, album.ID)
+	return &album, nil
+}
+
+// externalFilter busca un documento por su proveedor e ID externo. Lo importado de Spotify
+// antes de que existieran esos campos solo tiene spotify_id.
+func externalFilter(provider, id string) bson.M {
+	filter := bson.M{"provider": provider, "external_id": id}
+	if provider == metadata.ProviderSpotify {
+		return bson.M{"$or": bson.A{filter, bson.M{"spotify_id": id}}}
+	}
+	return filter
+}
+
+// releaseYear extrae el año de una fecha AAAA, AAAA-MM o AAAA-MM-DD; 0 si no lo tiene
+func releaseYear(date string) int {
+	year, err := strconv.Atoi(strings.SplitN(date, "-", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return year
+}
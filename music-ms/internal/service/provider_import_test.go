@@ -0,0 +1,33 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportedGenres(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      []string
+		exists      bool
+		after       []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{"artista nuevo", nil, false, []string{"pop", "latin"}, []string{"pop", "latin"}, nil},
+		{"artista nuevo sin géneros", nil, false, nil, nil, nil},
+		// Reimportar sin cambios no debe volver a sumar el artista a sus géneros
+		{"mismos géneros", []string{"pop", "latin"}, true, []string{"latin", "pop"}, nil, nil},
+		{"géneros distintos", []string{"pop", "dance"}, true, []string{"pop", "latin"}, []string{"latin"}, []string{"dance"}},
+		{"el proveedor no devuelve géneros", []string{"pop"}, true, nil, nil, nil},
+		{"existía sin géneros", nil, true, []string{"pop"}, []string{"pop"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := importedGenres(tt.before, tt.exists, tt.after)
+			if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("importedGenres = (%v, %v), se esperaba (%v, %v)", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
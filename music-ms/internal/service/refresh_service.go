@@ -0,0 +1,557 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/metadata"
+	"github.com/angel/music-ms/internal/models"
+)
+
+// Origen de una pasada de refresco
+const (
+	RefreshTriggerSchedule = "schedule"
+	RefreshTriggerManual   = "manual"
+)
+
+const (
+	// DefaultRefreshRunsLimit es el número de pasadas que devuelve el listado
+	DefaultRefreshRunsLimit = 20
+	// refreshUnavailableWait es cada cuánto se comprueba si ya hay credenciales de Spotify
+	refreshUnavailableWait = time.Minute
+	// refreshLockID es el _id del documento de locks que reserva el refresco
+	refreshLockID = "catalog_refresh"
+	// refreshLease es cuánto dura la reserva del refresco; la instancia que lo ejecuta la
+	// renueva cada tercio, así que otra solo puede empezar si esa lleva ese tiempo sin dar señales
+	refreshLease = time.Minute
+)
+
+// ErrRefreshRunning indica que ya hay una pasada de refresco en curso
+var ErrRefreshRunning = errors.New("catalog refresh already running")
+
+// errRefreshLockLost interrumpe la pasada cuyo lock ha caducado o ha tomado otra instancia
+var errRefreshLockLost = errors.New("se perdió la reserva del refresco")
+
+// refreshLock es el documento de la colección locks que reserva el refresco del catálogo:
+// aunque haya varias réplicas del servicio, solo una ejecuta una pasada a la vez
+type refreshLock struct {
+	ID        string             `bson:"_id"`
+	Owner     string             `bson:"owner"`
+	RunID     primitive.ObjectID `bson:"run_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// RefreshService mantiene al día el catálogo importado de Spotify. En cada pasada toma los
+// batchSize artistas que hace más tiempo que no se revisan, actualiza los campos que han
+// cambiado en ellos y en sus álbumes, e importa los álbumes nuevos de los artistas
+// seguidos. Las peticiones a Spotify se espacian requestInterval para no superar su límite.
+type RefreshService struct {
+	music           *MusicService
+	interval        time.Duration
+	batchSize       int
+	requestInterval time.Duration
+	owner           string // Identifica a esta instancia en el lock
+}
+
+// NewRefreshService crea el refresco del catálogo; con interval 0 solo se ejecuta a mano
+func NewRefreshService(music *MusicService, interval time.Duration, batchSize int, requestInterval time.Duration) *RefreshService {
+	return &RefreshService{
+		music:           music,
+		interval:        interval,
+		batchSize:       batchSize,
+		requestInterval: requestInterval,
+		owner:           newWorkerID(),
+	}
+}
+
+// GetRefreshRunCollection retorna la colección con el registro de cada pasada
+func (r *RefreshService) GetRefreshRunCollection() *mongo.Collection {
+	return r.music.db.Collection("refresh_runs")
+}
+
+// GetLockCollection retorna la colección de locks entre instancias del servicio
+func (r *RefreshService) GetLockCollection() *mongo.Collection {
+	return r.music.db.Collection("locks")
+}
+
+// Start programa, si hay intervalo, las pasadas contando desde la última, hasta que se
+// cancele ctx. Una pasada que se quedó a medias (la instancia se paró o dejó de renovar el
+// lock) se marca como fallida cuando la siguiente toma el lock.
+func (r *RefreshService) Start(ctx context.Context) error {
+	if r.interval <= 0 {
+		return nil
+	}
+
+	go func() {
+		for {
+			wait := time.Duration(0)
+			runs, err := r.GetRefreshRuns(ctx, 1)
+			if err != nil {
+				log.Printf("Error consultando el último refresco del catálogo: %v", err)
+				wait = r.interval
+			} else if len(runs) > 0 {
+				wait = time.Until(runs[0].StartedAt.Add(r.interval))
+			}
+			// Sin credenciales se vuelve a mirar cada poco hasta que las haya
+			available := r.music.spotifyService.Available()
+			if !available {
+				wait = max(wait, refreshUnavailableWait)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			if !available {
+				continue
+			}
+
+			run, err := r.begin(ctx, RefreshTriggerSchedule)
+			if err == ErrRefreshRunning {
+				continue
+			}
+			if err != nil {
+				log.Printf("Error iniciando el refresco del catálogo: %v", err)
+				continue
+			}
+			r.execute(ctx, run)
+		}
+	}()
+	return nil
+}
+
+// RunNow lanza una pasada en segundo plano y la devuelve recién creada
+func (r *RefreshService) RunNow(ctx context.Context) (*models.RefreshRun, error) {
+	if !r.music.spotifyService.Available() {
+		return nil, ErrSpotifyUnavailable
+	}
+	run, err := r.begin(ctx, RefreshTriggerManual)
+	if err != nil {
+		return nil, err
+	}
+	go r.execute(context.Background(), run)
+	return run, nil
+}
+
+// GetRefreshRuns obtiene las pasadas más recientes
+func (r *RefreshService) GetRefreshRuns(ctx context.Context, limit int) ([]models.RefreshRun, error) {
+	if limit <= 0 {
+		limit = DefaultRefreshRunsLimit
+	}
+	return findAll[models.RefreshRun](ctx, r.GetRefreshRunCollection(), bson.M{},
+		options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(int64(limit)))
+}
+
+// GetRefreshRun obtiene una pasada con su registro de cambios
+func (r *RefreshService) GetRefreshRun(ctx context.Context, id string) (*models.RefreshRun, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	var run models.RefreshRun
+	if err := r.GetRefreshRunCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// begin toma el lock del refresco y guarda la pasada; execute lo libera al terminar
+func (r *RefreshService) begin(ctx context.Context, trigger string) (*models.RefreshRun, error) {
+	run := &models.RefreshRun{
+		ID:        primitive.NewObjectID(),
+		Status:    models.RefreshRunRunning,
+		Trigger:   trigger,
+		Changes:   []models.CatalogChange{},
+		Errors:    []string{},
+		StartedAt: time.Now(),
+	}
+	previous, err := r.lock(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		r.abandon(ctx, previous.RunID)
+	}
+	if _, err := r.GetRefreshRunCollection().InsertOne(ctx, run); err != nil {
+		r.unlock(run.ID)
+		return nil, err
+	}
+	return run, nil
+}
+
+// refreshLockFilter encuentra el lock si ha caducado. Si sigue vigente no encuentra nada y
+// el upsert choca con su _id, así que solo una instancia lo toma aunque lo intenten a la vez.
+func refreshLockFilter(now time.Time) bson.M {
+	return bson.M{"_id": refreshLockID, "expires_at": bson.M{"$lt": now}}
+}
+
+// lock reserva el refresco para la pasada runID. Devuelve el lock caducado que sustituye,
+// si lo había, o ErrRefreshRunning si otra pasada lo tiene.
+func (r *RefreshService) lock(ctx context.Context, runID primitive.ObjectID) (*refreshLock, error) {
+	now := time.Now()
+	var previous refreshLock
+	err := r.GetLockCollection().FindOneAndUpdate(ctx,
+		refreshLockFilter(now),
+		bson.M{"$set": refreshLock{ID: refreshLockID, Owner: r.owner, RunID: runID, ExpiresAt: now.Add(refreshLease)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&previous)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrRefreshRunning
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
+// owned encuentra el lock mientras siga siendo de la pasada runID de esta instancia
+func (r *RefreshService) owned(runID primitive.ObjectID) bson.M {
+	return bson.M{"_id": refreshLockID, "owner": r.owner, "run_id": runID}
+}
+
+// abandon marca como fallida la pasada cuyo lock caducó sin que terminara
+func (r *RefreshService) abandon(ctx context.Context, runID primitive.ObjectID) {
+	_, err := r.GetRefreshRunCollection().UpdateOne(ctx,
+		bson.M{"_id": runID, "status": models.RefreshRunRunning},
+		bson.M{
+			"$set":  bson.M{"status": models.RefreshRunFailed, "finished_at": time.Now()},
+			"$push": bson.M{"errors": "interrumpida: la instancia que la ejecutaba dejó de renovar la reserva"},
+		})
+	if err != nil {
+		log.Printf("Error marcando como fallido el refresco %s: %v", runID.Hex(), err)
+	}
+}
+
+// heartbeat renueva el lock hasta que done se cierra; si deja de ser de la pasada (caducó y
+// lo tomó otra instancia) la cancela con errRefreshLockLost
+func (r *RefreshService) heartbeat(ctx context.Context, runID primitive.ObjectID, cancel context.CancelCauseFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(refreshLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		result, err := r.GetLockCollection().UpdateOne(ctx, r.owned(runID),
+			bson.M{"$set": bson.M{"expires_at": time.Now().Add(refreshLease)}})
+		if err != nil {
+			// Un fallo puntual no suelta el lock; si se repite, caduca
+			log.Printf("Error renovando la reserva del refresco %s: %v", runID.Hex(), err)
+			continue
+		}
+		if result.MatchedCount == 0 {
+			cancel(errRefreshLockLost)
+			return
+		}
+	}
+}
+
+// unlock libera el lock para que la siguiente pasada no espere a que caduque
+func (r *RefreshService) unlock(runID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.GetLockCollection().DeleteOne(ctx, r.owned(runID)); err != nil {
+		log.Printf("Error liberando la reserva del refresco %s: %v", runID.Hex(), err)
+	}
+}
+
+func (r *RefreshService) execute(ctx context.Context, run *models.RefreshRun) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer r.unlock(run.ID)
+	done := make(chan struct{})
+	defer close(done)
+	go r.heartbeat(ctx, run.ID, cancel, done)
+	log.Printf("Refrescando el catálogo desde Spotify (%s)", run.Trigger)
+
+	artists, err := findAll[models.Artist](ctx, r.music.GetArtistCollection(),
+		bson.M{"spotify_id": bson.M{"$nin": bson.A{"", nil}}},
+		options.Find().
+			SetSort(bson.D{{Key: "refreshed_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetLimit(int64(r.batchSize)))
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+		r.save(ctx, run, models.RefreshRunFailed)
+		return
+	}
+
+	pace := r.newPacer()
+	defer pace.stop()
+	for i := range artists {
+		if err := r.refreshArtist(ctx, pace, run, &artists[i]); err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", artists[i].Name, err))
+			// Se marca como revisado igualmente para que un artista con errores no ocupe
+			// siempre un hueco de la pasada
+			_, err := r.music.GetArtistCollection().UpdateOne(ctx, bson.M{"_id": artists[i].ID}, bson.M{"$set": bson.M{"refreshed_at": time.Now()}})
+			if err != nil {
+				log.Printf("Error marcando como revisado a %s: %v", artists[i].Name, err)
+			}
+		}
+		if ctx.Err() != nil {
+			run.Errors = append(run.Errors, context.Cause(ctx).Error())
+			r.save(context.Background(), run, models.RefreshRunFailed)
+			return
+		}
+		run.ArtistsChecked++
+		r.save(ctx, run, models.RefreshRunRunning)
+	}
+	r.save(ctx, run, models.RefreshRunCompleted)
+	log.Printf("Refresco del catálogo terminado: %d artistas, %d cambios, %d álbumes nuevos, %d errores",
+		run.ArtistsChecked, len(run.Changes), run.AlbumsImported, len(run.Errors))
+}
+
+// save guarda el progreso de la pasada con el estado indicado
+func (r *RefreshService) save(ctx context.Context, run *models.RefreshRun, status string) {
+	run.Status = status
+	if status != models.RefreshRunRunning {
+		now := time.Now()
+		run.FinishedAt = &now
+	}
+	if _, err := r.GetRefreshRunCollection().ReplaceOne(ctx, bson.M{"_id": run.ID}, run); err != nil {
+		log.Printf("Error guardando el refresco %s: %v", run.ID.Hex(), err)
+	}
+}
+
+// refreshArtist actualiza un artista y sus álbumes con los datos actuales de Spotify
+func (r *RefreshService) refreshArtist(ctx context.Context, pace *pacer, run *models.RefreshRun, artist *models.Artist) error {
+	spotifyService := r.music.spotifyService
+
+	var fresh *spotify.FullArtist
+	err := pace.call(ctx, func() (err error) {
+		fresh, err = spotifyService.GetArtist(ctx, artist.SpotifyID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	latest := spotifyService.ConvertSpotifyArtistToModel(fresh)
+
+	now := time.Now()
+	set := bson.M{"refreshed_at": now}
+	changed := func(field string, before, after interface{}) {
+		set[field] = after
+		run.Changes = append(run.Changes, models.CatalogChange{
+			Type: models.CatalogChangeArtist, ID: artist.ID, Name: artist.Name, Field: field, Old: before, New: after,
+		})
+	}
+	if latest.Name != artist.Name {
+		changed("name", artist.Name, latest.Name)
+	}
+	if latest.ImageURL != "" && latest.ImageURL != artist.ImageURL {
+		changed("image_url", artist.ImageURL, latest.ImageURL)
+	}
+	if latest.Popularity != artist.Popularity {
+		changed("popularity", artist.Popularity, latest.Popularity)
+	}
+	var addedGenres, removedGenres []string
+	if len(latest.Genres) > 0 && !genresEqual(artist.Genres, latest.Genres) {
+		changed("genres", artist.Genres, latest.Genres)
+		addedGenres, removedGenres = diffGenres(artist.Genres, latest.Genres)
+	}
+	if len(set) > 1 {
+		set["updated_at"] = now
+	}
+	if _, err := r.music.GetArtistCollection().UpdateOne(ctx, bson.M{"_id": artist.ID}, bson.M{"$set": set}); err != nil {
+		return err
+	}
+	// Los contadores se ajustan después de guardar el artista, y solo con los géneros que
+	// ha ganado o perdido
+	if err := r.music.adjustGenreCounts(ctx, addedGenres, removedGenres); err != nil {
+		log.Printf("Error actualizando los géneros de %s: %v", latest.Name, err)
+	}
+	if len(set) > 1 {
+		artist.Name, artist.Popularity = latest.Name, latest.Popularity
+		r.music.refreshArtistSuggestions(ctx, artist)
+	}
+
+	var spotifyAlbums []spotify.SimpleAlbum
+	err = pace.call(ctx, func() (err error) {
+		spotifyAlbums, err = spotifyService.GetArtistAlbums(ctx, artist.SpotifyID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	spotifyIDs := make([]string, len(spotifyAlbums))
+	for i, album := range spotifyAlbums {
+		spotifyIDs[i] = string(album.ID)
+	}
+	existing, err := findAll[models.Album](ctx, r.music.GetAlbumCollection(), bson.M{"spotify_id": bson.M{"$in": spotifyIDs}})
+	if err != nil {
+		return err
+	}
+	bySpotifyID := make(map[string]*models.Album, len(existing))
+	for i := range existing {
+		bySpotifyID[existing[i].SpotifyID] = &existing[i]
+	}
+	// Importar un álbum hace varias peticiones (el álbum y los artistas que falten): cada una
+	// pasa por el pacer
+	provider := pacedProvider{MetadataProvider: spotifyProvider{spotify: spotifyService}, pace: pace}
+
+	for _, spotifyAlbum := range spotifyAlbums {
+		album, ok := bySpotifyID[string(spotifyAlbum.ID)]
+		if ok {
+			run.AlbumsChecked++
+			if err := r.refreshAlbum(ctx, run, album, spotifyAlbum); err != nil {
+				return err
+			}
+			continue
+		}
+		if !artist.Followed {
+			continue
+		}
+
+		imported, err := r.music.importProviderAlbum(ctx, provider, string(spotifyAlbum.ID), artist.ID)
+		if err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s - %s: %v", artist.Name, spotifyAlbum.Name, err))
+			continue
+		}
+		run.AlbumsImported++
+		run.Changes = append(run.Changes, models.CatalogChange{Type: models.CatalogChangeNewAlbum, ID: imported.ID, Name: imported.Title})
+	}
+	return nil
+}
+
+// refreshAlbum actualiza el título, la portada y la fecha de un álbum si han cambiado
+func (r *RefreshService) refreshAlbum(ctx context.Context, run *models.RefreshRun, album *models.Album, spotifyAlbum spotify.SimpleAlbum) error {
+	latest := r.music.spotifyService.ConvertSpotifyAlbumToModel(&spotify.FullAlbum{SimpleAlbum: spotifyAlbum})
+
+	set := bson.M{}
+	changed := func(field string, before, after interface{}) {
+		set[field] = after
+		run.Changes = append(run.Changes, models.CatalogChange{
+			Type: models.CatalogChangeAlbum, ID: album.ID, Name: album.Title, Field: field, Old: before, New: after,
+		})
+	}
+	if latest.Title != album.Title {
+		changed("title", album.Title, latest.Title)
+	}
+	if latest.ImageURL != "" && latest.ImageURL != album.ImageURL {
+		changed("image_url", album.ImageURL, latest.ImageURL)
+	}
+	if latest.ReleaseDate != "" && latest.ReleaseDate != album.ReleaseDate {
+		changed("release_date", album.ReleaseDate, latest.ReleaseDate)
+		set["year"] = latest.Year
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	set["updated_at"] = time.Now()
+	if _, err := r.music.GetAlbumCollection().UpdateOne(ctx, bson.M{"_id": album.ID}, bson.M{"$set": set}); err != nil {
+		return err
+	}
+	if _, ok := set["title"]; ok {
+		r.music.RefreshAlbumSuggestions(ctx, album.ID)
+	}
+	return nil
+}
+
+// pacer espacia las peticiones a Spotify de una pasada para no acercarse a su límite; los
+// 429 que aun así lleguen los repite el transporte del cliente
+type pacer struct {
+	ticker *time.Ticker // nil si no hay que espaciar
+}
+
+func (r *RefreshService) newPacer() *pacer {
+	if r.requestInterval <= 0 {
+		return &pacer{}
+	}
+	return &pacer{ticker: time.NewTicker(r.requestInterval)}
+}
+
+func (p *pacer) stop() {
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+}
+
+func (p *pacer) call(ctx context.Context, request func() error) error {
+	if p.ticker != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.ticker.C:
+		}
+	}
+	return request()
+}
+
+// pacedProvider pasa por el pacer cada petición al proveedor
+type pacedProvider struct {
+	MetadataProvider
+	pace *pacer
+}
+
+func (p pacedProvider) SearchArtists(ctx context.Context, query string, limit int) (artists []metadata.Artist, err error) {
+	err = p.pace.call(ctx, func() error {
+		artists, err = p.MetadataProvider.SearchArtists(ctx, query, limit)
+		return err
+	})
+	return artists, err
+}
+
+func (p pacedProvider) SearchAlbums(ctx context.Context, query string, limit int) (albums []metadata.Album, err error) {
+	err = p.pace.call(ctx, func() error {
+		albums, err = p.MetadataProvider.SearchAlbums(ctx, query, limit)
+		return err
+	})
+	return albums, err
+}
+
+func (p pacedProvider) GetArtist(ctx context.Context, id string) (artist *metadata.Artist, err error) {
+	err = p.pace.call(ctx, func() error {
+		artist, err = p.MetadataProvider.GetArtist(ctx, id)
+		return err
+	})
+	return artist, err
+}
+
+func (p pacedProvider) GetAlbum(ctx context.Context, id string) (album *metadata.Album, err error) {
+	err = p.pace.call(ctx, func() error {
+		album, err = p.MetadataProvider.GetAlbum(ctx, id)
+		return err
+	})
+	return album, err
+}
+
+func (p pacedProvider) GetArtistAlbums(ctx context.Context, artistID string) (albums []metadata.Album, err error) {
+	err = p.pace.call(ctx, func() error {
+		albums, err = p.MetadataProvider.GetArtistAlbums(ctx, artistID)
+		return err
+	})
+	return albums, err
+}
+
+// FollowArtist marca si se siguen las novedades de un artista: el refresco programado
+// importa los álbumes nuevos de los artistas seguidos
+func (s *MusicService) FollowArtist(ctx context.Context, id string, followed bool) (*models.Artist, error) {
+	objectID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+	var artist models.Artist
+	err = s.GetArtistCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"followed": followed, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&artist)
+	if err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
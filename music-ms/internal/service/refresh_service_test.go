@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/angel/music-ms/internal/metadata"
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/search"
+)
+
+func TestDiffGenres(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      []string
+		after       []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{"sin cambios", []string{"pop", "rock"}, []string{"rock", "pop"}, nil, nil},
+		{"uno nuevo", []string{"pop"}, []string{"pop", "latin"}, []string{"latin"}, nil},
+		{"uno quitado", []string{"pop", "latin"}, []string{"pop"}, nil, []string{"latin"}},
+		{"sustituido", []string{"pop", "dance"}, []string{"pop", "latin"}, []string{"latin"}, []string{"dance"}},
+		{"sin géneros antes", nil, []string{"pop"}, []string{"pop"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := diffGenres(tt.before, tt.after)
+			if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("diffGenres = (%v, %v), se esperaba (%v, %v)", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+// begin toma el lock si está libre o ha caducado; en el segundo caso la pasada que lo
+// tenía se da por fallida. Si el lock sigue vigente el upsert choca con su _id.
+func TestRefreshBeginLock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	stale := refreshLock{ID: refreshLockID, Owner: "caido-1-abc", RunID: primitive.NewObjectID(), ExpiresAt: time.Now().Add(-time.Minute)}
+	tests := []struct {
+		name        string
+		lock        bson.D // Respuesta a findAndModify
+		wantErr     error
+		wantAbandon bool
+	}{
+		{"libre", mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}), nil, false},
+		{"caducado", mtest.CreateSuccessResponse(bson.E{Key: "value", Value: document(t, stale)}), nil, true},
+		{"en curso", mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error"}),
+			ErrRefreshRunning, false},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.lock)
+			if tt.wantAbandon {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+			}
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			refresher := &RefreshService{music: &MusicService{db: mt.DB}, owner: "host-1-abc"}
+			before := time.Now()
+			run, err := refresher.begin(context.Background(), RefreshTriggerManual)
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("begin error = %v, se esperaba %v", err, tt.wantErr)
+			}
+
+			// El lock solo se toma si ha caducado, y queda a nombre de esta instancia y pasada
+			command := startedCommand(mt, "findAndModify")
+			var sent struct {
+				Query struct {
+					ID        string `bson:"_id"`
+					ExpiresAt struct {
+						Lt time.Time `bson:"$lt"`
+					} `bson:"expires_at"`
+				} `bson:"query"`
+				Update struct {
+					Set refreshLock `bson:"$set"`
+				} `bson:"update"`
+				Upsert bool `bson:"upsert"`
+			}
+			if err := bson.Unmarshal(command, &sent); err != nil {
+				mt.Fatal(err)
+			}
+			if sent.Query.ID != refreshLockID || sent.Query.ExpiresAt.Lt.Before(before.Truncate(time.Millisecond)) || !sent.Upsert ||
+				sent.Update.Set.Owner != "host-1-abc" || sent.Update.Set.ExpiresAt.Before(before.Add(refreshLease).Truncate(time.Millisecond)) {
+				mt.Errorf("findAndModify = %v, se esperaba tomar el lock caducado para host-1-abc", command)
+			}
+
+			if tt.wantErr != nil {
+				if run != nil {
+					mt.Errorf("begin = %+v, se esperaba nil", run)
+				}
+				for _, started := range mt.GetAllStartedEvents() {
+					if started.CommandName != "findAndModify" {
+						mt.Errorf("con el lock ocupado se envió %s", started.CommandName)
+					}
+				}
+				return
+			}
+			if run == nil || run.Status != models.RefreshRunRunning || sent.Update.Set.RunID != run.ID {
+				mt.Fatalf("begin = %+v, se esperaba una pasada en curso con el lock %v", run, sent.Update.Set)
+			}
+			startedCommand(mt, "insert")
+
+			updates := sentUpdates(mt)
+			if !tt.wantAbandon {
+				if len(updates) != 0 {
+					mt.Errorf("sin lock caducado se actualizó %v", updates)
+				}
+				return
+			}
+			if len(updates) != 1 || updates[0].collection != "refresh_runs" {
+				mt.Fatalf("actualizaciones = %v, se esperaba marcar la pasada abandonada", updates)
+			}
+			var filter struct {
+				ID     primitive.ObjectID `bson:"_id"`
+				Status string             `bson:"status"`
+			}
+			var set struct {
+				Status string `bson:"status"`
+			}
+			if err := bson.Unmarshal(updates[0].filter, &filter); err != nil {
+				mt.Fatal(err)
+			}
+			if err := bson.Unmarshal(updates[0].set, &set); err != nil {
+				mt.Fatal(err)
+			}
+			if filter.ID != stale.RunID || filter.Status != models.RefreshRunRunning || set.Status != models.RefreshRunFailed {
+				mt.Errorf("abandono = %+v %+v, se esperaba dar por fallida la pasada %s si seguía en curso", filter, set, stale.RunID.Hex())
+			}
+		})
+	}
+}
+
+// refreshCatalog es un Spotify de pruebas que devuelve siempre el mismo artista y álbumes
+func refreshCatalog(t *testing.T, artist spotify.FullArtist, albums ...spotify.SimpleAlbum) *SpotifyService {
+	t.Helper()
+	respond := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/token", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/artists/"+string(artist.ID), func(w http.ResponseWriter, r *http.Request) {
+		respond(w, artist)
+	})
+	mux.HandleFunc("/v1/artists/"+string(artist.ID)+"/albums", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, map[string]interface{}{"items": albums, "total": len(albums)})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return NewSpotifyService(fixedCredentials("id", "secret"), SpotifyOptions{APIURL: server.URL + "/v1", TokenURL: server.URL + "/api/token"})
+}
+
+// refreshArtist solo escribe y registra los campos que han cambiado en Spotify, y ajusta
+// los contadores con los géneros ganados o perdidos
+func TestRefreshArtistDetectsChanges(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	stored := models.Artist{ID: primitive.NewObjectID(), Name: "Rosalia", SpotifyID: "a1", Genres: []string{"pop", "flamenco"}, Popularity: 80}
+	album := models.Album{ID: primitive.NewObjectID(), Title: "Motomami", SpotifyID: "b1", ReleaseDate: "2022-03-18", Year: 2022}
+	spotifyAlbum := spotify.SimpleAlbum{ID: "b1", Name: "Motomami", ReleaseDate: "2022-03-18", ReleaseDatePrecision: "day"}
+	success := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+	albums := mtest.CreateCursorResponse(0, "music.albums", mtest.FirstBatch, document(t, album))
+
+	type change struct{ kind, field string }
+	tests := []struct {
+		name        string
+		fresh       spotify.FullArtist
+		album       spotify.SimpleAlbum
+		responses   []bson.D
+		wantChanges []change
+		wantSet     []string // Campos del $set del artista
+		wantGenres  []string // Filtro por nombre de cada actualización de géneros
+	}{
+		{
+			name:      "sin cambios",
+			fresh:     spotify.FullArtist{SimpleArtist: spotify.SimpleArtist{ID: "a1", Name: "Rosalia"}, Genres: []string{"flamenco", "pop"}, Popularity: 80},
+			album:     spotifyAlbum,
+			responses: []bson.D{success, albums},
+			wantSet:   []string{"refreshed_at"},
+		},
+		{
+			name:  "nombre, géneros y fecha del álbum",
+			fresh: spotify.FullArtist{SimpleArtist: spotify.SimpleArtist{ID: "a1", Name: "Rosalía"}, Genres: []string{"pop", "latin"}, Popularity: 80},
+			album: spotify.SimpleAlbum{ID: "b1", Name: "Motomami", ReleaseDate: "2022-03-17", ReleaseDatePrecision: "day"},
+			responses: []bson.D{
+				success, success, success, // Artista y los dos géneros
+				mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{}}), // Álbumes para las sugerencias
+				albums, success,
+			},
+			wantChanges: []change{
+				{models.CatalogChangeArtist, "name"}, {models.CatalogChangeArtist, "genres"}, {models.CatalogChangeAlbum, "release_date"},
+			},
+			wantSet:    []string{"genres", "name", "refreshed_at", "updated_at"},
+			wantGenres: []string{"latin", "flamenco"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			music := &MusicService{db: mt.DB, spotifyService: refreshCatalog(mt.T, tt.fresh, tt.album), suggestions: search.NewSuggestionIndex()}
+			refresher := &RefreshService{music: music, owner: "host-1-abc"}
+			run := &models.RefreshRun{}
+			artist := stored
+			if err := refresher.refreshArtist(context.Background(), &pacer{}, run, &artist); err != nil {
+				mt.Fatal(err)
+			}
+
+			var changes []change
+			for _, c := range run.Changes {
+				changes = append(changes, change{c.Type, c.Field})
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				mt.Errorf("cambios = %v, se esperaba %v", changes, tt.wantChanges)
+			}
+
+			var artistSet []string
+			var genres []string
+			for _, update := range sentUpdates(mt) {
+				switch update.collection {
+				case "artists":
+					artistSet = update.setKeys()
+				case "genres":
+					genres = append(genres, update.filter.Lookup("name").StringValue())
+				}
+			}
+			if !reflect.DeepEqual(artistSet, tt.wantSet) || !reflect.DeepEqual(genres, tt.wantGenres) {
+				mt.Errorf("$set del artista = %v y géneros %v, se esperaba %v y %v", artistSet, genres, tt.wantSet, tt.wantGenres)
+			}
+		})
+	}
+}
+
+// countingProvider cuenta las peticiones que le llegan
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Name() string { return "prueba" }
+
+func (p *countingProvider) SearchArtists(ctx context.Context, query string, limit int) ([]metadata.Artist, error) {
+	p.calls++
+	return nil, nil
+}
+
+func (p *countingProvider) SearchAlbums(ctx context.Context, query string, limit int) ([]metadata.Album, error) {
+	p.calls++
+	return nil, nil
+}
+
+func (p *countingProvider) GetArtist(ctx context.Context, id string) (*metadata.Artist, error) {
+	p.calls++
+	return &metadata.Artist{ID: id}, nil
+}
+
+func (p *countingProvider) GetAlbum(ctx context.Context, id string) (*metadata.Album, error) {
+	p.calls++
+	return &metadata.Album{ID: id}, nil
+}
+
+func (p *countingProvider) GetArtistAlbums(ctx context.Context, artistID string) ([]metadata.Album, error) {
+	p.calls++
+	return nil, nil
+}
+
+// Cada petición al proveedor debe esperar su turno en el pacer, no solo la primera de cada
+// álbum importado
+func TestPacedProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(ctx context.Context, provider MetadataProvider) error
+	}{
+		{"SearchArtists", func(ctx context.Context, provider MetadataProvider) error {
+			_, err := provider.SearchArtists(ctx, "rosalía", 1)
+			return err
+		}},
+		{"SearchAlbums", func(ctx context.Context, provider MetadataProvider) error {
+			_, err := provider.SearchAlbums(ctx, "motomami", 1)
+			return err
+		}},
+		{"GetArtist", func(ctx context.Context, provider MetadataProvider) error {
+			_, err := provider.GetArtist(ctx, "a1")
+			return err
+		}},
+		{"GetAlbum", func(ctx context.Context, provider MetadataProvider) error {
+			_, err := provider.GetAlbum(ctx, "b1")
+			return err
+		}},
+		{"GetArtistAlbums", func(ctx context.Context, provider MetadataProvider) error {
+			_, err := provider.GetArtistAlbums(ctx, "a1")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sin turno (el primer tic llega dentro de una hora) y con ctx cancelado, la
+			// petición no debe llegar al proveedor
+			inner := &countingProvider{}
+			pace := &pacer{ticker: time.NewTicker(time.Hour)}
+			defer pace.stop()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := tt.request(ctx, pacedProvider{MetadataProvider: inner, pace: pace})
+			if !errors.Is(err, context.Canceled) || inner.calls != 0 {
+				t.Errorf("sin turno: error = %v con %d peticiones, se esperaba context.Canceled sin peticiones", err, inner.calls)
+			}
+
+			// Con turno la petición pasa
+			err = tt.request(context.Background(), pacedProvider{MetadataProvider: inner, pace: &pacer{}})
+			if err != nil || inner.calls != 1 {
+				t.Errorf("con turno: error = %v con %d peticiones, se esperaba 1 petición", err, inner.calls)
+			}
+		})
+	}
+}
+
+func TestPacerSpacesRequests(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	pace := &pacer{ticker: time.NewTicker(interval)}
+	defer pace.stop()
+	provider := pacedProvider{MetadataProvider: &countingProvider{}, pace: pace}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := provider.GetArtist(context.Background(), "a1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 3*interval {
+		t.Errorf("3 peticiones en %v, se esperaban al menos %v", elapsed, 3*interval)
+	}
+}
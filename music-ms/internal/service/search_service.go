@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/search"
+)
+
+// Tipos de resultado de búsqueda
+const (
+	SearchTypeSong   = "song"
+	SearchTypeAlbum  = "album"
+	SearchTypeArtist = "artist"
+)
+
+const (
+	// DefaultSearchLimit es el número de resultados si no se indica limit
+	DefaultSearchLimit = 20
+	// MaxSearchLimit es el máximo de resultados por búsqueda
+	MaxSearchLimit = 50
+	// searchIndexName es el nombre del índice de texto en songs, albums y artists
+	searchIndexName = "search_text"
+)
+
+// SearchResult es un resultado de la búsqueda unificada; solo uno de Song, Album o Artist
+// está definido según Type
+type SearchResult struct {
+	Type      string         `json:"type"`
+	Score     float64        `json:"score"`
+	Highlight string         `json:"highlight"` // Título o nombre con las coincidencias entre <em>
+	Song      *models.Song   `json:"song,omitempty"`
+	Album     *models.Album  `json:"album,omitempty"`
+	Artist    *models.Artist `json:"artist,omitempty"`
+}
+
+// EnsureSearchIndexes crea los índices de texto de la búsqueda si no existen. Se usa
+// default_language "none" para no aplicar las reglas de un idioma a títulos en varios;
+// los índices de texto ya ignoran mayúsculas y acentos.
+func (s *MusicService) EnsureSearchIndexes(ctx context.Context) error {
+	indexes := map[*mongo.Collection]string{
+		s.GetSongCollection():   "title",
+		s.GetAlbumCollection():  "title",
+		s.GetArtistCollection(): "name",
+	}
+	for collection, field := range indexes {
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: "text"}},
+			Options: options.Index().SetName(searchIndexName).SetDefaultLanguage("none"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchResponse es el resultado de una búsqueda. Si nada coincide con lo escrito se buscan
+// las palabras parecidas del catálogo y DidYouMean propone la consulta corregida.
+type SearchResponse struct {
+	Query      string         `json:"query"`
+	Results    []SearchResult `json:"results"`
+	DidYouMean string         `json:"did_you_mean,omitempty"`
+}
+
+// Search busca en canciones, álbumes y artistas (o solo en types) y ordena los resultados
+// por relevancia del texto ponderada por la popularidad de los artistas
+func (s *MusicService) Search(ctx context.Context, query string, types []string, limit int) (*SearchResponse, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, invalid("query", "la búsqueda está vacía")
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		return nil, invalid("limit", "el máximo es %d", MaxSearchLimit)
+	}
+	wanted := map[string]bool{}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t != SearchTypeSong && t != SearchTypeAlbum && t != SearchTypeArtist {
+			return nil, invalid("types", "tipo desconocido: %q", t)
+		}
+		wanted[t] = true
+	}
+
+	response := &SearchResponse{Query: query}
+	results, err := s.searchText(ctx, terms, terms, wanted, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		if expanded, corrected := s.correctTerms(terms); corrected != "" {
+			if results, err = s.searchText(ctx, expanded, search.Terms(corrected), wanted, limit); err != nil {
+				return nil, err
+			}
+			response.DidYouMean = corrected
+		}
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+	response.Results = results
+	return response, nil
+}
+
+// searchText busca terms con los índices de texto; phrase es la consulta con la que se
+// compara el título para premiar las coincidencias completas
+func (s *MusicService) searchText(ctx context.Context, terms, phrase []string, wanted map[string]bool, limit int) ([]SearchResult, error) {
+	all := len(wanted) == 0
+
+	// Se buscan los términos ya normalizados para que la sintaxis de $text (frases entre
+	// comillas, negaciones con "-") no se aplique a lo que escribe el usuario
+	textFilter := bson.M{"$text": bson.M{"$search": strings.Join(terms, " ")}}
+	findOptions := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(int64(limit))
+
+	var results []SearchResult
+	if all || wanted[SearchTypeArtist] {
+		artists, err := findAll[scored[models.Artist]](ctx, s.GetArtistCollection(), textFilter, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		for i := range artists {
+			artist := &artists[i].Doc
+			results = append(results, newSearchResult(SearchTypeArtist, artist.Name, terms, phrase, artists[i].Score, artist.Popularity))
+			results[len(results)-1].Artist = artist
+		}
+	}
+
+	if all || wanted[SearchTypeAlbum] {
+		albums, err := findAll[scored[models.Album]](ctx, s.GetAlbumCollection(), textFilter, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		var artistIDs []primitive.ObjectID
+		for _, album := range albums {
+			artistIDs = append(artistIDs, album.Doc.ArtistIDs...)
+		}
+		popularity, err := s.artistPopularity(ctx, artistIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range albums {
+			album := &albums[i].Doc
+			results = append(results, newSearchResult(SearchTypeAlbum, album.Title, terms, phrase, albums[i].Score, maxPopularity(popularity, album.ArtistIDs)))
+			results[len(results)-1].Album = album
+		}
+	}
+
+	if all || wanted[SearchTypeSong] {
+		songs, err := findAll[scored[models.Song]](ctx, s.GetSongCollection(), textFilter, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		// La popularidad de una canción es la de su artista más popular, propio o del álbum
+		var albumIDs []primitive.ObjectID
+		for _, song := range songs {
+			albumIDs = append(albumIDs, song.Doc.AlbumID)
+		}
+		albums, err := s.GetAlbumsByIDs(ctx, albumIDs)
+		if err != nil {
+			return nil, err
+		}
+		songArtists := make([][]primitive.ObjectID, len(songs))
+		var artistIDs []primitive.ObjectID
+		for i, song := range songs {
+			songArtists[i] = append(songArtists[i], song.Doc.ArtistIDs...)
+			if album, ok := albums[song.Doc.AlbumID]; ok {
+				songArtists[i] = append(songArtists[i], album.ArtistIDs...)
+			}
+			artistIDs = append(artistIDs, songArtists[i]...)
+		}
+		popularity, err := s.artistPopularity(ctx, artistIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range songs {
+			song := &songs[i].Doc
+			results = append(results, newSearchResult(SearchTypeSong, song.Title, terms, phrase, songs[i].Score, maxPopularity(popularity, songArtists[i])))
+			results[len(results)-1].Song = song
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool { return results[a].Score > results[b].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// maxCorrections es cuántas palabras parecidas se prueban por cada palabra desconocida
+const maxCorrections = 3
+
+// correctTerms cambia las palabras que no aparecen en el catálogo por las más parecidas que
+// sí, con la tolerancia configurada. Devuelve los términos a buscar (las palabras conocidas
+// y las alternativas de las demás) y la consulta corregida, vacía si no hay nada que corregir.
+func (s *MusicService) correctTerms(terms []string) ([]string, string) {
+	if s.fuzziness <= 0 {
+		return nil, ""
+	}
+	var expanded []string
+	corrected := make([]string, len(terms))
+	changed := false
+	for i, term := range terms {
+		corrected[i] = term
+		alternatives := s.suggestions.Corrections(term, search.AllowedEdits(term, s.fuzziness), maxCorrections)
+		if len(alternatives) == 0 {
+			expanded = append(expanded, term)
+			continue
+		}
+		expanded = append(expanded, alternatives...)
+		if alternatives[0] != term {
+			corrected[i] = alternatives[0]
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, ""
+	}
+	return expanded, strings.Join(corrected, " ")
+}
+
+// DidYouMean propone la consulta corregida con palabras del catálogo, o "" si todas existen
+// o no se parecen a ninguna
+func (s *MusicService) DidYouMean(query string) string {
+	_, corrected := s.correctTerms(search.Terms(query))
+	return corrected
+}
+
+// scored es un documento con la puntuación de $text
+type scored[T any] struct {
+	Doc   T       `bson:",inline"`
+	Score float64 `bson:"score"`
+}
+
+// newSearchResult calcula la puntuación final: la de $text, duplicada si el texto coincide
+// entero con la búsqueda, y aumentada hasta el doble según la popularidad (0-100)
+func newSearchResult(resultType, text string, terms, phrase []string, textScore float64, popularity int) SearchResult {
+	score := textScore
+	if strings.Join(search.Terms(text), " ") == strings.Join(phrase, " ") {
+		score *= 2
+	}
+	score *= 1 + float64(popularity)/100
+	highlight, _ := search.Highlight(text, terms)
+	return SearchResult{Type: resultType, Score: score, Highlight: highlight}
+}
+
+// artistPopularity devuelve la popularidad de cada artista indicado
+func (s *MusicService) artistPopularity(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	popularity := make(map[primitive.ObjectID]int)
+	if len(ids) == 0 {
+		return popularity, nil
+	}
+	artists, err := s.GetArtistsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, artist := range artists {
+		popularity[id] = artist.Popularity
+	}
+	return popularity, nil
+}
+
+func maxPopularity(popularity map[primitive.ObjectID]int, ids []primitive.ObjectID) int {
+	best := 0
+	for _, id := range ids {
+		if p := popularity[id]; p > best {
+			best = p
+		}
+	}
+	return best
+}
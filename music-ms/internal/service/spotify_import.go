@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zmb3/spotify/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/angel/music-ms/internal/metadata"
+	"github.com/angel/music-ms/internal/models"
+)
+
+// ErrArtistNotFound indica que la búsqueda en Spotify no devolvió ningún artista
+var ErrArtistNotFound = errors.New("artist not found in Spotify")
+
+// saveSpotifyArtist guarda el artista si no existía y registra sus géneros; devuelve su ID
+func (s *MusicService) saveSpotifyArtist(ctx context.Context, artist *spotify.FullArtist) (primitive.ObjectID, error) {
+	details := spotifyArtist(artist)
+	saved, err := s.saveProviderArtist(ctx, metadata.ProviderSpotify, &details)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return saved.ID, nil
+}
+
+// importArtistAlbum importa un álbum de Spotify y sus pistas para el artista indicado. Los
+// álbumes y canciones que ya existen no se duplican: se les añade el artista.
+func (s *MusicService) importArtistAlbum(ctx context.Context, artistID primitive.ObjectID, spotifyAlbumID string) (*models.Album, error) {
+	return s.importProviderAlbum(ctx, spotifyProvider{spotify: s.spotifyService}, spotifyAlbumID, artistID)
+}
+
+// genresEqual compara dos listas de géneros sin tener en cuenta el orden
+func genresEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, genre := range a {
+		counts[genre]++
+	}
+	for _, genre := range b {
+		if counts[genre] <= 0 {
+			return false
+		}
+		counts[genre]--
+	}
+	return true
+}
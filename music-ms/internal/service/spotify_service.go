@@ -4,47 +4,97 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 
+	"github.com/angel/music-ms/internal/metadata"
 	"github.com/angel/music-ms/internal/models"
 )
 
+// ErrSpotifyUnavailable indica que no hay credenciales de Spotify configuradas
+var ErrSpotifyUnavailable = errors.New("Spotify service not available")
+
+// SpotifyCredentials devuelve las credenciales de la aplicación de Spotify, vacías si aún
+// no están configuradas. Se consulta en cada petición para detectar cambios.
+type SpotifyCredentials func() (clientID, clientSecret string)
+
+// SpotifyOptions cambia las URLs de Spotify, p. ej. para usar un servidor de pruebas
+type SpotifyOptions struct {
+	APIURL   string // Vacío usa https://api.spotify.com/v1/
+	TokenURL string // Vacío usa el endpoint de tokens de Spotify
+}
+
 // SpotifyService maneja la interacción con la API de Spotify
 type SpotifyService struct {
-	client *spotify.Client
+	credentials SpotifyCredentials
+	options     SpotifyOptions
+
+	mu       sync.Mutex
+	client   *spotify.Client
+	clientID string // Credenciales con las que se creó client
+	secret   string
+}
+
+// NewSpotifyService crea un nuevo servicio de Spotify. No pide ningún token al crearse: el
+// cliente se crea en la primera petición, o en la primera tras configurar o cambiar las
+// credenciales, y renueva el token él solo antes de que caduque.
+func NewSpotifyService(credentials SpotifyCredentials, options SpotifyOptions) *SpotifyService {
+	return &SpotifyService{credentials: credentials, options: options}
+}
+
+// Available indica si hay credenciales configuradas
+func (s *SpotifyService) Available() bool {
+	clientID, clientSecret := s.credentials()
+	return clientID != "" && clientSecret != ""
 }
 
-// NewSpotifyService crea un nuevo servicio de Spotify
-func NewSpotifyService(clientID, clientSecret string) (*SpotifyService, error) {
+// Client retorna el cliente de Spotify, creándolo si hace falta
+func (s *SpotifyService) Client() (*spotify.Client, error) {
+	clientID, clientSecret := s.credentials()
 	if clientID == "" || clientSecret == "" {
-		return nil, errors.New("spotify client ID and secret are required")
+		return nil, ErrSpotifyUnavailable
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil && clientID == s.clientID && clientSecret == s.secret {
+		return s.client, nil
+	}
+
+	tokenURL := s.options.TokenURL
+	if tokenURL == "" {
+		tokenURL = spotifyauth.TokenURL
+	}
 	config := &clientcredentials.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		TokenURL:     spotifyauth.TokenURL,
+		TokenURL:     tokenURL,
 	}
 
-	token, err := config.Token(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	httpClient := spotifyauth.New().Client(context.Background(), token)
-	client := spotify.New(httpClient)
-
-	return &SpotifyService{client: client}, nil
-}
+	// Tanto las peticiones de token como las de la API se repiten ante 429 y 5xx. El
+	// TokenSource guarda el token y pide otro cuando está a punto de caducar.
+	tokenCtx := context.WithValue(context.Background(), oauth2.HTTPClient,
+		&http.Client{Transport: newRetryTransport(http.DefaultTransport)})
+	httpClient := &http.Client{Transport: newRetryTransport(&oauth2.Transport{
+		Source: config.TokenSource(tokenCtx),
+		Base:   http.DefaultTransport,
+	})}
 
-// Client retorna el cliente de Spotify
-func (s *SpotifyService) Client() *spotify.Client {
-	return s.client
+	var clientOptions []spotify.ClientOption
+	if s.options.APIURL != "" {
+		clientOptions = append(clientOptions, spotify.WithBaseURL(strings.TrimSuffix(s.options.APIURL, "/")+"/"))
+	}
+	s.client = spotify.New(httpClient, clientOptions...)
+	s.clientID, s.secret = clientID, clientSecret
+	return s.client, nil
 }
 
 // SearchAlbums busca álbumes en Spotify
@@ -53,7 +103,11 @@ func (s *SpotifyService) SearchAlbums(ctx context.Context, query string, limit i
 		limit = 10 // valor por defecto
 	}
 
-	results, err := s.client.Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
+	client, err := s.Client()
+	if err != nil {
+		return nil, err
+	}
+	results, err := client.Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +121,11 @@ func (s *SpotifyService) SearchAlbums(ctx context.Context, query string, limit i
 
 // GetAlbum obtiene un álbum específico de Spotify
 func (s *SpotifyService) GetAlbum(ctx context.Context, id string) (*spotify.FullAlbum, error) {
-	album, err := s.client.GetAlbum(ctx, spotify.ID(id))
+	client, err := s.Client()
+	if err != nil {
+		return nil, err
+	}
+	album, err := client.GetAlbum(ctx, spotify.ID(id))
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +134,11 @@ func (s *SpotifyService) GetAlbum(ctx context.Context, id string) (*spotify.Full
 
 // GetArtist obtiene un artista específico de Spotify
 func (s *SpotifyService) GetArtist(ctx context.Context, id string) (*spotify.FullArtist, error) {
-	artist, err := s.client.GetArtist(ctx, spotify.ID(id))
+	client, err := s.Client()
+	if err != nil {
+		return nil, err
+	}
+	artist, err := client.GetArtist(ctx, spotify.ID(id))
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +151,11 @@ func (s *SpotifyService) SearchArtists(ctx context.Context, query string, limit
 		limit = 10 // valor por defecto
 	}
 
-	results, err := s.client.Search(ctx, query, spotify.SearchTypeArtist, spotify.Limit(limit))
+	client, err := s.Client()
+	if err != nil {
+		return nil, err
+	}
+	results, err := client.Search(ctx, query, spotify.SearchTypeArtist, spotify.Limit(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +169,11 @@ func (s *SpotifyService) SearchArtists(ctx context.Context, query string, limit
 
 // GetArtistAlbums obtiene todos los álbumes de un artista en Spotify
 func (s *SpotifyService) GetArtistAlbums(ctx context.Context, artistID string) ([]spotify.SimpleAlbum, error) {
-	albums, err := s.client.GetArtistAlbums(ctx, spotify.ID(artistID), []spotify.AlbumType{spotify.AlbumTypeAlbum}, spotify.Limit(50))
+	client, err := s.Client()
+	if err != nil {
+		return nil, err
+	}
+	albums, err := client.GetArtistAlbums(ctx, spotify.ID(artistID), []spotify.AlbumType{spotify.AlbumTypeAlbum}, spotify.Limit(50))
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +201,8 @@ func (s *SpotifyService) ConvertSpotifyAlbumToModel(album *spotify.FullAlbum) mo
 		Title:       album.Name,
 		ReleaseDate: album.ReleaseDate,
 		SpotifyID:   string(album.ID),
+		Provider:    metadata.ProviderSpotify,
+		ExternalID:  string(album.ID),
 		ImageURL:    imageURL,
 		Year:        year,
 		CreatedAt:   time.Now(),
@@ -148,6 +220,8 @@ func (s *SpotifyService) ConvertSpotifyArtistToModel(artist *spotify.FullArtist)
 	return models.Artist{
 		Name:       artist.Name,
 		SpotifyID:  string(artist.ID),
+		Provider:   metadata.ProviderSpotify,
+		ExternalID: string(artist.ID),
 		ImageURL:   imageURL,
 		Genres:     artist.Genres,
 		Popularity: artist.Popularity,
@@ -162,11 +236,15 @@ func (s *SpotifyService) ConvertSpotifyTrackToModel(track spotify.SimpleTrack, a
 		Title:       track.Name,
 		Duration:    track.Duration / 1000, // Convertir de ms a segundos
 		SpotifyID:   string(track.ID),
+		Provider:    metadata.ProviderSpotify,
+		ExternalID:  string(track.ID),
 		AlbumID:     albumID,
 		ArtistIDs:   artistIDs, // Añadir los IDs de los artistas
 		TrackNumber: track.TrackNumber,
 		AudioURL:    "", // Spotify no proporciona URL de audio directamente
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		// Los mercados de Spotify sirven como lista inicial de países con licencia
+		AvailableMarkets: track.AvailableMarkets,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
 	}
 }
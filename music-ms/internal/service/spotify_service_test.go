@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// fakeSpotify es un servidor falso con el endpoint de tokens y GET /v1/artists/:id. Las
+// peticiones a la API reciben primero las respuestas de failures, en orden, y luego el
+// artista.
+type fakeSpotify struct {
+	*httptest.Server
+	expiresIn int // Duración de los tokens, en segundos
+
+	mu        sync.Mutex
+	clientIDs []string    // client_id de cada petición de token
+	auths     []string    // Authorization de cada petición a la API
+	attempts  []time.Time // Cuándo llegó cada petición a la API
+	failures  []func(w http.ResponseWriter)
+}
+
+func newFakeSpotify(t *testing.T, expiresIn int, failures ...func(w http.ResponseWriter)) *fakeSpotify {
+	t.Helper()
+	fake := &fakeSpotify{expiresIn: expiresIn, failures: failures}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/token", fake.token)
+	mux.HandleFunc("/v1/artists/", fake.artist)
+	fake.Server = httptest.NewServer(mux)
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (f *fakeSpotify) token(w http.ResponseWriter, r *http.Request) {
+	clientID, _, _ := r.BasicAuth()
+	f.mu.Lock()
+	f.clientIDs = append(f.clientIDs, clientID)
+	token := fmt.Sprintf("token-%d", len(f.clientIDs))
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   f.expiresIn,
+	})
+}
+
+func (f *fakeSpotify) artist(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.auths = append(f.auths, r.Header.Get("Authorization"))
+	f.attempts = append(f.attempts, time.Now())
+	var failure func(w http.ResponseWriter)
+	if len(f.failures) > 0 {
+		failure, f.failures = f.failures[0], f.failures[1:]
+	}
+	f.mu.Unlock()
+	if failure != nil {
+		failure(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": strings.TrimPrefix(r.URL.Path, "/v1/artists/"), "name": "Rosalía"})
+}
+
+func (f *fakeSpotify) service(credentials SpotifyCredentials) *SpotifyService {
+	return NewSpotifyService(credentials, SpotifyOptions{APIURL: f.URL + "/v1", TokenURL: f.URL + "/api/token"})
+}
+
+func (f *fakeSpotify) counts() (tokens int, clientIDs, auths []string, attempts []time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.clientIDs), append([]string(nil), f.clientIDs...), append([]string(nil), f.auths...), append([]time.Time(nil), f.attempts...)
+}
+
+func fixedCredentials(clientID, secret string) SpotifyCredentials {
+	return func() (string, string) { return clientID, secret }
+}
+
+// spotifyFailure responde con el estado y las cabeceras indicadas y un error de Spotify
+func spotifyFailure(status int, headers func(h http.Header)) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if headers != nil {
+			headers(w.Header())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":{"status":%d,"message":"%s"}}`, status, http.StatusText(status))
+	}
+}
+
+func TestSpotifyTokenRenewal(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  int
+		wantTokens int
+		want       []string // Authorization de las dos peticiones
+	}{
+		{"token vigente se reutiliza", 3600, 1, []string{"Bearer token-1", "Bearer token-1"}},
+		// oauth2 da por caducado un token al que le quedan menos de 10 s
+		{"token caducado se renueva", 1, 2, []string{"Bearer token-1", "Bearer token-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSpotify(t, tt.expiresIn)
+			spotifyService := fake.service(fixedCredentials("id", "secret"))
+			for i := 0; i < 2; i++ {
+				if _, err := spotifyService.GetArtist(context.Background(), "a1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tokens, _, auths, _ := fake.counts()
+			if tokens != tt.wantTokens || fmt.Sprint(auths) != fmt.Sprint(tt.want) {
+				t.Errorf("%d tokens pedidos, Authorization %v, se esperaba %v", tokens, auths, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpotifyRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     []func(w http.ResponseWriter)
+		wantStatus   int             // Estado del error devuelto; 0 si la petición acaba bien
+		wantAttempts int             // Peticiones que llegan al servidor
+		wantGaps     []time.Duration // Espera mínima antes de cada reintento
+	}{
+		{
+			name: "429 con Retry-After en segundos",
+			failures: []func(w http.ResponseWriter){
+				spotifyFailure(http.StatusTooManyRequests, func(h http.Header) { h.Set("Retry-After", "1") }),
+			},
+			wantAttempts: 2,
+			wantGaps:     []time.Duration{time.Second},
+		},
+		{
+			// La fecha tiene resolución de segundos: dentro de 2 s son al menos 1 s de espera
+			name: "429 con Retry-After como fecha",
+			failures: []func(w http.ResponseWriter){
+				spotifyFailure(http.StatusTooManyRequests, func(h http.Header) {
+					h.Set("Retry-After", time.Now().Add(2*time.Second).UTC().Format(http.TimeFormat))
+				}),
+			},
+			wantAttempts: 2,
+			wantGaps:     []time.Duration{time.Second},
+		},
+		{
+			name: "5xx con espera exponencial",
+			failures: []func(w http.ResponseWriter){
+				spotifyFailure(http.StatusServiceUnavailable, nil),
+				spotifyFailure(http.StatusBadGateway, nil),
+			},
+			wantAttempts: 3,
+			wantGaps:     []time.Duration{spotifyRetryBackoff, 2 * spotifyRetryBackoff},
+		},
+		{
+			name: "Retry-After mayor que la espera máxima",
+			failures: []func(w http.ResponseWriter){
+				spotifyFailure(http.StatusTooManyRequests, func(h http.Header) { h.Set("Retry-After", "3600") }),
+			},
+			wantStatus:   http.StatusTooManyRequests,
+			wantAttempts: 1,
+		},
+		{
+			name:         "4xx no se repite",
+			failures:     []func(w http.ResponseWriter){spotifyFailure(http.StatusNotFound, nil)},
+			wantStatus:   http.StatusNotFound,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fake := newFakeSpotify(t, 3600, tt.failures...)
+			_, err := fake.service(fixedCredentials("id", "secret")).GetArtist(context.Background(), "a1")
+
+			var spotifyErr spotify.Error
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Fatalf("GetArtist error = %v", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &spotifyErr) || spotifyErr.Status != tt.wantStatus):
+				t.Fatalf("GetArtist error = %v, se esperaba un error %d de Spotify", err, tt.wantStatus)
+			}
+			_, _, _, attempts := fake.counts()
+			if len(attempts) != tt.wantAttempts {
+				t.Fatalf("%d peticiones, se esperaban %d", len(attempts), tt.wantAttempts)
+			}
+			for i, gap := range tt.wantGaps {
+				if waited := attempts[i+1].Sub(attempts[i]); waited < gap {
+					t.Errorf("reintento %d tras %v, se esperaba al menos %v", i+1, waited, gap)
+				}
+			}
+		})
+	}
+}
+
+// El cliente no se crea hasta que hay credenciales, y se vuelve a crear si cambian
+func TestSpotifyLazyClient(t *testing.T) {
+	fake := newFakeSpotify(t, 3600)
+	var mu sync.Mutex
+	var clientID, secret string
+	spotifyService := fake.service(func() (string, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return clientID, secret
+	})
+	setCredentials := func(id, key string) {
+		mu.Lock()
+		defer mu.Unlock()
+		clientID, secret = id, key
+	}
+
+	steps := []struct {
+		name          string
+		clientID      string
+		secret        string
+		wantErr       error
+		wantClientIDs []string // client_id de los tokens pedidos hasta ahora
+	}{
+		{"sin credenciales", "", "", ErrSpotifyUnavailable, nil},
+		{"al aparecer las credenciales", "id-1", "secret", nil, []string{"id-1"}},
+		{"con las mismas credenciales", "id-1", "secret", nil, []string{"id-1"}},
+		{"al cambiar las credenciales", "id-2", "secret", nil, []string{"id-1", "id-2"}},
+	}
+	for _, step := range steps {
+		setCredentials(step.clientID, step.secret)
+		if available := spotifyService.Available(); available != (step.clientID != "") {
+			t.Errorf("%s: Available = %v", step.name, available)
+		}
+		if _, err := spotifyService.GetArtist(context.Background(), "a1"); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: GetArtist error = %v, se esperaba %v", step.name, err, step.wantErr)
+		}
+		if _, clientIDs, _, _ := fake.counts(); fmt.Sprint(clientIDs) != fmt.Sprint(step.wantClientIDs) {
+			t.Errorf("%s: tokens pedidos para %v, se esperaba %v", step.name, clientIDs, step.wantClientIDs)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// spotifyMaxRetries es cuántas veces se repite una petición rechazada por Spotify
+	spotifyMaxRetries = 4
+	// spotifyRetryBackoff es la primera espera ante un 5xx; se duplica en cada reintento
+	spotifyRetryBackoff = 500 * time.Millisecond
+	// spotifyMaxRetryWait es la espera máxima; si Retry-After pide más se devuelve el 429
+	spotifyMaxRetryWait = 2 * time.Minute
+)
+
+// retryTransport repite las peticiones que Spotify rechaza por superar su límite (429),
+// esperando lo que indique Retry-After, y las que fallan con 5xx, con espera exponencial.
+// Las peticiones con cuerpo solo se repiten si este se puede volver a leer (GetBody).
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+	maxWait time.Duration
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		base:    base,
+		retries: spotifyMaxRetries,
+		backoff: spotifyRetryBackoff,
+		maxWait: spotifyMaxRetryWait,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || !replayable || attempt == t.retries {
+			return resp, err
+		}
+		wait, retry := t.retryWait(resp, attempt)
+		if !retry || wait > t.maxWait {
+			return resp, nil
+		}
+
+		// Se descarta la respuesta para poder reutilizar la conexión
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryWait decide si repetir la petición y cuánto esperar antes
+func (t *retryTransport) retryWait(resp *http.Response, attempt int) (time.Duration, bool) {
+	retryable := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+	if !retryable {
+		return 0, false
+	}
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return wait, true
+	}
+	return t.backoff << attempt, true
+}
+
+// parseRetryAfter interpreta Retry-After, en segundos o como fecha HTTP
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		min    time.Duration
+		max    time.Duration
+		wantOK bool
+	}{
+		{"vacío", "", 0, 0, false},
+		{"segundos", "3", 3 * time.Second, 3 * time.Second, true},
+		{"cero", "0", 0, 0, true},
+		{"segundos negativos", "-1", 0, 0, false},
+		// La fecha tiene resolución de segundos
+		{"fecha futura", time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat), 4 * time.Second, 5 * time.Second, true},
+		{"fecha pasada", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0, true},
+		{"inválido", "pronto", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := parseRetryAfter(tt.value)
+			if ok != tt.wantOK || wait < tt.min || wait > tt.max {
+				t.Errorf("parseRetryAfter(%q) = (%v, %v), se esperaba (%v-%v, %v)", tt.value, wait, ok, tt.min, tt.max, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/angel/music-ms/internal/models"
+	"github.com/angel/music-ms/internal/search"
+)
+
+const (
+	// DefaultSuggestLimit es el número de sugerencias si no se indica limit
+	DefaultSuggestLimit = 8
+	// MaxSuggestLimit es el máximo de sugerencias por consulta
+	MaxSuggestLimit = 25
+)
+
+// suggestionSource calcula las sugerencias de álbumes y canciones a partir de sus artistas:
+// el subtítulo es el primer artista y la popularidad la del más popular
+type suggestionSource struct {
+	artists map[primitive.ObjectID]*models.Artist
+	albums  map[primitive.ObjectID]*models.Album
+}
+
+func (src suggestionSource) artistSuggestion(artist *models.Artist) search.Suggestion {
+	return search.Suggestion{Type: SearchTypeArtist, ID: artist.ID.Hex(), Text: artist.Name, Popularity: artist.Popularity}
+}
+
+func (src suggestionSource) withArtists(suggestion search.Suggestion, artistIDs []primitive.ObjectID) search.Suggestion {
+	for _, id := range artistIDs {
+		artist, ok := src.artists[id]
+		if !ok {
+			continue
+		}
+		if suggestion.Subtitle == "" {
+			suggestion.Subtitle = artist.Name
+		}
+		if artist.Popularity > suggestion.Popularity {
+			suggestion.Popularity = artist.Popularity
+		}
+	}
+	return suggestion
+}
+
+func (src suggestionSource) albumSuggestion(album *models.Album) search.Suggestion {
+	return src.withArtists(search.Suggestion{Type: SearchTypeAlbum, ID: album.ID.Hex(), Text: album.Title}, album.ArtistIDs)
+}
+
+func (src suggestionSource) songSuggestion(song *models.Song) search.Suggestion {
+	artistIDs := song.ArtistIDs
+	if album, ok := src.albums[song.AlbumID]; ok {
+		artistIDs = append(append([]primitive.ObjectID{}, artistIDs...), album.ArtistIDs...)
+	}
+	return src.withArtists(search.Suggestion{Type: SearchTypeSong, ID: song.ID.Hex(), Text: song.Title}, artistIDs)
+}
+
+// BuildSuggestionIndex carga en el índice de sugerencias todo el catálogo, sustituyendo lo
+// que hubiera. Solo lee los campos necesarios; las altas posteriores se añaden de forma
+// incremental.
+func (s *MusicService) BuildSuggestionIndex(ctx context.Context) error {
+	start := time.Now()
+	err := s.suggestions.Rebuild(func() ([]search.Suggestion, error) {
+		artists, err := findAll[models.Artist](ctx, s.GetArtistCollection(), bson.M{},
+			options.Find().SetProjection(bson.M{"name": 1, "popularity": 1}))
+		if err != nil {
+			return nil, err
+		}
+		albums, err := findAll[models.Album](ctx, s.GetAlbumCollection(), bson.M{},
+			options.Find().SetProjection(bson.M{"title": 1, "artist_ids": 1}))
+		if err != nil {
+			return nil, err
+		}
+		songs, err := findAll[models.Song](ctx, s.GetSongCollection(), bson.M{},
+			options.Find().SetProjection(bson.M{"title": 1, "album_id": 1, "artist_ids": 1}))
+		if err != nil {
+			return nil, err
+		}
+
+		src := suggestionSource{
+			artists: make(map[primitive.ObjectID]*models.Artist, len(artists)),
+			albums:  make(map[primitive.ObjectID]*models.Album, len(albums)),
+		}
+		suggestions := make([]search.Suggestion, 0, len(artists)+len(albums)+len(songs))
+		for i := range artists {
+			src.artists[artists[i].ID] = &artists[i]
+			suggestions = append(suggestions, src.artistSuggestion(&artists[i]))
+		}
+		for i := range albums {
+			src.albums[albums[i].ID] = &albums[i]
+			suggestions = append(suggestions, src.albumSuggestion(&albums[i]))
+		}
+		for i := range songs {
+			suggestions = append(suggestions, src.songSuggestion(&songs[i]))
+		}
+		return suggestions, nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Índice de sugerencias construido: %d elementos en %v", s.suggestions.Len(), time.Since(start))
+	return nil
+}
+
+// StartSuggestionIndex construye el índice de sugerencias en segundo plano y, con
+// interval > 0, lo reconstruye periódicamente. Cada réplica solo actualiza su índice con
+// sus propias escrituras; la reconstrucción recoge las de las demás réplicas y las del
+// importador por línea de comandos.
+func (s *MusicService) StartSuggestionIndex(ctx context.Context, interval time.Duration) {
+	go func() {
+		if err := s.BuildSuggestionIndex(ctx); err != nil {
+			log.Printf("Error construyendo el índice de sugerencias: %v", err)
+		}
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.BuildSuggestionIndex(ctx); err != nil {
+					log.Printf("Error reconstruyendo el índice de sugerencias: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// RefreshAlbumSuggestions vuelve a indexar un álbum, sus canciones y sus artistas. Se llama
+// tras importar o modificar un álbum.
+func (s *MusicService) RefreshAlbumSuggestions(ctx context.Context, albumID primitive.ObjectID) {
+	album, err := s.GetAlbumByID(ctx, albumID)
+	if err != nil {
+		log.Printf("Error indexando sugerencias del álbum %s: %v", albumID.Hex(), err)
+		return
+	}
+	songs, err := s.GetSongsByAlbumID(ctx, albumID)
+	if err != nil {
+		log.Printf("Error indexando sugerencias del álbum %s: %v", albumID.Hex(), err)
+		return
+	}
+	artistIDs := append([]primitive.ObjectID{}, album.ArtistIDs...)
+	for _, song := range songs {
+		artistIDs = append(artistIDs, song.ArtistIDs...)
+	}
+	artists, err := s.GetArtistsByIDs(ctx, artistIDs)
+	if err != nil {
+		log.Printf("Error indexando sugerencias del álbum %s: %v", albumID.Hex(), err)
+		return
+	}
+
+	src := suggestionSource{artists: artists, albums: map[primitive.ObjectID]*models.Album{album.ID: album}}
+	for _, artist := range artists {
+		s.suggestions.Upsert(src.artistSuggestion(artist))
+	}
+	s.suggestions.Upsert(src.albumSuggestion(album))
+	for i := range songs {
+		s.suggestions.Upsert(src.songSuggestion(&songs[i]))
+	}
+}
+
+// refreshSongSuggestion vuelve a indexar una canción suelta (creada o modificada)
+func (s *MusicService) refreshSongSuggestion(ctx context.Context, song *models.Song) {
+	src := suggestionSource{albums: map[primitive.ObjectID]*models.Album{}}
+	artistIDs := song.ArtistIDs
+	if song.AlbumID != primitive.NilObjectID {
+		if album, err := s.GetAlbumByID(ctx, song.AlbumID); err == nil {
+			src.albums[album.ID] = album
+			artistIDs = append(append([]primitive.ObjectID{}, artistIDs...), album.ArtistIDs...)
+		}
+	}
+	artists, err := s.GetArtistsByIDs(ctx, artistIDs)
+	if err != nil {
+		log.Printf("Error indexando sugerencias de la canción %s: %v", song.ID.Hex(), err)
+		return
+	}
+	src.artists = artists
+	s.suggestions.Upsert(src.songSuggestion(song))
+}
+
+// refreshArtistSuggestions vuelve a indexar un artista y, como su nombre y popularidad
+// aparecen en ellos, sus álbumes y las canciones de estos
+func (s *MusicService) refreshArtistSuggestions(ctx context.Context, artist *models.Artist) {
+	s.suggestions.Upsert(suggestionSource{}.artistSuggestion(artist))
+	albumIDs, err := s.GetAlbumCollection().Distinct(ctx, "_id", bson.M{"artist_ids": artist.ID})
+	if err != nil {
+		log.Printf("Error indexando sugerencias del artista %s: %v", artist.ID.Hex(), err)
+		return
+	}
+	for _, id := range albumIDs {
+		if albumID, ok := id.(primitive.ObjectID); ok {
+			s.RefreshAlbumSuggestions(ctx, albumID)
+		}
+	}
+}
+
+// Suggest devuelve sugerencias para lo que el usuario lleva escrito, desde el índice en memoria
+func (s *MusicService) Suggest(query string, types []string, limit int) ([]search.SuggestResult, error) {
+	if limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+	if limit > MaxSuggestLimit {
+		return nil, invalid("limit", "el máximo es %d", MaxSuggestLimit)
+	}
+	normalized := make([]string, len(types))
+	for i, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != SearchTypeSong && t != SearchTypeAlbum && t != SearchTypeArtist {
+			return nil, invalid("types", "tipo desconocido: %q", t)
+		}
+		normalized[i] = t
+	}
+	return s.suggestions.Suggest(query, normalized, limit), nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AdminSessionView es la vista de una sesión de reproducción para soporte
+type AdminSessionView struct {
+	UserID          string    `json:"user_id"`
+	DeviceID        string    `json:"device_id"`
+	SongID          string    `json:"song_id"`
+	SongTitle       string    `json:"song_title,omitempty"`
+	State           string    `json:"state"`            // "playing", "paused"
+	AccumulatedTime int       `json:"accumulated_time"` // Segundos escuchados, incluida la reproducción en curso
+	Position        int       `json:"position"`
+	SongDuration    int       `json:"song_duration,omitempty"`
+	Context         string    `json:"context,omitempty"`
+	Private         bool      `json:"private"`
+	StartTime       time.Time `json:"start_time"`
+	LastPlayTime    time.Time `json:"last_play_time"`
+	Connections     int       `json:"connections"` // Conexiones abiertas del dispositivo, en todas las instancias
+}
+
+func newAdminSessionView(session *PlaybackSession, connections int, now time.Time) *AdminSessionView {
+	view := &AdminSessionView{
+		UserID:          session.UserID,
+		DeviceID:        session.DeviceID,
+		SongID:          session.SongID,
+		SongTitle:       session.SongTitle,
+		State:           "paused",
+		AccumulatedTime: session.AccumulatedTime,
+		Position:        session.currentPosition(now),
+		SongDuration:    session.SongDuration,
+		Context:         session.Context,
+		Private:         session.Private,
+		StartTime:       session.StartTime,
+		LastPlayTime:    session.LastPlayTime,
+		Connections:     connections,
+	}
+	if session.IsPlaying {
+		view.State = "playing"
+		view.AccumulatedTime += int(now.Sub(session.LastPlayTime).Seconds())
+	}
+	return view
+}
+
+// adminSessionViews ordena las sesiones por usuario y dispositivo para una salida estable.
+// connections son las conexiones abiertas por sessionKey (ver adminSessions).
+func adminSessionViews(sessions []*PlaybackSession, connections map[string]int) []*AdminSessionView {
+	now := time.Now()
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].UserID != sessions[j].UserID {
+			return sessions[i].UserID < sessions[j].UserID
+		}
+		return sessions[i].DeviceID < sessions[j].DeviceID
+	})
+	views := make([]*AdminSessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, newAdminSessionView(session, connections[sessionKey(session.UserID, session.DeviceID)], now))
+	}
+	return views
+}
+
+// requireAdmin valida el token de ADMIN_API_TOKEN. Sin token configurado, los endpoints quedan deshabilitados.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	expected := os.Getenv("ADMIN_API_TOKEN")
+	if expected == "" {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "endpoints de administración deshabilitados"})
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "token de administración inválido"})
+		return false
+	}
+	return true
+}
+
+// adminSessionsHandler atiende las rutas /admin/sessions...
+//
+//	GET  /admin/sessions
+//	GET  /admin/sessions/{userId}
+//	POST /admin/sessions/{userId}/stop?device_id=...
+//	POST /admin/sessions/{userId}/pause?device_id=...
+//
+// Sin device_id, stop y pause afectan a todos los dispositivos del usuario.
+func adminSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/sessions"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		views := adminSessionViews(adminSessions(""))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"count":    len(views),
+			"sessions": views,
+		})
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		var view *AdminUserView
+		if !queryOwner(ownerQuery{Kind: queryAdminUser, UserID: parts[0]}, &view) {
+			view = localAdminUser(parts[0])
+		}
+		if view == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "el usuario no tiene sesiones activas"})
+			return
+		}
+		// El propietario solo conoce sus conexiones: los dispositivos pueden estar en otras
+		_, connections := adminSessions(parts[0])
+		for _, session := range view.Sessions {
+			session.Connections = connections[sessionKey(session.UserID, session.DeviceID)]
+		}
+		writeJSON(w, http.StatusOK, view)
+
+	case len(parts) == 2 && (parts[1] == "stop" || parts[1] == "pause"):
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "método no permitido"})
+			return
+		}
+		adminControlSession(w, parts[0], r.URL.Query().Get("device_id"), parts[1])
+
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "ruta no encontrada"})
+	}
+}
+
+// AdminUserView es el estado de un usuario para soporte
+type AdminUserView struct {
+	UserID         string              `json:"user_id"`
+	Sessions       []*AdminSessionView `json:"sessions"`
+	Timer          *PlaybackTimer      `json:"timer"`
+	PrivateSession *PrivateSession     `json:"private_session,omitempty"`
+}
+
+// adminSessionsPart es la respuesta de cada instancia a queryAdminSessions: las sesiones que
+// guarda y las conexiones abiertas en ella por sessionKey. Un dispositivo puede estar
+// conectado a una instancia distinta de la propietaria de su sesión, así que las
+// conexiones de todas las instancias se suman.
+type adminSessionsPart struct {
+	Sessions    []*PlaybackSession `json:"sessions"`
+	Connections map[string]int     `json:"connections"`
+}
+
+// localAdminSessions es la parte de esta instancia, de userID o de todos si es ""
+func localAdminSessions(userID string) adminSessionsPart {
+	sessionsMu.Lock()
+	var sessions []*PlaybackSession
+	if userID == "" {
+		sessions = sessionStore.ListSessions()
+	} else {
+		sessions = sessionStore.ListUserSessions(userID)
+	}
+	sessionsMu.Unlock()
+	return adminSessionsPart{Sessions: sessions, Connections: clients.countDevices(userID)}
+}
+
+// adminSessions reúne las sesiones y las conexiones de todas las instancias; sin
+// coordinación, las locales
+func adminSessions(userID string) ([]*PlaybackSession, map[string]int) {
+	var sessions []*PlaybackSession
+	connections := make(map[string]int)
+	gathered := gatherAll(ownerQuery{Kind: queryAdminSessions, UserID: userID}, func(result json.RawMessage) error {
+		var part adminSessionsPart
+		if err := json.Unmarshal(result, &part); err != nil {
+			return err
+		}
+		sessions = append(sessions, part.Sessions...)
+		for key, count := range part.Connections {
+			connections[key] += count
+		}
+		return nil
+	})
+	if !gathered {
+		part := localAdminSessions(userID)
+		return part.Sessions, part.Connections
+	}
+	return sessions, connections
+}
+
+// localAdminUser construye la vista del usuario con el estado de esta instancia; nil si no tiene sesiones
+func localAdminUser(userID string) *AdminUserView {
+	sessionsMu.Lock()
+	sessions := sessionStore.ListUserSessions(userID)
+	sessionsMu.Unlock()
+	if len(sessions) == 0 {
+		return nil
+	}
+	view := &AdminUserView{
+		UserID:   userID,
+		Sessions: adminSessionViews(sessions, clients.countDevices(userID)),
+		Timer:    getTimer(userID),
+	}
+	if private, active := getPrivateSession(userID); active {
+		view.PrivateSession = private
+	}
+	return view
+}
+
+// adminControlSession fuerza la detención o pausa en la instancia propietaria del usuario
+func adminControlSession(w http.ResponseWriter, userID, deviceID, action string) {
+	var affected []string
+	if !queryOwner(ownerQuery{Kind: action, UserID: userID, DeviceID: deviceID}, &affected) {
+		affected = localAdminControl(userID, deviceID, action)
+	}
+	if len(affected) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no hay sesión para el usuario o dispositivo"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"action":  action,
+		"devices": affected,
+	})
+}
+
+// localAdminControl fuerza la detención o pausa por los caminos normales (evento
+// song_played, presencia) y avisa a los dispositivos afectados, que devuelve
+func localAdminControl(userID, deviceID, action string) []string {
+	sessionsMu.Lock()
+	var targets []*PlaybackSession
+	for _, session := range sessionStore.ListUserSessions(userID) {
+		if deviceID == "" || session.DeviceID == deviceID {
+			targets = append(targets, session)
+		}
+	}
+	sessionsMu.Unlock()
+
+	affected := make([]string, 0, len(targets))
+	for _, session := range targets {
+		log.Printf("ADMIN - %s forzado para user_id=%s, device_id=%s, song_id=%s",
+			action, userID, session.DeviceID, session.SongID)
+
+		var err error
+		message := StreamResponse{DeviceID: session.DeviceID}
+		if action == "stop" {
+			err = endPlaybackSession(userID, session.DeviceID)
+			songStopped(userID, session.DeviceID)
+			message.Type = "session_stopped"
+			message.Message = "Reproducción detenida por soporte"
+		} else {
+			err = pausePlaybackSession(userID, session.DeviceID)
+			message.Type = "session_paused"
+			message.Message = "Reproducción pausada por soporte"
+		}
+		// Un fallo al publicar el evento no deja la sesión abierta: se registra y se sigue
+		if err != nil {
+			log.Printf("Error en acción de administración para user_id=%s: %v", userID, err)
+		}
+		clients.sendToDevice(userID, session.DeviceID, message)
+		affected = append(affected, session.DeviceID)
+	}
+	return affected
+}
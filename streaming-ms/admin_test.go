@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "admin-de-pruebas"
+
+// recordingWriter guarda los mensajes enviados a una conexión de prueba
+type recordingWriter struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *recordingWriter) WriteMessage(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, v.(StreamResponse).Type)
+	return nil
+}
+
+func (w *recordingWriter) types() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.messages...)
+}
+
+// adminFixture deja en esta instancia las sesiones de ana (web sonando con dos conexiones,
+// movil pausada) y de bruno (tv sonando), y cuenta los eventos song_played publicados
+type adminFixture struct {
+	connections map[string]*recordingWriter // Primera conexión de cada dispositivo, por sessionKey
+	mu          sync.Mutex
+	published   []SongPlayedEvent
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	fixture := &adminFixture{connections: make(map[string]*recordingWriter)}
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event SongPlayedEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		fixture.mu.Lock()
+		fixture.published = append(fixture.published, event)
+		fixture.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(gateway.Close)
+	t.Setenv("API_GATEWAY_URL", gateway.URL)
+	t.Setenv("ADMIN_API_TOKEN", testAdminToken)
+
+	previous := sessionStore
+	sessionStore = NewMemorySessionStore()
+	t.Cleanup(func() { sessionStore = previous })
+
+	now := time.Now()
+	for _, session := range []*PlaybackSession{
+		{UserID: "ana", DeviceID: "web", SongID: "s1", StartTime: now.Add(-time.Minute), AccumulatedTime: 10, IsPlaying: true, LastPlayTime: now.Add(-30 * time.Second)},
+		{UserID: "ana", DeviceID: "movil", SongID: "s2", StartTime: now.Add(-time.Hour), AccumulatedTime: 5},
+		{UserID: "bruno", DeviceID: "tv", SongID: "s3", StartTime: now, IsPlaying: true, LastPlayTime: now},
+	} {
+		sessionStore.SaveSession(session)
+	}
+	for _, key := range []string{"ana/web", "ana/web", "bruno/tv"} {
+		userID, deviceID, _ := strings.Cut(key, "/")
+		writer := &recordingWriter{}
+		client := &streamClient{userID: userID, deviceID: deviceID, conn: writer}
+		clients.add(client)
+		t.Cleanup(func() { clients.remove(client) })
+		if fixture.connections[key] == nil {
+			fixture.connections[key] = writer
+		}
+	}
+	return fixture
+}
+
+func (f *adminFixture) publishedSongs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var songs []string
+	for _, event := range f.published {
+		songs = append(songs, event.SongID)
+	}
+	sort.Strings(songs)
+	return songs
+}
+
+// adminRequest llama a adminSessionsHandler con el token de administración
+func adminRequest(method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	adminSessionsHandler(rec, req)
+	return rec
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	newAdminFixture(t)
+	tests := []struct {
+		name   string
+		token  string // ADMIN_API_TOKEN
+		header string
+		want   int
+	}{
+		{"sin ADMIN_API_TOKEN", "", "Bearer " + testAdminToken, http.StatusForbidden},
+		{"sin token", testAdminToken, "", http.StatusUnauthorized},
+		{"token incorrecto", testAdminToken, "Bearer otro", http.StatusUnauthorized},
+		{"sin Bearer", testAdminToken, testAdminToken, http.StatusUnauthorized},
+		{"token correcto", testAdminToken, "Bearer " + testAdminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADMIN_API_TOKEN", tt.token)
+			req := httptest.NewRequest(http.MethodGet, "/admin/sessions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			adminSessionsHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, se esperaba %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// sessionSummary resume una vista como "user/device:estado:conexiones"
+func sessionSummary(views []*AdminSessionView) []string {
+	var summary []string
+	for _, view := range views {
+		summary = append(summary, fmt.Sprintf("%s/%s:%s:%d", view.UserID, view.DeviceID, view.State, view.Connections))
+	}
+	return summary
+}
+
+func TestAdminSessionViews(t *testing.T) {
+	newAdminFixture(t)
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       []string
+	}{
+		{"todas las sesiones", "/admin/sessions", http.StatusOK, []string{"ana/movil:paused:0", "ana/web:playing:2", "bruno/tv:playing:1"}},
+		{"sesiones de un usuario", "/admin/sessions/ana", http.StatusOK, []string{"ana/movil:paused:0", "ana/web:playing:2"}},
+		{"usuario sin sesiones", "/admin/sessions/carla", http.StatusNotFound, nil},
+		{"ruta desconocida", "/admin/sessions/ana/seek", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(http.MethodGet, tt.path)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, se esperaba %d (%s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body struct {
+				Sessions []*AdminSessionView `json:"sessions"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := sessionSummary(body.Sessions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sesiones = %v, se esperaba %v", got, tt.want)
+			}
+			// El tiempo escuchado incluye la reproducción en curso
+			for _, view := range body.Sessions {
+				if view.DeviceID == "web" && view.AccumulatedTime < 40 {
+					t.Errorf("ana/web lleva %d s escuchados, se esperaban al menos 40", view.AccumulatedTime)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminControl(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		wantStatus    int
+		wantRemaining []string // Sesiones que quedan, como en sessionSummary
+		wantMessages  []string // Mensajes recibidos por la primera conexión de ana/web
+		wantPublished []string // Canciones con evento song_played
+	}{
+		{
+			name:          "pausa de un dispositivo",
+			method:        http.MethodPost,
+			path:          "/admin/sessions/ana/pause?device_id=web",
+			wantStatus:    http.StatusOK,
+			wantRemaining: []string{"ana/movil:paused:0", "ana/web:paused:2", "bruno/tv:playing:1"},
+			wantMessages:  []string{"session_paused"},
+		},
+		{
+			name:          "detención de todos los dispositivos del usuario",
+			method:        http.MethodPost,
+			path:          "/admin/sessions/ana/stop",
+			wantStatus:    http.StatusOK,
+			wantRemaining: []string{"bruno/tv:playing:1"},
+			wantMessages:  []string{"session_stopped"},
+			wantPublished: []string{"s1", "s2"},
+		},
+		{
+			name:          "dispositivo sin sesión",
+			method:        http.MethodPost,
+			path:          "/admin/sessions/ana/stop?device_id=tv",
+			wantStatus:    http.StatusNotFound,
+			wantRemaining: []string{"ana/movil:paused:0", "ana/web:playing:2", "bruno/tv:playing:1"},
+		},
+		{
+			name:          "solo con POST",
+			method:        http.MethodGet,
+			path:          "/admin/sessions/ana/stop",
+			wantStatus:    http.StatusMethodNotAllowed,
+			wantRemaining: []string{"ana/movil:paused:0", "ana/web:playing:2", "bruno/tv:playing:1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newAdminFixture(t)
+			rec := adminRequest(tt.method, tt.path)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, se esperaba %d (%s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := sessionSummary(adminSessionViews(adminSessions(""))); !reflect.DeepEqual(got, tt.wantRemaining) {
+				t.Errorf("sesiones = %v, se esperaba %v", got, tt.wantRemaining)
+			}
+			if got := fixture.connections["ana/web"].types(); !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("mensajes a ana/web = %v, se esperaba %v", got, tt.wantMessages)
+			}
+			if published := fixture.publishedSongs(); !reflect.DeepEqual(published, tt.wantPublished) {
+				t.Errorf("song_played de %v, se esperaba %v", published, tt.wantPublished)
+			}
+		})
+	}
+}
+
+// Con varias instancias, cada una responde sus sesiones y sus conexiones: un dispositivo
+// puede estar conectado a una instancia que no guarda su sesión
+func TestAdminSessionsAcrossInstances(t *testing.T) {
+	newAdminFixture(t)
+	// Esta instancia guarda solo las sesiones de ana; bruno vive en la otra
+	sessionStore.DeleteSession("bruno", "tv")
+
+	transport := NewMemoryTransport()
+	local, err := newCoordinator("a", transport, time.Minute, defaultCoordinatorLocal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	remoteSession := &PlaybackSession{UserID: "bruno", DeviceID: "tv", SongID: "s3", StartTime: time.Now()}
+	remote, err := newCoordinator("b", transport, time.Minute, coordinatorLocal{
+		handle:   func(cmd Command) StreamResponse { return StreamResponse{} },
+		deliver:  func(userID, deviceID string, msg StreamResponse) {},
+		presence: func(p *Presence, event string) {},
+		answer: func(q ownerQuery) (interface{}, error) {
+			part := adminSessionsPart{Connections: map[string]int{"ana/web": 1}}
+			if q.UserID == "" || q.UserID == "bruno" {
+				part.Sessions = []*PlaybackSession{remoteSession}
+			}
+			return part, nil
+		},
+		hasState:   func(userID string) bool { return false },
+		sseCommand: func(connectionID string, request StreamRequest) bool { return false },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	previous := coordinator
+	coordinator = local
+	defer func() { coordinator = previous }()
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		// bruno/tv tiene una conexión en esta instancia y su sesión en la otra
+		{"todas las sesiones", "/admin/sessions", []string{"ana/movil:paused:0", "ana/web:playing:3", "bruno/tv:paused:1"}},
+		{"sesiones de un usuario", "/admin/sessions/ana", []string{"ana/movil:paused:0", "ana/web:playing:3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(http.MethodGet, tt.path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+			}
+			var body struct {
+				Sessions []*AdminSessionView `json:"sessions"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := sessionSummary(body.Sessions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sesiones = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenClaims son los claims del JWT que envía el cliente al conectarse
+type TokenClaims map[string]interface{}
+
+// String devuelve un claim de texto o "" si no existe
+func (c TokenClaims) String(name string) string {
+	if value, ok := c[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// tokenFromRequest obtiene el token del header Authorization o, para WebSocket
+// desde navegador (que no permite headers), del query parameter "token"
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// errNoJWTSecret indica que no se puede verificar ningún token porque falta JWT_SECRET
+var errNoJWTSecret = errors.New("JWT_SECRET no configurado")
+
+// authError traduce un error de autenticación a la respuesta: 503 si el servicio no puede
+// verificar tokens, 401 si el token no es válido
+func authError(err error) (int, string) {
+	if errors.Is(err, errNoJWTSecret) {
+		return http.StatusServiceUnavailable, "autenticación no disponible: " + err.Error()
+	}
+	return http.StatusUnauthorized, "token inválido: " + err.Error()
+}
+
+// parseToken decodifica un JWT y verifica su firma HS256 con JWT_SECRET. Sin JWT_SECRET no
+// se acepta ningún token: el servicio está expuesto directamente y no puede fiarse de que
+// otro lo haya validado.
+func parseToken(token string) (TokenClaims, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errNoJWTSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token con formato inválido")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header del token inválido: %v", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("algoritmo de firma no soportado: %s", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("firma del token inválida")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("firma del token inválida")
+	}
+
+	var claims TokenClaims
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims del token inválidos: %v", err)
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() > int64(exp) {
+		return nil, fmt.Errorf("token expirado")
+	}
+	return claims, nil
+}
+
+func decodeTokenSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// planFromClaims obtiene el plan del usuario del claim configurado en PLAN_CLAIM (por defecto "plan")
+func planFromClaims(claims TokenClaims) string {
+	name := os.Getenv("PLAN_CLAIM")
+	if name == "" {
+		name = "plan"
+	}
+	return strings.ToLower(claims.String(name))
+}
+
+// userClaims son los claims que identifican al usuario, por orden: "id" es el que pone auth-ms
+var userClaims = []string{"user_id", "sub", "id"}
+
+// identityFromRequest verifica el token obligatorio de la petición y devuelve el usuario
+// que identifica (userClaims) junto con los claims, de los que salen el plan y el país. Si
+// viene user_id en la query debe coincidir: nunca se toma la identidad de ahí.
+func identityFromRequest(r *http.Request) (string, TokenClaims, error) {
+	token := tokenFromRequest(r)
+	if token == "" {
+		return "", nil, fmt.Errorf("token requerido")
+	}
+	claims, err := parseToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+	var userID string
+	for _, name := range userClaims {
+		if userID = claims.String(name); userID != "" {
+			break
+		}
+	}
+	if userID == "" {
+		return "", nil, fmt.Errorf("el token no identifica al usuario")
+	}
+	if queryUserID := r.URL.Query().Get("user_id"); queryUserID != "" && queryUserID != userID {
+		return "", nil, fmt.Errorf("el token no corresponde a user_id=%s", queryUserID)
+	}
+	return userID, claims, nil
+}
+
+// viewerFromRequest identifica a quien consulta la actividad de otros usuarios
+func viewerFromRequest(r *http.Request) (string, error) {
+	viewer, _, err := identityFromRequest(r)
+	return viewer, err
+}
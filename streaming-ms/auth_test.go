@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testJWTSecret es el JWT_SECRET con el que se firman los tokens de las pruebas
+const testJWTSecret = "secreto-de-pruebas"
+
+// signedToken arma un JWT con el algoritmo indicado y lo firma con secret
+func signedToken(t *testing.T, alg, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `","typ":"JWT"}`))
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// testToken firma un JWT con testJWTSecret
+func testToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	return signedToken(t, "HS256", testJWTSecret, claims)
+}
+
+// unsignedToken arma un JWT "alg: none" como los que cualquiera puede fabricar
+func unsignedToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestParseToken(t *testing.T) {
+	claims := map[string]interface{}{"user_id": "ana"}
+	tests := []struct {
+		name    string
+		secret  string
+		token   string
+		wantErr bool
+	}{
+		{"firmado con el secreto", testJWTSecret, testToken(t, claims), false},
+		{"sin firmar", testJWTSecret, unsignedToken(t, claims), true},
+		{"firmado con otro secreto", testJWTSecret, signedToken(t, "HS256", "otro", claims), true},
+		{"otro algoritmo", testJWTSecret, signedToken(t, "HS512", testJWTSecret, claims), true},
+		{"expirado", testJWTSecret, testToken(t, map[string]interface{}{"user_id": "ana", "exp": 1}), true},
+		{"formato inválido", testJWTSecret, "no-es-un-jwt", true},
+		// Sin secreto no se puede verificar nada: ni siquiera un token bien firmado se acepta
+		{"sin JWT_SECRET", "", testToken(t, claims), true},
+		{"sin JWT_SECRET ni firma", "", unsignedToken(t, claims), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", tt.secret)
+			got, err := parseToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseToken error = %v, se esperaba error: %v", err, tt.wantErr)
+			}
+			if err == nil && got.String("user_id") != "ana" {
+				t.Errorf("claims = %v", got)
+			}
+			if tt.secret == "" && !errors.Is(err, errNoJWTSecret) {
+				t.Errorf("parseToken error = %v, se esperaba %v", err, errNoJWTSecret)
+			}
+		})
+	}
+}
+
+// Sin JWT_SECRET las rutas con token no están disponibles, en vez de aceptar cualquier token
+// fabricado a mano
+func TestViewerEndpointsFailClosed(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	token := unsignedToken(t, map[string]interface{}{"user_id": "ana"})
+	tests := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"actividad", "/users/ana/now-playing", usersHandler},
+		{"historial", "/users/ana/recent", usersHandler},
+		{"presencia", "/presence", presenceWsHandler},
+		{"reproducción por WebSocket", "/ws?user_id=ana", wsHandler},
+		{"reproducción por SSE", "/sse?user_id=ana", sseHandler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, se esperaba %d (%s)", rec.Code, http.StatusServiceUnavailable, rec.Body.String())
+			}
+		})
+	}
+}
+
+// El usuario y el plan de /ws y /sse salen del token verificado, no de la query
+func TestStreamIdentity(t *testing.T) {
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	ana := testToken(t, map[string]interface{}{"user_id": "ana", "plan": "Premium", "country": "ar"})
+	tests := []struct {
+		name       string
+		query      string
+		token      string
+		wantStatus int // 0 si la conexión se acepta
+		wantUser   string
+		wantDevice string
+		wantPlan   string
+	}{
+		{"usuario y plan del token", "device_id=movil", ana, 0, "ana", "movil", "premium"},
+		{"user_id de la query coincide", "user_id=ana", ana, 0, "ana", defaultDeviceID, "premium"},
+		{"usuario del claim sub", "", testToken(t, map[string]interface{}{"sub": "bruno"}), 0, "bruno", defaultDeviceID, ""},
+		{"usuario del claim id de auth-ms", "user_id=carla", testToken(t, map[string]interface{}{"id": "carla"}), 0, "carla", defaultDeviceID, ""},
+		{"sin token", "user_id=ana", "", http.StatusUnauthorized, "", "", ""},
+		{"user_id de otro usuario", "user_id=bruno", ana, http.StatusUnauthorized, "", "", ""},
+		{"token sin usuario", "user_id=ana", testToken(t, map[string]interface{}{"plan": "premium"}), http.StatusUnauthorized, "", "", ""},
+		{"token sin firmar", "user_id=ana", unsignedToken(t, map[string]interface{}{"user_id": "ana", "plan": "premium"}), http.StatusUnauthorized, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws?"+tt.query, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			userID, deviceID, plan, country, ok := streamIdentity(rec, req)
+			if tt.wantStatus != 0 {
+				if ok || rec.Code != tt.wantStatus {
+					t.Errorf("ok = %v, status = %d, se esperaba %d", ok, rec.Code, tt.wantStatus)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("conexión rechazada: %d %s", rec.Code, rec.Body.String())
+			}
+			if userID != tt.wantUser || deviceID != tt.wantDevice || plan != tt.wantPlan {
+				t.Errorf("identidad = (%q, %q, %q), se esperaba (%q, %q, %q)", userID, deviceID, plan, tt.wantUser, tt.wantDevice, tt.wantPlan)
+			}
+			if userID == "ana" && country != "AR" {
+				t.Errorf("país = %q, se esperaba AR", country)
+			}
+		})
+	}
+}
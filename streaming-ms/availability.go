@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Códigos de error de disponibilidad que recibe el cliente en StreamResponse.Code
+const (
+	codeNotAvailableInRegion = "not_available_in_region"
+	codeNotYetReleased       = "not_yet_released"
+	codeNoLongerAvailable    = "no_longer_available"
+)
+
+// SongAvailability son las restricciones de licencia de una canción según music-ms
+type SongAvailability struct {
+	AvailableMarkets []string   `json:"available_markets"` // ISO 3166-1 alfa-2; vacío = todos los países
+	AvailableFrom    *time.Time `json:"available_from"`
+	AvailableUntil   *time.Time `json:"available_until"`
+}
+
+// availabilityError indica que la canción no se puede reproducir para el usuario
+type availabilityError struct {
+	Code    string
+	Message string
+}
+
+func (e *availabilityError) Error() string { return e.Message }
+
+// check valida la ventana de licencia y el país del usuario. Si la canción está limitada a
+// ciertos mercados y no se conoce el país (sin claim ni header), no se reproduce.
+func (a SongAvailability) check(country string, now time.Time) error {
+	if a.AvailableFrom != nil && now.Before(*a.AvailableFrom) {
+		return &availabilityError{
+			Code:    codeNotYetReleased,
+			Message: fmt.Sprintf("La canción estará disponible a partir del %s", a.AvailableFrom.Format("02/01/2006")),
+		}
+	}
+	if a.AvailableUntil != nil && !now.Before(*a.AvailableUntil) {
+		return &availabilityError{
+			Code:    codeNoLongerAvailable,
+			Message: "La canción ya no está disponible",
+		}
+	}
+	if len(a.AvailableMarkets) == 0 {
+		return nil
+	}
+	for _, market := range a.AvailableMarkets {
+		if strings.EqualFold(market, country) {
+			return nil
+		}
+	}
+	return &availabilityError{
+		Code:    codeNotAvailableInRegion,
+		Message: "La canción no está disponible en tu región",
+	}
+}
+
+// countryFromRequest obtiene el país del usuario del claim COUNTRY_CLAIM (por defecto "country")
+// o, si el token no lo trae, del header configurado en COUNTRY_HEADER (p. ej. "CF-IPCountry")
+func countryFromRequest(r *http.Request, claims TokenClaims) string {
+	name := os.Getenv("COUNTRY_CLAIM")
+	if name == "" {
+		name = "country"
+	}
+	country := claims.String(name)
+	if country == "" {
+		if header := os.Getenv("COUNTRY_HEADER"); header != "" {
+			country = r.Header.Get(header)
+		}
+	}
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "XX" { // Código habitual de los proxies para país desconocido
+		return ""
+	}
+	return country
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSongAvailabilityCheck(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name         string
+		availability SongAvailability
+		country      string
+		wantCode     string
+	}{
+		{"sin restricciones", SongAvailability{}, "", ""},
+		{"país con licencia", SongAvailability{AvailableMarkets: []string{"AR", "MX"}}, "MX", ""},
+		{"mayúsculas y minúsculas", SongAvailability{AvailableMarkets: []string{"ar"}}, "AR", ""},
+		{"país sin licencia", SongAvailability{AvailableMarkets: []string{"AR"}}, "ES", codeNotAvailableInRegion},
+		{"país desconocido con mercados", SongAvailability{AvailableMarkets: []string{"AR"}}, "", codeNotAvailableInRegion},
+		{"país desconocido sin mercados", SongAvailability{AvailableUntil: &future}, "", ""},
+		{"antes del lanzamiento", SongAvailability{AvailableFrom: &future}, "AR", codeNotYetReleased},
+		{"licencia vencida", SongAvailability{AvailableUntil: &past}, "AR", codeNoLongerAvailable},
+		{"vence justo ahora", SongAvailability{AvailableUntil: &now}, "AR", codeNoLongerAvailable},
+		{"dentro de la ventana", SongAvailability{AvailableFrom: &past, AvailableUntil: &future, AvailableMarkets: []string{"AR"}}, "AR", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.availability.check(tt.country, now)
+			var code string
+			if err != nil {
+				code = err.(*availabilityError).Code
+			}
+			if code != tt.wantCode {
+				t.Errorf("check(%q) = %q, se esperaba %q", tt.country, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCountryFromRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims TokenClaims
+		header string // Valor de CF-IPCountry
+		want   string
+	}{
+		{"sin token ni header", TokenClaims{}, "", ""},
+		{"claim del token", TokenClaims{"country": "ar"}, "MX", "AR"},
+		{"header si el token no lo trae", TokenClaims{}, "mx", "MX"},
+		{"país desconocido del proxy", TokenClaims{}, "XX", ""},
+	}
+	t.Setenv("COUNTRY_CLAIM", "")
+	t.Setenv("COUNTRY_HEADER", "CF-IPCountry")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ws", nil)
+			if tt.header != "" {
+				req.Header.Set("CF-IPCountry", tt.header)
+			}
+			if got := countryFromRequest(req, tt.claims); got != tt.want {
+				t.Errorf("countryFromRequest = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Sin país en el token ni header no se conoce: una canción limitada a ciertos mercados no se reproduce
+func TestUnknownCountryFailsClosed(t *testing.T) {
+	t.Setenv("COUNTRY_HEADER", "CF-IPCountry")
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken(t, map[string]interface{}{"user_id": "ana"}))
+	_, claims, err := identityFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	country := countryFromRequest(req, claims)
+	err = SongAvailability{AvailableMarkets: []string{"AR"}}.check(country, time.Now())
+	if unavailable, ok := err.(*availabilityError); !ok || unavailable.Code != codeNotAvailableInRegion {
+		t.Errorf("check = %v, se esperaba %s", err, codeNotAvailableInRegion)
+	}
+}
+
+// fakeMusicMS responde a la consulta GraphQL de la canción con las restricciones indicadas
+func fakeMusicMS(t *testing.T, availability SongAvailability) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		song := struct {
+			Song
+			SongAvailability
+		}{Song{ID: "s1", Title: "Canción", AudioURL: "https://cdn.example/s1.mp3"}, availability}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"song": song}})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("API_GATEWAY_URL", server.URL)
+}
+
+// Reanudar pasa por la misma comprobación que play: la licencia pudo vencer durante la pausa
+func TestResumeChecksAvailability(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	tests := []struct {
+		name         string
+		availability SongAvailability
+		country      string
+		wantCode     string
+		wantPlaying  bool
+	}{
+		{"dentro de la ventana", SongAvailability{AvailableUntil: &future}, "AR", "", true},
+		{"licencia vencida durante la pausa", SongAvailability{AvailableUntil: &past}, "AR", codeNoLongerAvailable, false},
+		{"reanuda desde un país sin licencia", SongAvailability{AvailableMarkets: []string{"AR"}}, "ES", codeNotAvailableInRegion, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeMusicMS(t, tt.availability)
+			previous := sessionStore
+			sessionStore = NewMemorySessionStore()
+			defer func() { sessionStore = previous }()
+			sessionStore.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1", StartTime: past})
+
+			response := handleCommand(Command{UserID: "ana", DeviceID: "web", Country: tt.country,
+				Request: StreamRequest{Type: "resume", SongID: "s1"}})
+			if response.Code != tt.wantCode {
+				t.Errorf("respuesta %+v, se esperaba el código %q", response, tt.wantCode)
+			}
+			if session, _ := sessionStore.GetSession("ana", "web"); session.IsPlaying != tt.wantPlaying {
+				t.Errorf("sonando = %v, se esperaba %v", session.IsPlaying, tt.wantPlaying)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// royalty-report genera los reportes de reproducciones por artista a partir de eventos
+// song_played en JSONL (outbox de streaming-ms o export del topic de Kafka).
+//
+//	royalty-report -events outbox.jsonl -from 2025-01-01 -to 2025-01-31 -out reports
+//	royalty-report -verify reports/<run_id>
+//
+// La clave de firma se lee de ROYALTY_SIGNING_KEY.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"streaming-ms/internal/royalty"
+)
+
+func main() {
+	events := flag.String("events", "", "Archivos de eventos JSONL separados por coma")
+	from := flag.String("from", "", "Día inicial AAAA-MM-DD (UTC, inclusive)")
+	to := flag.String("to", "", "Día final AAAA-MM-DD (UTC, inclusive)")
+	artist := flag.String("artist", "", "Generar solo el reporte de este artista")
+	out := flag.String("out", "reports", "Directorio de salida")
+	formats := flag.String("format", "csv,json", "Formatos separados por coma: csv, json")
+	minSeconds := flag.Int("min-seconds", 30, "Segundos escuchados para que una reproducción califique")
+	verify := flag.String("verify", "", "Verificar las firmas del directorio de una ejecución")
+	flag.Parse()
+
+	log.SetFlags(0)
+	key := []byte(os.Getenv("ROYALTY_SIGNING_KEY"))
+	if len(key) == 0 {
+		log.Fatal("ROYALTY_SIGNING_KEY requerido para firmar o verificar reportes")
+	}
+
+	if *verify != "" {
+		manifest, err := royalty.VerifyRun(*verify, key)
+		if err != nil {
+			log.Fatalf("Verificación fallida: %v", err)
+		}
+		fmt.Printf("Ejecución %s verificada: %d archivos, %d reproducciones calificadas (%s a %s)\n",
+			manifest.RunID, len(manifest.Files), manifest.QualifiedPlays, manifest.From, manifest.To)
+		return
+	}
+
+	if *events == "" || *from == "" || *to == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts := royalty.Options{MinSeconds: *minSeconds, ArtistID: *artist}
+	var err error
+	if opts.From, err = time.Parse("2006-01-02", *from); err != nil {
+		log.Fatalf("-from inválido: %v", err)
+	}
+	if opts.To, err = time.Parse("2006-01-02", *to); err != nil {
+		log.Fatalf("-to inválido: %v", err)
+	}
+	if opts.To.Before(opts.From) {
+		log.Fatal("-to debe ser igual o posterior a -from")
+	}
+
+	var all []royalty.Event
+	for _, path := range strings.Split(*events, ",") {
+		file, err := os.Open(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("Error abriendo eventos: %v", err)
+		}
+		read, err := royalty.ReadEvents(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Error leyendo %s: %v", path, err)
+		}
+		all = append(all, read...)
+	}
+
+	result := royalty.Aggregate(all, opts)
+	runDir, err := royalty.WriteRun(*out, result, opts, strings.Split(*formats, ","), key)
+	if err != nil {
+		log.Fatalf("Error escribiendo reportes: %v", err)
+	}
+
+	fmt.Printf("Run ID: %s\n", result.RunID)
+	fmt.Printf("Eventos leídos: %d (duplicados: %d, fuera de rango: %d, sin calificar: %d)\n",
+		result.EventsRead, result.Duplicates, result.OutOfRange, result.NotQualified)
+	fmt.Printf("Reproducciones calificadas: %d, artistas: %d\n", result.QualifiedPlays, len(result.Reports))
+	fmt.Printf("Reportes en %s\n", runDir)
+}
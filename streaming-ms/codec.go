@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Subprotocolos de WebSocket con los que el cliente elige la codificación de los mensajes.
+// Sin subprotocolo se usa JSON, como hasta ahora.
+const (
+	subprotocolJSON    = "json"
+	subprotocolMsgpack = "msgpack"
+)
+
+// msgpackHandle usa los tags json de los structs para que los campos se llamen igual en ambas
+// codificaciones; WriteExt activa la especificación nueva (str/bin y timestamps)
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.TypeInfos = codec.NewTypeInfos([]string{"json"})
+	return h
+}()
+
+// messageCodec serializa los mensajes de una conexión WebSocket
+type messageCodec interface {
+	Name() string
+	MessageType() int // websocket.TextMessage o websocket.BinaryMessage
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return subprotocolJSON }
+func (jsonCodec) MessageType() int                           { return websocket.TextMessage }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string     { return subprotocolMsgpack }
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(v)
+	return data, err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+// codecForSubprotocol devuelve el codec del subprotocolo negociado en el handshake
+func codecForSubprotocol(subprotocol string) messageCodec {
+	if subprotocol == subprotocolMsgpack {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+// wsConn envuelve la conexión WebSocket con el codec negociado. Implementa messageWriter
+// para que los envíos a dispositivos no dependan de la codificación de cada conexión.
+type wsConn struct {
+	conn  *websocket.Conn
+	codec messageCodec
+}
+
+func newWSConn(conn *websocket.Conn) *wsConn {
+	return &wsConn{conn: conn, codec: codecForSubprotocol(conn.Subprotocol())}
+}
+
+// WriteMessage codifica el mensaje con el codec de la conexión y lo escribe
+func (c *wsConn) WriteMessage(v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(c.codec.MessageType(), data)
+}
+
+// ReadMessage lee el siguiente mensaje y lo decodifica con el codec de la conexión.
+// Los mensajes de texto se aceptan siempre como JSON para facilitar la depuración.
+func (c *wsConn) ReadMessage(v interface{}) error {
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if messageType == websocket.TextMessage {
+		return json.Unmarshal(data, v)
+	}
+	return c.codec.Unmarshal(data, v)
+}
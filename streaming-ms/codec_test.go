@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsURL convierte la URL de un httptest.Server en la de su WebSocket
+func wsURL(server *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + path
+}
+
+func TestWSConnNegotiatesCodec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgraded, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer upgraded.Close()
+		newWSConn(upgraded).WriteMessage(StreamResponse{Type: "status", Message: "hola"})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		subprotocols []string
+		wantProtocol string
+		wantType     int
+		decode       func(data []byte, v interface{}) error
+	}{
+		{"sin subprotocolo", nil, "", websocket.TextMessage, json.Unmarshal},
+		{"json", []string{subprotocolJSON}, subprotocolJSON, websocket.TextMessage, json.Unmarshal},
+		{"msgpack", []string{subprotocolMsgpack}, subprotocolMsgpack, websocket.BinaryMessage, msgpackCodec{}.Unmarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: tt.subprotocols}
+			conn, _, err := dialer.Dial(wsURL(server, "/"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if conn.Subprotocol() != tt.wantProtocol {
+				t.Errorf("subprotocolo = %q, se esperaba %q", conn.Subprotocol(), tt.wantProtocol)
+			}
+
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if messageType != tt.wantType {
+				t.Errorf("tipo de mensaje = %d, se esperaba %d", messageType, tt.wantType)
+			}
+			var response StreamResponse
+			if err := tt.decode(data, &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Type != "status" || response.Message != "hola" {
+				t.Errorf("mensaje = %+v", response)
+			}
+		})
+	}
+}
+
+// El WebSocket de presencia escribe JSON: no debe aceptar msgpack aunque el cliente lo pida
+func TestPresenceUpgraderIsJSONOnly(t *testing.T) {
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	server := httptest.NewServer(http.HandlerFunc(presenceWsHandler))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolMsgpack}}
+	token := testToken(t, map[string]interface{}{"user_id": "ana"})
+	conn, _, err := dialer.Dial(wsURL(server, "/presence?token="+token), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "" {
+		t.Errorf("subprotocolo = %q, se esperaba ninguno", conn.Subprotocol())
+	}
+
+	if err := conn.WriteJSON(PresenceRequest{Type: "subscribe", UserIDs: []string{"ana"}}); err != nil {
+		t.Fatal(err)
+	}
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg PresenceMessage
+	if messageType != websocket.TextMessage || json.Unmarshal(data, &msg) != nil || msg.Type != "presence_snapshot" {
+		t.Errorf("mensaje = %d %s, se esperaba un presence_snapshot en JSON", messageType, data)
+	}
+}
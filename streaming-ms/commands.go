@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Command es un comando de un dispositivo ya autenticado. Se ejecuta en la instancia
+// propietaria de la sesión del usuario (ver coordinator.go).
+type Command struct {
+	UserID     string        `json:"user_id"`
+	DeviceID   string        `json:"device_id"`
+	Plan       string        `json:"plan,omitempty"`
+	Country    string        `json:"country,omitempty"`
+	Request    StreamRequest `json:"request"`
+	Disconnect bool          `json:"disconnect,omitempty"` // El dispositivo cerró la conexión
+}
+
+// executeCommand ejecuta el comando localmente o, con coordinación entre instancias,
+// en la instancia propietaria del usuario
+func executeCommand(cmd Command) StreamResponse {
+	if coordinator != nil {
+		return coordinator.Execute(cmd)
+	}
+	return handleCommand(cmd)
+}
+
+// handleCommand aplica un comando sobre las sesiones locales y devuelve la respuesta para el cliente
+func handleCommand(cmd Command) StreamResponse {
+	currentUserID := cmd.UserID
+	deviceID := cmd.DeviceID
+	request := cmd.Request
+
+	// Finalizar la sesión del dispositivo cuando se desconecta el cliente.
+	// El temporizador queda a la espera de que se reconecte.
+	if cmd.Disconnect {
+		endPlaybackSession(currentUserID, deviceID)
+		refreshTimer(currentUserID, deviceID)
+		return StreamResponse{Type: "status", Message: "Dispositivo desconectado"}
+	}
+
+	switch request.Type {
+	case "play":
+		log.Printf("Solicitud de reproducción para canción ID: %s de user_id: %s", request.SongID, currentUserID)
+
+		song, err := getSongFromMusicMS(request.SongID, cmd.Country)
+		var unavailable *availabilityError
+		if errors.As(err, &unavailable) {
+			return StreamResponse{
+				Type:    "error",
+				Code:    unavailable.Code,
+				Message: unavailable.Message,
+			}
+		}
+		if err != nil {
+			log.Printf("Error obteniendo canción: %v", err)
+			response := StreamResponse{
+				Type:    "error",
+				Message: "No se pudo obtener la canción: " + err.Error(),
+			}
+			return response
+		}
+
+		// Verificar si hay audio_url disponible
+		if song.AudioURL == "" {
+			log.Printf("Canción encontrada pero sin audio_url: %s", song.Title)
+			response := StreamResponse{
+				Type:    "error",
+				Message: fmt.Sprintf("La canción '%s' no tiene audio disponible. Audio URL no configurado en la base de datos.", song.Title),
+			}
+			return response
+		}
+
+		// Posición inicial: la indicada por el cliente o, si pide continuar, la del historial
+		position := request.Position
+		if position == nil && request.Resume {
+			if resumeAt, ok := resumePosition(currentUserID, song.ID); ok {
+				position = &resumeAt
+			}
+		}
+
+		// Iniciar sesión de reproducción (esto finalizará automáticamente cualquier sesión previa)
+		startPlaybackSession(currentUserID, deviceID, song, request.Context, position)
+		enforceStreamLimit(currentUserID, deviceID, cmd.Plan)
+
+		log.Printf("Enviando datos de canción al cliente: %s", song.Title)
+		response := StreamResponse{
+			Type:     "song_data",
+			Message:  fmt.Sprintf("Reproduciendo: %s", song.Title),
+			Song:     song,
+			Position: position,
+			Timer:    getTimer(currentUserID),
+		}
+		return response
+
+	case "pause":
+		log.Printf("Solicitud de pausa para canción ID: %s de user_id: %s", request.SongID, currentUserID)
+
+		// Pausar sesión de reproducción y enviar evento a Kafka
+		err := pausePlaybackSession(currentUserID, deviceID)
+		if err != nil {
+			log.Printf("Error pausando sesión: %v", err)
+		}
+
+		response := StreamResponse{
+			Type:    "status",
+			Message: fmt.Sprintf("Canción %s pausada", request.SongID),
+			Timer:   getTimer(currentUserID),
+		}
+		return response
+
+	case "stop":
+		log.Printf("Solicitud de detener para canción ID: %s de user_id: %s", request.SongID, currentUserID)
+
+		// Finalizar sesión de reproducción y enviar evento a Kafka
+		err := endPlaybackSession(currentUserID, deviceID)
+		if err != nil {
+			log.Printf("Error finalizando sesión: %v", err)
+		}
+		songStopped(currentUserID, deviceID)
+
+		response := StreamResponse{
+			Type:    "status",
+			Message: fmt.Sprintf("Canción %s detenida", request.SongID),
+			Timer:   getTimer(currentUserID),
+		}
+		return response
+
+	case "resume":
+		log.Printf("Solicitud de reanudar para canción ID: %s de user_id: %s", request.SongID, currentUserID)
+
+		// La misma comprobación de mercado y ventana de licencia que en play: pudo vencer
+		// mientras estaba pausada, o el dispositivo reanuda desde otro país
+		if err := checkSongAvailability(request.SongID, cmd.Country); err != nil {
+			var unavailable *availabilityError
+			if errors.As(err, &unavailable) {
+				return StreamResponse{
+					Type:    "error",
+					Code:    unavailable.Code,
+					Message: unavailable.Message,
+				}
+			}
+			log.Printf("Error comprobando disponibilidad: %v", err)
+			return StreamResponse{
+				Type:    "error",
+				Message: "No se pudo reanudar la reproducción: " + err.Error(),
+			}
+		}
+
+		// Reanudar sesión de reproducción
+		err := resumePlaybackSession(currentUserID, deviceID, request.SongID)
+		if err != nil {
+			log.Printf("Error reanudando sesión: %v", err)
+			response := StreamResponse{
+				Type:    "error",
+				Message: "No se pudo reanudar la reproducción: " + err.Error(),
+			}
+			return response
+		}
+		enforceStreamLimit(currentUserID, deviceID, cmd.Plan)
+
+		response := StreamResponse{
+			Type:    "status",
+			Message: fmt.Sprintf("Canción %s reanudada", request.SongID),
+			Timer:   getTimer(currentUserID),
+		}
+		return response
+
+	case "seek":
+		if request.Position == nil {
+			return StreamResponse{
+				Type:    "error",
+				Message: "position requerido para seek",
+			}
+		}
+
+		if err := seekPlaybackSession(currentUserID, deviceID, request.SongID, *request.Position); err != nil {
+			log.Printf("Error moviendo posición: %v", err)
+			return StreamResponse{
+				Type:    "error",
+				Message: "No se pudo cambiar la posición: " + err.Error(),
+			}
+		}
+
+		return StreamResponse{
+			Type:     "status",
+			Message:  fmt.Sprintf("Posición actualizada a %d segundos", *request.Position),
+			Position: request.Position,
+			Timer:    getTimer(currentUserID),
+		}
+
+	case "private_session":
+		// Activar o desactivar la sesión privada: sin eventos a Kafka ni presencia
+		enabled := request.Enabled == nil || *request.Enabled
+		response := StreamResponse{
+			Type:    "status",
+			Message: "Sesión privada desactivada",
+		}
+		if enabled {
+			duration := time.Duration(request.DurationMinutes) * time.Minute
+			private := enablePrivateSession(currentUserID, duration)
+			response.Message = fmt.Sprintf("Sesión privada activada hasta %s", private.ExpiresAt.Format(time.RFC3339))
+			response.PrivateSession = private
+		} else {
+			disablePrivateSession(currentUserID)
+		}
+		return response
+
+	case "sleep_timer", "stop_after_song":
+		// Programar pausa/detención del lado del servidor; se avisa a todos los dispositivos
+		var timer *PlaybackTimer
+		var err error
+		if request.Type == "sleep_timer" {
+			timer, err = setSleepTimer(currentUserID, deviceID, request.DurationMinutes, request.Action)
+		} else {
+			timer, err = setEndOfSongTimer(currentUserID, deviceID, request.Action)
+		}
+		if err != nil {
+			log.Printf("Error programando temporizador: %v", err)
+			return StreamResponse{
+				Type:    "error",
+				Message: "No se pudo programar el temporizador: " + err.Error(),
+			}
+		}
+		return StreamResponse{
+			Type:    "status",
+			Message: "Temporizador programado",
+			Timer:   timer,
+		}
+
+	case "cancel_timer":
+		message := "No hay temporizador programado"
+		if cancelTimer(currentUserID) {
+			message = "Temporizador cancelado"
+		}
+		return StreamResponse{
+			Type:    "status",
+			Message: message,
+		}
+
+	case "telemetry":
+		// Telemetría del reproductor: no tiene respuesta salvo que sea inválida
+		if request.Telemetry == nil {
+			return StreamResponse{
+				Type:    "error",
+				Message: "telemetry requerido para el comando telemetry",
+			}
+		}
+		if err := recordTelemetry(currentUserID, deviceID, request.SongID, *request.Telemetry); err != nil {
+			return StreamResponse{
+				Type:    "error",
+				Message: "Telemetría inválida: " + err.Error(),
+			}
+		}
+		return StreamResponse{}
+
+	default:
+		response := StreamResponse{
+			Type:    "error",
+			Message: "Tipo de comando no reconocido",
+		}
+		return response
+	}
+}
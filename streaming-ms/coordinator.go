@@ -0,0 +1,564 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// broadcastChannel reparte a todas las instancias los mensajes para dispositivos y presencia
+	broadcastChannel = "streaming:broadcast"
+	// commandTimeout es lo que espera una instancia la respuesta del propietario ("play" consulta music-ms)
+	commandTimeout = 10 * time.Second
+	// queryTimeout es lo que espera una consulta al propietario del usuario
+	queryTimeout = 3 * time.Second
+	// gatherWindow es cuánto se esperan respuestas de las instancias en Gather
+	gatherWindow = 300 * time.Millisecond
+)
+
+// coordinator es nil cuando el servicio corre como instancia única (COORDINATOR_TRANSPORT sin configurar)
+var coordinator *Coordinator
+
+// instanceChannel es el canal por el que una instancia recibe comandos y respuestas
+func instanceChannel(instanceID string) string {
+	return "streaming:instance:" + instanceID
+}
+
+// coordinatorMessage es el sobre que viaja por el transporte
+type coordinatorMessage struct {
+	Kind     string          `json:"kind"` // "command", "query", "gather", "reply", "device", "presence", "sse_command"
+	ID       string          `json:"id,omitempty"`
+	ReplyTo  string          `json:"reply_to,omitempty"`
+	Command  *Command        `json:"command,omitempty"`
+	Response *StreamResponse `json:"response,omitempty"`
+	UserID   string          `json:"user_id,omitempty"`
+	DeviceID string          `json:"device_id,omitempty"` // "device": vacío para todos los dispositivos
+	Presence *Presence       `json:"presence,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Query    *ownerQuery     `json:"query,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"` // "reply" a "query" o "gather"
+	Error    string          `json:"error,omitempty"`
+	// "sse_command": comando para la conexión SSE abierta en otra instancia
+	ConnectionID string         `json:"connection_id,omitempty"`
+	Request      *StreamRequest `json:"request,omitempty"`
+}
+
+// coordinatorLocal es lo que hace el coordinador sobre el estado de esta instancia. Las
+// pruebas lo sustituyen para simular varias instancias en un mismo proceso.
+type coordinatorLocal struct {
+	handle   func(cmd Command) StreamResponse
+	deliver  func(userID, deviceID string, msg StreamResponse)
+	presence func(p *Presence, event string)
+	answer   func(q ownerQuery) (interface{}, error)
+	hasState func(userID string) bool
+	// sseCommand ejecuta el comando si la conexión SSE está en esta instancia
+	sseCommand func(connectionID string, request StreamRequest) bool
+}
+
+func defaultCoordinatorLocal() coordinatorLocal {
+	return coordinatorLocal{
+		handle:   handleCommand,
+		deliver:  clients.deliverLocal,
+		presence: broadcastPresenceLocal,
+		answer:   answerQuery,
+		hasState: hasLocalState,
+
+		sseCommand: deliverSSECommand,
+	}
+}
+
+// Coordinator reparte los usuarios entre instancias. Las sesiones de un usuario viven en
+// su instancia propietaria; los comandos y las consultas sobre su estado que llegan a otra
+// instancia se reenvían al propietario y los mensajes para dispositivos se difunden a
+// todas las instancias.
+type Coordinator struct {
+	instanceID string
+	transport  Transport
+	ownerTTL   time.Duration
+	local      coordinatorLocal
+
+	mu      sync.Mutex
+	pending map[string]chan coordinatorMessage // Comandos y consultas esperando respuesta
+	owned   map[string]bool                    // Usuarios de los que esta instancia es propietaria
+	seq     uint64
+	stop    chan struct{}
+}
+
+// NewCoordinator suscribe la instancia a su canal y al de difusión y arranca la renovación de propiedad
+func NewCoordinator(instanceID string, transport Transport, ownerTTL time.Duration) (*Coordinator, error) {
+	return newCoordinator(instanceID, transport, ownerTTL, defaultCoordinatorLocal())
+}
+
+func newCoordinator(instanceID string, transport Transport, ownerTTL time.Duration, local coordinatorLocal) (*Coordinator, error) {
+	c := &Coordinator{
+		instanceID: instanceID,
+		transport:  transport,
+		ownerTTL:   ownerTTL,
+		local:      local,
+		pending:    make(map[string]chan coordinatorMessage),
+		owned:      make(map[string]bool),
+		stop:       make(chan struct{}),
+	}
+	if err := transport.Subscribe(instanceChannel(instanceID), c.handleInstanceMessage); err != nil {
+		return nil, fmt.Errorf("error suscribiendo canal de instancia: %v", err)
+	}
+	if err := transport.Subscribe(broadcastChannel, c.handleBroadcastMessage); err != nil {
+		return nil, fmt.Errorf("error suscribiendo canal de difusión: %v", err)
+	}
+	go c.refreshLoop()
+	return c, nil
+}
+
+// Execute ejecuta el comando en la instancia propietaria del usuario, reclamando la
+// propiedad si nadie la tiene. Si el transporte falla, se ejecuta localmente.
+func (c *Coordinator) Execute(cmd Command) StreamResponse {
+	owner, err := c.transport.ClaimOwner(cmd.UserID, c.instanceID, c.ownerTTL)
+	if err != nil {
+		log.Printf("Error consultando propietario de user_id=%s, se ejecuta localmente: %v", cmd.UserID, err)
+		return c.local.handle(cmd)
+	}
+	if owner == c.instanceID {
+		c.markOwned(cmd.UserID)
+		return c.local.handle(cmd)
+	}
+	return c.forward(owner, cmd)
+}
+
+// forward envía el comando al propietario y espera su respuesta
+func (c *Coordinator) forward(owner string, cmd Command) StreamResponse {
+	log.Printf("COORDINACIÓN - reenviando %q de user_id=%s a instancia %s", cmd.Request.Type, cmd.UserID, owner)
+	replies, done, err := c.request(instanceChannel(owner), coordinatorMessage{Kind: "command", Command: &cmd}, 1)
+	if err != nil {
+		return StreamResponse{Type: "error", Message: "No se pudo contactar la instancia de la sesión: " + err.Error()}
+	}
+	defer done()
+
+	select {
+	case reply := <-replies:
+		if reply.Response == nil {
+			return StreamResponse{Type: "error", Message: "Respuesta vacía de la instancia de la sesión"}
+		}
+		return *reply.Response
+	case <-time.After(commandTimeout):
+		log.Printf("COORDINACIÓN - la instancia %s no respondió al comando de user_id=%s", owner, cmd.UserID)
+		return StreamResponse{Type: "error", Message: "La instancia que gestiona la sesión no respondió"}
+	}
+}
+
+// ForwardSSECommand entrega el comando a la instancia que tiene abierta la conexión SSE,
+// que responde al cliente por su stream. Devuelve false si ninguna instancia la tiene.
+func (c *Coordinator) ForwardSSECommand(connectionID string, request StreamRequest) (bool, error) {
+	replies, done, err := c.request(broadcastChannel, coordinatorMessage{
+		Kind:         "sse_command",
+		ConnectionID: connectionID,
+		Request:      &request,
+	}, 1)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	select {
+	case <-replies:
+		return true, nil
+	case <-time.After(gatherWindow):
+		return false, nil
+	}
+}
+
+// Query resuelve q en la instancia propietaria del usuario y decodifica el resultado en
+// result. Devuelve false si el usuario no tiene propietario o lo es esta instancia: su
+// estado, si lo tiene, es el local.
+func (c *Coordinator) Query(q ownerQuery, result interface{}) (bool, error) {
+	owner, err := c.transport.Owner(q.UserID)
+	if err != nil {
+		return false, err
+	}
+	if owner == "" || owner == c.instanceID {
+		return false, nil
+	}
+
+	replies, done, err := c.request(instanceChannel(owner), coordinatorMessage{Kind: "query", Query: &q}, 1)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return false, fmt.Errorf("instancia %s: %s", owner, reply.Error)
+		}
+		return true, json.Unmarshal(reply.Result, result)
+	case <-time.After(queryTimeout):
+		return false, fmt.Errorf("la instancia %s no respondió a la consulta %q de user_id=%s", owner, q.Kind, q.UserID)
+	}
+}
+
+// Gather difunde q a todas las instancias, esta incluida, y devuelve los resultados que
+// llegan durante gatherWindow. Sirve para el estado que no vive solo en el propietario
+// actual, como el historial, que guarda cada instancia que atendió al usuario.
+func (c *Coordinator) Gather(q ownerQuery) ([]json.RawMessage, error) {
+	replies, done, err := c.request(broadcastChannel, coordinatorMessage{Kind: "gather", Query: &q}, 64)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var results []json.RawMessage
+	timeout := time.After(gatherWindow)
+	for {
+		select {
+		case reply := <-replies:
+			if reply.Error != "" {
+				log.Printf("COORDINACIÓN - error en la consulta %q: %s", q.Kind, reply.Error)
+				continue
+			}
+			results = append(results, reply.Result)
+		case <-timeout:
+			return results, nil
+		}
+	}
+}
+
+// request publica msg esperando respuestas con su ID. done deja de esperarlas.
+func (c *Coordinator) request(channel string, msg coordinatorMessage, buffer int) (<-chan coordinatorMessage, func(), error) {
+	msg.ID = fmt.Sprintf("%s-%d", c.instanceID, atomic.AddUint64(&c.seq, 1))
+	msg.ReplyTo = c.instanceID
+	replies := make(chan coordinatorMessage, buffer)
+	c.mu.Lock()
+	c.pending[msg.ID] = replies
+	c.mu.Unlock()
+	done := func() {
+		c.mu.Lock()
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+	}
+
+	if err := c.publish(channel, msg); err != nil {
+		done()
+		return nil, nil, err
+	}
+	return replies, done, nil
+}
+
+// reply responde a una consulta con el resultado de resolverla localmente
+func (c *Coordinator) reply(msg coordinatorMessage) {
+	answer := coordinatorMessage{Kind: "reply", ID: msg.ID}
+	result, err := c.local.answer(*msg.Query)
+	if err == nil {
+		answer.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		answer.Error = err.Error()
+	}
+	if err := c.publish(instanceChannel(msg.ReplyTo), answer); err != nil {
+		log.Printf("COORDINACIÓN - error respondiendo a %s: %v", msg.ReplyTo, err)
+	}
+}
+
+// PublishDevice difunde un mensaje para los dispositivos de un usuario (deviceID vacío: todos)
+func (c *Coordinator) PublishDevice(userID, deviceID string, msg StreamResponse) error {
+	return c.publish(broadcastChannel, coordinatorMessage{
+		Kind:     "device",
+		UserID:   userID,
+		DeviceID: deviceID,
+		Response: &msg,
+	})
+}
+
+// PublishPresence difunde un cambio de presencia a los suscriptores de todas las instancias
+func (c *Coordinator) PublishPresence(p *Presence, event string) error {
+	return c.publish(broadcastChannel, coordinatorMessage{
+		Kind:     "presence",
+		Presence: p,
+		Event:    event,
+	})
+}
+
+func (c *Coordinator) publish(channel string, msg coordinatorMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.transport.Publish(channel, payload)
+}
+
+func (c *Coordinator) handleInstanceMessage(payload []byte) {
+	var msg coordinatorMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("COORDINACIÓN - mensaje inválido: %v", err)
+		return
+	}
+
+	switch msg.Kind {
+	case "command":
+		if msg.Command == nil {
+			return
+		}
+		// Se ejecuta aparte para no bloquear la entrega de respuestas a esta instancia
+		go func() {
+			c.markOwned(msg.Command.UserID)
+			response := c.local.handle(*msg.Command)
+			if err := c.publish(instanceChannel(msg.ReplyTo), coordinatorMessage{
+				Kind:     "reply",
+				ID:       msg.ID,
+				Response: &response,
+			}); err != nil {
+				log.Printf("COORDINACIÓN - error respondiendo a %s: %v", msg.ReplyTo, err)
+			}
+		}()
+
+	case "query":
+		if msg.Query != nil {
+			go c.reply(msg)
+		}
+
+	case "reply":
+		c.mu.Lock()
+		replies, exists := c.pending[msg.ID]
+		c.mu.Unlock()
+		if !exists {
+			return
+		}
+		select {
+		case replies <- msg:
+		default:
+			log.Printf("COORDINACIÓN - respuesta %s descartada: nadie la espera", msg.ID)
+		}
+	}
+}
+
+func (c *Coordinator) handleBroadcastMessage(payload []byte) {
+	var msg coordinatorMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("COORDINACIÓN - mensaje de difusión inválido: %v", err)
+		return
+	}
+
+	switch msg.Kind {
+	case "device":
+		if msg.Response != nil {
+			c.local.deliver(msg.UserID, msg.DeviceID, *msg.Response)
+		}
+	case "presence":
+		if msg.Presence != nil {
+			c.local.presence(msg.Presence, msg.Event)
+		}
+	case "gather":
+		if msg.Query != nil {
+			go c.reply(msg)
+		}
+	case "sse_command":
+		// Solo responde la instancia que tiene la conexión
+		if msg.Request != nil && c.local.sseCommand(msg.ConnectionID, *msg.Request) {
+			if err := c.publish(instanceChannel(msg.ReplyTo), coordinatorMessage{Kind: "reply", ID: msg.ID}); err != nil {
+				log.Printf("COORDINACIÓN - error confirmando comando SSE a %s: %v", msg.ReplyTo, err)
+			}
+		}
+	}
+}
+
+func (c *Coordinator) markOwned(userID string) {
+	c.mu.Lock()
+	c.owned[userID] = true
+	c.mu.Unlock()
+}
+
+// hasLocalState indica si la instancia guarda estado del usuario que obliga a conservar la propiedad
+func hasLocalState(userID string) bool {
+	sessionsMu.Lock()
+	sessions := sessionStore.ListUserSessions(userID)
+	sessionsMu.Unlock()
+	return len(sessions) > 0 || getTimer(userID) != nil || isPrivateSession(userID)
+}
+
+// Consultas sobre el estado de los usuarios que se resuelven en otra instancia
+const (
+	queryPresence      = "presence"       // Presencia del usuario (propietario)
+	queryHistory       = "history"        // Historial local (todas las instancias)
+	queryAdminUser     = "admin_user"     // Sesiones, temporizador y sesión privada (propietario)
+	queryAdminSessions = "admin_sessions" // Sesiones y conexiones locales (todas las instancias)
+	queryAdminStop     = "stop"           // Detención forzada por soporte (propietario)
+	queryAdminPause    = "pause"          // Pausa forzada por soporte (propietario)
+)
+
+// ownerQuery es una operación sobre el estado de un usuario que debe resolver la instancia
+// que lo guarda (ver Coordinator.Query y Coordinator.Gather)
+type ownerQuery struct {
+	Kind     string `json:"kind"`
+	UserID   string `json:"user_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+// answerQuery resuelve una consulta con el estado de esta instancia
+func answerQuery(q ownerQuery) (interface{}, error) {
+	switch q.Kind {
+	case queryPresence:
+		return localPresence(q.UserID), nil
+	case queryHistory:
+		return sessionStore.ListHistory(q.UserID, q.Limit), nil
+	case queryAdminUser:
+		return localAdminUser(q.UserID), nil
+	case queryAdminSessions:
+		return localAdminSessions(q.UserID), nil
+	case queryAdminStop, queryAdminPause:
+		return localAdminControl(q.UserID, q.DeviceID, q.Kind), nil
+	}
+	return nil, fmt.Errorf("consulta desconocida: %q", q.Kind)
+}
+
+// queryOwner resuelve q en la instancia propietaria del usuario. Devuelve false si la
+// respuesta es el estado local: sin coordinación, sin propietario, si lo es esta instancia
+// o si la consulta falla.
+func queryOwner(q ownerQuery, result interface{}) bool {
+	if coordinator == nil {
+		return false
+	}
+	remote, err := coordinator.Query(q, result)
+	if err != nil {
+		log.Printf("COORDINACIÓN - error en la consulta %q de user_id=%s, se responde con el estado local: %v", q.Kind, q.UserID, err)
+		return false
+	}
+	return remote
+}
+
+// gatherAll reúne el resultado de q en todas las instancias y los agrega con each. Sin
+// coordinación, o si la difusión falla, devuelve false y hay que usar solo el estado local.
+func gatherAll(q ownerQuery, each func(result json.RawMessage) error) bool {
+	if coordinator == nil {
+		return false
+	}
+	results, err := coordinator.Gather(q)
+	if err != nil {
+		log.Printf("COORDINACIÓN - error difundiendo la consulta %q, se responde con el estado local: %v", q.Kind, err)
+		return false
+	}
+	for _, result := range results {
+		if err := each(result); err != nil {
+			log.Printf("COORDINACIÓN - resultado inválido de la consulta %q: %v", q.Kind, err)
+		}
+	}
+	return true
+}
+
+// refreshLoop renueva la propiedad de los usuarios con estado y libera el resto
+func (c *Coordinator) refreshLoop() {
+	ticker := time.NewTicker(c.ownerTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		users := make([]string, 0, len(c.owned))
+		for userID := range c.owned {
+			users = append(users, userID)
+		}
+		c.mu.Unlock()
+
+		for _, userID := range users {
+			if c.local.hasState(userID) {
+				if err := c.transport.RefreshOwner(userID, c.instanceID, c.ownerTTL); err != nil {
+					log.Printf("COORDINACIÓN - error renovando propiedad de user_id=%s: %v", userID, err)
+				}
+				continue
+			}
+			if err := c.transport.ReleaseOwner(userID, c.instanceID); err != nil {
+				log.Printf("COORDINACIÓN - error liberando propiedad de user_id=%s: %v", userID, err)
+				continue
+			}
+			c.mu.Lock()
+			delete(c.owned, userID)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// claimLocalUsers reclama los usuarios con estado recuperado del almacén al arrancar
+func (c *Coordinator) claimLocalUsers() {
+	users := make(map[string]bool)
+	for _, session := range sessionStore.ListSessions() {
+		users[session.UserID] = true
+	}
+	for _, timer := range sessionStore.ListTimers() {
+		users[timer.UserID] = true
+	}
+	for _, private := range sessionStore.ListPrivateSessions() {
+		users[private.UserID] = true
+	}
+	for userID := range users {
+		owner, err := c.transport.ClaimOwner(userID, c.instanceID, c.ownerTTL)
+		if err != nil || owner != c.instanceID {
+			log.Printf("COORDINACIÓN - user_id=%s recuperado pero pertenece a %q (err=%v)", userID, owner, err)
+			continue
+		}
+		c.markOwned(userID)
+	}
+}
+
+// Close detiene la renovación y libera los usuarios propios
+func (c *Coordinator) Close() error {
+	close(c.stop)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for userID := range c.owned {
+		c.transport.ReleaseOwner(userID, c.instanceID)
+	}
+	return c.transport.Close()
+}
+
+// newCoordinatorFromEnv configura la coordinación según COORDINATOR_TRANSPORT ("memory" o "redis").
+// Sin configurar, el servicio funciona como instancia única.
+func newCoordinatorFromEnv() *Coordinator {
+	kind := os.Getenv("COORDINATOR_TRANSPORT")
+	if kind == "" {
+		return nil
+	}
+
+	instanceID := os.Getenv("INSTANCE_ID")
+	if instanceID == "" {
+		hostname, _ := os.Hostname()
+		instanceID = hostname + "-" + strconv.Itoa(os.Getpid())
+	}
+	ttl := time.Duration(envInt("OWNER_TTL_SECONDS", 30)) * time.Second
+
+	var transport Transport
+	switch kind {
+	case "memory":
+		transport = NewMemoryTransport()
+	case "redis":
+		addr := os.Getenv("REDIS_ADDR")
+		if addr == "" {
+			addr = "localhost:6379"
+		}
+		redis, err := NewRedisTransport(addr)
+		if err != nil {
+			log.Printf("Advertencia: %v; el servicio funcionará como instancia única", err)
+			return nil
+		}
+		transport = redis
+	default:
+		log.Printf("COORDINATOR_TRANSPORT desconocido: %s; el servicio funcionará como instancia única", kind)
+		return nil
+	}
+
+	c, err := NewCoordinator(instanceID, transport, ttl)
+	if err != nil {
+		log.Printf("Advertencia: no se pudo iniciar la coordinación: %v", err)
+		transport.Close()
+		return nil
+	}
+	log.Printf("Coordinación entre instancias activa: instancia=%s, transporte=%s", instanceID, kind)
+	return c
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testInstance es un coordinador con su estado local simulado, para levantar varias
+// instancias sobre el mismo memoryTransport
+type testInstance struct {
+	*Coordinator
+	mu        sync.Mutex
+	delivered []string // "userID/deviceID:type"
+	stateful  map[string]bool
+	crashed   bool
+	sse       map[string][]string // Comandos recibidos por conexión SSE abierta en la instancia
+}
+
+func newTestInstance(t *testing.T, id string, transport Transport, ttl time.Duration) *testInstance {
+	t.Helper()
+	instance := &testInstance{stateful: make(map[string]bool), sse: make(map[string][]string)}
+	local := coordinatorLocal{
+		handle: func(cmd Command) StreamResponse {
+			instance.mu.Lock()
+			instance.stateful[cmd.UserID] = true
+			instance.mu.Unlock()
+			return StreamResponse{Type: "status", Message: id}
+		},
+		deliver: func(userID, deviceID string, msg StreamResponse) {
+			instance.mu.Lock()
+			instance.delivered = append(instance.delivered, userID+"/"+deviceID+":"+msg.Type)
+			instance.mu.Unlock()
+		},
+		presence: func(p *Presence, event string) {},
+		answer: func(q ownerQuery) (interface{}, error) {
+			return map[string]string{"instance": id, "kind": q.Kind}, nil
+		},
+		hasState: func(userID string) bool {
+			instance.mu.Lock()
+			defer instance.mu.Unlock()
+			return instance.stateful[userID]
+		},
+		sseCommand: func(connectionID string, request StreamRequest) bool {
+			instance.mu.Lock()
+			defer instance.mu.Unlock()
+			commands, open := instance.sse[connectionID]
+			if open {
+				instance.sse[connectionID] = append(commands, request.Type)
+			}
+			return open
+		},
+	}
+	c, err := newCoordinator(id, transport, ttl, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance.Coordinator = c
+	t.Cleanup(func() {
+		if !instance.crashed {
+			c.Close()
+		}
+	})
+	return instance
+}
+
+// crash detiene la renovación sin liberar nada, como si la instancia hubiera caído
+func (i *testInstance) crash() {
+	i.crashed = true
+	close(i.stop)
+}
+
+// forget simula que la instancia ya no tiene estado del usuario
+func (i *testInstance) forget(userID string) {
+	i.mu.Lock()
+	delete(i.stateful, userID)
+	i.mu.Unlock()
+}
+
+func (i *testInstance) deliveries() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string(nil), i.delivered...)
+}
+
+// waitFor repite check hasta que se cumple o pasa un segundo
+func waitFor(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no se cumplió a tiempo: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCoordinatorOwnershipHandoff(t *testing.T) {
+	const ttl = 90 * time.Millisecond
+	cmd := Command{UserID: "ana", DeviceID: "web", Request: StreamRequest{Type: "pause"}}
+
+	tests := []struct {
+		name string
+		// leave hace que la instancia a deje de ser propietaria de "ana"
+		leave func(a *testInstance)
+	}{
+		{
+			name:  "la propiedad se libera cuando no queda estado",
+			leave: func(a *testInstance) { a.forget("ana") },
+		},
+		{
+			name:  "la propiedad expira si la instancia deja de renovarla",
+			leave: func(a *testInstance) { a.crash() },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewMemoryTransport()
+			a := newTestInstance(t, "a", transport, ttl)
+			b := newTestInstance(t, "b", transport, ttl)
+
+			if got := a.Execute(cmd).Message; got != "a" {
+				t.Fatalf("el primer comando lo atendió %q, se esperaba a", got)
+			}
+			if got := b.Execute(cmd).Message; got != "a" {
+				t.Fatalf("b debía reenviar el comando al propietario, lo atendió %q", got)
+			}
+			// La renovación mantiene la propiedad más allá del TTL mientras haya estado
+			time.Sleep(2 * ttl)
+			if owner, _ := transport.Owner("ana"); owner != "a" {
+				t.Fatalf("propietario = %q tras renovar, se esperaba a", owner)
+			}
+
+			tt.leave(a)
+			waitFor(t, "que a pierda la propiedad", func() bool {
+				owner, _ := transport.Owner("ana")
+				return owner != "a"
+			})
+			if got := b.Execute(cmd).Message; got != "b" {
+				t.Errorf("tras el traspaso el comando lo atendió %q, se esperaba b", got)
+			}
+			if got := a.Execute(cmd).Message; got != "b" {
+				t.Errorf("a debía reenviar al nuevo propietario, lo atendió %q", got)
+			}
+		})
+	}
+}
+
+func TestCoordinatorPublishDevice(t *testing.T) {
+	transport := NewMemoryTransport()
+	a := newTestInstance(t, "a", transport, time.Minute)
+	b := newTestInstance(t, "b", transport, time.Minute)
+
+	tests := []struct {
+		userID, deviceID string
+		want             string
+	}{
+		{"ana", "web", "ana/web:stream_preempted"},
+		{"ana", "", "ana/:stream_preempted"},
+	}
+	for _, tt := range tests {
+		if err := a.PublishDevice(tt.userID, tt.deviceID, StreamResponse{Type: "stream_preempted"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{tests[0].want, tests[1].want}
+	for _, instance := range []*testInstance{a, b} {
+		waitFor(t, "la entrega en "+instance.instanceID, func() bool { return len(instance.deliveries()) == len(want) })
+		got := instance.deliveries()
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s entregó %v, se esperaba %v", instance.instanceID, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestCoordinatorQuery(t *testing.T) {
+	transport := NewMemoryTransport()
+	a := newTestInstance(t, "a", transport, time.Minute)
+	b := newTestInstance(t, "b", transport, time.Minute)
+	a.Execute(Command{UserID: "ana", Request: StreamRequest{Type: "pause"}})
+
+	tests := []struct {
+		name       string
+		from       *testInstance
+		userID     string
+		wantRemote bool
+		wantFrom   string
+	}{
+		{"desde otra instancia la responde el propietario", b, "ana", true, "a"},
+		{"en el propietario se usa el estado local", a, "ana", false, ""},
+		{"sin propietario se usa el estado local", b, "bruno", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]string
+			remote, err := tt.from.Query(ownerQuery{Kind: queryPresence, UserID: tt.userID}, &result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remote != tt.wantRemote || result["instance"] != tt.wantFrom {
+				t.Errorf("Query = (%v, %v), se esperaba remota=%v desde %q", remote, result, tt.wantRemote, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestCoordinatorGather(t *testing.T) {
+	transport := NewMemoryTransport()
+	a := newTestInstance(t, "a", transport, time.Minute)
+	newTestInstance(t, "b", transport, time.Minute)
+	newTestInstance(t, "c", transport, time.Minute)
+
+	results, err := a.Gather(ownerQuery{Kind: queryHistory, UserID: "ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instances []string
+	for _, raw := range results {
+		var result map[string]string
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, result["instance"])
+	}
+	sort.Strings(instances)
+	if len(instances) != 3 || instances[0] != "a" || instances[1] != "b" || instances[2] != "c" {
+		t.Errorf("respondieron %v, se esperaban las tres instancias", instances)
+	}
+}
+
+func TestCoordinatorForwardSSECommand(t *testing.T) {
+	transport := NewMemoryTransport()
+	a := newTestInstance(t, "a", transport, time.Minute)
+	b := newTestInstance(t, "b", transport, time.Minute)
+	b.sse["conexion-b"] = nil
+
+	tests := []struct {
+		name         string
+		connectionID string
+		want         bool
+	}{
+		{"la conexión está en otra instancia", "conexion-b", true},
+		{"ninguna instancia tiene la conexión", "conexion-x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := a.ForwardSSECommand(tt.connectionID, StreamRequest{Type: "pause"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.want {
+				t.Errorf("ForwardSSECommand(%q) = %v, se esperaba %v", tt.connectionID, found, tt.want)
+			}
+		})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if got := b.sse["conexion-b"]; len(got) != 1 || got[0] != "pause" {
+		t.Errorf("la instancia b recibió %v, se esperaba [pause]", got)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// followingCacheTTL es cuánto se reutiliza la lista de seguidos de un usuario
+const followingCacheTTL = time.Minute
+
+// followingEntry es la lista de usuarios que sigue alguien, tal como se leyó
+type followingEntry struct {
+	ids       map[string]bool
+	expiresAt time.Time
+}
+
+// followGraph consulta a quién sigue cada usuario en el servicio configurado en
+// FOLLOWING_API_URL: GET {url}/users/{id}/following responde {"user_ids": [...]}
+type followGraph struct {
+	baseURL string
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]followingEntry
+}
+
+var follows = newFollowGraphFromEnv()
+
+func newFollowGraphFromEnv() *followGraph {
+	return &followGraph{
+		baseURL: strings.TrimRight(os.Getenv("FOLLOWING_API_URL"), "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+		cache:   make(map[string]followingEntry),
+	}
+}
+
+// canSee indica si viewer puede consultar la actividad de userID: la suya siempre y la de
+// quienes sigue. Sin FOLLOWING_API_URL, o si el servicio falla, solo la suya.
+func (g *followGraph) canSee(viewer, userID string) bool {
+	if viewer == userID {
+		return true
+	}
+	if g.baseURL == "" {
+		return false
+	}
+	following, err := g.following(viewer)
+	if err != nil {
+		log.Printf("Error consultando a quién sigue %s: %v", viewer, err)
+		return false
+	}
+	return following[userID]
+}
+
+// following devuelve los usuarios que sigue viewer, de la caché si sigue vigente
+func (g *followGraph) following(viewer string) (map[string]bool, error) {
+	now := time.Now()
+	g.mu.Lock()
+	entry, ok := g.cache[viewer]
+	g.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.ids, nil
+	}
+
+	resp, err := g.client.Get(g.baseURL + "/users/" + url.PathEscape(viewer) + "/following")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var body struct {
+		UserIDs []string `json:"user_ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(body.UserIDs))
+	for _, id := range body.UserIDs {
+		ids[id] = true
+	}
+	g.mu.Lock()
+	g.cache[viewer] = followingEntry{ids: ids, expiresAt: now.Add(followingCacheTTL)}
+	g.mu.Unlock()
+	return ids, nil
+}
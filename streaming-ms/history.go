@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// resumeTailSeconds: si quedaban menos segundos que esto, la canción se considera terminada
+const resumeTailSeconds = 30
+
+// HistoryEntry es una sesión de reproducción terminada
+type HistoryEntry struct {
+	UserID         string    `json:"user_id"`
+	SongID         string    `json:"song_id"`
+	SongTitle      string    `json:"song_title,omitempty"`
+	Context        string    `json:"context,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	EndedAt        time.Time `json:"ended_at"`
+	DurationPlayed int       `json:"duration_played"` // Segundos escuchados
+	LastPosition   int       `json:"last_position"`   // Segundo de la canción en el que se detuvo
+	SongDuration   int       `json:"song_duration,omitempty"`
+	ResumePosition *int      `json:"resume_position,omitempty"` // Solo para canciones largas sin terminar
+}
+
+// envInt lee una variable de entorno entera positiva con valor por defecto
+func envInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("%s inválido: %s, usando valor por defecto %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// historyMaxEntries es la cantidad de sesiones que se conservan por usuario (HISTORY_MAX_ENTRIES)
+func historyMaxEntries() int {
+	return envInt("HISTORY_MAX_ENTRIES", 50)
+}
+
+// resumeMinTrackSeconds es la duración a partir de la cual se ofrece continuar (RESUME_MIN_TRACK_SECONDS)
+func resumeMinTrackSeconds() int {
+	return envInt("RESUME_MIN_TRACK_SECONDS", 600)
+}
+
+// resumableAt devuelve la posición desde la que conviene continuar la entrada,
+// solo para pistas largas (podcasts, sesiones en vivo) que no se terminaron
+func (e *HistoryEntry) resumableAt() (int, bool) {
+	if e.SongDuration < resumeMinTrackSeconds() {
+		return 0, false
+	}
+	if e.LastPosition <= 0 || e.LastPosition >= e.SongDuration-resumeTailSeconds {
+		return 0, false
+	}
+	return e.LastPosition, true
+}
+
+// recordHistory guarda en el historial una sesión terminada
+func recordHistory(session *PlaybackSession, durationPlayed int) {
+	entry := &HistoryEntry{
+		UserID:         session.UserID,
+		SongID:         session.SongID,
+		SongTitle:      session.SongTitle,
+		Context:        session.Context,
+		StartedAt:      session.StartTime,
+		EndedAt:        time.Now(),
+		DurationPlayed: durationPlayed,
+		LastPosition:   session.currentPosition(time.Now()),
+		SongDuration:   session.SongDuration,
+	}
+	if err := sessionStore.AppendHistory(entry, historyMaxEntries()); err != nil {
+		log.Printf("Error guardando historial para user_id=%s: %v", session.UserID, err)
+	}
+}
+
+// resumePosition busca en el historial dónde se dejó una canción larga
+func resumePosition(userID, songID string) (int, bool) {
+	for _, entry := range sessionStore.ListHistory(userID, 0) {
+		if entry.SongID == songID {
+			return entry.resumableAt()
+		}
+	}
+	return 0, false
+}
+
+// recentHistory devuelve las últimas reproducciones del usuario. Con coordinación se reúne
+// el historial de todas las instancias: cada una guarda las sesiones que terminaron en ella.
+func recentHistory(userID string, limit int) []*HistoryEntry {
+	entries := []*HistoryEntry{}
+	gathered := gatherAll(ownerQuery{Kind: queryHistory, UserID: userID, Limit: limit}, func(result json.RawMessage) error {
+		var part []*HistoryEntry
+		if err := json.Unmarshal(result, &part); err != nil {
+			return err
+		}
+		entries = append(entries, part...)
+		return nil
+	})
+	if !gathered {
+		return sessionStore.ListHistory(userID, limit)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].EndedAt.After(entries[j].EndedAt)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// recentHandler atiende GET /users/{id}/recent?limit=N
+func recentHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit inválido"})
+			return
+		}
+		limit = parsed
+	}
+
+	entries := recentHistory(userID, limit)
+	for _, entry := range entries {
+		if position, ok := entry.resumableAt(); ok {
+			entry.ResumePosition = &position
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"items":   entries,
+	})
+}
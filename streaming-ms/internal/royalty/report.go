@@ -0,0 +1,221 @@
+package royalty
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// formatVersion cambia si cambia el cálculo; forma parte del run ID
+const formatVersion = "royalty-v1"
+
+// runID identifica la ejecución por sus parámetros y los eventos calificados (en orden
+// canónico): repetir la ejecución con los mismos datos da el mismo ID
+func runID(opts Options, eventKeys []string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%d\n%s\n",
+		formatVersion,
+		truncateDay(opts.From).Format("2006-01-02"),
+		truncateDay(opts.To).Format("2006-01-02"),
+		opts.MinSeconds,
+		opts.ArtistID)
+	for _, key := range eventKeys {
+		fmt.Fprintln(hash, key)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// Sign devuelve la firma HMAC-SHA256 (hex) del contenido
+func Sign(data, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReportCSV serializa el reporte como CSV con una fila por canción y día
+func ReportCSV(report *ArtistReport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	rows := [][]string{{
+		"run_id", "artist_id", "artist_name", "date", "album_id", "album_title",
+		"song_id", "song_title", "plays", "listened_seconds", "listeners",
+	}}
+	for _, row := range report.TrackDays {
+		rows = append(rows, []string{
+			report.RunID, report.ArtistID, report.ArtistName, row.Date, row.AlbumID, row.AlbumTitle,
+			row.SongID, row.SongTitle,
+			strconv.Itoa(row.Plays), strconv.Itoa(row.ListenedSeconds), strconv.Itoa(row.Listeners),
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReportJSON serializa el reporte completo (totales por álbum, canción y día)
+func ReportJSON(report *ArtistReport) ([]byte, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ManifestFile es un archivo generado con su hash y firma
+type ManifestFile struct {
+	Name      string `json:"name"`
+	ArtistID  string `json:"artist_id"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"` // HMAC-SHA256 del contenido
+}
+
+// Manifest describe una ejecución: parámetros, conteos y archivos firmados
+type Manifest struct {
+	RunID          string         `json:"run_id"`
+	Version        string         `json:"version"`
+	From           string         `json:"from"`
+	To             string         `json:"to"`
+	MinSeconds     int            `json:"min_seconds"`
+	ArtistID       string         `json:"artist_id,omitempty"`
+	EventsRead     int            `json:"events_read"`
+	Duplicates     int            `json:"duplicates"`
+	OutOfRange     int            `json:"out_of_range"`
+	NotQualified   int            `json:"not_qualified"`
+	QualifiedPlays int            `json:"qualified_plays"`
+	Files          []ManifestFile `json:"files"`
+}
+
+// manifestName es el nombre del manifiesto dentro del directorio de la ejecución
+const manifestName = "manifest.json"
+
+// WriteRun escribe los reportes en dir/<run_id>/ en los formatos pedidos ("csv", "json"),
+// cada uno con su firma en <archivo>.sig, y un manifiesto firmado. Devuelve el directorio.
+func WriteRun(dir string, result *Result, opts Options, formats []string, key []byte) (string, error) {
+	if len(key) == 0 {
+		return "", fmt.Errorf("se requiere una clave de firma")
+	}
+	runDir := filepath.Join(dir, result.RunID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		return "", err
+	}
+
+	manifest := Manifest{
+		RunID:          result.RunID,
+		Version:        formatVersion,
+		From:           truncateDay(opts.From).Format("2006-01-02"),
+		To:             truncateDay(opts.To).Format("2006-01-02"),
+		MinSeconds:     opts.MinSeconds,
+		ArtistID:       opts.ArtistID,
+		EventsRead:     result.EventsRead,
+		Duplicates:     result.Duplicates,
+		OutOfRange:     result.OutOfRange,
+		NotQualified:   result.NotQualified,
+		QualifiedPlays: result.QualifiedPlays,
+		Files:          []ManifestFile{},
+	}
+
+	for _, report := range result.Reports {
+		for _, format := range formats {
+			var data []byte
+			var err error
+			switch format {
+			case "csv":
+				data, err = ReportCSV(report)
+			case "json":
+				data, err = ReportJSON(report)
+			default:
+				return "", fmt.Errorf("formato desconocido: %s", format)
+			}
+			if err != nil {
+				return "", err
+			}
+
+			name := fmt.Sprintf("artist-%s.%s", safeFileName(report.ArtistID), format)
+			file, err := writeSigned(runDir, name, data, key)
+			if err != nil {
+				return "", err
+			}
+			file.ArtistID = report.ArtistID
+			manifest.Files = append(manifest.Files, file)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if _, err := writeSigned(runDir, manifestName, append(data, '\n'), key); err != nil {
+		return "", err
+	}
+	return runDir, nil
+}
+
+func writeSigned(dir, name string, data, key []byte) (ManifestFile, error) {
+	signature := Sign(data, key)
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		return ManifestFile{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".sig"), []byte(signature+"\n"), 0o644); err != nil {
+		return ManifestFile{}, err
+	}
+	sum := sha256.Sum256(data)
+	return ManifestFile{Name: name, SHA256: hex.EncodeToString(sum[:]), Signature: signature}, nil
+}
+
+// VerifyRun comprueba la firma del manifiesto y la de cada archivo que lista
+func VerifyRun(runDir string, key []byte) (*Manifest, error) {
+	data, err := verifyFile(runDir, manifestName, key)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s inválido: %v", manifestName, err)
+	}
+	for _, file := range manifest.Files {
+		content, err := verifyFile(runDir, file.Name, key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, fmt.Errorf("%s: el hash no coincide con el manifiesto", file.Name)
+		}
+	}
+	return &manifest, nil
+}
+
+func verifyFile(dir, name string, key []byte) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	signature, err := os.ReadFile(filepath.Join(dir, name+".sig"))
+	if err != nil {
+		return nil, err
+	}
+	expected := Sign(data, key)
+	if !hmac.Equal([]byte(strings.TrimSpace(string(signature))), []byte(expected)) {
+		return nil, fmt.Errorf("%s: firma inválida", name)
+	}
+	return data, nil
+}
+
+// safeFileName deja solo caracteres seguros para usar el ID del artista como nombre de archivo
+func safeFileName(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, id)
+}
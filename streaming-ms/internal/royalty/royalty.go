@@ -0,0 +1,371 @@
+// Package royalty agrega los eventos song_played (del stream de Kafka o del outbox de
+// streaming-ms) en reportes de reproducciones por artista para sellos y auditorías.
+package royalty
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnknownArtistID agrupa las reproducciones de eventos sin datos de artista
+const UnknownArtistID = "unknown"
+
+// Artist es un artista tal como viaja en el evento song_played
+type Artist struct {
+	ID   string `json:"Id"`
+	Name string `json:"Name,omitempty"`
+}
+
+// Event es un evento song_played. Los campos de catálogo (título, álbum, artistas) solo
+// vienen en los eventos que publica streaming-ms desde que existe el outbox.
+type Event struct {
+	Event          string   `json:"Event"`
+	UserID         string   `json:"User_Id"`
+	SongID         string   `json:"Song_Id"`
+	PlayedAt       string   `json:"Played_At"` // RFC3339
+	DurationPlayed *int     `json:"Duration_Played,omitempty"`
+	SongTitle      string   `json:"Song_Title,omitempty"`
+	AlbumID        string   `json:"Album_Id,omitempty"`
+	AlbumTitle     string   `json:"Album_Title,omitempty"`
+	Artists        []Artist `json:"Artists,omitempty"`
+
+	playedAt time.Time
+}
+
+// key identifica el evento para descartar duplicados (Kafka entrega al menos una vez
+// y el outbox puede contener los mismos eventos)
+func (e *Event) key() string {
+	duration := 0
+	if e.DurationPlayed != nil {
+		duration = *e.DurationPlayed
+	}
+	return fmt.Sprintf("%s|%s|%s|%d", e.UserID, e.SongID, e.playedAt.UTC().Format(time.RFC3339), duration)
+}
+
+// ReadEvents lee eventos en formato JSONL (uno por línea). Las líneas vacías se ignoran;
+// una línea inválida es un error para que la auditoría no pase por alto datos.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			return nil, fmt.Errorf("línea %d: %v", line, err)
+		}
+		if event.Event != "" && event.Event != "song_played" {
+			continue
+		}
+		playedAt, err := time.Parse(time.RFC3339, event.PlayedAt)
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: Played_At inválido: %v", line, err)
+		}
+		if event.SongID == "" {
+			return nil, fmt.Errorf("línea %d: Song_Id requerido", line)
+		}
+		event.playedAt = playedAt
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Options son los parámetros de una ejecución. Forman parte del run ID.
+type Options struct {
+	From       time.Time // Día inicial (UTC, inclusive)
+	To         time.Time // Día final (UTC, inclusive)
+	MinSeconds int       // Segundos escuchados para que una reproducción cuente
+	ArtistID   string    // Opcional: solo este artista
+}
+
+// Stats son los totales de un grupo de reproducciones calificadas
+type Stats struct {
+	Plays           int `json:"plays"`
+	ListenedSeconds int `json:"listened_seconds"`
+	Listeners       int `json:"listeners"` // Usuarios distintos
+}
+
+// TrackDay son las reproducciones de una canción en un día
+type TrackDay struct {
+	Date       string `json:"date"` // AAAA-MM-DD (UTC)
+	SongID     string `json:"song_id"`
+	SongTitle  string `json:"song_title,omitempty"`
+	AlbumID    string `json:"album_id,omitempty"`
+	AlbumTitle string `json:"album_title,omitempty"`
+	Stats
+}
+
+// TrackTotal son las reproducciones de una canción en todo el período
+type TrackTotal struct {
+	SongID     string `json:"song_id"`
+	SongTitle  string `json:"song_title,omitempty"`
+	AlbumID    string `json:"album_id,omitempty"`
+	AlbumTitle string `json:"album_title,omitempty"`
+	Stats
+}
+
+// AlbumTotal son las reproducciones de un álbum en todo el período
+type AlbumTotal struct {
+	AlbumID    string `json:"album_id"`
+	AlbumTitle string `json:"album_title,omitempty"`
+	Stats
+}
+
+// DayTotal son las reproducciones de todas las canciones del artista en un día
+type DayTotal struct {
+	Date string `json:"date"`
+	Stats
+}
+
+// ArtistReport es el reporte de un artista para el período
+type ArtistReport struct {
+	RunID      string       `json:"run_id"`
+	ArtistID   string       `json:"artist_id"`
+	ArtistName string       `json:"artist_name,omitempty"`
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	MinSeconds int          `json:"min_seconds"`
+	Totals     Stats        `json:"totals"`
+	Albums     []AlbumTotal `json:"albums"`
+	Tracks     []TrackTotal `json:"tracks"`
+	Days       []DayTotal   `json:"days"`
+	TrackDays  []TrackDay   `json:"track_days"`
+}
+
+// Result es el resultado de una ejecución
+type Result struct {
+	RunID          string
+	EventsRead     int
+	Duplicates     int
+	OutOfRange     int
+	NotQualified   int
+	QualifiedPlays int             // Con -artist, solo las de ese artista
+	Reports        []*ArtistReport // Ordenados por artist_id
+}
+
+// accumulator suma reproducciones y cuenta oyentes distintos
+type accumulator struct {
+	stats     Stats
+	listeners map[string]bool
+}
+
+func (a *accumulator) add(userID string, seconds int) {
+	if a.listeners == nil {
+		a.listeners = make(map[string]bool)
+	}
+	a.stats.Plays++
+	a.stats.ListenedSeconds += seconds
+	a.listeners[userID] = true
+	a.stats.Listeners = len(a.listeners)
+}
+
+// artistAccumulator junta los grupos de un artista
+type artistAccumulator struct {
+	name      string
+	totals    accumulator
+	albums    map[string]*accumulator
+	tracks    map[string]*accumulator
+	days      map[string]*accumulator
+	trackDays map[[2]string]*accumulator // {fecha, song_id}
+}
+
+// Aggregate filtra los eventos del período, descarta duplicados y reproducciones que no
+// califican y agrupa por artista, álbum, canción y día. El resultado no depende del orden
+// de los eventos: el mismo conjunto de eventos y opciones produce el mismo run ID y reportes.
+func Aggregate(events []Event, opts Options) *Result {
+	from := truncateDay(opts.From)
+	to := truncateDay(opts.To).AddDate(0, 0, 1)
+
+	result := &Result{EventsRead: len(events)}
+	unique := make(map[string]Event, len(events))
+	songs := make(map[string]Event) // Evento del que se toman los datos de catálogo de cada canción
+	var qualified []Event
+
+	for _, event := range events {
+		key := event.key()
+		if existing, seen := unique[key]; seen {
+			result.Duplicates++
+			// De dos copias se conserva la que trae datos de catálogo
+			if len(existing.Artists) == 0 && len(event.Artists) > 0 {
+				unique[key] = event
+			}
+			continue
+		}
+		unique[key] = event
+	}
+
+	for _, event := range unique {
+		if event.playedAt.Before(from) || !event.playedAt.Before(to) {
+			result.OutOfRange++
+			continue
+		}
+		if event.DurationPlayed == nil || *event.DurationPlayed < opts.MinSeconds {
+			result.NotQualified++
+			continue
+		}
+		qualified = append(qualified, event)
+	}
+
+	// Orden canónico para el run ID y para elegir los datos de catálogo de cada canción
+	sort.Slice(qualified, func(i, j int) bool { return qualified[i].key() < qualified[j].key() })
+	keys := make([]string, len(qualified))
+	for i, event := range qualified {
+		keys[i] = event.key()
+		// Se usan los datos del evento más reciente que los trae
+		known, exists := songs[event.SongID]
+		if !exists || (len(event.Artists) > 0 && (len(known.Artists) == 0 || event.playedAt.After(known.playedAt))) {
+			songs[event.SongID] = event
+		}
+	}
+	result.RunID = runID(opts, keys)
+
+	artists := make(map[string]*artistAccumulator)
+	for _, event := range qualified {
+		catalog := songs[event.SongID]
+		eventArtists := catalog.Artists
+		if len(eventArtists) == 0 {
+			eventArtists = []Artist{{ID: UnknownArtistID}}
+		}
+		day := event.playedAt.UTC().Format("2006-01-02")
+		seconds := *event.DurationPlayed
+
+		accumulated := false
+		for _, artist := range eventArtists {
+			if opts.ArtistID != "" && artist.ID != opts.ArtistID {
+				continue
+			}
+			accumulated = true
+			acc, exists := artists[artist.ID]
+			if !exists {
+				acc = &artistAccumulator{
+					albums:    make(map[string]*accumulator),
+					tracks:    make(map[string]*accumulator),
+					days:      make(map[string]*accumulator),
+					trackDays: make(map[[2]string]*accumulator),
+				}
+				artists[artist.ID] = acc
+			}
+			if acc.name == "" {
+				acc.name = artist.Name
+			}
+			acc.totals.add(event.UserID, seconds)
+			group(acc.albums, catalog.AlbumID).add(event.UserID, seconds)
+			group(acc.tracks, event.SongID).add(event.UserID, seconds)
+			group(acc.days, day).add(event.UserID, seconds)
+			trackDay, exists := acc.trackDays[[2]string{day, event.SongID}]
+			if !exists {
+				trackDay = &accumulator{}
+				acc.trackDays[[2]string{day, event.SongID}] = trackDay
+			}
+			trackDay.add(event.UserID, seconds)
+		}
+		if accumulated {
+			result.QualifiedPlays++
+		}
+	}
+
+	artistIDs := make([]string, 0, len(artists))
+	for artistID := range artists {
+		artistIDs = append(artistIDs, artistID)
+	}
+	sort.Strings(artistIDs)
+	for _, artistID := range artistIDs {
+		result.Reports = append(result.Reports, buildReport(result.RunID, artistID, artists[artistID], songs, opts))
+	}
+	return result
+}
+
+func group(groups map[string]*accumulator, key string) *accumulator {
+	acc, exists := groups[key]
+	if !exists {
+		acc = &accumulator{}
+		groups[key] = acc
+	}
+	return acc
+}
+
+func buildReport(runID, artistID string, acc *artistAccumulator, songs map[string]Event, opts Options) *ArtistReport {
+	report := &ArtistReport{
+		RunID:      runID,
+		ArtistID:   artistID,
+		ArtistName: acc.name,
+		From:       truncateDay(opts.From).Format("2006-01-02"),
+		To:         truncateDay(opts.To).Format("2006-01-02"),
+		MinSeconds: opts.MinSeconds,
+		Totals:     acc.totals.stats,
+	}
+
+	albumTitles := make(map[string]string)
+	for _, song := range songs {
+		if song.AlbumID != "" {
+			albumTitles[song.AlbumID] = song.AlbumTitle
+		}
+	}
+	for _, albumID := range sortedKeys(acc.albums) {
+		report.Albums = append(report.Albums, AlbumTotal{
+			AlbumID:    albumID,
+			AlbumTitle: albumTitles[albumID],
+			Stats:      acc.albums[albumID].stats,
+		})
+	}
+	for _, songID := range sortedKeys(acc.tracks) {
+		song := songs[songID]
+		report.Tracks = append(report.Tracks, TrackTotal{
+			SongID:     songID,
+			SongTitle:  song.SongTitle,
+			AlbumID:    song.AlbumID,
+			AlbumTitle: song.AlbumTitle,
+			Stats:      acc.tracks[songID].stats,
+		})
+	}
+	for _, day := range sortedKeys(acc.days) {
+		report.Days = append(report.Days, DayTotal{Date: day, Stats: acc.days[day].stats})
+	}
+
+	trackDayKeys := make([][2]string, 0, len(acc.trackDays))
+	for key := range acc.trackDays {
+		trackDayKeys = append(trackDayKeys, key)
+	}
+	sort.Slice(trackDayKeys, func(i, j int) bool {
+		if trackDayKeys[i][0] != trackDayKeys[j][0] {
+			return trackDayKeys[i][0] < trackDayKeys[j][0]
+		}
+		return trackDayKeys[i][1] < trackDayKeys[j][1]
+	})
+	for _, key := range trackDayKeys {
+		song := songs[key[1]]
+		report.TrackDays = append(report.TrackDays, TrackDay{
+			Date:       key[0],
+			SongID:     key[1],
+			SongTitle:  song.SongTitle,
+			AlbumID:    song.AlbumID,
+			AlbumTitle: song.AlbumTitle,
+			Stats:      acc.trackDays[key].stats,
+		})
+	}
+	return report
+}
+
+func sortedKeys(groups map[string]*accumulator) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,218 @@
+package royalty
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// event arma un evento ya leído (con playedAt) para las pruebas
+func event(userID, songID, playedAt string, seconds int, artists ...string) Event {
+	e := Event{Event: "song_played", UserID: userID, SongID: songID, PlayedAt: playedAt, DurationPlayed: &seconds}
+	for _, id := range artists {
+		e.Artists = append(e.Artists, Artist{ID: id, Name: "Nombre " + id})
+	}
+	e.playedAt, _ = time.Parse(time.RFC3339, playedAt)
+	return e
+}
+
+func TestAggregate(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	opts := Options{From: day, To: day, MinSeconds: 30}
+	withArtist := func(artistID string) Options {
+		o := opts
+		o.ArtistID = artistID
+		return o
+	}
+	noDuration := event("ana", "s1", "2024-05-01T10:00:00Z", 0, "a1")
+	noDuration.DurationPlayed = nil
+
+	tests := []struct {
+		name          string
+		events        []Event
+		opts          Options
+		wantDups      int
+		wantOut       int
+		wantNot       int
+		wantQualified int
+		wantPlays     map[string]int // Reproducciones por artista
+		wantListeners map[string]int
+	}{
+		{
+			name: "duplicados de Kafka y del outbox",
+			events: []Event{
+				event("ana", "s1", "2024-05-01T10:00:00Z", 60),
+				event("ana", "s1", "2024-05-01T10:00:00Z", 60, "a1"),
+				event("ana", "s1", "2024-05-01T10:00:00Z", 60, "a1"),
+			},
+			opts:          opts,
+			wantDups:      2,
+			wantQualified: 1,
+			wantPlays:     map[string]int{"a1": 1},
+			wantListeners: map[string]int{"a1": 1},
+		},
+		{
+			name: "fuera del período y sin calificar",
+			events: []Event{
+				event("ana", "s1", "2024-04-30T23:59:59Z", 60, "a1"),
+				event("ana", "s1", "2024-05-02T00:00:00Z", 60, "a1"),
+				event("ana", "s1", "2024-05-01T10:00:00Z", 29, "a1"),
+				noDuration,
+				event("ana", "s1", "2024-05-01T23:59:59Z", 30, "a1"),
+			},
+			opts:          opts,
+			wantOut:       2,
+			wantNot:       2,
+			wantQualified: 1,
+			wantPlays:     map[string]int{"a1": 1},
+			wantListeners: map[string]int{"a1": 1},
+		},
+		{
+			name: "varios artistas y oyentes distintos",
+			events: []Event{
+				event("ana", "s1", "2024-05-01T10:00:00Z", 60, "a1", "a2"),
+				event("ana", "s1", "2024-05-01T11:00:00Z", 60, "a1", "a2"),
+				event("bruno", "s2", "2024-05-01T12:00:00Z", 60, "a2"),
+			},
+			opts:          opts,
+			wantQualified: 3,
+			wantPlays:     map[string]int{"a1": 2, "a2": 3},
+			wantListeners: map[string]int{"a1": 1, "a2": 2},
+		},
+		{
+			name: "sin datos de artista",
+			events: []Event{
+				event("ana", "s9", "2024-05-01T10:00:00Z", 60),
+			},
+			opts:          opts,
+			wantQualified: 1,
+			wantPlays:     map[string]int{UnknownArtistID: 1},
+			wantListeners: map[string]int{UnknownArtistID: 1},
+		},
+		{
+			name: "filtro de artista: solo cuentan sus reproducciones",
+			events: []Event{
+				event("ana", "s1", "2024-05-01T10:00:00Z", 60, "a1", "a2"),
+				event("bruno", "s2", "2024-05-01T12:00:00Z", 60, "a2"),
+				event("carla", "s3", "2024-05-01T13:00:00Z", 60, "a3"),
+			},
+			opts:          withArtist("a1"),
+			wantQualified: 1,
+			wantPlays:     map[string]int{"a1": 1},
+			wantListeners: map[string]int{"a1": 1},
+		},
+		{
+			name: "filtro de artista sin reproducciones",
+			events: []Event{
+				event("ana", "s1", "2024-05-01T10:00:00Z", 60, "a1"),
+			},
+			opts:          withArtist("a9"),
+			wantQualified: 0,
+			wantPlays:     map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Aggregate(tt.events, tt.opts)
+			if result.EventsRead != len(tt.events) || result.Duplicates != tt.wantDups ||
+				result.OutOfRange != tt.wantOut || result.NotQualified != tt.wantNot ||
+				result.QualifiedPlays != tt.wantQualified {
+				t.Errorf("leídos=%d duplicados=%d fuera=%d sin calificar=%d calificadas=%d; se esperaba %d/%d/%d/%d/%d",
+					result.EventsRead, result.Duplicates, result.OutOfRange, result.NotQualified, result.QualifiedPlays,
+					len(tt.events), tt.wantDups, tt.wantOut, tt.wantNot, tt.wantQualified)
+			}
+			if len(result.Reports) != len(tt.wantPlays) {
+				t.Fatalf("%d reportes, se esperaban %d", len(result.Reports), len(tt.wantPlays))
+			}
+			for _, report := range result.Reports {
+				if report.Totals.Plays != tt.wantPlays[report.ArtistID] {
+					t.Errorf("%s: %d reproducciones, se esperaban %d", report.ArtistID, report.Totals.Plays, tt.wantPlays[report.ArtistID])
+				}
+				if report.Totals.Listeners != tt.wantListeners[report.ArtistID] {
+					t.Errorf("%s: %d oyentes, se esperaban %d", report.ArtistID, report.Totals.Listeners, tt.wantListeners[report.ArtistID])
+				}
+				if report.RunID != result.RunID {
+					t.Errorf("%s: run ID %s distinto del de la ejecución %s", report.ArtistID, report.RunID, result.RunID)
+				}
+			}
+		})
+	}
+}
+
+// El run ID y los reportes no dependen del orden ni de los duplicados de los eventos
+func TestAggregateIsDeterministic(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	opts := Options{From: day, To: day, MinSeconds: 30}
+	events := []Event{
+		event("ana", "s1", "2024-05-01T10:00:00Z", 60, "a1"),
+		event("bruno", "s2", "2024-05-01T11:00:00Z", 90, "a1", "a2"),
+		event("carla", "s1", "2024-05-01T12:00:00Z", 45, "a1"),
+	}
+	reversed := []Event{events[2], events[1], events[0], events[1]}
+
+	first, second := Aggregate(events, opts), Aggregate(reversed, opts)
+	if first.RunID != second.RunID {
+		t.Errorf("run ID %s != %s con los eventos en otro orden", first.RunID, second.RunID)
+	}
+	if len(first.Reports) != len(second.Reports) {
+		t.Fatalf("%d reportes != %d", len(first.Reports), len(second.Reports))
+	}
+	for i := range first.Reports {
+		a, b := first.Reports[i], second.Reports[i]
+		if a.ArtistID != b.ArtistID || a.Totals != b.Totals || len(a.TrackDays) != len(b.TrackDays) {
+			t.Errorf("reporte %d distinto: %+v != %+v", i, a, b)
+		}
+	}
+
+	opts.MinSeconds = 60
+	if Aggregate(events, opts).RunID == first.RunID {
+		t.Error("el run ID debe cambiar con las opciones")
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr string
+	}{
+		{
+			name:  "ignora líneas vacías y otros eventos",
+			input: `{"Event":"song_played","User_Id":"ana","Song_Id":"s1","Played_At":"2024-05-01T10:00:00Z","Duration_Played":60}` + "\n\n" + `{"Event":"song_liked","Song_Id":"s1","Played_At":"2024-05-01T10:00:00Z"}` + "\n",
+			want:  1,
+		},
+		{
+			name:    "JSON inválido",
+			input:   `{"Event":"song_played"` + "\n",
+			wantErr: "línea 1",
+		},
+		{
+			name:    "fecha inválida",
+			input:   "\n" + `{"Event":"song_played","Song_Id":"s1","Played_At":"ayer"}`,
+			wantErr: "línea 2: Played_At inválido",
+		},
+		{
+			name:    "sin canción",
+			input:   `{"Event":"song_played","Played_At":"2024-05-01T10:00:00Z"}`,
+			wantErr: "Song_Id requerido",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ReadEvents(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, se esperaba %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != tt.want {
+				t.Errorf("%d eventos, se esperaban %d", len(events), tt.want)
+			}
+		})
+	}
+}
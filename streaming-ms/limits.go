@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultDeviceID se usa cuando el cliente no envía device_id (un único dispositivo por usuario)
+const defaultDeviceID = "default"
+
+var (
+	// streamLimits es el máximo de dispositivos reproduciendo a la vez por plan
+	streamLimits = map[string]int{"free": 1, "premium": 3, "family": 6}
+	// defaultStreamLimit se aplica a planes desconocidos o conexiones sin token
+	defaultStreamLimit = 1
+)
+
+// loadStreamLimits lee STREAM_LIMITS ("free=1,premium=3,family=6") y DEFAULT_STREAM_LIMIT.
+// Un límite 0 significa sin límite.
+func loadStreamLimits() {
+	if value := os.Getenv("STREAM_LIMITS"); value != "" {
+		limits := make(map[string]int)
+		for _, pair := range strings.Split(value, ",") {
+			plan, rawLimit, found := strings.Cut(strings.TrimSpace(pair), "=")
+			limit, err := strconv.Atoi(strings.TrimSpace(rawLimit))
+			if !found || err != nil || limit < 0 {
+				log.Printf("STREAM_LIMITS: entrada inválida %q, se ignora", pair)
+				continue
+			}
+			limits[strings.ToLower(strings.TrimSpace(plan))] = limit
+		}
+		streamLimits = limits
+	}
+	if value := os.Getenv("DEFAULT_STREAM_LIMIT"); value != "" {
+		if limit, err := strconv.Atoi(value); err == nil && limit >= 0 {
+			defaultStreamLimit = limit
+		} else {
+			log.Printf("DEFAULT_STREAM_LIMIT inválido: %s, usando valor por defecto %d", value, defaultStreamLimit)
+		}
+	}
+	log.Printf("Límites de reproducción simultánea: %v (por defecto %d)", streamLimits, defaultStreamLimit)
+}
+
+// streamLimitFor devuelve el límite de dispositivos simultáneos del plan
+func streamLimitFor(plan string) int {
+	if limit, exists := streamLimits[plan]; exists {
+		return limit
+	}
+	return defaultStreamLimit
+}
+
+// messageWriter es el destino de los mensajes de un cliente (*wsConn o un stream SSE),
+// que los codifica según su protocolo
+type messageWriter interface {
+	WriteMessage(v interface{}) error
+}
+
+// streamClient es una conexión de reproducción de un dispositivo (WebSocket o SSE)
+type streamClient struct {
+	id       string // Solo SSE: identifica la conexión en POST /sse/command
+	userID   string
+	deviceID string
+	plan     string
+	country  string // ISO 3166-1 alfa-2; vacío si no se conoce
+	conn     messageWriter
+	writeMu  sync.Mutex
+}
+
+// send serializa las escrituras: otras conexiones pueden escribir en esta (p. ej. al desplazarla)
+func (c *streamClient) send(msg StreamResponse) error {
+	// Los comandos sin respuesta (telemetría) devuelven un mensaje sin tipo
+	if msg.Type == "" {
+		return nil
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(msg)
+}
+
+// clientHub mantiene las conexiones de reproducción abiertas por usuario
+type clientHub struct {
+	mu      sync.RWMutex
+	clients map[string]map[*streamClient]struct{}
+	byID    map[string]*streamClient
+}
+
+var clients = &clientHub{
+	clients: make(map[string]map[*streamClient]struct{}),
+	byID:    make(map[string]*streamClient),
+}
+
+func (h *clientHub) add(client *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[client.userID] == nil {
+		h.clients[client.userID] = make(map[*streamClient]struct{})
+	}
+	h.clients[client.userID][client] = struct{}{}
+	if client.id != "" {
+		h.byID[client.id] = client
+	}
+}
+
+func (h *clientHub) remove(client *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients[client.userID], client)
+	if len(h.clients[client.userID]) == 0 {
+		delete(h.clients, client.userID)
+	}
+	if client.id != "" {
+		delete(h.byID, client.id)
+	}
+}
+
+// get busca una conexión SSE por su identificador
+func (h *clientHub) get(id string) (*streamClient, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	client, exists := h.byID[id]
+	return client, exists
+}
+
+// sendToDevice envía un mensaje a todas las conexiones de un dispositivo del usuario
+func (h *clientHub) sendToDevice(userID, deviceID string, msg StreamResponse) {
+	h.deliver(userID, deviceID, msg)
+}
+
+// broadcast envía un mensaje a todas las conexiones del usuario
+func (h *clientHub) broadcast(userID string, msg StreamResponse) {
+	h.deliver(userID, "", msg)
+}
+
+// deliver entrega el mensaje. Con coordinación entre instancias se difunde para que
+// cada instancia lo entregue a las conexiones que tenga abiertas.
+func (h *clientHub) deliver(userID, deviceID string, msg StreamResponse) {
+	if coordinator != nil {
+		err := coordinator.PublishDevice(userID, deviceID, msg)
+		if err == nil {
+			return
+		}
+		log.Printf("Error difundiendo mensaje para user_id=%s, se entrega solo localmente: %v", userID, err)
+	}
+	h.deliverLocal(userID, deviceID, msg)
+}
+
+// deliverLocal escribe en las conexiones de esta instancia (deviceID vacío: todos los dispositivos)
+func (h *clientHub) deliverLocal(userID, deviceID string, msg StreamResponse) {
+	h.mu.RLock()
+	var targets []*streamClient
+	for client := range h.clients[userID] {
+		if deviceID == "" || client.deviceID == deviceID {
+			targets = append(targets, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range targets {
+		if err := client.send(msg); err != nil {
+			log.Printf("Error enviando mensaje a user_id=%s, device_id=%s: %v", userID, client.deviceID, err)
+		}
+	}
+}
+
+// countDevices cuenta las conexiones abiertas en esta instancia por sessionKey, de userID o
+// de todos los usuarios si es ""
+func (h *clientHub) countDevices(userID string) map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := make(map[string]int)
+	for id, userClients := range h.clients {
+		if userID != "" && id != userID {
+			continue
+		}
+		for client := range userClients {
+			counts[sessionKey(client.userID, client.deviceID)]++
+		}
+	}
+	return counts
+}
+
+// enforceStreamLimit pausa los streams más antiguos del usuario cuando deviceID empieza
+// a reproducir y el usuario supera el límite de su plan
+func enforceStreamLimit(userID, deviceID, plan string) {
+	limit := streamLimitFor(plan)
+	if limit <= 0 {
+		return
+	}
+
+	sessionsMu.Lock()
+	preempted := preemptedSessions(sessionStore.ListUserSessions(userID), deviceID, limit)
+	sessionsMu.Unlock()
+
+	for _, session := range preempted {
+		log.Printf("LÍMITE DE DISPOSITIVOS - user_id=%s, plan=%q, límite=%d: pausando device_id=%s",
+			userID, plan, limit, session.DeviceID)
+		if err := pausePlaybackSession(userID, session.DeviceID); err != nil {
+			log.Printf("Error pausando dispositivo desplazado: %v", err)
+		}
+		clients.sendToDevice(userID, session.DeviceID, StreamResponse{
+			Type:     "stream_preempted",
+			Message:  fmt.Sprintf("Reproducción pausada: se alcanzó el límite de dispositivos reproduciendo a la vez de tu plan (%d)", limit),
+			DeviceID: deviceID,
+		})
+	}
+}
+
+// preemptedSessions elige qué dispositivos pausar para que, contando deviceID, no haya más
+// de limit reproduciendo. Se pausan los streams que empezaron antes (StartTime: inicio de la
+// canción en curso, no la última reanudación), así el que acaba de empezar nunca se pausa.
+func preemptedSessions(sessions []*PlaybackSession, deviceID string, limit int) []*PlaybackSession {
+	var others []*PlaybackSession
+	for _, session := range sessions {
+		if session.IsPlaying && session.DeviceID != deviceID {
+			others = append(others, session)
+		}
+	}
+
+	excess := len(others) + 1 - limit
+	if excess <= 0 {
+		return nil
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if !others[i].StartTime.Equal(others[j].StartTime) {
+			return others[i].StartTime.Before(others[j].StartTime)
+		}
+		return others[i].DeviceID < others[j].DeviceID
+	})
+	return others[:excess]
+}
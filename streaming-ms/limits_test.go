@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPreemptedSessions(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name     string
+		sessions []*PlaybackSession
+		deviceID string
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "dentro del límite",
+			sessions: []*PlaybackSession{{DeviceID: "web", IsPlaying: true, StartTime: at(0)}},
+			deviceID: "movil",
+			limit:    2,
+			want:     nil,
+		},
+		{
+			name: "se pausa el stream que empezó antes aunque se reanudara después",
+			sessions: []*PlaybackSession{
+				{DeviceID: "web", IsPlaying: true, StartTime: at(0), LastPlayTime: at(30)},
+				{DeviceID: "tv", IsPlaying: true, StartTime: at(10), LastPlayTime: at(10)},
+			},
+			deviceID: "movil",
+			limit:    2,
+			want:     []string{"web"},
+		},
+		{
+			name: "los pausados no cuentan",
+			sessions: []*PlaybackSession{
+				{DeviceID: "web", IsPlaying: false, StartTime: at(0)},
+				{DeviceID: "tv", IsPlaying: true, StartTime: at(10)},
+			},
+			deviceID: "movil",
+			limit:    2,
+			want:     nil,
+		},
+		{
+			name: "el dispositivo que empieza no se cuenta dos veces",
+			sessions: []*PlaybackSession{
+				{DeviceID: "movil", IsPlaying: true, StartTime: at(0)},
+				{DeviceID: "tv", IsPlaying: true, StartTime: at(10)},
+			},
+			deviceID: "movil",
+			limit:    1,
+			want:     []string{"tv"},
+		},
+		{
+			name: "varios de exceso, del más antiguo al más reciente",
+			sessions: []*PlaybackSession{
+				{DeviceID: "c", IsPlaying: true, StartTime: at(20)},
+				{DeviceID: "a", IsPlaying: true, StartTime: at(0)},
+				{DeviceID: "b", IsPlaying: true, StartTime: at(0)},
+			},
+			deviceID: "movil",
+			limit:    1,
+			want:     []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, session := range preemptedSessions(tt.sessions, tt.deviceID, tt.limit) {
+				got = append(got, session.DeviceID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("preemptedSessions = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// LyricLine es una línea de letra sincronizada según music-ms
+type LyricLine struct {
+	TimeMs int    `json:"time_ms"`
+	Text   string `json:"text"`
+}
+
+// LyricPush es el contenido de un mensaje "lyric_line"
+type LyricPush struct {
+	SongID   string `json:"song_id"`
+	Index    int    `json:"index"`
+	TimeMs   int    `json:"time_ms"`
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+}
+
+// lyricFollower sigue la posición de la sesión de un dispositivo y envía la línea
+// de letra vigente cada vez que cambia
+type lyricFollower struct {
+	songID    string
+	language  string
+	lines     []LyricLine
+	lastIndex int
+	timer     *time.Timer
+
+	// Reloj propio en ms: la sesión guarda la posición en segundos enteros y al pausar
+	// se trunca, lo que haría retroceder la letra
+	clockMs      int
+	clockAt      time.Time
+	clockPlaying bool
+}
+
+var (
+	// lyricFollowers por sessionKey(userID, deviceID); solo en la instancia que atendió el play
+	lyricFollowers = make(map[string]*lyricFollower)
+	lyricsMu       sync.Mutex
+)
+
+// startLyrics descarga en segundo plano la letra sincronizada de la canción y empieza a
+// enviarla al dispositivo. Sin letra sincronizada no hace nada.
+func startLyrics(userID, deviceID, songID string) {
+	key := sessionKey(userID, deviceID)
+	lyricsMu.Lock()
+	if follower, exists := lyricFollowers[key]; exists {
+		follower.stop()
+		delete(lyricFollowers, key)
+	}
+	lyricsMu.Unlock()
+
+	go func() {
+		language, lines, err := getLyricsFromMusicMS(songID)
+		if err != nil {
+			log.Printf("Error obteniendo letra de song_id=%s: %v", songID, err)
+			return
+		}
+		if len(lines) == 0 {
+			return
+		}
+
+		lyricsMu.Lock()
+		// Si mientras tanto el dispositivo cambió de canción, la letra ya no sirve
+		sessionsMu.Lock()
+		session, exists := sessionStore.GetSession(userID, deviceID)
+		sessionsMu.Unlock()
+		if !exists || session.SongID != songID {
+			lyricsMu.Unlock()
+			return
+		}
+		if previous, exists := lyricFollowers[key]; exists {
+			previous.stop()
+		}
+		lyricFollowers[key] = &lyricFollower{songID: songID, language: language, lines: lines, lastIndex: -1}
+		lyricsMu.Unlock()
+		refreshLyrics(userID, deviceID)
+	}()
+}
+
+// refreshLyrics envía la línea que corresponde a la posición actual y programa la siguiente.
+// Se llama cuando cambia la reproducción (play, pausa, reanudar, seek, stop).
+func refreshLyrics(userID, deviceID string) {
+	key := sessionKey(userID, deviceID)
+	lyricsMu.Lock()
+	follower, exists := lyricFollowers[key]
+	if !exists {
+		lyricsMu.Unlock()
+		return
+	}
+	follower.stop()
+
+	sessionsMu.Lock()
+	session, hasSession := sessionStore.GetSession(userID, deviceID)
+	sessionsMu.Unlock()
+	if !hasSession || session.SongID != follower.songID {
+		delete(lyricFollowers, key)
+		lyricsMu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	positionMs := follower.position(session, now)
+	index := -1
+	for i, line := range follower.lines {
+		if line.TimeMs > positionMs {
+			break
+		}
+		index = i
+	}
+
+	// Tras un seek antes de la primera línea se envía index -1 para que el cliente la limpie
+	var push *LyricPush
+	if index != follower.lastIndex {
+		push = &LyricPush{SongID: follower.songID, Index: index, Language: follower.language}
+		if index >= 0 {
+			push.TimeMs, push.Text = follower.lines[index].TimeMs, follower.lines[index].Text
+		}
+	}
+	follower.lastIndex = index
+
+	if session.IsPlaying && index+1 < len(follower.lines) {
+		wait := time.Duration(follower.lines[index+1].TimeMs-positionMs) * time.Millisecond
+		follower.timer = time.AfterFunc(wait, func() { refreshLyrics(userID, deviceID) })
+	}
+	lyricsMu.Unlock()
+
+	if push != nil {
+		clients.sendToDevice(userID, deviceID, StreamResponse{
+			Type:    "lyric_line",
+			Message: push.Text,
+			Lyric:   push,
+		})
+	}
+}
+
+func (f *lyricFollower) stop() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+}
+
+// position usa el reloj propio salvo que la sesión difiera en un segundo o más (un seek)
+func (f *lyricFollower) position(session *PlaybackSession, now time.Time) int {
+	positionMs := positionMillis(session, now)
+	if !f.clockAt.IsZero() {
+		own := f.clockMs
+		if f.clockPlaying {
+			own += int(now.Sub(f.clockAt).Milliseconds())
+		}
+		if diff := own - positionMs; diff > -1000 && diff < 1000 {
+			positionMs = own
+		}
+	}
+	f.clockMs, f.clockAt, f.clockPlaying = positionMs, now, session.IsPlaying
+	return positionMs
+}
+
+// positionMillis es currentPosition con precisión de milisegundos, para que las líneas
+// lleguen a tiempo aunque la posición guardada esté en segundos
+func positionMillis(session *PlaybackSession, now time.Time) int {
+	position := session.Position * 1000
+	if session.IsPlaying {
+		position += int(now.Sub(session.LastPlayTime).Milliseconds())
+	}
+	if session.SongDuration > 0 && position > session.SongDuration*1000 {
+		position = session.SongDuration * 1000
+	}
+	return position
+}
+
+// getLyricsFromMusicMS obtiene la letra sincronizada de la canción; devuelve líneas vacías
+// si la canción no tiene letra o no está sincronizada
+func getLyricsFromMusicMS(songID string) (string, []LyricLine, error) {
+	apiGatewayURL := os.Getenv("API_GATEWAY_URL")
+	if apiGatewayURL == "" {
+		apiGatewayURL = "http://apigateway:8080"
+	}
+
+	query := `query GetSongLyrics($id: ID!) { song(id: $id) { lyrics { language synced lines { time_ms text } } } }`
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": map[string]interface{}{"id": songID},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	resp, err := http.Post(apiGatewayURL+"/api/v1/music/graphql", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("music-ms respondió con status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Song *struct {
+				Lyrics *struct {
+					Language string      `json:"language"`
+					Synced   bool        `json:"synced"`
+					Lines    []LyricLine `json:"lines"`
+				} `json:"lyrics"`
+			} `json:"song"`
+		} `json:"data"`
+		Errors []interface{} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", nil, err
+	}
+	if len(result.Errors) > 0 {
+		return "", nil, fmt.Errorf("la respuesta GraphQL contiene errores")
+	}
+	if result.Data.Song == nil || result.Data.Song.Lyrics == nil || !result.Data.Song.Lyrics.Synced {
+		return "", nil, nil
+	}
+	return result.Data.Song.Lyrics.Language, result.Data.Song.Lyrics.Lines, nil
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,41 +19,117 @@ import (
 )
 
 type Song struct {
-	ID       string `json:"id"`
-	Title    string `json:"title"`
-	AudioURL string `json:"audio_url"`
-	S3Key    string `json:"s3_key,omitempty"`    // Nueva: clave de S3
-	S3Bucket string `json:"s3_bucket,omitempty"` // Nueva: bucket de S3
+	ID       string        `json:"id"`
+	Title    string        `json:"title"`
+	AudioURL string        `json:"audio_url"`
+	Duration int           `json:"duration,omitempty"`  // Duración en segundos
+	S3Key    string        `json:"s3_key,omitempty"`    // Nueva: clave de S3
+	S3Bucket string        `json:"s3_bucket,omitempty"` // Nueva: bucket de S3
+	Storage  string        `json:"storage,omitempty"`   // Origen del audio para las métricas: "s3" o el host de la URL
+	Album    *SongAlbum    `json:"album,omitempty"`
+	Artists  []SongArtist  `json:"artists,omitempty"`
+	Loudness *SongLoudness `json:"loudness,omitempty"` // Ganancias para normalizar el volumen en el cliente
+}
+
+// SongLoudness son los valores de normalización de music-ms (nil si la pista no se analizó)
+type SongLoudness struct {
+	TrackGainDB    float64 `json:"track_gain_db"`
+	AlbumGainDB    float64 `json:"album_gain_db"`
+	PeakDBFS       float64 `json:"peak_dbfs"`
+	AlbumPeakDBFS  float64 `json:"album_peak_dbfs"`
+	IntegratedLUFS float64 `json:"integrated_lufs"`
+	ReferenceLUFS  float64 `json:"reference_lufs"`
+}
+
+// SongAlbum es el álbum de una canción según music-ms
+type SongAlbum struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// SongArtist es un artista de una canción según music-ms
+type SongArtist struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
 
 type StreamRequest struct {
-	Type   string `json:"type"` // "play", "pause", "stop", "resume"
-	SongID string `json:"songId"`
+	Type            string          `json:"type"` // "play", "pause", "stop", "resume", "seek", "private_session", "sleep_timer", "stop_after_song", "cancel_timer", "telemetry"
+	SongID          string          `json:"songId"`
+	Context         string          `json:"context,omitempty"`         // Origen de la reproducción, p. ej. "album:<id>"
+	Position        *int            `json:"position,omitempty"`        // Segundos; para "play" y "seek"
+	Resume          bool            `json:"resume,omitempty"`          // "play": continuar donde se dejó la canción
+	Enabled         *bool           `json:"enabled,omitempty"`         // Solo para "private_session"
+	DurationMinutes int             `json:"durationMinutes,omitempty"` // Para "private_session" y "sleep_timer"
+	Action          string          `json:"action,omitempty"`          // Temporizadores: "pause" o "stop" (por defecto)
+	Telemetry       *TelemetryEvent `json:"telemetry,omitempty"`
 }
 
 type StreamResponse struct {
-	Type    string `json:"type"` // "song_data", "error", "status"
-	Message string `json:"message"`
-	Song    *Song  `json:"song,omitempty"`
+	Type           string          `json:"type"` // "song_data", "error", "status", "stream_preempted", "timer", "timer_fired", "session_stopped", "session_paused", "lyric_line"
+	Message        string          `json:"message"`
+	Song           *Song           `json:"song,omitempty"`
+	Position       *int            `json:"position,omitempty"` // Segundos desde donde debe reproducir el cliente
+	PrivateSession *PrivateSession `json:"private_session,omitempty"`
+	DeviceID       string          `json:"device_id,omitempty"`     // "stream_preempted": dispositivo que empezó a reproducir
+	Timer          *PlaybackTimer  `json:"timer,omitempty"`         // Temporizador vigente del usuario
+	ConnectionID   string          `json:"connection_id,omitempty"` // "connected" (SSE): id para POST /sse/command
+	Code           string          `json:"code,omitempty"`          // "error": motivo legible por el cliente, p. ej. "not_available_in_region"
+	Lyric          *LyricPush      `json:"lyric,omitempty"`         // "lyric_line": línea de letra vigente
 }
 
-// PlaybackSession mantiene el estado de reproducción de un usuario
+// PlaybackSession mantiene el estado de reproducción de un usuario en un dispositivo
 type PlaybackSession struct {
-	UserID          string    `json:"user_id"`
-	SongID          string    `json:"song_id"`
-	StartTime       time.Time `json:"start_time"`       // Momento en que inició la sesión actual
-	AccumulatedTime int       `json:"accumulated_time"` // Segundos acumulados de sesiones anteriores (pausas)
-	IsPlaying       bool      `json:"is_playing"`
-	LastPlayTime    time.Time `json:"last_play_time"` // Último momento en que se inició reproducción
+	UserID          string       `json:"user_id"`
+	DeviceID        string       `json:"device_id"`
+	SongID          string       `json:"song_id"`
+	StartTime       time.Time    `json:"start_time"`       // Momento en que inició la sesión actual
+	AccumulatedTime int          `json:"accumulated_time"` // Segundos acumulados de sesiones anteriores (pausas)
+	IsPlaying       bool         `json:"is_playing"`
+	LastPlayTime    time.Time    `json:"last_play_time"` // Último momento en que se inició reproducción
+	SongTitle       string       `json:"song_title,omitempty"`
+	Private         bool         `json:"private"` // Reproducida en sesión privada: no se envía a Kafka
+	Context         string       `json:"context,omitempty"`
+	Position        int          `json:"position"`      // Posición (segundos) en LastPlayTime o al pausar
+	SongDuration    int          `json:"song_duration"` // Duración de la canción en segundos (0 si se desconoce)
+	Storage         string       `json:"storage,omitempty"`
+	AlbumID         string       `json:"album_id,omitempty"`
+	AlbumTitle      string       `json:"album_title,omitempty"`
+	Artists         []SongArtist `json:"artists,omitempty"` // Para atribuir la reproducción en los reportes de regalías
+	QoE             SessionQoE   `json:"qoe"`               // Telemetría del cliente para esta canción
+}
+
+// currentPosition calcula la posición actual dentro de la canción
+func (s *PlaybackSession) currentPosition(now time.Time) int {
+	position := s.Position
+	if s.IsPlaying {
+		position += int(now.Sub(s.LastPlayTime).Seconds())
+	}
+	if s.SongDuration > 0 && position > s.SongDuration {
+		position = s.SongDuration
+	}
+	return position
 }
 
 // SongPlayedEvent representa el evento que se envía a Kafka
 type SongPlayedEvent struct {
-	Event          string `json:"Event"`
-	UserID         string `json:"User_Id"`
-	SongID         string `json:"Song_Id"`
-	PlayedAt       string `json:"Played_At"` // RFC3339 timestamp string
-	DurationPlayed *int   `json:"Duration_Played,omitempty"`
+	Event          string      `json:"Event"`
+	UserID         string      `json:"User_Id"`
+	SongID         string      `json:"Song_Id"`
+	PlayedAt       string      `json:"Played_At"` // RFC3339 timestamp string
+	DurationPlayed *int        `json:"Duration_Played,omitempty"`
+	QoE            *QoESummary `json:"QoE,omitempty"` // Calidad de la reproducción informada por el cliente
+	// Datos de catálogo para los reportes de regalías (ver internal/royalty)
+	SongTitle  string        `json:"Song_Title,omitempty"`
+	AlbumID    string        `json:"Album_Id,omitempty"`
+	AlbumTitle string        `json:"Album_Title,omitempty"`
+	Artists    []EventArtist `json:"Artists,omitempty"`
+}
+
+// EventArtist es un artista dentro del evento song_played
+type EventArtist struct {
+	ID   string `json:"Id"`
+	Name string `json:"Name,omitempty"`
 }
 
 // S3Service maneja las operaciones con S3
@@ -116,10 +193,15 @@ func (s *S3Service) GeneratePresignedURL(ctx context.Context, key string) (strin
 var (
 	upgrader = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true }, // Configura para producción
+		// El cliente elige la codificación con Sec-WebSocket-Protocol; sin subprotocolo, JSON
+		Subprotocols:      []string{subprotocolMsgpack, subprotocolJSON},
+		EnableCompression: true, // permessage-deflate si el cliente lo ofrece
 	}
 	s3Service *S3Service
-	// userSessions mantiene las sesiones de reproducción activas por usuario
-	userSessions = make(map[string]*PlaybackSession)
+	// sessionStore mantiene las sesiones de reproducción activas por usuario y dispositivo
+	sessionStore SessionStore = NewMemorySessionStore()
+	// sessionsMu serializa las lecturas-modificaciones de sesiones entre conexiones
+	sessionsMu sync.Mutex
 )
 
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -131,47 +213,108 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// startPlaybackSession inicia una nueva sesión de reproducción o reanuda una pausada
-func startPlaybackSession(userID, songID string) {
-	session, exists := userSessions[userID]
+// startPlaybackSession inicia una nueva sesión de reproducción o reanuda una pausada.
+// position indica desde qué segundo reproduce el cliente (nil para mantener el actual)
+func startPlaybackSession(userID, deviceID string, song *Song, playContext string, position *int) {
+	songID := song.ID
+	private := isPrivateSession(userID)
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
 	currentTime := time.Now()
 
 	// Si existe una sesión para la misma canción, reanudarla
 	if exists && session.SongID == songID && !session.IsPlaying {
-		log.Printf("REANUDANDO SESIÓN - user_id=%s, song_id=%s, tiempo_acumulado=%d segundos",
-			userID, songID, session.AccumulatedTime)
+		log.Printf("REANUDANDO SESIÓN - user_id=%s, device_id=%s, song_id=%s, tiempo_acumulado=%d segundos",
+			userID, deviceID, songID, session.AccumulatedTime)
 		session.IsPlaying = true
 		session.LastPlayTime = currentTime
+		session.Private = session.Private || private
+		if position != nil {
+			session.Position = *position
+		}
+		sessionStore.SaveSession(session)
+		sessionsMu.Unlock()
+		notifyPresence(userID)
+		refreshTimer(userID, deviceID)
+		refreshLyrics(userID, deviceID)
 		return
 	}
 
-	// Si hay una sesión activa para una canción diferente, finalizarla primero
+	// Si hay una sesión activa para una canción diferente, se finaliza fuera del lock
+	var previous *PlaybackSession
 	if exists && session.IsPlaying && session.SongID != songID {
-		log.Printf("Finalizando sesión previa para user_id=%s antes de iniciar nueva", userID)
-		endPlaybackSession(userID)
+		log.Printf("Finalizando sesión previa para user_id=%s, device_id=%s antes de iniciar nueva", userID, deviceID)
+		previous = session
+	}
+
+	startPosition := 0
+	if position != nil {
+		startPosition = *position
+	}
+
+	var albumID, albumTitle string
+	if song.Album != nil {
+		albumID, albumTitle = song.Album.ID, song.Album.Title
 	}
 
 	// Crear nueva sesión para nueva canción
-	userSessions[userID] = &PlaybackSession{
+	sessionStore.SaveSession(&PlaybackSession{
 		UserID:          userID,
+		DeviceID:        deviceID,
 		SongID:          songID,
 		StartTime:       currentTime,
 		AccumulatedTime: 0, // Nueva canción, tiempo acumulado en 0
 		IsPlaying:       true,
 		LastPlayTime:    currentTime,
+		SongTitle:       song.Title,
+		Private:         private,
+		Context:         playContext,
+		Position:        startPosition,
+		SongDuration:    song.Duration,
+		Storage:         song.Storage,
+		AlbumID:         albumID,
+		AlbumTitle:      albumTitle,
+		Artists:         song.Artists,
+	})
+	sessionsMu.Unlock()
+	metrics.recordPlay(songID, song.Storage)
+	log.Printf("NUEVA SESIÓN INICIADA - user_id=%s, device_id=%s, song_id=%s, start_time=%s",
+		userID, deviceID, songID, currentTime.Format(time.RFC3339))
+
+	if previous != nil {
+		if err := finishPlaybackSession(previous); err != nil {
+			log.Printf("Error finalizando sesión previa para user_id=%s: %v", userID, err)
+		}
 	}
-	log.Printf("NUEVA SESIÓN INICIADA - user_id=%s, song_id=%s, start_time=%s",
-		userID, songID, currentTime.Format(time.RFC3339))
+	notifyPresence(userID)
+	refreshTimer(userID, deviceID)
+	startLyrics(userID, deviceID, songID)
 }
 
-// endPlaybackSession finaliza la sesión actual y envía el evento final a Kafka
-func endPlaybackSession(userID string) error {
-	session, exists := userSessions[userID]
+// endPlaybackSession finaliza la sesión del dispositivo y envía el evento final a Kafka
+func endPlaybackSession(userID, deviceID string) error {
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
 	if !exists {
-		log.Printf("No hay sesión para finalizar para user_id=%s", userID)
+		sessionsMu.Unlock()
+		log.Printf("No hay sesión para finalizar para user_id=%s, device_id=%s", userID, deviceID)
 		return nil
 	}
 
+	// Eliminar la sesión antes de publicar para no bloquear al resto de conexiones
+	sessionStore.DeleteSession(userID, deviceID)
+	sessionsMu.Unlock()
+	log.Printf("Sesión eliminada para user_id=%s, device_id=%s", userID, deviceID)
+
+	notifyPresence(userID)
+	refreshLyrics(userID, deviceID)
+	return finishPlaybackSession(session)
+}
+
+// finishPlaybackSession calcula la duración total de una sesión ya retirada del mapa
+// y envía el evento final a Kafka
+func finishPlaybackSession(session *PlaybackSession) error {
+	userID := session.UserID
 	var totalDuration int
 
 	// Si está reproduciendo, calcular tiempo de la sesión actual y sumarlo al acumulado
@@ -187,26 +330,32 @@ func endPlaybackSession(userID string) error {
 			userID, totalDuration)
 	}
 
-	// Solo enviar evento si se reprodujo por más de 1 segundo en total
+	// Las sesiones privadas no generan eventos: no afectan recomendaciones ni historial
+	if session.Private {
+		log.Printf("SESIÓN PRIVADA - evento no enviado a Kafka para user_id=%s, song_id=%s", userID, session.SongID)
+		return nil
+	}
+
+	// Solo guardar historial y enviar evento si se reprodujo por más de 1 segundo en total
 	if totalDuration > 0 {
-		err := publishSongPlayedEvent(session.UserID, session.SongID, session.StartTime, totalDuration)
+		recordHistory(session, totalDuration)
+		err := publishSongPlayedEvent(session, totalDuration)
 		if err != nil {
 			log.Printf("Error enviando evento final a Kafka: %v", err)
 			return err
 		}
 	}
 
-	// Eliminar la sesión completamente
-	delete(userSessions, userID)
-	log.Printf("Sesión eliminada para user_id=%s", userID)
 	return nil
 }
 
-// pausePlaybackSession pausa la sesión actual y acumula el tiempo reproducido
-func pausePlaybackSession(userID string) error {
-	session, exists := userSessions[userID]
+// pausePlaybackSession pausa la sesión del dispositivo y acumula el tiempo reproducido
+func pausePlaybackSession(userID, deviceID string) error {
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
 	if !exists || !session.IsPlaying {
-		log.Printf("No hay sesión activa para pausar para user_id=%s", userID)
+		sessionsMu.Unlock()
+		log.Printf("No hay sesión activa para pausar para user_id=%s, device_id=%s", userID, deviceID)
 		return nil
 	}
 
@@ -215,51 +364,105 @@ func pausePlaybackSession(userID string) error {
 
 	// Acumular el tiempo de reproducción
 	session.AccumulatedTime += currentSessionDuration
+	session.Position = session.currentPosition(time.Now())
 
 	// Marcar sesión como pausada pero NO eliminar la sesión
 	session.IsPlaying = false
+	sessionStore.SaveSession(session)
+	sessionsMu.Unlock()
 
-	log.Printf("SESIÓN PAUSADA - user_id=%s, duración_sesión_actual=%d segundos, tiempo_total_acumulado=%d segundos",
-		userID, currentSessionDuration, session.AccumulatedTime)
+	log.Printf("SESIÓN PAUSADA - user_id=%s, device_id=%s, duración_sesión_actual=%d segundos, tiempo_total_acumulado=%d segundos",
+		userID, deviceID, currentSessionDuration, session.AccumulatedTime)
 
 	// NO enviar a Kafka en pausa, solo acumular tiempo
 	log.Printf("PAUSA: Tiempo acumulado sin enviar a Kafka (se enviará al cambiar/terminar canción)")
 
+	notifyPresence(userID)
+	refreshTimer(userID, deviceID)
+	refreshLyrics(userID, deviceID)
 	return nil
 }
 
 // resumePlaybackSession reanuda una sesión pausada
-func resumePlaybackSession(userID, songID string) error {
-	session, exists := userSessions[userID]
+func resumePlaybackSession(userID, deviceID, songID string) error {
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
 	if !exists {
-		log.Printf("No hay sesión para reanudar para user_id=%s", userID)
+		sessionsMu.Unlock()
+		log.Printf("No hay sesión para reanudar para user_id=%s, device_id=%s", userID, deviceID)
 		return fmt.Errorf("no hay sesión para reanudar")
 	}
 
 	// Verificar que sea la misma canción
 	if session.SongID != songID {
+		sessionsMu.Unlock()
 		log.Printf("Intento de reanudar canción diferente: sesión=%s, solicitada=%s", session.SongID, songID)
 		return fmt.Errorf("canción diferente en sesión")
 	}
 
 	// Si ya está reproduciendo, no hacer nada
 	if session.IsPlaying {
-		log.Printf("La sesión ya está activa para user_id=%s", userID)
+		sessionsMu.Unlock()
+		log.Printf("La sesión ya está activa para user_id=%s, device_id=%s", userID, deviceID)
 		return nil
 	}
 
 	// Reactivar la sesión
 	session.IsPlaying = true
 	session.LastPlayTime = time.Now()
+	session.Private = session.Private || isPrivateSession(userID)
+	sessionStore.SaveSession(session)
+	sessionsMu.Unlock()
 
-	log.Printf("SESIÓN REANUDADA - user_id=%s, song_id=%s, tiempo_acumulado=%d segundos",
-		userID, songID, session.AccumulatedTime)
+	log.Printf("SESIÓN REANUDADA - user_id=%s, device_id=%s, song_id=%s, tiempo_acumulado=%d segundos",
+		userID, deviceID, songID, session.AccumulatedTime)
 
+	notifyPresence(userID)
+	refreshTimer(userID, deviceID)
+	refreshLyrics(userID, deviceID)
 	return nil
 }
 
+// seekPlaybackSession mueve la posición de la canción en curso sin cortar la sesión
+func seekPlaybackSession(userID, deviceID, songID string, position int) error {
+	if position < 0 {
+		return fmt.Errorf("posición inválida")
+	}
+
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
+	if !exists {
+		sessionsMu.Unlock()
+		return fmt.Errorf("no hay sesión activa")
+	}
+	if songID != "" && session.SongID != songID {
+		sessionsMu.Unlock()
+		return fmt.Errorf("canción diferente en sesión")
+	}
+	if session.SongDuration > 0 && position > session.SongDuration {
+		position = session.SongDuration
+	}
+
+	// El tiempo escuchado antes del salto se acumula igual que en una pausa
+	if session.IsPlaying {
+		now := time.Now()
+		session.AccumulatedTime += int(now.Sub(session.LastPlayTime).Seconds())
+		session.LastPlayTime = now
+	}
+	session.Position = position
+	log.Printf("SEEK - user_id=%s, song_id=%s, posición=%d segundos", userID, session.SongID, position)
+	err := sessionStore.SaveSession(session)
+	sessionsMu.Unlock()
+
+	refreshTimer(userID, deviceID)
+	refreshLyrics(userID, deviceID)
+	return err
+}
+
 // publishSongPlayedEvent envía el evento de canción reproducida al API Gateway
-func publishSongPlayedEvent(userID, songID string, startTime time.Time, durationPlayed int) error {
+// con el resumen de telemetría del cliente y los datos de catálogo de la sesión
+func publishSongPlayedEvent(session *PlaybackSession, durationPlayed int) error {
+	userID, songID := session.UserID, session.SongID
 	apiGatewayURL := os.Getenv("API_GATEWAY_URL")
 	if apiGatewayURL == "" {
 		apiGatewayURL = "http://apigateway:8080"
@@ -271,9 +474,19 @@ func publishSongPlayedEvent(userID, songID string, startTime time.Time, duration
 		Event:          "song_played",
 		UserID:         userID,
 		SongID:         songID,
-		PlayedAt:       startTime.Format(time.RFC3339),
+		PlayedAt:       session.StartTime.Format(time.RFC3339),
 		DurationPlayed: &durationPlayed,
+		QoE:            session.QoE.summary(session.Storage, time.Now()),
+		SongTitle:      session.SongTitle,
+		AlbumID:        session.AlbumID,
+		AlbumTitle:     session.AlbumTitle,
 	}
+	for _, artist := range session.Artists {
+		event.Artists = append(event.Artists, EventArtist{ID: artist.ID, Name: artist.Name})
+	}
+
+	// El outbox se escribe antes de publicar: si Kafka falla, el evento queda para los reportes
+	appendOutbox(event)
 
 	jsonBody, err := json.Marshal(event)
 	if err != nil {
@@ -299,14 +512,61 @@ func publishSongPlayedEvent(userID, songID string, startTime time.Time, duration
 	return nil
 }
 
-func getSongFromMusicMS(songID string) (*Song, error) {
+// getSongFromMusicMS obtiene la canción y comprueba que se pueda reproducir en country
+// antes de firmar la URL; si no, devuelve un *availabilityError
+func getSongFromMusicMS(songID, country string) (*Song, error) {
+	song, availability, err := fetchSongFromMusicMS(songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := availability.check(country, time.Now()); err != nil {
+		log.Printf("Canción %s no disponible (país=%q): %v", songID, country, err)
+		return nil, err
+	}
+	song.Storage = storageBackend(song.AudioURL)
+	log.Printf("Canción obtenida exitosamente (GraphQL): %s", song.Title)
+
+	// Si la canción tiene audio_url pero es una clave de S3 (no una URL completa), generar URL firmada
+	if song.AudioURL != "" && s3Service != nil {
+		// Verificar si es una clave de S3 (no contiene http)
+		if len(song.AudioURL) > 0 && song.AudioURL[0] != 'h' {
+			log.Printf("Detectada clave S3, generando URL firmada para: %s", song.AudioURL)
+			signedURL, err := s3Service.GeneratePresignedURL(context.Background(), song.AudioURL)
+			if err != nil {
+				log.Printf("Error generando URL firmada: %v", err)
+				return nil, fmt.Errorf("error generando URL de audio")
+			}
+			song.AudioURL = signedURL
+			log.Printf("URL firmada generada exitosamente")
+		}
+	}
+
+	return song, nil
+}
+
+// checkSongAvailability vuelve a comprobar en music-ms que la canción se pueda reproducir en
+// country, p. ej. al reanudar: la licencia puede vencer mientras la sesión está pausada
+func checkSongAvailability(songID, country string) error {
+	_, availability, err := fetchSongFromMusicMS(songID)
+	if err != nil {
+		return err
+	}
+	if err := availability.check(country, time.Now()); err != nil {
+		log.Printf("Canción %s no disponible (país=%q): %v", songID, country, err)
+		return err
+	}
+	return nil
+}
+
+// fetchSongFromMusicMS consulta en music-ms la canción y sus restricciones de licencia
+func fetchSongFromMusicMS(songID string) (*Song, SongAvailability, error) {
 	apiGatewayURL := os.Getenv("API_GATEWAY_URL")
 	if apiGatewayURL == "" {
 		apiGatewayURL = "http://apigateway:8080" // Cambia esto según tu entorno
 	}
 
 	graphqlURL := apiGatewayURL + "/api/v1/music/graphql"
-	query := `query GetSongById($id: ID!) { song(id: $id) { id title audio_url } }`
+	query := `query GetSongById($id: ID!) { song(id: $id) { id title audio_url duration available_markets available_from available_until album { id title } artists { id name } loudness { track_gain_db album_gain_db peak_dbfs album_peak_dbfs integrated_lufs reference_lufs } } }`
 	requestBody := map[string]interface{}{
 		"query":     query,
 		"variables": map[string]interface{}{"id": songID},
@@ -314,200 +574,121 @@ func getSongFromMusicMS(songID string) (*Song, error) {
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, err
+		return nil, SongAvailability{}, err
 	}
 
 	log.Printf("Consultando music-ms (GraphQL) en: %s con id: %s", graphqlURL, songID)
 	resp, err := http.Post(graphqlURL, "application/json", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return nil, SongAvailability{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("Error: music-ms (GraphQL) respondió con status %d para song ID %s", resp.StatusCode, songID)
-		return nil, fmt.Errorf("canción no encontrada (status: %d)", resp.StatusCode)
+		return nil, SongAvailability{}, fmt.Errorf("canción no encontrada (status: %d)", resp.StatusCode)
 	}
 
 	var result struct {
 		Data struct {
-			Song *Song `json:"song"`
+			Song *struct {
+				Song
+				SongAvailability
+			} `json:"song"`
 		} `json:"data"`
 		Errors []interface{} `json:"errors"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		log.Printf("Error decodificando respuesta de music-ms (GraphQL): %v", err)
-		return nil, fmt.Errorf("error procesando datos de la canción")
+		return nil, SongAvailability{}, fmt.Errorf("error procesando datos de la canción")
 	}
 
 	if len(result.Errors) > 0 {
 		log.Printf("Error: la respuesta GraphQL contiene errores")
-		return nil, fmt.Errorf("canción no encontrada o error en GraphQL")
+		return nil, SongAvailability{}, fmt.Errorf("canción no encontrada o error en GraphQL")
 	}
 
 	if result.Data.Song == nil {
 		log.Printf("Error: la canción no existe")
-		return nil, fmt.Errorf("canción no encontrada o error en GraphQL")
+		return nil, SongAvailability{}, fmt.Errorf("canción no encontrada o error en GraphQL")
 	}
 
-	song := result.Data.Song
-	log.Printf("Canción obtenida exitosamente (GraphQL): %s", song.Title)
+	return &result.Data.Song.Song, result.Data.Song.SongAvailability, nil
+}
 
-	// Si la canción tiene audio_url pero es una clave de S3 (no una URL completa), generar URL firmada
-	if song.AudioURL != "" && s3Service != nil {
-		// Verificar si es una clave de S3 (no contiene http)
-		if len(song.AudioURL) > 0 && song.AudioURL[0] != 'h' {
-			log.Printf("Detectada clave S3, generando URL firmada para: %s", song.AudioURL)
-			signedURL, err := s3Service.GeneratePresignedURL(context.Background(), song.AudioURL)
-			if err != nil {
-				log.Printf("Error generando URL firmada: %v", err)
-				return nil, fmt.Errorf("error generando URL de audio")
-			}
-			song.AudioURL = signedURL
-			log.Printf("URL firmada generada exitosamente")
-		}
+// streamIdentity lee el usuario, el dispositivo, el plan y el país de una conexión de reproducción.
+// El usuario y el plan salen del token, que es obligatorio. Si falta o es inválido responde
+// el error y devuelve ok=false.
+func streamIdentity(w http.ResponseWriter, r *http.Request) (userID, deviceID, plan, country string, ok bool) {
+	userID, claims, err := identityFromRequest(r)
+	if err != nil {
+		log.Printf("Error: conexión de reproducción rechazada: %v", err)
+		status, message := authError(err)
+		http.Error(w, message, status)
+		return "", "", "", "", false
 	}
 
-	return song, nil
+	// Cada dispositivo del usuario mantiene su propia sesión de reproducción
+	deviceID = r.URL.Query().Get("device_id")
+	if deviceID == "" {
+		deviceID = defaultDeviceID
+	}
+	return userID, deviceID, planFromClaims(claims), countryFromRequest(r, claims), true
 }
 
 func wsHandler(w http.ResponseWriter, r *http.Request) {
-	// Obtener user_id del query parameter
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		log.Printf("Error: user_id requerido en query parameter")
-		http.Error(w, "user_id requerido en query parameter", http.StatusBadRequest)
+	userID, deviceID, plan, country, ok := streamIdentity(w, r)
+	if !ok {
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	upgraded, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Upgrade error:", err)
 		return
 	}
-	defer conn.Close()
+	defer upgraded.Close()
+	conn := newWSConn(upgraded)
+
+	client := &streamClient{
+		userID:   userID,
+		deviceID: deviceID,
+		plan:     plan,
+		country:  country,
+		conn:     conn,
+	}
+	clients.add(client)
+	defer clients.remove(client)
 
-	log.Printf("Cliente WebSocket conectado con user_id: %s", userID)
+	log.Printf("Cliente WebSocket conectado con user_id: %s, device_id: %s, plan: %q, país: %q, codec: %s",
+		userID, deviceID, client.plan, client.country, conn.codec.Name())
 
-	// El userID viene del query parameter y es constante para esta conexión
+	// El userID viene del token y es constante para esta conexión
 	currentUserID := userID
 
 	for {
 		var request StreamRequest
-		err := conn.ReadJSON(&request)
+		err := conn.ReadMessage(&request)
 		if err != nil {
 			log.Println("Read error:", err)
-			// Finalizar sesión si existe antes de cerrar la conexión
-			if currentUserID != "" {
-				endPlaybackSession(currentUserID)
-			}
 			break
 		}
 
 		log.Printf("Received request: %+v", request)
 
-		switch request.Type {
-		case "play":
-			log.Printf("Solicitud de reproducción para canción ID: %s de user_id: %s", request.SongID, currentUserID)
-
-			song, err := getSongFromMusicMS(request.SongID)
-			if err != nil {
-				log.Printf("Error obteniendo canción: %v", err)
-				response := StreamResponse{
-					Type:    "error",
-					Message: "No se pudo obtener la canción: " + err.Error(),
-				}
-				conn.WriteJSON(response)
-				continue
-			}
-
-			// Verificar si hay audio_url disponible
-			if song.AudioURL == "" {
-				log.Printf("Canción encontrada pero sin audio_url: %s", song.Title)
-				response := StreamResponse{
-					Type:    "error",
-					Message: fmt.Sprintf("La canción '%s' no tiene audio disponible. Audio URL no configurado en la base de datos.", song.Title),
-				}
-				conn.WriteJSON(response)
-				continue
-			}
-
-			// Iniciar sesión de reproducción (esto finalizará automáticamente cualquier sesión previa)
-			startPlaybackSession(currentUserID, request.SongID)
-
-			log.Printf("Enviando datos de canción al cliente: %s", song.Title)
-			response := StreamResponse{
-				Type:    "song_data",
-				Message: fmt.Sprintf("Reproduciendo: %s", song.Title),
-				Song:    song,
-			}
-			conn.WriteJSON(response)
-
-		case "pause":
-			log.Printf("Solicitud de pausa para canción ID: %s de user_id: %s", request.SongID, currentUserID)
-
-			// Pausar sesión de reproducción y enviar evento a Kafka
-			err := pausePlaybackSession(currentUserID)
-			if err != nil {
-				log.Printf("Error pausando sesión: %v", err)
-			}
-
-			response := StreamResponse{
-				Type:    "status",
-				Message: fmt.Sprintf("Canción %s pausada", request.SongID),
-			}
-			conn.WriteJSON(response)
-
-		case "stop":
-			log.Printf("Solicitud de detener para canción ID: %s de user_id: %s", request.SongID, currentUserID)
-
-			// Finalizar sesión de reproducción y enviar evento a Kafka
-			err := endPlaybackSession(currentUserID)
-			if err != nil {
-				log.Printf("Error finalizando sesión: %v", err)
-			}
-
-			response := StreamResponse{
-				Type:    "status",
-				Message: fmt.Sprintf("Canción %s detenida", request.SongID),
-			}
-			conn.WriteJSON(response)
-
-		case "resume":
-			log.Printf("Solicitud de reanudar para canción ID: %s de user_id: %s", request.SongID, currentUserID)
-
-			// Reanudar sesión de reproducción
-			err := resumePlaybackSession(currentUserID, request.SongID)
-			if err != nil {
-				log.Printf("Error reanudando sesión: %v", err)
-				response := StreamResponse{
-					Type:    "error",
-					Message: "No se pudo reanudar la reproducción: " + err.Error(),
-				}
-				conn.WriteJSON(response)
-				continue
-			}
-
-			response := StreamResponse{
-				Type:    "status",
-				Message: fmt.Sprintf("Canción %s reanudada", request.SongID),
-			}
-			conn.WriteJSON(response)
-
-		default:
-			response := StreamResponse{
-				Type:    "error",
-				Message: "Tipo de comando no reconocido",
-			}
-			conn.WriteJSON(response)
-		}
+		response := executeCommand(Command{
+			UserID:   currentUserID,
+			DeviceID: deviceID,
+			Plan:     client.plan,
+			Country:  client.country,
+			Request:  request,
+		})
+		client.send(response)
 	}
 
 	// Finalizar sesión si existe cuando se desconecta el cliente
-	if currentUserID != "" {
-		endPlaybackSession(currentUserID)
-	}
+	executeCommand(Command{UserID: currentUserID, DeviceID: deviceID, Disconnect: true})
 
 	log.Println("Cliente WebSocket desconectado")
 }
@@ -524,8 +705,27 @@ func main() {
 		log.Printf("Servicio S3 inicializado correctamente")
 	}
 
+	// Inicializar almacén de sesiones (persistente si se configura SESSION_STORE_PATH)
+	sessionStore = newSessionStoreFromEnv()
+	restorePrivateSessions()
+	restoreTimers()
+	loadStreamLimits()
+
+	// Coordinación entre instancias (opcional, COORDINATOR_TRANSPORT)
+	coordinator = newCoordinatorFromEnv()
+	if coordinator != nil {
+		coordinator.claimLocalUsers()
+	}
+
 	http.HandleFunc("/health", healthCheckHandler)
+	http.HandleFunc("/metrics", metricsHandler)
 	http.HandleFunc("/ws", wsHandler)
+	http.HandleFunc("/sse", sseHandler)
+	http.HandleFunc("/sse/command", sseCommandHandler)
+	http.HandleFunc("/users/", usersHandler)
+	http.HandleFunc("/presence", presenceWsHandler)
+	http.HandleFunc("/admin/sessions", adminSessionsHandler)
+	http.HandleFunc("/admin/sessions/", adminSessionsHandler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
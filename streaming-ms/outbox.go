@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+// outboxMu serializa las escrituras al archivo de outbox
+var outboxMu sync.Mutex
+
+// appendOutbox agrega el evento como una línea JSON al archivo de EVENT_OUTBOX_PATH.
+// Es la fuente para los reportes de regalías (cmd/royalty-report) independiente de Kafka.
+// Sin la variable configurada no hace nada; un fallo se registra sin afectar la reproducción.
+func appendOutbox(event SongPlayedEvent) {
+	path := os.Getenv("EVENT_OUTBOX_PATH")
+	if path == "" {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error serializando evento para el outbox: %v", err)
+		return
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("Error abriendo outbox %s: %v", path, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error escribiendo outbox %s: %v", path, err)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Estados de presencia que se comunican a los seguidores
+const (
+	presenceStarted = "started"
+	presencePaused  = "paused"
+	presenceStopped = "stopped"
+)
+
+// maxPresenceBatch limita cuántos usuarios se pueden consultar o seguir a la vez
+const maxPresenceBatch = 100
+
+// Presence describe lo que un usuario está escuchando en este momento
+type Presence struct {
+	UserID         string     `json:"user_id"`
+	State          string     `json:"state"` // "playing", "paused", "stopped"
+	SongID         string     `json:"song_id,omitempty"`
+	SongTitle      string     `json:"song_title,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	ElapsedSeconds int        `json:"elapsed_seconds"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// PresenceRequest son los comandos que envía un cliente suscrito a presencia
+type PresenceRequest struct {
+	Type    string   `json:"type"` // "subscribe", "unsubscribe"
+	UserIDs []string `json:"userIds"`
+}
+
+// PresenceMessage son los mensajes que reciben los clientes suscritos a presencia
+type PresenceMessage struct {
+	Type      string      `json:"type"` // "presence", "presence_snapshot", "error"
+	Event     string      `json:"event,omitempty"`
+	Message   string      `json:"message,omitempty"`
+	Presence  *Presence   `json:"presence,omitempty"`
+	Presences []*Presence `json:"presences,omitempty"`
+}
+
+// presenceSubscriber es una conexión que sigue la actividad de otros usuarios
+type presenceSubscriber struct {
+	userID    string
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	following map[string]bool
+}
+
+// send serializa las escrituras sobre la conexión (gorilla no admite escritores concurrentes)
+func (s *presenceSubscriber) send(msg PresenceMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteJSON(msg)
+}
+
+// presenceHub mantiene los suscriptores de presencia
+type presenceHub struct {
+	mu          sync.RWMutex
+	subscribers map[*presenceSubscriber]struct{}
+}
+
+var presence = &presenceHub{
+	subscribers: make(map[*presenceSubscriber]struct{}),
+}
+
+// primarySession elige la sesión que representa al usuario cuando escucha en varios
+// dispositivos: la última que empezó a reproducir o, si todas están pausadas, la última pausada
+func primarySession(sessions []*PlaybackSession) *PlaybackSession {
+	var primary *PlaybackSession
+	for _, session := range sessions {
+		if session.Private {
+			continue
+		}
+		if primary == nil ||
+			(session.IsPlaying && !primary.IsPlaying) ||
+			(session.IsPlaying == primary.IsPlaying && session.LastPlayTime.After(primary.LastPlayTime)) {
+			primary = session
+		}
+	}
+	return primary
+}
+
+// getPresence devuelve la presencia de un usuario; con coordinación la calcula la
+// instancia propietaria, que es la que tiene sus sesiones
+func getPresence(userID string) *Presence {
+	var p Presence
+	if queryOwner(ownerQuery{Kind: queryPresence, UserID: userID}, &p) {
+		return &p
+	}
+	return localPresence(userID)
+}
+
+// localPresence construye la presencia de un usuario a partir de sus sesiones de esta instancia
+func localPresence(userID string) *Presence {
+	now := time.Now()
+	p := &Presence{UserID: userID, State: "stopped", UpdatedAt: now}
+
+	if isPrivateSession(userID) {
+		return p
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	session := primarySession(sessionStore.ListUserSessions(userID))
+	if session == nil {
+		return p
+	}
+
+	startedAt := session.StartTime
+	p.SongID = session.SongID
+	p.SongTitle = session.SongTitle
+	p.StartedAt = &startedAt
+	p.ElapsedSeconds = session.AccumulatedTime
+	if session.IsPlaying {
+		p.State = "playing"
+		p.ElapsedSeconds += int(now.Sub(session.LastPlayTime).Seconds())
+	} else {
+		p.State = "paused"
+	}
+	return p
+}
+
+// notifyPresence envía el estado actual de un usuario a quienes lo siguen. El evento
+// se deriva del estado: si pausa un dispositivo mientras otro reproduce, sigue "started".
+func notifyPresence(userID string) {
+	if isPrivateSession(userID) {
+		return
+	}
+	p := getPresence(userID)
+	event := presenceStopped
+	switch p.State {
+	case "playing":
+		event = presenceStarted
+	case "paused":
+		event = presencePaused
+	}
+	broadcastPresence(p, event)
+}
+
+// broadcastPresence reparte un cambio de presencia entre los suscriptores interesados,
+// también los conectados a otras instancias si hay coordinación
+func broadcastPresence(p *Presence, event string) {
+	if coordinator != nil {
+		err := coordinator.PublishPresence(p, event)
+		if err == nil {
+			return
+		}
+		log.Printf("Error difundiendo presencia de %s, se entrega solo localmente: %v", p.UserID, err)
+	}
+	broadcastPresenceLocal(p, event)
+}
+
+// broadcastPresenceLocal entrega la presencia a los suscriptores de esta instancia
+func broadcastPresenceLocal(p *Presence, event string) {
+	presence.mu.RLock()
+	var targets []*presenceSubscriber
+	for sub := range presence.subscribers {
+		if sub.following[p.UserID] {
+			targets = append(targets, sub)
+		}
+	}
+	presence.mu.RUnlock()
+
+	msg := PresenceMessage{Type: "presence", Event: event, Presence: p}
+	for _, sub := range targets {
+		if err := sub.send(msg); err != nil {
+			log.Printf("Error enviando presencia de %s a %s: %v", p.UserID, sub.userID, err)
+		}
+	}
+}
+
+// parseUserIDs separa una lista de IDs "a,b,c" descartando vacíos y duplicados
+func parseUserIDs(raw []string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, value := range raw {
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// usersHandler atiende las rutas /users/...
+//
+//	GET /users/{id}/now-playing
+//	GET /users/{id}/recent?limit=N
+//	GET /users/now-playing?ids=a,b,c
+//
+// Requieren token: cada usuario ve su propia actividad y la de quienes sigue.
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "método no permitido"})
+		return
+	}
+	viewer, err := viewerFromRequest(r)
+	if err != nil {
+		status, message := authError(err)
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "now-playing":
+		ids := parseUserIDs(r.URL.Query()["ids"])
+		if len(ids) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "parámetro ids requerido"})
+			return
+		}
+		if len(ids) > maxPresenceBatch {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "demasiados usuarios en la consulta"})
+			return
+		}
+		presences := make([]*Presence, 0, len(ids))
+		for _, id := range ids {
+			if !follows.canSee(viewer, id) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "no puedes ver la actividad de " + id})
+				return
+			}
+			presences = append(presences, getPresence(id))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"presences": presences})
+
+	case len(parts) == 2 && parts[0] != "" && (parts[1] == "now-playing" || parts[1] == "recent"):
+		if !follows.canSee(viewer, parts[0]) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "no puedes ver la actividad de " + parts[0]})
+			return
+		}
+		if parts[1] == "recent" {
+			recentHandler(w, r, parts[0])
+			return
+		}
+		writeJSON(w, http.StatusOK, getPresence(parts[0]))
+
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "ruta no encontrada"})
+	}
+}
+
+// presenceUpgrader acepta el WebSocket de presencia sin negociar subprotocolo: sus mensajes
+// son siempre JSON, a diferencia de /ws que puede usar msgpack
+var presenceUpgrader = websocket.Upgrader{
+	CheckOrigin:       func(r *http.Request) bool { return true }, // Configura para producción
+	EnableCompression: true,
+}
+
+// presenceWsHandler permite a un cliente seguir en vivo la actividad de los usuarios que
+// sigue. El usuario se toma del token; user_id en la query es opcional.
+func presenceWsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := viewerFromRequest(r)
+	if err != nil {
+		status, message := authError(err)
+		http.Error(w, message, status)
+		return
+	}
+
+	conn, err := presenceUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := &presenceSubscriber{
+		userID:    userID,
+		conn:      conn,
+		following: make(map[string]bool),
+	}
+	presence.mu.Lock()
+	presence.subscribers[sub] = struct{}{}
+	presence.mu.Unlock()
+
+	defer func() {
+		presence.mu.Lock()
+		delete(presence.subscribers, sub)
+		presence.mu.Unlock()
+	}()
+
+	log.Printf("Suscriptor de presencia conectado: user_id=%s", userID)
+
+	for {
+		var request PresenceRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			log.Println("Read error (presencia):", err)
+			break
+		}
+
+		ids := parseUserIDs(request.UserIDs)
+
+		switch request.Type {
+		case "subscribe":
+			allowed := ids[:0]
+			for _, id := range ids {
+				if follows.canSee(userID, id) {
+					allowed = append(allowed, id)
+				} else {
+					sub.send(PresenceMessage{Type: "error", Message: "no puedes ver la actividad de " + id})
+				}
+			}
+			ids = allowed
+
+			presence.mu.Lock()
+			if len(sub.following)+len(ids) > maxPresenceBatch {
+				presence.mu.Unlock()
+				sub.send(PresenceMessage{Type: "error", Message: "demasiados usuarios seguidos"})
+				continue
+			}
+			for _, id := range ids {
+				sub.following[id] = true
+			}
+			presence.mu.Unlock()
+
+			// Enviar el estado actual de los usuarios recién seguidos
+			snapshot := make([]*Presence, 0, len(ids))
+			for _, id := range ids {
+				snapshot = append(snapshot, getPresence(id))
+			}
+			sub.send(PresenceMessage{Type: "presence_snapshot", Presences: snapshot})
+
+		case "unsubscribe":
+			presence.mu.Lock()
+			for _, id := range ids {
+				delete(sub.following, id)
+			}
+			presence.mu.Unlock()
+
+		default:
+			sub.send(PresenceMessage{Type: "error", Message: "Tipo de comando no reconocido"})
+		}
+	}
+
+	log.Printf("Suscriptor de presencia desconectado: user_id=%s", userID)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUsersHandlerAuthorization(t *testing.T) {
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	following := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/ana/following":
+			writeJSON(w, http.StatusOK, map[string][]string{"user_ids": {"bruno"}})
+		default:
+			writeJSON(w, http.StatusOK, map[string][]string{"user_ids": {}})
+		}
+	}))
+	defer following.Close()
+
+	previous := follows
+	follows = &followGraph{baseURL: following.URL, client: following.Client(), cache: make(map[string]followingEntry)}
+	defer func() { follows = previous }()
+
+	ana := testToken(t, map[string]interface{}{"user_id": "ana"})
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"sin token", "/users/ana/now-playing", "", http.StatusUnauthorized},
+		{"token sin usuario", "/users/ana/now-playing", testToken(t, map[string]interface{}{"plan": "free"}), http.StatusUnauthorized},
+		{"token expirado", "/users/ana/now-playing", testToken(t, map[string]interface{}{"user_id": "ana", "exp": 1}), http.StatusUnauthorized},
+		{"token sin firmar", "/users/ana/now-playing", unsignedToken(t, map[string]interface{}{"user_id": "ana"}), http.StatusUnauthorized},
+		{"propia actividad", "/users/ana/now-playing", ana, http.StatusOK},
+		{"propio historial", "/users/ana/recent", ana, http.StatusOK},
+		{"usuario seguido", "/users/bruno/now-playing", ana, http.StatusOK},
+		{"historial de un seguido", "/users/bruno/recent", ana, http.StatusOK},
+		{"usuario no seguido", "/users/carla/now-playing", ana, http.StatusForbidden},
+		{"historial de un no seguido", "/users/carla/recent", ana, http.StatusForbidden},
+		{"lote de seguidos", "/users/now-playing?ids=ana,bruno", ana, http.StatusOK},
+		{"lote con un no seguido", "/users/now-playing?ids=bruno,carla", ana, http.StatusForbidden},
+		{"user_id de otro usuario", "/users/ana/now-playing?user_id=bruno", ana, http.StatusUnauthorized},
+		{"seguidos de otro usuario", "/users/bruno/now-playing", testToken(t, map[string]interface{}{"sub": "carla"}), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			usersHandler(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, se esperaba %d (%s)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFollowGraphWithoutService(t *testing.T) {
+	graph := &followGraph{cache: make(map[string]followingEntry)}
+	tests := []struct {
+		viewer, userID string
+		want           bool
+	}{
+		{"ana", "ana", true},
+		{"ana", "bruno", false},
+	}
+	for _, tt := range tests {
+		if got := graph.canSee(tt.viewer, tt.userID); got != tt.want {
+			t.Errorf("canSee(%q, %q) = %v, se esperaba %v", tt.viewer, tt.userID, got, tt.want)
+		}
+	}
+}
+
+func TestFollowGraphFailsClosed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "caído", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	graph := &followGraph{baseURL: server.URL, client: server.Client(), cache: make(map[string]followingEntry)}
+	if graph.canSee("ana", "bruno") {
+		t.Error("si el servicio de seguidos falla no se debe autorizar")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxPrivateSessionDuration es la duración máxima que un cliente puede pedir
+const maxPrivateSessionDuration = 24 * time.Hour
+
+// PrivateSession indica que un usuario escucha sin afectar analíticas ni presencia
+type PrivateSession struct {
+	UserID    string    `json:"user_id"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	// privateExpiryTimers avisa a los seguidores cuando una sesión privada expira
+	privateExpiryTimers   = make(map[string]*time.Timer)
+	privateExpiryTimersMu sync.Mutex
+)
+
+// defaultPrivateSessionDuration lee PRIVATE_SESSION_TTL_MINUTES (por defecto 6 horas)
+func defaultPrivateSessionDuration() time.Duration {
+	if value := os.Getenv("PRIVATE_SESSION_TTL_MINUTES"); value != "" {
+		if minutes, err := strconv.Atoi(value); err == nil && minutes > 0 {
+			return time.Duration(minutes) * time.Minute
+		}
+		log.Printf("PRIVATE_SESSION_TTL_MINUTES inválido: %s, usando valor por defecto", value)
+	}
+	return 6 * time.Hour
+}
+
+// getPrivateSession devuelve la sesión privada vigente del usuario, descartando las expiradas
+func getPrivateSession(userID string) (*PrivateSession, bool) {
+	private, exists := sessionStore.GetPrivateSession(userID)
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(private.ExpiresAt) {
+		sessionStore.DeletePrivateSession(userID)
+		return nil, false
+	}
+	return private, true
+}
+
+// isPrivateSession indica si el usuario tiene una sesión privada vigente
+func isPrivateSession(userID string) bool {
+	_, active := getPrivateSession(userID)
+	return active
+}
+
+// enablePrivateSession activa la sesión privada durante la duración indicada
+// (o la configurada por defecto) y marca como privada la reproducción en curso
+func enablePrivateSession(userID string, duration time.Duration) *PrivateSession {
+	if duration <= 0 {
+		duration = defaultPrivateSessionDuration()
+	}
+	if duration > maxPrivateSessionDuration {
+		duration = maxPrivateSessionDuration
+	}
+
+	now := time.Now()
+	private := &PrivateSession{
+		UserID:    userID,
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := sessionStore.SavePrivateSession(private); err != nil {
+		log.Printf("Error guardando sesión privada para user_id=%s: %v", userID, err)
+	}
+
+	// Las canciones en curso tampoco deben contar para analíticas
+	sessionsMu.Lock()
+	for _, session := range sessionStore.ListUserSessions(userID) {
+		if !session.Private {
+			session.Private = true
+			sessionStore.SaveSession(session)
+		}
+	}
+	sessionsMu.Unlock()
+
+	schedulePrivateExpiry(private)
+	log.Printf("SESIÓN PRIVADA ACTIVADA - user_id=%s, expira=%s", userID, private.ExpiresAt.Format(time.RFC3339))
+
+	// Para los seguidores es como si el usuario hubiera dejado de escuchar
+	broadcastPresence(&Presence{UserID: userID, State: "stopped", UpdatedAt: now}, presenceStopped)
+	return private
+}
+
+// disablePrivateSession termina la sesión privada y vuelve a publicar la presencia.
+// Las canciones en curso se mantienen privadas hasta que terminen.
+func disablePrivateSession(userID string) {
+	privateExpiryTimersMu.Lock()
+	if timer, exists := privateExpiryTimers[userID]; exists {
+		timer.Stop()
+		delete(privateExpiryTimers, userID)
+	}
+	privateExpiryTimersMu.Unlock()
+
+	if err := sessionStore.DeletePrivateSession(userID); err != nil {
+		log.Printf("Error eliminando sesión privada para user_id=%s: %v", userID, err)
+	}
+	log.Printf("SESIÓN PRIVADA DESACTIVADA - user_id=%s", userID)
+	notifyPresence(userID)
+}
+
+// schedulePrivateExpiry programa el fin automático de la sesión privada
+func schedulePrivateExpiry(private *PrivateSession) {
+	userID := private.UserID
+	expiresAt := private.ExpiresAt
+
+	privateExpiryTimersMu.Lock()
+	defer privateExpiryTimersMu.Unlock()
+
+	if timer, exists := privateExpiryTimers[userID]; exists {
+		timer.Stop()
+	}
+	privateExpiryTimers[userID] = time.AfterFunc(time.Until(expiresAt), func() {
+		privateExpiryTimersMu.Lock()
+		delete(privateExpiryTimers, userID)
+		privateExpiryTimersMu.Unlock()
+
+		// Solo expira si no se renovó mientras tanto
+		current, exists := sessionStore.GetPrivateSession(userID)
+		if !exists || !current.ExpiresAt.Equal(expiresAt) {
+			return
+		}
+		sessionStore.DeletePrivateSession(userID)
+		log.Printf("SESIÓN PRIVADA EXPIRADA - user_id=%s", userID)
+		notifyPresence(userID)
+	})
+}
+
+// restorePrivateSessions reprograma la expiración de las sesiones privadas persistidas
+func restorePrivateSessions() {
+	for _, private := range sessionStore.ListPrivateSessions() {
+		if time.Now().After(private.ExpiresAt) {
+			sessionStore.DeletePrivateSession(private.UserID)
+			continue
+		}
+		schedulePrivateExpiry(private)
+	}
+}
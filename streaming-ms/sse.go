@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseKeepAlive es cada cuánto se envía un comentario para que los proxies no corten el stream
+const sseKeepAlive = 25 * time.Second
+
+// sseStream escribe los mensajes como eventos SSE ("data: {...}") sobre la respuesta HTTP
+type sseStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	closed  bool
+
+	// commandMu ejecuta en orden los comandos de la conexión, como el bucle de lectura del WebSocket
+	commandMu sync.Mutex
+}
+
+func (s *sseStream) WriteMessage(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(fmt.Sprintf("data: %s\n\n", data))
+}
+
+func (s *sseStream) write(chunk string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("stream SSE cerrado")
+	}
+	if _, err := fmt.Fprint(s.w, chunk); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// close impide nuevas escrituras una vez que el handler terminó
+func (s *sseStream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+func newConnectionID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// sseHandler es la alternativa a /ws para redes que bloquean WebSocket: los mensajes
+// llegan por Server-Sent Events y los comandos se envían con POST /sse/command
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, deviceID, plan, country, ok := streamIdentity(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming no soportado", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &sseStream{w: w, flusher: flusher}
+	client := &streamClient{
+		id:       newConnectionID(),
+		userID:   userID,
+		deviceID: deviceID,
+		plan:     plan,
+		country:  country,
+		conn:     stream,
+	}
+	clients.add(client)
+	defer clients.remove(client)
+
+	log.Printf("Cliente SSE conectado con user_id: %s, device_id: %s, plan: %q, país: %q", userID, deviceID, plan, country)
+	client.send(StreamResponse{
+		Type:         "connected",
+		Message:      "Conexión SSE establecida",
+		ConnectionID: client.id,
+	})
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-r.Context().Done():
+			done = true
+		case <-ticker.C:
+			client.writeMu.Lock()
+			err := stream.write(": keep-alive\n\n")
+			client.writeMu.Unlock()
+			done = err != nil
+		}
+	}
+	stream.close()
+
+	// Finalizar sesión si existe cuando se desconecta el cliente
+	executeCommand(Command{UserID: userID, DeviceID: deviceID, Disconnect: true})
+	log.Println("Cliente SSE desconectado")
+}
+
+// sseCommandHandler recibe los comandos de una conexión SSE:
+//
+//	POST /sse/command?connection_id=...  {"type": "play", "songId": "..."}
+//
+// La respuesta al comando llega por el stream SSE, igual que en /ws. Con varias réplicas el
+// POST puede llegar a una instancia distinta de la que tiene el stream: se le reenvía.
+func sseCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "método no permitido"})
+		return
+	}
+
+	connectionID := r.URL.Query().Get("connection_id")
+	client, stream, local := sseClient(connectionID)
+	if !local && coordinator == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "conexión SSE no encontrada"})
+		return
+	}
+
+	var request StreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "comando inválido: " + err.Error()})
+		return
+	}
+	log.Printf("Received request (SSE): %+v", request)
+
+	if local {
+		runSSECommand(client, stream, request)
+	} else {
+		found, err := coordinator.ForwardSSECommand(connectionID, request)
+		if err != nil {
+			log.Printf("Error reenviando comando SSE de la conexión %s: %v", connectionID, err)
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "no se pudo contactar la instancia de la conexión"})
+			return
+		}
+		if !found {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "conexión SSE no encontrada"})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+// sseClient busca una conexión SSE abierta en esta instancia
+func sseClient(connectionID string) (*streamClient, *sseStream, bool) {
+	client, exists := clients.get(connectionID)
+	if !exists {
+		return nil, nil, false
+	}
+	stream, isSSE := client.conn.(*sseStream)
+	if !isSSE {
+		return nil, nil, false
+	}
+	return client, stream, true
+}
+
+// runSSECommand ejecuta el comando de la conexión y envía la respuesta por su stream
+func runSSECommand(client *streamClient, stream *sseStream, request StreamRequest) {
+	stream.commandMu.Lock()
+	defer stream.commandMu.Unlock()
+	response := executeCommand(Command{
+		UserID:   client.userID,
+		DeviceID: client.deviceID,
+		Plan:     client.plan,
+		Country:  client.country,
+		Request:  request,
+	})
+	client.send(response)
+}
+
+// deliverSSECommand atiende un comando reenviado por otra instancia si la conexión está
+// aquí. Se ejecuta aparte: quien lo reenvió solo espera saber que la conexión existe.
+func deliverSSECommand(connectionID string, request StreamRequest) bool {
+	client, stream, ok := sseClient(connectionID)
+	if !ok {
+		return false
+	}
+	go runSSECommand(client, stream, request)
+	return true
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SessionStore persiste el estado de reproducción de los usuarios.
+// Las sesiones de reproducción se identifican por usuario y dispositivo.
+// Las implementaciones guardan copias: quien modifica una sesión debe volver a guardarla.
+type SessionStore interface {
+	GetSession(userID, deviceID string) (*PlaybackSession, bool)
+	SaveSession(session *PlaybackSession) error
+	DeleteSession(userID, deviceID string) error
+	ListSessions() []*PlaybackSession
+	ListUserSessions(userID string) []*PlaybackSession
+
+	GetPrivateSession(userID string) (*PrivateSession, bool)
+	SavePrivateSession(private *PrivateSession) error
+	DeletePrivateSession(userID string) error
+	ListPrivateSessions() []*PrivateSession
+
+	// AppendHistory agrega una entrada al inicio del historial y conserva solo las maxEntries más recientes
+	AppendHistory(entry *HistoryEntry, maxEntries int) error
+	ListHistory(userID string, limit int) []*HistoryEntry
+
+	GetTimer(userID string) (*PlaybackTimer, bool)
+	SaveTimer(timer *PlaybackTimer) error
+	DeleteTimer(userID string) error
+	ListTimers() []*PlaybackTimer
+}
+
+// sessionKey identifica la sesión de un dispositivo dentro del almacén
+func sessionKey(userID, deviceID string) string {
+	return userID + "/" + deviceID
+}
+
+// storeSnapshot es el formato en disco del almacén de sesiones
+type storeSnapshot struct {
+	Seq             uint64                      `json:"seq,omitempty"`      // Último cambio del diario incluido
+	SavedAt         time.Time                   `json:"saved_at,omitempty"` // Cuándo se volcó
+	Sessions        map[string]*PlaybackSession `json:"sessions"`           // Clave: sessionKey
+	PrivateSessions map[string]*PrivateSession  `json:"private_sessions"`
+	History         map[string][]*HistoryEntry  `json:"history"`
+	Timers          map[string]*PlaybackTimer   `json:"timers"`
+}
+
+// Tipos de cambio del almacén
+const (
+	changeSession = "session"
+	changePrivate = "private"
+	changeHistory = "history"
+	changeTimer   = "timer"
+)
+
+// storeChange es una escritura sobre una clave del almacén, tal como se agrega al diario
+type storeChange struct {
+	Seq        uint64           `json:"seq"`
+	At         time.Time        `json:"at,omitempty"` // Cuándo se escribió
+	Kind       string           `json:"kind"`
+	Key        string           `json:"key"` // sessionKey para las sesiones, userID para el resto
+	Deleted    bool             `json:"deleted,omitempty"`
+	Session    *PlaybackSession `json:"session,omitempty"`
+	Private    *PrivateSession  `json:"private,omitempty"`
+	Entry      *HistoryEntry    `json:"entry,omitempty"`
+	MaxEntries int              `json:"max_entries,omitempty"`
+	Timer      *PlaybackTimer   `json:"timer,omitempty"`
+}
+
+// memorySessionStore guarda las sesiones en memoria. Si journal no es nil, cada
+// escritura se agrega al diario en disco (con el lock tomado).
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*PlaybackSession
+	private  map[string]*PrivateSession
+	history  map[string][]*HistoryEntry
+	timers   map[string]*PlaybackTimer
+	seq      uint64
+	journal  *storeJournal
+}
+
+// NewMemorySessionStore crea un almacén que se pierde al reiniciar el servicio
+func NewMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{
+		sessions: make(map[string]*PlaybackSession),
+		private:  make(map[string]*PrivateSession),
+		history:  make(map[string][]*HistoryEntry),
+		timers:   make(map[string]*PlaybackTimer),
+	}
+}
+
+// NewFileSessionStore crea un almacén persistente en path. Cada escritura agrega solo la
+// clave modificada al diario path.log; cada compactEvery cambios el estado completo se
+// vuelca a path y el diario se vacía. Al arrancar se lee path, se aplica el diario y se
+// pausan las sesiones que estaban sonando (ver pauseRestoredLocked).
+func NewFileSessionStore(path string, compactEvery int) (*memorySessionStore, error) {
+	store := NewMemorySessionStore()
+	var lastWrite time.Time
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error leyendo almacén de sesiones: %v", err)
+	}
+	if len(data) > 0 {
+		var snapshot storeSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("error decodificando almacén de sesiones: %v", err)
+		}
+		for _, session := range snapshot.Sessions {
+			// Los archivos anteriores a los dispositivos guardaban una sesión por usuario
+			if session.DeviceID == "" {
+				session.DeviceID = defaultDeviceID
+			}
+			store.sessions[sessionKey(session.UserID, session.DeviceID)] = session
+		}
+		for userID, private := range snapshot.PrivateSessions {
+			store.private[userID] = private
+		}
+		for userID, entries := range snapshot.History {
+			store.history[userID] = entries
+		}
+		for userID, timer := range snapshot.Timers {
+			store.timers[userID] = timer
+		}
+		store.seq = snapshot.Seq
+		lastWrite = snapshot.SavedAt
+	}
+
+	replayed, replayedAt, err := store.replay(path + ".log")
+	if err != nil {
+		return nil, err
+	}
+	if replayedAt.After(lastWrite) {
+		lastWrite = replayedAt
+	}
+	paused := store.pauseRestoredLocked(lastWrite)
+	log.Printf("Almacén de sesiones recuperado de %s (%d cambios del diario): %d sesiones (%d pausadas), %d sesiones privadas, historial de %d usuarios, %d temporizadores",
+		path, replayed, len(store.sessions), paused, len(store.private), len(store.history), len(store.timers))
+
+	journal, err := openStoreJournal(path, compactEvery)
+	if err != nil {
+		return nil, err
+	}
+	store.journal = journal
+	// Se compacta al arrancar para empezar con el diario vacío y con las pausas en disco
+	if replayed > 0 || paused > 0 {
+		if err := journal.compact(store.snapshotLocked()); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// replay aplica los cambios del diario posteriores a la instantánea y devuelve cuántos
+// aplicó y cuándo se escribió el último. Una última línea incompleta (el proceso murió a
+// mitad de escritura) se descarta.
+func (s *memorySessionStore) replay(path string) (int, time.Time, error) {
+	var lastAt time.Time
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, lastAt, nil
+	}
+	if err != nil {
+		return 0, lastAt, fmt.Errorf("error leyendo diario de sesiones: %v", err)
+	}
+	defer file.Close()
+
+	replayed := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var change storeChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			log.Printf("Cambio ilegible en el diario de sesiones, se descarta el resto: %v", err)
+			break
+		}
+		if change.Seq <= s.seq {
+			continue
+		}
+		s.applyLocked(&change)
+		s.seq = change.Seq
+		if change.At.After(lastAt) {
+			lastAt = change.At
+		}
+		replayed++
+	}
+	return replayed, lastAt, scanner.Err()
+}
+
+// pauseRestoredLocked pausa las sesiones que seguían sonando cuando se paró el proceso, en
+// la última posición conocida: la de lastWrite, la última escritura del almacén. Si no, al
+// reanudar o terminar la canción el tiempo que el servicio estuvo caído contaría como
+// escuchado (en song_played, en /admin y en los límites de dispositivos).
+func (s *memorySessionStore) pauseRestoredLocked(lastWrite time.Time) int {
+	paused := 0
+	for _, session := range s.sessions {
+		if !session.IsPlaying {
+			continue
+		}
+		// Sin fecha (archivos anteriores) no se cuenta nada después de LastPlayTime
+		seen := lastWrite
+		if seen.Before(session.LastPlayTime) {
+			seen = session.LastPlayTime
+		}
+		session.AccumulatedTime += int(seen.Sub(session.LastPlayTime).Seconds())
+		session.Position = session.currentPosition(seen)
+		session.IsPlaying = false
+		paused++
+	}
+	return paused
+}
+
+// storeJournal es el diario de cambios del almacén persistente
+type storeJournal struct {
+	path         string // Instantánea; el diario es path + ".log"
+	file         *os.File
+	pending      int // Cambios en el diario desde la última compactación
+	compactEvery int
+}
+
+func openStoreJournal(path string, compactEvery int) (*storeJournal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo diario de sesiones: %v", err)
+	}
+	return &storeJournal{path: path, file: file, compactEvery: compactEvery}, nil
+}
+
+// append escribe un cambio al final del diario
+func (j *storeJournal) append(change *storeChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	j.pending++
+	return nil
+}
+
+// compact vuelca la instantánea y vacía el diario. La instantánea lleva el último Seq,
+// así que si el proceso muere antes de vaciar el diario sus cambios no se aplican dos veces.
+func (j *storeJournal) compact(snapshot storeSnapshot) error {
+	if err := writeFileAtomic(j.path, snapshot); err != nil {
+		return err
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	j.pending = 0
+	return nil
+}
+
+// writeFileAtomic escribe el JSON en un archivo temporal y lo renombra,
+// para no dejar el almacén corrupto si el proceso muere a mitad de escritura
+func writeFileAtomic(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *memorySessionStore) snapshotLocked() storeSnapshot {
+	return storeSnapshot{Seq: s.seq, SavedAt: time.Now(), Sessions: s.sessions, PrivateSessions: s.private, History: s.history, Timers: s.timers}
+}
+
+// applyLocked aplica un cambio sobre el estado en memoria. Requiere s.mu tomado.
+func (s *memorySessionStore) applyLocked(change *storeChange) {
+	switch change.Kind {
+	case changeSession:
+		if change.Deleted {
+			delete(s.sessions, change.Key)
+		} else {
+			s.sessions[change.Key] = change.Session
+		}
+	case changePrivate:
+		if change.Deleted {
+			delete(s.private, change.Key)
+		} else {
+			s.private[change.Key] = change.Private
+		}
+	case changeHistory:
+		entries := append([]*HistoryEntry{change.Entry}, s.history[change.Key]...)
+		if change.MaxEntries > 0 && len(entries) > change.MaxEntries {
+			entries = entries[:change.MaxEntries]
+		}
+		s.history[change.Key] = entries
+	case changeTimer:
+		if change.Deleted {
+			delete(s.timers, change.Key)
+		} else {
+			s.timers[change.Key] = change.Timer
+		}
+	}
+}
+
+// commitLocked agrega el cambio al diario, si el almacén es persistente, y después lo aplica
+// en memoria: si no se puede escribir, la memoria no cambia y sigue igual que el disco.
+// Requiere s.mu tomado.
+func (s *memorySessionStore) commitLocked(change storeChange) error {
+	change.Seq = s.seq + 1
+	change.At = time.Now()
+	if s.journal != nil {
+		if err := s.journal.append(&change); err != nil {
+			log.Printf("Error persistiendo almacén de sesiones: %v", err)
+			return err
+		}
+	}
+	s.seq = change.Seq
+	s.applyLocked(&change)
+	if s.journal == nil {
+		return nil
+	}
+	if s.journal.pending >= s.journal.compactEvery {
+		if err := s.journal.compact(s.snapshotLocked()); err != nil {
+			log.Printf("Error compactando almacén de sesiones: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memorySessionStore) GetSession(userID, deviceID string) (*PlaybackSession, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, exists := s.sessions[sessionKey(userID, deviceID)]
+	if !exists {
+		return nil, false
+	}
+	copied := *session
+	return &copied, true
+}
+
+func (s *memorySessionStore) SaveSession(session *PlaybackSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *session
+	return s.commitLocked(storeChange{Kind: changeSession, Key: sessionKey(session.UserID, session.DeviceID), Session: &copied})
+}
+
+func (s *memorySessionStore) DeleteSession(userID, deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey(userID, deviceID)
+	if _, exists := s.sessions[key]; !exists {
+		return nil
+	}
+	return s.commitLocked(storeChange{Kind: changeSession, Key: key, Deleted: true})
+}
+
+func (s *memorySessionStore) ListSessions() []*PlaybackSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make([]*PlaybackSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		copied := *session
+		sessions = append(sessions, &copied)
+	}
+	return sessions
+}
+
+func (s *memorySessionStore) ListUserSessions(userID string) []*PlaybackSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var sessions []*PlaybackSession
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions
+}
+
+func (s *memorySessionStore) GetPrivateSession(userID string) (*PrivateSession, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	private, exists := s.private[userID]
+	if !exists {
+		return nil, false
+	}
+	copied := *private
+	return &copied, true
+}
+
+func (s *memorySessionStore) SavePrivateSession(private *PrivateSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *private
+	return s.commitLocked(storeChange{Kind: changePrivate, Key: private.UserID, Private: &copied})
+}
+
+func (s *memorySessionStore) DeletePrivateSession(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.private[userID]; !exists {
+		return nil
+	}
+	return s.commitLocked(storeChange{Kind: changePrivate, Key: userID, Deleted: true})
+}
+
+func (s *memorySessionStore) ListPrivateSessions() []*PrivateSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	privates := make([]*PrivateSession, 0, len(s.private))
+	for _, private := range s.private {
+		copied := *private
+		privates = append(privates, &copied)
+	}
+	return privates
+}
+
+func (s *memorySessionStore) AppendHistory(entry *HistoryEntry, maxEntries int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *entry
+	return s.commitLocked(storeChange{Kind: changeHistory, Key: entry.UserID, Entry: &copied, MaxEntries: maxEntries})
+}
+
+func (s *memorySessionStore) ListHistory(userID string, limit int) []*HistoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := s.history[userID]
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	result := make([]*HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		copied := *entry
+		result = append(result, &copied)
+	}
+	return result
+}
+
+func (s *memorySessionStore) GetTimer(userID string) (*PlaybackTimer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	timer, exists := s.timers[userID]
+	if !exists {
+		return nil, false
+	}
+	copied := *timer
+	return &copied, true
+}
+
+func (s *memorySessionStore) SaveTimer(timer *PlaybackTimer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *timer
+	return s.commitLocked(storeChange{Kind: changeTimer, Key: timer.UserID, Timer: &copied})
+}
+
+func (s *memorySessionStore) DeleteTimer(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.timers[userID]; !exists {
+		return nil
+	}
+	return s.commitLocked(storeChange{Kind: changeTimer, Key: userID, Deleted: true})
+}
+
+func (s *memorySessionStore) ListTimers() []*PlaybackTimer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	timers := make([]*PlaybackTimer, 0, len(s.timers))
+	for _, timer := range s.timers {
+		copied := *timer
+		timers = append(timers, &copied)
+	}
+	return timers
+}
+
+// newSessionStoreFromEnv elige el almacén según SESSION_STORE_PATH
+func newSessionStoreFromEnv() SessionStore {
+	path := os.Getenv("SESSION_STORE_PATH")
+	if path == "" {
+		log.Printf("SESSION_STORE_PATH no configurado, las sesiones se guardarán solo en memoria")
+		return NewMemorySessionStore()
+	}
+
+	store, err := NewFileSessionStore(path, envInt("SESSION_STORE_COMPACT_EVERY", 1000))
+	if err != nil {
+		log.Printf("Advertencia: no se pudo abrir el almacén de sesiones en %s: %v", path, err)
+		log.Printf("Las sesiones se guardarán solo en memoria")
+		return NewMemorySessionStore()
+	}
+	log.Printf("Almacén de sesiones persistente en %s", path)
+	return store
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeState resume el contenido del almacén para comparar antes y después de reabrirlo
+func storeState(store *memorySessionStore) map[string]string {
+	state := make(map[string]string)
+	for _, session := range store.ListSessions() {
+		state["session:"+sessionKey(session.UserID, session.DeviceID)] = session.SongID
+	}
+	for _, private := range store.ListPrivateSessions() {
+		state["private:"+private.UserID] = "on"
+	}
+	for _, timer := range store.ListTimers() {
+		state["timer:"+timer.UserID] = timer.Action
+	}
+	for _, userID := range []string{"ana", "bruno"} {
+		var songs []string
+		for _, entry := range store.ListHistory(userID, 0) {
+			songs = append(songs, entry.SongID)
+		}
+		if len(songs) > 0 {
+			state["history:"+userID] = strings.Join(songs, ",")
+		}
+	}
+	return state
+}
+
+func TestFileSessionStoreReopen(t *testing.T) {
+	tests := []struct {
+		name         string
+		compactEvery int
+		ops          func(store *memorySessionStore)
+		want         map[string]string
+	}{
+		{
+			name:         "solo diario",
+			compactEvery: 1000,
+			ops: func(store *memorySessionStore) {
+				store.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1"})
+				store.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s2"})
+				store.SaveSession(&PlaybackSession{UserID: "bruno", DeviceID: "movil", SongID: "s3"})
+				store.DeleteSession("bruno", "movil")
+				store.SavePrivateSession(&PrivateSession{UserID: "ana"})
+				store.SaveTimer(&PlaybackTimer{UserID: "ana", Action: "pause"})
+			},
+			want: map[string]string{"session:ana/web": "s2", "private:ana": "on", "timer:ana": "pause"},
+		},
+		{
+			name:         "historial recortado",
+			compactEvery: 1000,
+			ops: func(store *memorySessionStore) {
+				for _, songID := range []string{"s1", "s2", "s3", "s4"} {
+					store.AppendHistory(&HistoryEntry{UserID: "ana", SongID: songID}, 3)
+				}
+			},
+			want: map[string]string{"history:ana": "s4,s3,s2"},
+		},
+		{
+			name:         "con compactaciones intermedias",
+			compactEvery: 2,
+			ops: func(store *memorySessionStore) {
+				for _, songID := range []string{"s1", "s2", "s3", "s4", "s5"} {
+					store.AppendHistory(&HistoryEntry{UserID: "bruno", SongID: songID}, 10)
+				}
+				store.SaveTimer(&PlaybackTimer{UserID: "bruno", Action: "stop"})
+				store.DeleteTimer("bruno")
+				store.SaveSession(&PlaybackSession{UserID: "bruno", DeviceID: "web", SongID: "s5"})
+			},
+			want: map[string]string{"history:bruno": "s5,s4,s3,s2,s1", "session:bruno/web": "s5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sessions.json")
+			store, err := NewFileSessionStore(path, tt.compactEvery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.ops(store)
+			if got := storeState(store); !sameState(got, tt.want) {
+				t.Fatalf("estado en memoria = %v, se esperaba %v", got, tt.want)
+			}
+			store.journal.file.Close()
+
+			reopened, err := NewFileSessionStore(path, tt.compactEvery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.journal.file.Close()
+			if got := storeState(reopened); !sameState(got, tt.want) {
+				t.Errorf("estado recuperado = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Cada escritura agrega una línea al diario en vez de volcar todo el almacén
+func TestFileSessionStoreAppendsPerKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.journal.file.Close()
+
+	for i := 0; i < 5; i++ {
+		store.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1", StartTime: time.Now()})
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("no se esperaba instantánea antes de compactar: %v", err)
+	}
+	data, err := os.ReadFile(path + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 5 {
+		t.Errorf("el diario tiene %d líneas, se esperaban 5", lines)
+	}
+}
+
+// Si el proceso muere tras volcar la instantánea pero antes de vaciar el diario, los
+// cambios ya incluidos no se aplican dos veces; una línea a medio escribir se descarta
+func TestFileSessionStoreReplaySkipsApplied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.AppendHistory(&HistoryEntry{UserID: "ana", SongID: "s1"}, 10)
+	store.AppendHistory(&HistoryEntry{UserID: "ana", SongID: "s2"}, 10)
+	if err := writeFileAtomic(path, store.snapshotLocked()); err != nil {
+		t.Fatal(err)
+	}
+	store.AppendHistory(&HistoryEntry{UserID: "ana", SongID: "s3"}, 10)
+	store.journal.file.WriteString(`{"seq":4,"kind":"history","key":"ana","entry":{"song_`)
+	store.journal.file.Close()
+
+	reopened, err := NewFileSessionStore(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.journal.file.Close()
+	want := map[string]string{"history:ana": "s3,s2,s1"}
+	if got := storeState(reopened); !sameState(got, want) {
+		t.Errorf("estado recuperado = %v, se esperaba %v", got, want)
+	}
+}
+
+// Las sesiones que sonaban al pararse el proceso vuelven pausadas en la última posición
+// conocida: el tiempo que el servicio estuvo caído no cuenta como escuchado
+func TestFileSessionStorePausesRestoredSessions(t *testing.T) {
+	lastPlay := time.Now().Add(-time.Hour)
+	playing := func() *PlaybackSession {
+		return &PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1", SongDuration: 200,
+			AccumulatedTime: 5, IsPlaying: true, LastPlayTime: lastPlay, Position: 10}
+	}
+	tests := []struct {
+		name            string
+		snapshot        *storeSnapshot
+		journal         []storeChange
+		wantPosition    int
+		wantAccumulated int
+	}{
+		{
+			name:            "hasta la instantánea",
+			snapshot:        &storeSnapshot{SavedAt: lastPlay.Add(30 * time.Second), Sessions: map[string]*PlaybackSession{"ana/web": playing()}},
+			wantPosition:    40,
+			wantAccumulated: 35,
+		},
+		{
+			name: "hasta el último cambio del diario",
+			journal: []storeChange{
+				{Seq: 1, At: lastPlay, Kind: changeSession, Key: "ana/web", Session: playing()},
+				{Seq: 2, At: lastPlay.Add(20 * time.Second), Kind: changeTimer, Key: "bruno", Timer: &PlaybackTimer{UserID: "bruno", Action: "stop"}},
+			},
+			wantPosition:    30,
+			wantAccumulated: 25,
+		},
+		{
+			name:            "sin límite de la canción",
+			snapshot:        &storeSnapshot{SavedAt: lastPlay.Add(time.Hour), Sessions: map[string]*PlaybackSession{"ana/web": playing()}},
+			wantPosition:    200,
+			wantAccumulated: 3605,
+		},
+		{
+			name:            "archivos sin fecha",
+			snapshot:        &storeSnapshot{Sessions: map[string]*PlaybackSession{"ana/web": playing()}},
+			wantPosition:    10,
+			wantAccumulated: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sessions.json")
+			if tt.snapshot != nil {
+				if err := writeFileAtomic(path, tt.snapshot); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var journal []byte
+			for _, change := range tt.journal {
+				line, err := json.Marshal(change)
+				if err != nil {
+					t.Fatal(err)
+				}
+				journal = append(append(journal, line...), '\n')
+			}
+			if err := os.WriteFile(path+".log", journal, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Se comprueba al cargar y otra vez tras reabrir: la pausa queda en disco
+			for _, step := range []string{"al cargar", "al reabrir"} {
+				store, err := NewFileSessionStore(path, 1000)
+				if err != nil {
+					t.Fatal(err)
+				}
+				store.journal.file.Close()
+				session, ok := store.GetSession("ana", "web")
+				if !ok {
+					t.Fatalf("%s: no se recuperó la sesión", step)
+				}
+				if session.IsPlaying || session.Position != tt.wantPosition || session.AccumulatedTime != tt.wantAccumulated {
+					t.Errorf("%s: sonando %v en %d s con %d s escuchados, se esperaba pausada en %d s con %d s",
+						step, session.IsPlaying, session.Position, session.AccumulatedTime, tt.wantPosition, tt.wantAccumulated)
+				}
+			}
+		})
+	}
+}
+
+// Si no se puede escribir en el diario la memoria no cambia, igual que el disco
+func TestFileSessionStoreFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	store.journal.file.Close()
+
+	if err := store.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s2"}); err == nil {
+		t.Fatal("se esperaba un error al escribir en el diario cerrado")
+	}
+	if err := store.AppendHistory(&HistoryEntry{UserID: "ana", SongID: "s2"}, 10); err == nil {
+		t.Fatal("se esperaba un error al escribir en el diario cerrado")
+	}
+	want := map[string]string{"session:ana/web": "s1"}
+	if got := storeState(store); !sameState(got, want) || store.seq != 1 {
+		t.Errorf("estado en memoria = %v (seq %d), se esperaba %v (seq 1)", got, store.seq, want)
+	}
+}
+
+func sameState(got, want map[string]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for key, value := range want {
+		if got[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Eventos de telemetría que envía el reproductor del cliente (comando "telemetry")
+const (
+	telemetryBufferingStart  = "buffering_start"
+	telemetryBufferingEnd    = "buffering_end"
+	telemetryPlaybackError   = "playback_error"
+	telemetryStartup         = "startup"
+	telemetryRenditionSwitch = "rendition_switch"
+)
+
+// playbackErrorCodes son los códigos de "playback_error" que se cuentan por separado: los
+// de MediaError del navegador. El resto se agrupa en "other" para que un cliente no pueda
+// crear series sin límite en /metrics.
+var playbackErrorCodes = map[string]bool{
+	"MEDIA_ERR_ABORTED":           true,
+	"MEDIA_ERR_NETWORK":           true,
+	"MEDIA_ERR_DECODE":            true,
+	"MEDIA_ERR_SRC_NOT_SUPPORTED": true,
+}
+
+// playbackErrorCode normaliza el código de error del cliente
+func playbackErrorCode(code string) string {
+	switch {
+	case code == "":
+		return "unknown"
+	case playbackErrorCodes[code]:
+		return code
+	}
+	return "other"
+}
+
+// TelemetryEvent es un evento de calidad de experiencia (QoE) reportado por el cliente
+type TelemetryEvent struct {
+	Event      string `json:"event"`                // Uno de los eventos telemetry*
+	Code       string `json:"code,omitempty"`       // "playback_error": código de error del reproductor
+	DurationMs int    `json:"durationMs,omitempty"` // "startup": tiempo hasta el primer audio; "buffering_end": duración del corte
+	Rendition  string `json:"rendition,omitempty"`  // "rendition_switch": calidad nueva, p. ej. "320kbps"
+}
+
+// SessionQoE acumula la telemetría de una sesión de reproducción.
+// Es un valor (sin punteros) para respetar las copias del almacén de sesiones.
+type SessionQoE struct {
+	StartupMs         int       `json:"startup_ms,omitempty"`
+	BufferingCount    int       `json:"buffering_count,omitempty"`
+	BufferingMs       int       `json:"buffering_ms,omitempty"`
+	BufferingSince    time.Time `json:"buffering_since"` // Corte en curso (cero si no hay)
+	Errors            int       `json:"errors,omitempty"`
+	LastErrorCode     string    `json:"last_error_code,omitempty"`
+	RenditionSwitches int       `json:"rendition_switches,omitempty"`
+	Rendition         string    `json:"rendition,omitempty"`
+}
+
+// QoESummary es el resumen de calidad que acompaña al evento song_played
+type QoESummary struct {
+	StartupMs         int    `json:"Startup_Ms,omitempty"`
+	BufferingCount    int    `json:"Buffering_Count"`
+	BufferingMs       int    `json:"Buffering_Ms"`
+	Errors            int    `json:"Errors"`
+	LastErrorCode     string `json:"Last_Error_Code,omitempty"`
+	RenditionSwitches int    `json:"Rendition_Switches"`
+	Storage           string `json:"Storage,omitempty"`
+}
+
+// summary devuelve el resumen de la sesión, o nil si el cliente no envió telemetría
+func (q SessionQoE) summary(storage string, now time.Time) *QoESummary {
+	bufferingMs := q.BufferingMs
+	if !q.BufferingSince.IsZero() {
+		bufferingMs += int(now.Sub(q.BufferingSince).Milliseconds())
+	}
+	if q.StartupMs == 0 && q.BufferingCount == 0 && q.Errors == 0 && q.RenditionSwitches == 0 {
+		return nil
+	}
+	return &QoESummary{
+		StartupMs:         q.StartupMs,
+		BufferingCount:    q.BufferingCount,
+		BufferingMs:       bufferingMs,
+		Errors:            q.Errors,
+		LastErrorCode:     q.LastErrorCode,
+		RenditionSwitches: q.RenditionSwitches,
+		Storage:           storage,
+	}
+}
+
+// storageBackend identifica de dónde se sirve el audio: "s3" para claves del bucket
+// o el host de la URL cuando music-ms guarda una URL completa
+func storageBackend(audioURL string) string {
+	if audioURL == "" {
+		return "unknown"
+	}
+	if !strings.HasPrefix(audioURL, "http") {
+		return "s3"
+	}
+	parsed, err := url.Parse(audioURL)
+	if err != nil || parsed.Host == "" {
+		return "unknown"
+	}
+	return parsed.Host
+}
+
+// qoeKey agrupa las métricas por canción y almacenamiento
+type qoeKey struct {
+	SongID  string
+	Storage string
+}
+
+// qoeCounters son los contadores acumulados de una canción en un almacenamiento
+type qoeCounters struct {
+	Plays             int
+	StartupCount      int
+	StartupMs         int64
+	BufferingEvents   int
+	BufferingMs       int64
+	RenditionSwitches int
+	Errors            map[string]int // Por código de error
+}
+
+// qoeMetrics agrega la telemetría de todas las sesiones de la instancia para /metrics
+type qoeMetrics struct {
+	mu       sync.Mutex
+	counters map[qoeKey]*qoeCounters
+}
+
+var metrics = &qoeMetrics{counters: make(map[qoeKey]*qoeCounters)}
+
+// get devuelve los contadores de la clave, creándolos si no existen. Requiere m.mu tomado.
+func (m *qoeMetrics) get(key qoeKey) *qoeCounters {
+	counters, exists := m.counters[key]
+	if !exists {
+		counters = &qoeCounters{Errors: make(map[string]int)}
+		m.counters[key] = counters
+	}
+	return counters
+}
+
+func (m *qoeMetrics) recordPlay(songID, storage string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(qoeKey{songID, storage}).Plays++
+}
+
+func (m *qoeMetrics) record(key qoeKey, event TelemetryEvent, bufferingMs int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters := m.get(key)
+	switch event.Event {
+	case telemetryStartup:
+		counters.StartupCount++
+		counters.StartupMs += int64(event.DurationMs)
+	case telemetryBufferingStart:
+		counters.BufferingEvents++
+	case telemetryBufferingEnd:
+		counters.BufferingMs += int64(bufferingMs)
+	case telemetryPlaybackError:
+		counters.Errors[event.Code]++
+	case telemetryRenditionSwitch:
+		counters.RenditionSwitches++
+	}
+}
+
+// recordTelemetry aplica un evento del cliente a la sesión del dispositivo y a las métricas.
+// Solo se acepta telemetría de la canción en curso del dispositivo: sin sesión, o con el
+// songId de otra canción, el evento se descarta para que un cliente no pueda inventar
+// canciones en /metrics.
+func recordTelemetry(userID, deviceID, songID string, event TelemetryEvent) error {
+	switch event.Event {
+	case telemetryBufferingStart, telemetryBufferingEnd, telemetryPlaybackError, telemetryStartup, telemetryRenditionSwitch:
+	default:
+		return fmt.Errorf("evento de telemetría desconocido: %q", event.Event)
+	}
+	if event.Event == telemetryPlaybackError {
+		event.Code = playbackErrorCode(event.Code)
+	}
+
+	now := time.Now()
+	bufferingMs := event.DurationMs
+
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
+	if !exists {
+		sessionsMu.Unlock()
+		return fmt.Errorf("no hay reproducción en curso en el dispositivo")
+	}
+	if songID != "" && session.SongID != songID {
+		sessionsMu.Unlock()
+		return fmt.Errorf("songId %s no es la canción en curso", songID)
+	}
+	key := qoeKey{SongID: session.SongID, Storage: "unknown"}
+	if session.Storage != "" {
+		key.Storage = session.Storage
+	}
+	qoe := &session.QoE
+	switch event.Event {
+	case telemetryStartup:
+		qoe.StartupMs = event.DurationMs
+	case telemetryBufferingStart:
+		qoe.BufferingCount++
+		qoe.BufferingSince = now
+	case telemetryBufferingEnd:
+		// Si el cliente no informa la duración, se mide desde buffering_start
+		if bufferingMs == 0 && !qoe.BufferingSince.IsZero() {
+			bufferingMs = int(now.Sub(qoe.BufferingSince).Milliseconds())
+		}
+		qoe.BufferingMs += bufferingMs
+		qoe.BufferingSince = time.Time{}
+	case telemetryPlaybackError:
+		qoe.Errors++
+		qoe.LastErrorCode = event.Code
+	case telemetryRenditionSwitch:
+		qoe.RenditionSwitches++
+		qoe.Rendition = event.Rendition
+	}
+	sessionStore.SaveSession(session)
+	sessionsMu.Unlock()
+
+	if event.Event == telemetryPlaybackError {
+		log.Printf("QOE - error de reproducción user_id=%s, device_id=%s, song_id=%s, storage=%s, code=%s",
+			userID, deviceID, key.SongID, key.Storage, event.Code)
+	}
+	metrics.record(key, event, bufferingMs)
+	return nil
+}
+
+// metricsHandler expone las métricas de calidad en formato de texto de Prometheus:
+//
+//	GET /metrics
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics.mu.Lock()
+	keys := make([]qoeKey, 0, len(metrics.counters))
+	for key := range metrics.counters {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].SongID != keys[j].SongID {
+			return keys[i].SongID < keys[j].SongID
+		}
+		return keys[i].Storage < keys[j].Storage
+	})
+
+	var b strings.Builder
+	header := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	series := func(name string, value func(c *qoeCounters) float64) {
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s{%s} %g\n", name, key.labels(), value(metrics.counters[key]))
+		}
+	}
+	header("streaming_playback_starts_total", "counter", "Reproducciones iniciadas")
+	series("streaming_playback_starts_total", func(c *qoeCounters) float64 { return float64(c.Plays) })
+	header("streaming_startup_seconds", "summary", "Tiempo de arranque informado por el cliente")
+	series("streaming_startup_seconds_sum", func(c *qoeCounters) float64 { return float64(c.StartupMs) / 1000 })
+	series("streaming_startup_seconds_count", func(c *qoeCounters) float64 { return float64(c.StartupCount) })
+	header("streaming_buffering_events_total", "counter", "Cortes por buffering")
+	series("streaming_buffering_events_total", func(c *qoeCounters) float64 { return float64(c.BufferingEvents) })
+	header("streaming_buffering_seconds_total", "counter", "Tiempo total en buffering")
+	series("streaming_buffering_seconds_total", func(c *qoeCounters) float64 { return float64(c.BufferingMs) / 1000 })
+	header("streaming_rendition_switches_total", "counter", "Cambios de calidad")
+	series("streaming_rendition_switches_total", func(c *qoeCounters) float64 { return float64(c.RenditionSwitches) })
+
+	header("streaming_playback_errors_total", "counter", "Errores de reproducción por código")
+	for _, key := range keys {
+		codes := make([]string, 0, len(metrics.counters[key].Errors))
+		for code := range metrics.counters[key].Errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "streaming_playback_errors_total{%s,code=%q} %d\n",
+				key.labels(), code, metrics.counters[key].Errors[code])
+		}
+	}
+	metrics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, b.String())
+}
+
+// labels formatea las etiquetas de Prometheus de la clave (%q escapa comillas y barras)
+func (k qoeKey) labels() string {
+	return fmt.Sprintf("song_id=%q,storage=%q", k.SongID, k.Storage)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlaybackErrorCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"MEDIA_ERR_NETWORK", "MEDIA_ERR_NETWORK"},
+		{"MEDIA_ERR_SRC_NOT_SUPPORTED", "MEDIA_ERR_SRC_NOT_SUPPORTED"},
+		{"", "unknown"},
+		{"media_err_network", "other"},
+		{"código-inventado-123", "other"},
+	}
+	for _, tt := range tests {
+		if got := playbackErrorCode(tt.code); got != tt.want {
+			t.Errorf("playbackErrorCode(%q) = %q, se esperaba %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+// La telemetría solo se acepta para la canción en curso del dispositivo: el resto no crea
+// series en /metrics
+func TestRecordTelemetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		deviceID    string
+		songID      string
+		event       TelemetryEvent
+		wantErr     bool
+		wantMetrics map[qoeKey]qoeCounters
+		wantQoE     SessionQoE
+	}{
+		{
+			name:     "error con código conocido",
+			deviceID: "web",
+			songID:   "s1",
+			event:    TelemetryEvent{Event: telemetryPlaybackError, Code: "MEDIA_ERR_NETWORK"},
+			wantMetrics: map[qoeKey]qoeCounters{
+				{"s1", "s3"}: {Errors: map[string]int{"MEDIA_ERR_NETWORK": 1}},
+			},
+			wantQoE: SessionQoE{Errors: 1, LastErrorCode: "MEDIA_ERR_NETWORK"},
+		},
+		{
+			name:     "código fuera de la lista",
+			deviceID: "web",
+			event:    TelemetryEvent{Event: telemetryPlaybackError, Code: "x-1234"},
+			wantMetrics: map[qoeKey]qoeCounters{
+				{"s1", "s3"}: {Errors: map[string]int{"other": 1}},
+			},
+			wantQoE: SessionQoE{Errors: 1, LastErrorCode: "other"},
+		},
+		{
+			name:     "arranque sin songId",
+			deviceID: "web",
+			event:    TelemetryEvent{Event: telemetryStartup, DurationMs: 250},
+			wantMetrics: map[qoeKey]qoeCounters{
+				{"s1", "s3"}: {StartupCount: 1, StartupMs: 250, Errors: map[string]int{}},
+			},
+			wantQoE: SessionQoE{StartupMs: 250},
+		},
+		{
+			name:        "sin sesión en el dispositivo",
+			deviceID:    "tv",
+			songID:      "s1",
+			event:       TelemetryEvent{Event: telemetryPlaybackError, Code: "MEDIA_ERR_NETWORK"},
+			wantErr:     true,
+			wantMetrics: map[qoeKey]qoeCounters{},
+		},
+		{
+			name:        "songId de otra canción",
+			deviceID:    "web",
+			songID:      "inventada",
+			event:       TelemetryEvent{Event: telemetryStartup, DurationMs: 250},
+			wantErr:     true,
+			wantMetrics: map[qoeKey]qoeCounters{},
+		},
+		{
+			name:        "evento desconocido",
+			deviceID:    "web",
+			event:       TelemetryEvent{Event: "stall"},
+			wantErr:     true,
+			wantMetrics: map[qoeKey]qoeCounters{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousStore, previousMetrics := sessionStore, metrics
+			sessionStore = NewMemorySessionStore()
+			metrics = &qoeMetrics{counters: make(map[qoeKey]*qoeCounters)}
+			defer func() { sessionStore, metrics = previousStore, previousMetrics }()
+			sessionStore.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1", Storage: "s3",
+				IsPlaying: true, StartTime: time.Now(), LastPlayTime: time.Now()})
+
+			err := recordTelemetry("ana", tt.deviceID, tt.songID, tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("recordTelemetry error = %v, se esperaba error: %v", err, tt.wantErr)
+			}
+			got := make(map[qoeKey]qoeCounters)
+			for key, counters := range metrics.counters {
+				got[key] = *counters
+			}
+			if !reflect.DeepEqual(got, tt.wantMetrics) {
+				t.Errorf("métricas = %+v, se esperaba %+v", got, tt.wantMetrics)
+			}
+			session, _ := sessionStore.GetSession("ana", "web")
+			if session.QoE != tt.wantQoE {
+				t.Errorf("QoE de la sesión = %+v, se esperaba %+v", session.QoE, tt.wantQoE)
+			}
+		})
+	}
+}
+
+// buffering_end sin durationMs se mide desde buffering_start
+func TestRecordTelemetryMeasuresBuffering(t *testing.T) {
+	previousStore, previousMetrics := sessionStore, metrics
+	sessionStore = NewMemorySessionStore()
+	metrics = &qoeMetrics{counters: make(map[qoeKey]*qoeCounters)}
+	defer func() { sessionStore, metrics = previousStore, previousMetrics }()
+	sessionStore.SaveSession(&PlaybackSession{UserID: "ana", DeviceID: "web", SongID: "s1", IsPlaying: true})
+
+	if err := recordTelemetry("ana", "web", "s1", TelemetryEvent{Event: telemetryBufferingStart}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := recordTelemetry("ana", "web", "s1", TelemetryEvent{Event: telemetryBufferingEnd}); err != nil {
+		t.Fatal(err)
+	}
+	counters := metrics.counters[qoeKey{"s1", "unknown"}]
+	session, _ := sessionStore.GetSession("ana", "web")
+	if counters.BufferingEvents != 1 || counters.BufferingMs < 20 || session.QoE.BufferingMs < 20 || !session.QoE.BufferingSince.IsZero() {
+		t.Errorf("métricas %+v, QoE %+v: se esperaba un corte de al menos 20 ms ya cerrado", *counters, session.QoE)
+	}
+}
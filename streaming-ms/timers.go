@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Modos y acciones de los temporizadores de reproducción
+const (
+	timerModeSleep     = "sleep"       // Detener en N minutos
+	timerModeEndOfSong = "end_of_song" // Detener al terminar la canción actual
+
+	timerActionPause = "pause"
+	timerActionStop  = "stop"
+)
+
+// maxSleepTimerMinutes limita la duración de un temporizador de apagado
+const maxSleepTimerMinutes = 12 * 60
+
+// PlaybackTimer programa una pausa o detención del lado del servidor. Hay como máximo
+// uno por usuario y controla la reproducción del dispositivo que lo programó.
+// Se guarda en el almacén de sesiones para sobrevivir a reconexiones del cliente.
+type PlaybackTimer struct {
+	UserID    string     `json:"user_id"`
+	DeviceID  string     `json:"device_id"`
+	Mode      string     `json:"mode"`   // "sleep", "end_of_song"
+	Action    string     `json:"action"` // "pause", "stop"
+	SongID    string     `json:"song_id,omitempty"`
+	FiresAt   *time.Time `json:"fires_at,omitempty"` // nil mientras la canción está pausada o sin sesión
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+var (
+	// timerHandles son los time.Timer en curso por usuario
+	timerHandles = make(map[string]*time.Timer)
+	// timersMu serializa la programación, cancelación y disparo de temporizadores
+	timersMu sync.Mutex
+)
+
+// normalizeTimerAction valida la acción pedida por el cliente (por defecto "stop")
+func normalizeTimerAction(action string) (string, error) {
+	switch action {
+	case "":
+		return timerActionStop, nil
+	case timerActionPause, timerActionStop:
+		return action, nil
+	}
+	return "", fmt.Errorf("acción de temporizador inválida: %s", action)
+}
+
+// getTimer devuelve el temporizador vigente del usuario o nil
+func getTimer(userID string) *PlaybackTimer {
+	timer, exists := sessionStore.GetTimer(userID)
+	if !exists {
+		return nil
+	}
+	return timer
+}
+
+// setSleepTimer programa la pausa o detención del dispositivo dentro de minutes minutos
+func setSleepTimer(userID, deviceID string, minutes int, action string) (*PlaybackTimer, error) {
+	if minutes <= 0 || minutes > maxSleepTimerMinutes {
+		return nil, fmt.Errorf("durationMinutes debe estar entre 1 y %d", maxSleepTimerMinutes)
+	}
+	action, err := normalizeTimerAction(action)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	firesAt := now.Add(time.Duration(minutes) * time.Minute)
+	timer := &PlaybackTimer{
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Mode:      timerModeSleep,
+		Action:    action,
+		FiresAt:   &firesAt,
+		CreatedAt: now,
+	}
+
+	timersMu.Lock()
+	armTimerLocked(timer)
+	timersMu.Unlock()
+
+	log.Printf("TEMPORIZADOR PROGRAMADO - user_id=%s, device_id=%s, acción=%s, dispara=%s",
+		userID, deviceID, action, firesAt.Format(time.RFC3339))
+	broadcastTimer(userID, "Temporizador programado", timer)
+	return timer, nil
+}
+
+// setEndOfSongTimer programa la pausa o detención al terminar la canción en curso del dispositivo
+func setEndOfSongTimer(userID, deviceID, action string) (*PlaybackTimer, error) {
+	action, err := normalizeTimerAction(action)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
+	sessionsMu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("no hay canción en reproducción")
+	}
+	if session.SongDuration <= 0 {
+		return nil, fmt.Errorf("la duración de la canción es desconocida")
+	}
+
+	timer := &PlaybackTimer{
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Mode:      timerModeEndOfSong,
+		Action:    action,
+		SongID:    session.SongID,
+		CreatedAt: time.Now(),
+	}
+
+	timersMu.Lock()
+	timer.FiresAt = songEndTime(session)
+	armTimerLocked(timer)
+	timersMu.Unlock()
+
+	log.Printf("TEMPORIZADOR PROGRAMADO - user_id=%s, device_id=%s, acción=%s al terminar song_id=%s",
+		userID, deviceID, action, session.SongID)
+	broadcastTimer(userID, "Temporizador programado", timer)
+	return timer, nil
+}
+
+// cancelTimer elimina el temporizador del usuario. Devuelve false si no había ninguno.
+func cancelTimer(userID string) bool {
+	timersMu.Lock()
+	timer := getTimer(userID)
+	if timer == nil {
+		timersMu.Unlock()
+		return false
+	}
+	disarmTimerLocked(userID)
+	timersMu.Unlock()
+
+	log.Printf("TEMPORIZADOR CANCELADO - user_id=%s", userID)
+	broadcastTimer(userID, "Temporizador cancelado", nil)
+	return true
+}
+
+// songEndTime calcula cuándo termina la canción de la sesión; nil si está pausada
+func songEndTime(session *PlaybackSession) *time.Time {
+	if !session.IsPlaying {
+		return nil
+	}
+	now := time.Now()
+	remaining := session.SongDuration - session.currentPosition(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	endsAt := now.Add(time.Duration(remaining) * time.Second)
+	return &endsAt
+}
+
+// armTimerLocked guarda el temporizador y programa su disparo. Requiere timersMu tomado.
+func armTimerLocked(timer *PlaybackTimer) {
+	if handle, exists := timerHandles[timer.UserID]; exists {
+		handle.Stop()
+		delete(timerHandles, timer.UserID)
+	}
+	if err := sessionStore.SaveTimer(timer); err != nil {
+		log.Printf("Error guardando temporizador para user_id=%s: %v", timer.UserID, err)
+	}
+	if timer.FiresAt == nil {
+		return
+	}
+
+	userID := timer.UserID
+	createdAt := timer.CreatedAt
+	timerHandles[userID] = time.AfterFunc(time.Until(*timer.FiresAt), func() {
+		fireTimer(userID, createdAt)
+	})
+}
+
+// disarmTimerLocked elimina el temporizador del usuario. Requiere timersMu tomado.
+func disarmTimerLocked(userID string) {
+	if handle, exists := timerHandles[userID]; exists {
+		handle.Stop()
+		delete(timerHandles, userID)
+	}
+	if err := sessionStore.DeleteTimer(userID); err != nil {
+		log.Printf("Error eliminando temporizador para user_id=%s: %v", userID, err)
+	}
+}
+
+// refreshTimer recalcula el temporizador "al terminar la canción" cuando cambia la reproducción
+// del dispositivo (play, pausa, reanudar, seek). Si el dispositivo ya pasó a otra canción,
+// la canción del temporizador terminó y se aplica la acción.
+func refreshTimer(userID, deviceID string) {
+	timersMu.Lock()
+	timer := getTimer(userID)
+	if timer == nil || timer.Mode != timerModeEndOfSong || timer.DeviceID != deviceID {
+		timersMu.Unlock()
+		return
+	}
+
+	sessionsMu.Lock()
+	session, exists := sessionStore.GetSession(userID, deviceID)
+	sessionsMu.Unlock()
+
+	if exists && session.SongID != timer.SongID {
+		timersMu.Unlock()
+		fireTimer(userID, timer.CreatedAt)
+		return
+	}
+
+	// Sin sesión (cliente desconectado) o en pausa, el temporizador espera
+	if exists {
+		timer.FiresAt = songEndTime(session)
+	} else {
+		timer.FiresAt = nil
+	}
+	armTimerLocked(timer)
+	timersMu.Unlock()
+	broadcastTimer(userID, "Temporizador actualizado", timer)
+}
+
+// songStopped descarta el temporizador "al terminar la canción" cuando el usuario
+// detiene esa canción a mano: ya no queda canción que esperar
+func songStopped(userID, deviceID string) {
+	timersMu.Lock()
+	timer := getTimer(userID)
+	if timer == nil || timer.Mode != timerModeEndOfSong || timer.DeviceID != deviceID {
+		timersMu.Unlock()
+		return
+	}
+	disarmTimerLocked(userID)
+	timersMu.Unlock()
+
+	log.Printf("TEMPORIZADOR DESCARTADO - user_id=%s, device_id=%s: canción detenida", userID, deviceID)
+	broadcastTimer(userID, "Temporizador cancelado: la canción se detuvo", nil)
+}
+
+// fireTimer aplica la acción del temporizador si sigue siendo el vigente
+func fireTimer(userID string, createdAt time.Time) {
+	timersMu.Lock()
+	timer := getTimer(userID)
+	if timer == nil || !timer.CreatedAt.Equal(createdAt) {
+		timersMu.Unlock()
+		return
+	}
+
+	if timer.Mode == timerModeEndOfSong {
+		sessionsMu.Lock()
+		session, exists := sessionStore.GetSession(userID, timer.DeviceID)
+		sessionsMu.Unlock()
+		// Si la misma canción no ha terminado (p. ej. por un seek hacia atrás) se reprograma
+		if exists && session.SongID == timer.SongID {
+			if endsAt := songEndTime(session); endsAt == nil || time.Until(*endsAt) > time.Second {
+				timer.FiresAt = endsAt
+				armTimerLocked(timer)
+				timersMu.Unlock()
+				return
+			}
+		}
+	}
+
+	disarmTimerLocked(userID)
+	timersMu.Unlock()
+
+	log.Printf("TEMPORIZADOR DISPARADO - user_id=%s, device_id=%s, acción=%s", userID, timer.DeviceID, timer.Action)
+
+	var err error
+	if timer.Action == timerActionPause {
+		err = pausePlaybackSession(userID, timer.DeviceID)
+	} else {
+		// Finalizar la sesión envía el evento song_played con la duración real escuchada
+		err = endPlaybackSession(userID, timer.DeviceID)
+	}
+	if err != nil {
+		log.Printf("Error aplicando temporizador para user_id=%s: %v", userID, err)
+	}
+
+	clients.broadcast(userID, StreamResponse{
+		Type:     "timer_fired",
+		Message:  fmt.Sprintf("Temporizador: reproducción %s", timerActionLabel(timer.Action)),
+		Timer:    timer,
+		DeviceID: timer.DeviceID,
+	})
+}
+
+func timerActionLabel(action string) string {
+	if action == timerActionPause {
+		return "pausada"
+	}
+	return "detenida"
+}
+
+// broadcastTimer avisa a todos los dispositivos del usuario del estado del temporizador
+func broadcastTimer(userID, message string, timer *PlaybackTimer) {
+	clients.broadcast(userID, StreamResponse{
+		Type:    "timer",
+		Message: message,
+		Timer:   timer,
+	})
+}
+
+// restoreTimers reprograma los temporizadores persistidos al arrancar
+func restoreTimers() {
+	for _, timer := range sessionStore.ListTimers() {
+		if timer.Mode == timerModeEndOfSong {
+			refreshTimer(timer.UserID, timer.DeviceID)
+			continue
+		}
+		timersMu.Lock()
+		armTimerLocked(timer)
+		timersMu.Unlock()
+	}
+}
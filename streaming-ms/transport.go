@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Transport es el backend de coordinación entre instancias: registro de qué instancia
+// es propietaria de cada usuario y pub/sub para enrutar comandos y difundir mensajes.
+type Transport interface {
+	// ClaimOwner asigna el usuario a instanceID si no tiene propietario y devuelve el propietario vigente
+	ClaimOwner(userID, instanceID string, ttl time.Duration) (string, error)
+	// RefreshOwner renueva la propiedad si sigue siendo de instanceID (o la recupera si expiró)
+	RefreshOwner(userID, instanceID string, ttl time.Duration) error
+	// ReleaseOwner libera la propiedad si pertenece a instanceID
+	ReleaseOwner(userID, instanceID string) error
+	// Owner devuelve el propietario vigente sin reclamarlo ("" si no tiene)
+	Owner(userID string) (string, error)
+
+	Publish(channel string, payload []byte) error
+	// Subscribe entrega en orden los mensajes del canal al handler
+	Subscribe(channel string, handler func(payload []byte)) error
+	Close() error
+}
+
+type memoryOwner struct {
+	instanceID string
+	expiresAt  time.Time
+}
+
+// memoryTransport implementa Transport dentro del proceso. Sirve para pruebas y para
+// levantar varios coordinadores en el mismo proceso compartiendo el transporte.
+type memoryTransport struct {
+	ownersMu sync.Mutex
+	owners   map[string]memoryOwner
+
+	// subsMu se mantiene en lectura mientras se publica para que Close no cierre canales en uso
+	subsMu      sync.RWMutex
+	subscribers map[string][]chan []byte
+	closed      bool
+}
+
+// NewMemoryTransport crea un transporte en memoria
+func NewMemoryTransport() *memoryTransport {
+	return &memoryTransport{
+		owners:      make(map[string]memoryOwner),
+		subscribers: make(map[string][]chan []byte),
+	}
+}
+
+func (t *memoryTransport) ClaimOwner(userID, instanceID string, ttl time.Duration) (string, error) {
+	t.ownersMu.Lock()
+	defer t.ownersMu.Unlock()
+	now := time.Now()
+	if owner, exists := t.owners[userID]; exists && now.Before(owner.expiresAt) {
+		return owner.instanceID, nil
+	}
+	t.owners[userID] = memoryOwner{instanceID: instanceID, expiresAt: now.Add(ttl)}
+	return instanceID, nil
+}
+
+func (t *memoryTransport) RefreshOwner(userID, instanceID string, ttl time.Duration) error {
+	t.ownersMu.Lock()
+	defer t.ownersMu.Unlock()
+	now := time.Now()
+	if owner, exists := t.owners[userID]; exists && now.Before(owner.expiresAt) && owner.instanceID != instanceID {
+		return nil
+	}
+	t.owners[userID] = memoryOwner{instanceID: instanceID, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (t *memoryTransport) ReleaseOwner(userID, instanceID string) error {
+	t.ownersMu.Lock()
+	defer t.ownersMu.Unlock()
+	if owner, exists := t.owners[userID]; exists && owner.instanceID == instanceID {
+		delete(t.owners, userID)
+	}
+	return nil
+}
+
+func (t *memoryTransport) Owner(userID string) (string, error) {
+	t.ownersMu.Lock()
+	defer t.ownersMu.Unlock()
+	if owner, exists := t.owners[userID]; exists && time.Now().Before(owner.expiresAt) {
+		return owner.instanceID, nil
+	}
+	return "", nil
+}
+
+func (t *memoryTransport) Publish(channel string, payload []byte) error {
+	t.subsMu.RLock()
+	defer t.subsMu.RUnlock()
+	if t.closed {
+		return nil
+	}
+
+	copied := append([]byte(nil), payload...)
+	for _, ch := range t.subscribers[channel] {
+		ch <- copied
+	}
+	return nil
+}
+
+func (t *memoryTransport) Subscribe(channel string, handler func(payload []byte)) error {
+	ch := make(chan []byte, 256)
+	t.subsMu.Lock()
+	t.subscribers[channel] = append(t.subscribers[channel], ch)
+	t.subsMu.Unlock()
+
+	go func() {
+		for payload := range ch {
+			handler(payload)
+		}
+	}()
+	return nil
+}
+
+func (t *memoryTransport) Close() error {
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	for channel, subs := range t.subscribers {
+		for _, ch := range subs {
+			close(ch)
+		}
+		delete(t.subscribers, channel)
+	}
+	log.Printf("Transporte en memoria cerrado")
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ownerKeyPrefix es el prefijo de las claves de propiedad de usuarios en Redis
+const ownerKeyPrefix = "streaming:owner:"
+
+// subscriptionQueue es el número de mensajes de un canal que esperan a su handler
+const subscriptionQueue = 256
+
+// redisError es un error devuelto por el servidor (respuesta "-ERR ...")
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisTransport implementa Transport sobre Redis (o cualquier servidor compatible con RESP)
+// con un cliente mínimo: una conexión para comandos y otra dedicada a SUBSCRIBE. Cada canal
+// entrega sus mensajes en orden desde su propia cola, de modo que un handler lento no frena
+// al lector ni al resto de canales.
+type redisTransport struct {
+	addr string
+
+	mu     sync.Mutex // conexión de comandos
+	conn   net.Conn
+	reader *bufio.Reader
+
+	subMu   sync.Mutex // conexión de suscripción y colas
+	subConn net.Conn
+	queues  map[string]chan []byte // Cola de cada canal suscrito, que vacía su handler
+	closed  bool
+}
+
+// NewRedisTransport conecta con Redis en addr (host:puerto)
+func NewRedisTransport(addr string) (*redisTransport, error) {
+	t := &redisTransport{
+		addr:   addr,
+		queues: make(map[string]chan []byte),
+	}
+	if _, err := t.do("PING"); err != nil {
+		return nil, fmt.Errorf("error conectando con Redis en %s: %v", addr, err)
+	}
+	go t.subscribeLoop()
+	return t, nil
+}
+
+// writeCommand codifica un comando como array RESP de bulk strings
+func writeCommand(w io.Writer, args ...string) error {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readReply lee una respuesta RESP: string, redisError, int64, []byte, []interface{} o nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("respuesta RESP inválida: %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("tipo RESP desconocido: %q", kind)
+}
+
+// do ejecuta un comando en la conexión de comandos, reconectando si hace falta
+func (t *redisTransport) do(args ...string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		conn, err := net.DialTimeout("tcp", t.addr, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		t.conn = conn
+		t.reader = bufio.NewReader(conn)
+	}
+
+	t.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reply, err := func() (interface{}, error) {
+		if err := writeCommand(t.conn, args...); err != nil {
+			return nil, err
+		}
+		return readReply(t.reader)
+	}()
+	if err != nil {
+		// Conexión en estado desconocido: se descarta y se reabre en el próximo comando
+		t.conn.Close()
+		t.conn = nil
+		return nil, err
+	}
+	if redisErr, ok := reply.(redisError); ok {
+		return nil, redisErr
+	}
+	return reply, nil
+}
+
+func replyString(reply interface{}) (string, bool) {
+	switch value := reply.(type) {
+	case string:
+		return value, true
+	case []byte:
+		return string(value), true
+	}
+	return "", false
+}
+
+func (t *redisTransport) ClaimOwner(userID, instanceID string, ttl time.Duration) (string, error) {
+	key := ownerKeyPrefix + userID
+	// Dos intentos: la clave puede expirar entre el SET NX y el GET
+	for attempt := 0; attempt < 2; attempt++ {
+		reply, err := t.do("SET", key, instanceID, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+		if err != nil {
+			return "", err
+		}
+		if reply != nil {
+			return instanceID, nil
+		}
+		reply, err = t.do("GET", key)
+		if err != nil {
+			return "", err
+		}
+		if owner, ok := replyString(reply); ok {
+			return owner, nil
+		}
+	}
+	return "", fmt.Errorf("no se pudo determinar el propietario de user_id=%s", userID)
+}
+
+// refreshOwnerScript renueva la clave solo si sigue siendo de ARGV[1], o la toma si expiró.
+// GET y PEXPIRE por separado podrían renovar la propiedad que otra instancia acaba de tomar.
+const refreshOwnerScript = `
+local owner = redis.call('GET', KEYS[1])
+if owner == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if not owner then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0`
+
+// releaseOwnerScript borra la clave solo si sigue siendo de ARGV[1]
+const releaseOwnerScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+func (t *redisTransport) RefreshOwner(userID, instanceID string, ttl time.Duration) error {
+	_, err := t.do("EVAL", refreshOwnerScript, "1", ownerKeyPrefix+userID, instanceID, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (t *redisTransport) ReleaseOwner(userID, instanceID string) error {
+	_, err := t.do("EVAL", releaseOwnerScript, "1", ownerKeyPrefix+userID, instanceID)
+	return err
+}
+
+func (t *redisTransport) Owner(userID string) (string, error) {
+	reply, err := t.do("GET", ownerKeyPrefix+userID)
+	if err != nil {
+		return "", err
+	}
+	owner, _ := replyString(reply)
+	return owner, nil
+}
+
+func (t *redisTransport) Publish(channel string, payload []byte) error {
+	_, err := t.do("PUBLISH", channel, string(payload))
+	return err
+}
+
+func (t *redisTransport) Subscribe(channel string, handler func(payload []byte)) error {
+	queue := make(chan []byte, subscriptionQueue)
+	go func() {
+		for payload := range queue {
+			handler(payload)
+		}
+	}()
+
+	t.subMu.Lock()
+	defer t.subMu.Unlock()
+	if t.closed {
+		close(queue)
+		return nil
+	}
+	if previous, exists := t.queues[channel]; exists {
+		close(previous)
+	}
+	t.queues[channel] = queue
+	if t.subConn == nil {
+		// El bucle de suscripción se suscribirá a todos los canales al conectar
+		return nil
+	}
+	return writeCommand(t.subConn, "SUBSCRIBE", channel)
+}
+
+// subscribeLoop mantiene la conexión de suscripción y reparte los mensajes,
+// reconectando y volviendo a suscribirse si se pierde
+func (t *redisTransport) subscribeLoop() {
+	for {
+		t.subMu.Lock()
+		if t.closed {
+			t.subMu.Unlock()
+			return
+		}
+		t.subMu.Unlock()
+
+		if err := t.runSubscription(); err != nil {
+			t.subMu.Lock()
+			closed := t.closed
+			t.subMu.Unlock()
+			if closed {
+				return
+			}
+			log.Printf("Suscripción a Redis interrumpida: %v; reintentando en 1s", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (t *redisTransport) runSubscription() error {
+	conn, err := net.DialTimeout("tcp", t.addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	t.subMu.Lock()
+	t.subConn = conn
+	for channel := range t.queues {
+		if err := writeCommand(conn, "SUBSCRIBE", channel); err != nil {
+			t.subConn = nil
+			t.subMu.Unlock()
+			return err
+		}
+	}
+	t.subMu.Unlock()
+
+	defer func() {
+		t.subMu.Lock()
+		t.subConn = nil
+		t.subMu.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+		if kind, _ := replyString(items[0]); kind != "message" {
+			continue
+		}
+		channel, _ := replyString(items[1])
+		payload, _ := items[2].([]byte)
+
+		t.dispatch(channel, payload)
+	}
+}
+
+// dispatch encola el mensaje para el handler del canal sin bloquear al lector. Con la cola
+// llena el mensaje se descarta: esperar frenaría a todos los canales y, si el lector se
+// retrasa, Redis acaba cerrando la suscripción y se pierden todos.
+func (t *redisTransport) dispatch(channel string, payload []byte) {
+	t.subMu.Lock()
+	defer t.subMu.Unlock()
+	queue, exists := t.queues[channel]
+	if !exists {
+		return
+	}
+	select {
+	case queue <- payload:
+	default:
+		log.Printf("Cola del canal %s llena, mensaje de Redis descartado", channel)
+	}
+}
+
+func (t *redisTransport) Close() error {
+	t.subMu.Lock()
+	t.closed = true
+	if t.subConn != nil {
+		t.subConn.Close()
+	}
+	for channel, queue := range t.queues {
+		close(queue)
+		delete(t.queues, channel)
+	}
+	t.subMu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		err := t.conn.Close()
+		t.conn = nil
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+	return nil
+}
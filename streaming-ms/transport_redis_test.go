@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis acepta conexiones RESP, guarda los comandos recibidos y responde PONG a PING
+// y :1 al resto. Recuerda la conexión que se suscribió a cada canal para publicar en ella.
+type fakeRedis struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	commands    [][]string
+	subscribers map[string]net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{listener: listener, subscribers: make(map[string]net.Conn)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		var args []string
+		for _, item := range items {
+			arg, _ := replyString(item)
+			args = append(args, arg)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "SUBSCRIBE" {
+			f.mu.Lock()
+			f.subscribers[args[1]] = conn
+			f.mu.Unlock()
+			continue
+		}
+		if args[0] == "PING" {
+			conn.Write([]byte("+PONG\r\n"))
+			continue
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args)
+		f.mu.Unlock()
+		conn.Write([]byte(":1\r\n"))
+	}
+}
+
+func (f *fakeRedis) subscribed(channel string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscribers[channel] != nil
+}
+
+// publish envía un mensaje al suscriptor del canal, como hace Redis tras un PUBLISH
+func (f *fakeRedis) publish(t *testing.T, channel, payload string) {
+	t.Helper()
+	f.mu.Lock()
+	conn := f.subscribers[channel]
+	f.mu.Unlock()
+	var buf bytes.Buffer
+	buf.WriteString("*3\r\n")
+	for _, item := range []string{"message", channel, payload} {
+		buf.WriteString("$" + strconv.Itoa(len(item)) + "\r\n" + item + "\r\n")
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeRedis) received() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.commands...)
+}
+
+// Renovar y liberar deben ser un único comando: comparar y modificar por separado deja
+// una ventana en la que otra instancia puede tomar la propiedad
+func TestRedisTransportOwnerScripts(t *testing.T) {
+	tests := []struct {
+		name   string
+		call   func(transport *redisTransport) error
+		script string
+		args   []string
+	}{
+		{
+			name:   "renovar",
+			call:   func(transport *redisTransport) error { return transport.RefreshOwner("ana", "i-1", 30*time.Second) },
+			script: refreshOwnerScript,
+			args:   []string{"1", ownerKeyPrefix + "ana", "i-1", "30000"},
+		},
+		{
+			name:   "liberar",
+			call:   func(transport *redisTransport) error { return transport.ReleaseOwner("ana", "i-1") },
+			script: releaseOwnerScript,
+			args:   []string{"1", ownerKeyPrefix + "ana", "i-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeRedis(t)
+			transport, err := NewRedisTransport(server.listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer transport.Close()
+
+			if err := tt.call(transport); err != nil {
+				t.Fatal(err)
+			}
+			want := [][]string{append([]string{"EVAL", tt.script}, tt.args...)}
+			if got := server.received(); !reflect.DeepEqual(got, want) {
+				t.Errorf("comandos = %q, se esperaba %q", got, want)
+			}
+		})
+	}
+}
+
+// Un handler que no termina no debe frenar la entrega en los demás canales, y cada canal
+// mantiene el orden de sus mensajes
+func TestRedisTransportChannelsDoNotBlockEachOther(t *testing.T) {
+	server := newFakeRedis(t)
+	transport, err := NewRedisTransport(server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	var mu sync.Mutex
+	var slow, fast []string
+	transport.Subscribe("lento", func(payload []byte) {
+		mu.Lock()
+		slow = append(slow, string(payload))
+		mu.Unlock()
+		<-blocked
+	})
+	transport.Subscribe("rapido", func(payload []byte) {
+		mu.Lock()
+		fast = append(fast, string(payload))
+		mu.Unlock()
+	})
+	waitFor(t, "suscripción a los dos canales", func() bool {
+		return server.subscribed("lento") && server.subscribed("rapido")
+	})
+
+	server.publish(t, "lento", "l1")
+	server.publish(t, "lento", "l2")
+	for _, payload := range []string{"r1", "r2", "r3"} {
+		server.publish(t, "rapido", payload)
+	}
+	waitFor(t, "entrega en el canal rápido", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(fast) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"r1", "r2", "r3"}; !reflect.DeepEqual(fast, want) {
+		t.Errorf("canal rápido = %v, se esperaba %v", fast, want)
+	}
+	// El segundo mensaje del canal lento espera en su cola a que termine el primero
+	if want := []string{"l1"}; !reflect.DeepEqual(slow, want) {
+		t.Errorf("canal lento = %v, se esperaba %v", slow, want)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{"string simple", "+OK\r\n", "OK"},
+		{"error", "-ERR algo\r\n", redisError("ERR algo")},
+		{"entero", ":42\r\n", int64(42)},
+		{"bulk", "$4\r\nhola\r\n", []byte("hola")},
+		{"bulk nulo", "$-1\r\n", nil},
+		{"array", "*2\r\n$7\r\nmessage\r\n:1\r\n", []interface{}{[]byte("message"), int64(1)}},
+		{"array nulo", "*-1\r\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readReply(%q) = %#v, se esperaba %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCommand(&buf, "SET", "clave", "valor"); err != nil {
+		t.Fatal(err)
+	}
+	want := "*3\r\n$3\r\nSET\r\n$5\r\nclave\r\n$5\r\nvalor\r\n"
+	if buf.String() != want {
+		t.Errorf("writeCommand = %q, se esperaba %q", buf.String(), want)
+	}
+}